@@ -9,10 +9,12 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/NYTimes/logrotate"
@@ -33,6 +35,7 @@ import (
 	"github.com/pterodactyl/wings/remote"
 	"github.com/pterodactyl/wings/router"
 	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/server/transfer"
 	"github.com/pterodactyl/wings/sftp"
 	"github.com/pterodactyl/wings/system"
 )
@@ -288,10 +291,42 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 	}()
 
 	sys := config.Get().System
-	// Ensure the archive directory exists.
-	if err := os.MkdirAll(sys.ArchiveDirectory, 0o755); err != nil {
+	// Ensure the archive directory exists and can be written to, the files left
+	// in it are only swept if it does. Each sweep runs even if another fails.
+	if err := transfer.EnsureArchiveDirectory(); err != nil {
 		log.WithField("error", err).Error("failed to create archive directory")
+	} else {
+		if err := transfer.RemoveStaleTemporaryFiles(); err != nil {
+			log.WithField("error", err).Warn("failed to remove stale temporary transfer archives")
+		}
+		if err := transfer.RemoveStaleArchiveCheckpoints(); err != nil {
+			log.WithField("error", err).Warn("failed to remove stale transfer archive checkpoints")
+		}
+		if err := transfer.RemoveStaleUploads(); err != nil {
+			log.WithField("error", err).Warn("failed to remove stale transfer archive uploads")
+		}
+	}
+	if err := transfer.RemoveExtractionStaging(); err != nil {
+		log.WithField("error", err).Warn("failed to remove staged files of incoming transfers")
 	}
+	go transfer.RemoveStaleSourceSnapshots(cmd.Context())
+	go transfer.SweepRetainedArchives(cmd.Context())
+	go transfer.SweepPrepared(cmd.Context(), manager)
+
+	// Clean up any incoming transfers that were still running when Wings was
+	// last stopped and let the Panel know they failed.
+	go transfer.ReconcileIncoming(cmd.Context(), pclient)
+
+	// Remove any in-progress transfer archives when Wings is stopped, the
+	// signal is then raised again so the process exits as it normally would.
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-ch
+		transfer.RemoveTemporaryFiles()
+		signal.Stop(ch)
+		_ = syscall.Kill(os.Getpid(), sig.(syscall.Signal))
+	}()
 
 	// Ensure the backup directory exists.
 	if err := os.MkdirAll(sys.BackupDirectory, 0o755); err != nil {
@@ -320,6 +355,13 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		TLSConfig: config.DefaultTLSConfig,
 	}
 
+	if err := transfer.ConfigureServerTLS(s.TLSConfig); err != nil {
+		log.WithError(err).Fatal("failed to configure transfer tls settings")
+	}
+	if config.Get().System.Transfers.RequireClientCert && !autotls && !api.Ssl.Enabled {
+		log.Warn("transfers require a client certificate but the webserver is not using TLS, all incoming transfers will be rejected")
+	}
+
 	profile, _ := cmd.Flags().GetBool("pprof")
 	if profile {
 		if r, _ := cmd.Flags().GetInt("pprof-block-rate"); r > 0 {
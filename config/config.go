@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
@@ -96,6 +97,12 @@ type ApiConfiguration struct {
 
 	// A list of IP address of proxies that may send a X-Forwarded-For header to set the true clients IP
 	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
+	// AdminToken must be sent in the X-Admin-Token header, in addition to the
+	// node's authentication token, to use administrative endpoints that can
+	// leave a server in an inconsistent state, such as forcibly cleaning up a
+	// stuck transfer. If empty these endpoints are disabled.
+	AdminToken string `json:"-" yaml:"admin_token"`
 }
 
 // RemoteQueryConfiguration defines the configuration settings for remote requests
@@ -259,6 +266,687 @@ type Transfers struct {
 	//
 	// Defaults to 0 (unlimited)
 	DownloadLimit int `default:"0" yaml:"download_limit"`
+
+	// GlobalDownloadLimit imposes a Network I/O read limit shared between all
+	// transfers running on this node at the same time. The bandwidth is divided
+	// between active transfers by their priority, a high priority transfer is
+	// given twice the share of a normal one and four times that of a low one.
+	// DownloadLimit still applies to each individual transfer.
+	//
+	// If the value is less than 1, the total speed is unlimited,
+	// if the value is greater than 0, the total speed is the value in MiB/s.
+	//
+	// Defaults to 0 (unlimited)
+	GlobalDownloadLimit int `default:"0" yaml:"global_download_limit"`
+
+	// DownloadSchedule allows the download limit of each transfer to change
+	// depending on the time of day. The limit of the first window matching the
+	// current time is used, outside of every window DownloadLimit applies. The
+	// limit is re-evaluated while a transfer is running so that it changes as
+	// windows start and end.
+	//
+	//	download_schedule:
+	//	  - window: "08:00-18:00"
+	//	    limit: 50
+	DownloadSchedule []TransferScheduleWindow `yaml:"download_schedule"`
+
+	// ScheduleTimezone is the timezone used to evaluate DownloadSchedule, such
+	// as "Europe/Amsterdam". If empty the local time of the node is used.
+	ScheduleTimezone string `yaml:"schedule_timezone"`
+
+	// CompressionFormat determines how archives created for transfers are
+	// compressed.
+	//
+	// "gzip" -> compresses the archive using gzip
+	// "zstd" -> compresses the archive using zstd
+	// "tar" -> no compression, useful when the storage layer is already compressed
+	// "auto" -> samples the server's files and uses tar for data that does not
+	//           compress, zstd for data that compresses well and gzip otherwise
+	//
+	// Defaults to "gzip"
+	CompressionFormat string `default:"gzip" yaml:"compression_format"`
+
+	// CompressionSampleSize is the number of MiB read from the start of a
+	// server's files to choose the compression format when it is "auto". At
+	// most 1 MiB is taken from any one file.
+	//
+	// Defaults to 64
+	CompressionSampleSize int `default:"64" yaml:"compression_sample_size"`
+
+	// CompressionEstimate is the percentage of their original size compressible
+	// files are expected to be reduced to when estimating the size of the
+	// archive of a server. The files are never read for the estimate, so this
+	// can be tuned to the data usually stored on this node. If the value is 0
+	// the estimate assumes 30% for zstd and 35% for gzip.
+	//
+	// Defaults to 0
+	CompressionEstimate int `default:"0" yaml:"compression_estimate"`
+
+	// CompressionDictionary is the path to a zstd dictionary, trained on the
+	// files servers on this node have in common, that zstd archives are
+	// compressed and decompressed with. Both nodes must have the same
+	// dictionary, transfers compressed with a dictionary the target node does
+	// not have are rejected before anything is received. If empty archives
+	// are compressed without a dictionary.
+	CompressionDictionary string `yaml:"compression_dictionary"`
+
+	// SigningKey is the path to a file containing a base64 encoded Ed25519
+	// private key. When set, the checksum of every archive sent by this node is
+	// signed so that the target node is able to verify it came from this node.
+	SigningKey string `yaml:"signing_key"`
+
+	// RequireSignature rejects any incoming transfer that does not include a
+	// valid checksum signature from the source node. The public key of the
+	// source node is retrieved from the Panel.
+	//
+	// Defaults to false
+	RequireSignature bool `default:"false" yaml:"require_signature"`
+
+	// MinimumArchiveSize is the smallest archive in bytes that will be accepted
+	// from a source node. Anything smaller is treated as a failed transfer
+	// before it is extracted, preventing an empty server from being migrated
+	// and reported as successful.
+	//
+	// Defaults to 1 byte (only empty archives are rejected)
+	MinimumArchiveSize int `default:"1" yaml:"minimum_archive_size"`
+
+	// SizeMismatch controls what happens when the compressed size of an
+	// incoming archive, such as its Content-Length, is larger than the total
+	// size of the files it contains as advertised by the source node in the
+	// X-Total-Size header. This is a sign of a misbehaving or tampered source,
+	// but the total is taken from the cached disk usage of the server on the
+	// source node and may be out of date, so by default the mismatch is only
+	// logged. With "refuse" the transfer is refused before the archive is
+	// received, with "ignore" the sizes are not compared.
+	//
+	// Defaults to "warn"
+	SizeMismatch string `default:"warn" yaml:"size_mismatch"`
+
+	// SizeMismatchAllowance is how much larger, in MiB, the compressed size of
+	// an archive is allowed to be than the files it contains, on top of 10% of
+	// their size. This covers the headers added for every file in the archive,
+	// which can outweigh the files for servers with many tiny files or archives
+	// that are not compressed.
+	//
+	// Defaults to 64
+	SizeMismatchAllowance int `default:"64" yaml:"size_mismatch_allowance"`
+
+	// TransportCompression compresses the request an archive is sent to the
+	// target node with using gzip, when the archive itself is not compressed
+	// because its compression format is "tar" or the compression level is
+	// "none". This keeps the archive cheap to create while still reducing the
+	// amount of data sent over slow links. The request is only compressed if
+	// the target node supports it.
+	//
+	// Defaults to false
+	TransportCompression bool `default:"false" yaml:"transport_compression"`
+
+	// PreserveXattrs stores the extended attributes of the files and
+	// directories of a server in its transfer archive, and restores them when
+	// an archive is extracted. Only user attributes and POSIX ACLs, which are
+	// otherwise lost when a server is transferred, are restored. File
+	// capabilities and trusted attributes are always dropped. Attributes that
+	// cannot be restored on the target node, such as those the filesystem does
+	// not support, are logged and skipped. This must be enabled on both nodes.
+	//
+	// Defaults to false
+	PreserveXattrs bool `default:"false" yaml:"preserve_xattrs"`
+
+	// RestoreSELinuxLabels also restores the SELinux contexts stored in a
+	// transfer archive when extended attributes are preserved. This should
+	// only be enabled if both nodes use the same SELinux policy.
+	//
+	// Defaults to false
+	RestoreSELinuxLabels bool `default:"false" yaml:"restore_selinux_labels"`
+
+	// LogDirectory is the directory the log of every transfer is written to,
+	// one file per transfer for each server, containing every message sent to
+	// the console of the server during the transfer along with the time it was
+	// sent. Persisted logs can be retrieved using the
+	// /api/transfers/:server/log endpoint after the transfer has completed.
+	//
+	// Defaults to "" (transfer logs are not persisted)
+	LogDirectory string `default:"" yaml:"log_directory"`
+
+	// LogRetention is how long, in seconds, a persisted transfer log is kept
+	// after it was last written to. If the value is less than 1, logs are only
+	// removed once a server has more than LogsPerServer of them.
+	//
+	// Defaults to 604800 (7 days)
+	LogRetention int `default:"604800" yaml:"log_retention"`
+
+	// LogsPerServer is the number of persisted transfer logs kept for each
+	// server, the logs of the oldest transfers are removed first. If the value
+	// is less than 1, logs are only removed once they have expired.
+	//
+	// Defaults to 10
+	LogsPerServer int `default:"10" yaml:"logs_per_server"`
+
+	// TemporaryFilePattern is appended to the name of an archive while it is
+	// still being written. The "*" is replaced with a random string, the file
+	// is only renamed to its final name once it has been completed.
+	//
+	// Defaults to ".part-*"
+	TemporaryFilePattern string `default:".part-*" yaml:"temporary_file_pattern"`
+
+	// WriteProbePattern is the name of the file created, and removed straight
+	// away, in the data directory of a server before it is received to check
+	// the directory can be written to. The "*" is replaced with a random
+	// string. Change it if the default name is matched by something watching
+	// the data directories of servers.
+	//
+	// Defaults to ".wings-write-probe-*"
+	WriteProbePattern string `default:".wings-write-probe-*" yaml:"write_probe_pattern"`
+
+	// StagingFileName is the name given to archives staged in the archive
+	// directory, without an extension. "{server}" is replaced with the UUID of
+	// the server, "{transfer}" with a unique identifier for the transfer and
+	// "{timestamp}" with the unix time the transfer started. The name should
+	// include "{transfer}" or "{timestamp}" so that a retried transfer does not
+	// use the same file as a previous attempt that is still being cleaned up.
+	//
+	// Defaults to "{server}-{transfer}"
+	StagingFileName string `default:"{server}-{transfer}" yaml:"staging_file_name"`
+
+	// ArchiveNameTemplate is the file name archives are sent to the target
+	// node with and, if set, staged in the archive directory with instead of
+	// StagingFileName. The same placeholders as StagingFileName are supported
+	// along with "{node}", which is replaced with the UUID of this node, and
+	// "{ext}", which is replaced with the extension of the archive and is
+	// appended if it does not appear in the template. Templates that do not
+	// produce a safe file name are ignored.
+	//
+	// Defaults to ""
+	ArchiveNameTemplate string `yaml:"archive_name_template"`
+
+	// ArchiveCheckpointInterval is how much of an archive staged in the
+	// archive directory, in MiB, is written between checkpoints. If Wings
+	// stops while the archive is being created the next transfer of the
+	// server continues from the last checkpoint rather than archiving every
+	// file again, unless any of the files it covers have changed since. Only
+	// archives that are staged before being sent, such as for deduplicated
+	// and object storage transfers, can be resumed.
+	//
+	// Defaults to 0 which disables checkpoints
+	ArchiveCheckpointInterval int `default:"0" yaml:"archive_checkpoint_interval"`
+
+	// ArchiveCheckpointMaxAge is how long, in seconds, an archive checkpoint
+	// can be resumed from after it was last updated. Older checkpoints, along
+	// with the partial archive they describe, are removed when Wings starts.
+	// Archives partially uploaded to this node by a source node are kept for
+	// the same amount of time.
+	//
+	// Defaults to 86400 (24 hours)
+	ArchiveCheckpointMaxAge int `default:"86400" yaml:"archive_checkpoint_max_age"`
+
+	// ArchiveRetention is how long, in seconds, an archive staged in the
+	// archive directory is kept after the server has been transferred
+	// successfully, allowing it to be used as a short-term backup of the
+	// server. Retained archives are removed by a sweep that runs every minute
+	// once their retention period has passed. Archives of transfers that
+	// failed are always removed straight away.
+	//
+	// Defaults to 0 (archives are removed as soon as the transfer completes)
+	ArchiveRetention int `default:"0" yaml:"archive_retention"`
+
+	// PreparedRetention is how long, in seconds, an environment created ahead
+	// of a transfer waits for the files of the server to be sent. Once it has
+	// passed the environment is destroyed and the Panel is told the server is
+	// no longer being transferred. Backups received ahead of a transfer that
+	// never started are removed after the same period. If the value is less
+	// than 1, both are kept until Wings is restarted.
+	//
+	// Defaults to 3600 (1 hour)
+	PreparedRetention int `default:"3600" yaml:"prepared_retention"`
+
+	// CompressionThreads is the number of goroutines used to compress and
+	// decompress transfer archives. If the value is less than 1 the number of
+	// threads is set to GOMAXPROCS.
+	//
+	// Defaults to 0 (GOMAXPROCS)
+	CompressionThreads int `default:"0" yaml:"compression_threads"`
+
+	// ChunkVerifyWorkers is the number of goroutines used to verify and store
+	// the chunks of deduplicated transfers as they are received, so that
+	// hashing them does not slow down a fast transfer. If the value is less
+	// than 1 the number of workers is set to GOMAXPROCS.
+	//
+	// Defaults to 0 (GOMAXPROCS)
+	ChunkVerifyWorkers int `default:"0" yaml:"chunk_verify_workers"`
+
+	// ChunkVerifyMemory is the maximum number of MiB each deduplicated
+	// transfer holds in memory for chunks that are waiting to be verified.
+	// Every chunk takes up to 4 MiB, once the limit is reached the next chunk
+	// is only received when a worker has finished with a previous one. At
+	// least one chunk is always held.
+	//
+	// Defaults to 64
+	ChunkVerifyMemory int `default:"64" yaml:"chunk_verify_memory"`
+
+	// ChunkStoreSize is the maximum size in MiB of the chunks kept from
+	// deduplicated transfers. Once a transfer has been received the least
+	// recently used chunks are removed until the store is smaller than this,
+	// chunks used within the last hour are always kept. Set to 0 to never
+	// remove chunks.
+	//
+	// Defaults to 10240 (10 GiB)
+	ChunkStoreSize int `default:"10240" yaml:"chunk_store_size"`
+
+	// DeltaTransfers enables sending only the files that are missing or have
+	// changed when the destination node already has a copy of the server, for
+	// example from a previous failed transfer. If the destination does not
+	// support delta transfers a full transfer is performed instead.
+	//
+	// Defaults to false
+	DeltaTransfers bool `default:"false" yaml:"delta_transfers"`
+
+	// StopTimeout is the amount of time in seconds to wait for a server to stop
+	// gracefully before a transfer is started.
+	//
+	// Defaults to 15 seconds
+	StopTimeout int `default:"15" yaml:"stop_timeout"`
+
+	// ForceStop determines if a server that has not stopped once StopTimeout
+	// has elapsed should be killed so that the transfer can continue. If false
+	// the transfer is aborted instead.
+	//
+	// Defaults to false
+	ForceStop bool `default:"false" yaml:"force_stop"`
+
+	// BlobCache keeps the compressed contents of every file added to a gzip
+	// transfer archive so that files which have not changed are not compressed
+	// again the next time the server is archived. Blobs are stored in the
+	// "blobs" directory inside the archive directory.
+	//
+	// Defaults to false
+	BlobCache bool `default:"false" yaml:"blob_cache"`
+
+	// BlobCacheSize is the maximum size in MiB of the blob cache, the least
+	// recently used blobs are removed once it grows larger than this.
+	//
+	// Defaults to 10240 MiB (10 GiB)
+	BlobCacheSize int `default:"10240" yaml:"blob_cache_size"`
+
+	// ArchiveDirectoryQuota is the maximum size in MiB of everything stored in
+	// the archive directory by transfers. A transfer that needs to stage an
+	// archive is rejected if the space it needs would take the directory over
+	// the quota, including space reserved by other transfers that are still
+	// writing their archives. If the value is less than 1 there is no quota.
+	//
+	// Defaults to 0 (no quota)
+	ArchiveDirectoryQuota int `default:"0" yaml:"archive_directory_quota"`
+
+	// PlainLogs sends transfer logs to the server console without any ANSI
+	// color codes, for consoles and log files that are unable to display them.
+	//
+	// Defaults to false
+	PlainLogs bool `default:"false" yaml:"plain_logs"`
+
+	// Snapshots takes a copy-on-write snapshot of a server's data directory
+	// before an incoming transfer modifies it. This is only possible when the
+	// directory is the root of a btrfs subvolume or the mountpoint of a zfs
+	// dataset. If the transfer fails the directory is rolled back to the
+	// snapshot rather than being deleted.
+	//
+	// Defaults to false
+	Snapshots bool `default:"false" yaml:"snapshots"`
+
+	// SourceSnapshot archives a point-in-time view of a server being sent to
+	// another node rather than its live files. With "snapshot" a btrfs or zfs
+	// snapshot is archived when the data directory supports it, with "copy"
+	// the files are copied next to the data directory if it does not, using
+	// reflinks where possible. The live files are archived if neither can be
+	// made, or with "off".
+	//
+	// Defaults to "off"
+	SourceSnapshot string `default:"off" yaml:"source_snapshot"`
+
+	// KeepSnapshots keeps the snapshot taken before a successful transfer so
+	// that it can be rolled back to manually, for example if the server does
+	// not work correctly on this node. Snapshots must be removed manually.
+	//
+	// Defaults to false
+	KeepSnapshots bool `default:"false" yaml:"keep_snapshots"`
+
+	// LogRateLimit is the maximum number of transfer messages per second sent
+	// to the console of a server. Progress updates that arrive faster than
+	// this are coalesced so only the latest is sent, messages about the
+	// transfer moving between stages or finishing are always sent. If the
+	// value is less than 1 there is no limit.
+	//
+	// Defaults to 0 (no limit)
+	LogRateLimit int `default:"0" yaml:"log_rate_limit"`
+
+	// Proxy is the URL of a proxy that every request made by a transfer is sent
+	// through, such as "socks5://127.0.0.1:1080" or "http://proxy:3128". This
+	// includes requests to the target node and to object storage. If empty,
+	// the standard proxy environment variables are used.
+	Proxy string `yaml:"proxy"`
+
+	// AllowedHosts lists the hosts, IP addresses and CIDR ranges that archives
+	// and checksum files may be downloaded from even though they are on an
+	// internal network, such as an object store on the same LAN as this node.
+	// Download URLs are sent by other nodes, so any URL whose host resolves to
+	// a private, loopback or link-local address is refused unless it is
+	// listed here.
+	//
+	// Defaults to no internal hosts
+	AllowedHosts []string `yaml:"allowed_hosts"`
+
+	// MaxIdleConns is the maximum number of idle connections kept open by
+	// transfers across every host. If the value is 0 there is no limit.
+	//
+	// Defaults to 100
+	MaxIdleConns int `default:"100" yaml:"max_idle_conns"`
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept open
+	// by transfers to each host, such as a target node or object storage.
+	// This is higher than the default used by Go so that concurrent transfers
+	// to the same node are able to reuse connections. If the value is 0 a
+	// limit of 2 is used.
+	//
+	// Defaults to 16
+	MaxIdleConnsPerHost int `default:"16" yaml:"max_idle_conns_per_host"`
+
+	// MaxConnsPerHost is the maximum number of connections, including those
+	// in use, that transfers will open to each host. Requests wait for a
+	// connection once the limit has been reached. If the value is 0 there is
+	// no limit.
+	//
+	// Defaults to 0 (no limit)
+	MaxConnsPerHost int `default:"0" yaml:"max_conns_per_host"`
+
+	// IdleConnTimeout is the number of seconds an idle connection is kept
+	// open for before it is closed. If the value is 0 idle connections are
+	// kept open until they are closed by the other side.
+	//
+	// Defaults to 90
+	IdleConnTimeout int `default:"90" yaml:"idle_conn_timeout"`
+
+	// SocketBufferSize is the size in KiB of the read and write buffers of the
+	// connections made by transfers. Larger buffers allow a single connection
+	// to make better use of links with a high bandwidth and latency, such as
+	// between continents. The value is limited to what the kernel allows,
+	// see net.core.rmem_max and net.core.wmem_max. If the value is less than
+	// 1 the buffers are sized by the operating system.
+	//
+	// Defaults to 0 (system default)
+	SocketBufferSize int `default:"0" yaml:"socket_buffer_size"`
+
+	// ClientCert is the path to a PEM encoded certificate this node presents
+	// when connecting to other nodes for a transfer, in addition to the
+	// transfer token. ClientKey must also be set.
+	//
+	// Defaults to "" (no client certificate)
+	ClientCert string `yaml:"client_cert"`
+
+	// ClientKey is the path to the PEM encoded private key of ClientCert.
+	//
+	// Defaults to ""
+	ClientKey string `yaml:"client_key"`
+
+	// ClientCA is the path to a PEM encoded bundle of the certificate
+	// authorities used to verify the client certificates of other nodes. The
+	// webserver must be using TLS for client certificates to be sent.
+	//
+	// Defaults to ""
+	ClientCA string `yaml:"client_ca"`
+
+	// MinTLSVersion is the oldest version of TLS used for transfers, either
+	// "1.2" or "1.3". It applies to connections made by this node to other
+	// nodes and object storage, and to incoming transfer requests when the
+	// webserver terminates TLS itself.
+	//
+	// Defaults to "1.2"
+	MinTLSVersion string `default:"1.2" yaml:"min_tls_version"`
+
+	// RequireClientCert rejects incoming transfers from nodes that do not
+	// present a client certificate signed by one of the authorities in
+	// ClientCA.
+	//
+	// Defaults to false
+	RequireClientCert bool `default:"false" yaml:"require_client_cert"`
+
+	// MinFreeSpaceAfter is the amount of free space that must remain on the
+	// disk server data is extracted to once an incoming transfer has been
+	// extracted. Transfers that would leave less space free are rejected
+	// before anything is extracted. The value is either a number of bytes or
+	// a percentage of the size of the disk, such as "5%".
+	//
+	// Defaults to "" (no margin)
+	MinFreeSpaceAfter string `yaml:"min_free_space_after"`
+
+	// MaxExtractedSize is the maximum amount of data in MiB that can be
+	// extracted from an archive received from another node. Extraction is
+	// stopped and the transfer fails if the archive expands to more than
+	// this. If the value is less than 1 there is no limit.
+	//
+	// Defaults to 0 (no limit)
+	MaxExtractedSize int `default:"0" yaml:"max_extracted_size"`
+
+	// MaxCompressionRatio is the maximum number of bytes that can be extracted
+	// for each byte of an archive received from another node, protecting
+	// against archives that are built to expand to many times their size. The
+	// ratio is only checked once at least 64 MiB has been extracted. If the
+	// value is less than 1 there is no limit.
+	//
+	// Defaults to 0 (no limit)
+	MaxCompressionRatio int `default:"0" yaml:"max_compression_ratio"`
+
+	// ExtractMemoryBudget is the approximate amount of memory in MiB each
+	// incoming transfer may use to buffer data while decompressing its
+	// archive. This budget multiplied by max_concurrent should fit within the
+	// memory available to Wings. A tight budget decompresses less data ahead
+	// of the extraction, which is slower but uses less memory, and zstd
+	// archives that need more than the budget to decompress are rejected.
+	// Budgets less than 8 MiB are raised to 8 MiB. If the value is less than
+	// 1 there is no budget.
+	//
+	// Defaults to 0 (no budget)
+	ExtractMemoryBudget int `default:"0" yaml:"extract_memory_budget"`
+
+	// ImagePreflight checks that the Docker image of an incoming server is
+	// either present on this node or can be pulled from its registry before
+	// any of its files are received. Without this an image that cannot be
+	// pulled is only discovered once the archive has been extracted. The
+	// check asks the registry for the image, so transfers are refused while
+	// the registry is unreachable even if the image could be pulled later.
+	//
+	// Defaults to false
+	ImagePreflight bool `default:"false" yaml:"image_preflight"`
+
+	// PrePullImage pulls the Docker image of an incoming server while its
+	// files are being received, rather than once they have been extracted,
+	// so the environment of the server can be created without waiting for
+	// the image. Pull progress is reported in the transfer log.
+	//
+	// Defaults to false
+	PrePullImage bool `default:"false" yaml:"pre_pull_image"`
+
+	// SegmentSize splits archives sent by this node into segments of the given
+	// size in MiB, each followed by its checksum. The target node verifies
+	// every segment before it is extracted so a corrupted archive is rejected
+	// as soon as the first bad segment arrives, rather than once the whole
+	// archive has been received. The target node must support segmented
+	// archives. If the value is less than 1 archives are sent as a single
+	// stream, segments are limited to 64 MiB.
+	//
+	// Defaults to 0 (disabled)
+	SegmentSize int `default:"0" yaml:"segment_size"`
+
+	// DownloadRetries is the number of times the initial request for an
+	// archive in object storage is retried when the archive is not available
+	// yet, such as a 404 returned shortly after it was uploaded, a 503 or the
+	// connection being refused. The delay between attempts starts at one
+	// second and doubles after every attempt. Connections lost part way
+	// through a download are resumed instead, see DownloadResumes.
+	//
+	// Defaults to 3
+	DownloadRetries int `default:"3" yaml:"download_retries"`
+
+	// DownloadResumes is the number of times a download from object storage
+	// is resumed from the bytes already received when the connection is lost
+	// part way through it. The archive must not have changed since the
+	// download started, otherwise the transfer fails rather than joining two
+	// different archives together. Set to 0 to fail the transfer as soon as
+	// the connection is lost.
+	//
+	// Defaults to 3
+	DownloadResumes int `default:"3" yaml:"download_resumes"`
+
+	// UploadChunkSize is the size in MiB of the chunks an archive is sent to
+	// the target node in when a transfer uses the upload mode. A chunk that
+	// fails to be sent is continued from the last byte the target node
+	// received.
+	//
+	// Defaults to 16
+	UploadChunkSize int `default:"16" yaml:"upload_chunk_size"`
+
+	// UploadRetries is the number of times in a row a chunk of an archive sent
+	// in the upload mode is retried before the transfer fails. The delay
+	// between attempts starts at one second and doubles after every attempt.
+	//
+	// Defaults to 5
+	UploadRetries int `default:"5" yaml:"upload_retries"`
+
+	// UploadLimit imposes a Network I/O write limit in MiB/s when sending an
+	// archive to the target node in the upload mode. If the value is less
+	// than 1 uploads are not limited.
+	//
+	// Defaults to 0 (unlimited)
+	UploadLimit int `default:"0" yaml:"upload_limit"`
+
+	// PostTransferCommand is the path to an executable run on this node after
+	// a server has been received successfully, before it is started. It is
+	// passed the UUID of the server and the path to its files as arguments,
+	// which are also set as WINGS_SERVER_ID and WINGS_SERVER_PATH alongside
+	// WINGS_TRANSFER_ID and WINGS_SOURCE_NODE in its environment. The output
+	// of the command is written to the log, and a command that fails only
+	// produces a warning.
+	//
+	// Defaults to "" (disabled)
+	PostTransferCommand string `yaml:"post_transfer_command"`
+
+	// PostTransferCommandTimeout is the number of seconds the post-transfer
+	// command may run for before it is killed.
+	//
+	// Defaults to 60
+	PostTransferCommandTimeout int `default:"60" yaml:"post_transfer_command_timeout"`
+
+	// ChecksumAlgorithms lists additional algorithms used to checksum
+	// archives streamed to the target node, such as "blake2b". A SHA-256
+	// checksum is always sent for target nodes that do not support anything
+	// else, and the target node verifies the strongest checksum it supports.
+	// This allows nodes to move to a new algorithm without being upgraded at
+	// the same time.
+	//
+	// Defaults to SHA-256 only
+	ChecksumAlgorithms []string `yaml:"checksum_algorithms"`
+
+	// ExcludeFromBackups stops the archives staged by transfers from being
+	// included in server backups while they exist, in case the archive
+	// directory is within the data directory of a server.
+	//
+	// Defaults to true
+	ExcludeFromBackups bool `default:"true" yaml:"exclude_from_backups"`
+
+	// VerifyManifest sends a manifest containing the path, size and hash of
+	// every file in a server along with its archive. The target node checks
+	// the extracted files against it and fails the transfer if any file is
+	// missing, unexpected or has different contents. Every file is hashed on
+	// both nodes, which adds time to the transfer.
+	//
+	// Defaults to false
+	VerifyManifest bool `default:"false" yaml:"verify_manifest"`
+
+	// AcceptBackups allows the source node of a transfer to send the local
+	// backups of the server along with its files, they are stored in the
+	// backup directory of this node. This should be disabled if the backups
+	// of servers on this node are not kept locally, the source node then
+	// keeps the backups and continues the transfer without them.
+	//
+	// Defaults to true
+	AcceptBackups bool `default:"true" yaml:"accept_backups"`
+
+	// IntegrityScan controls whether the files of a received server are read
+	// back from the disk after it has been extracted, which finds corruption
+	// introduced while writing the files that the archive checksum cannot.
+	// With "full" every file is read, with "sample" a random selection of
+	// files is read and with "off" the scan is skipped. A file that cannot be
+	// read fails the transfer.
+	//
+	// Defaults to "off"
+	IntegrityScan string `default:"off" yaml:"integrity_scan"`
+
+	// IntegrityScanSample is the percentage of files read when the integrity
+	// scan is set to "sample".
+	//
+	// Defaults to 10
+	IntegrityScanSample int `default:"10" yaml:"integrity_scan_sample"`
+
+	// FinalizeCommand is an optional command run on the target node once the
+	// files of a server have been extracted, before the transfer is reported
+	// as successful. It receives the same arguments and environment as the
+	// post-transfer command, along with WINGS_EGG_ID. The transfer fails if
+	// the command exits with an error or times out.
+	FinalizeCommand string `yaml:"finalize_command"`
+
+	// FinalizeCommands maps the UUID of an egg to the finalize command run
+	// for servers using it, in place of FinalizeCommand.
+	FinalizeCommands map[string]string `yaml:"finalize_commands"`
+
+	// FinalizeCommandTimeout is the number of seconds the finalize command may
+	// run for before it is killed and the transfer fails.
+	//
+	// Defaults to 300
+	FinalizeCommandTimeout int `default:"300" yaml:"finalize_command_timeout"`
+
+	// CleanupFailure controls what happens to the files extracted by an
+	// incoming transfer that failed. With "retry" removing the files is
+	// attempted a few times, with "leave" it is attempted once. With
+	// "quarantine" the files are moved to the .quarantine directory within
+	// the data directory for inspection instead of being removed. Files that
+	// are left behind are logged as an error and reported to the Panel as
+	// needing attention.
+	//
+	// Defaults to "retry"
+	CleanupFailure string `default:"retry" yaml:"cleanup_failure"`
+
+	// MountPolicy controls what happens when a server with custom mounts is
+	// transferred. Only the data directory of a server is archived, the
+	// contents of its mounts are never transferred. With "warn" the transfer
+	// continues and the mounts that were left behind are reported, with
+	// "refuse" the transfer is rejected until the mounts have been removed or
+	// handled separately.
+	//
+	// Defaults to "warn"
+	MountPolicy string `default:"warn" yaml:"mount_policy"`
+
+	// MaxConcurrent is the maximum number of incoming and outgoing transfers
+	// that can run on this node at the same time. Incoming transfers received
+	// once the limit has been reached are rejected, outgoing transfers wait
+	// for a free slot. If the value is less than 1 there is no limit.
+	//
+	// Defaults to 0 (no limit)
+	MaxConcurrent int `default:"0" yaml:"max_concurrent"`
+
+	// HealthMinimumFreeSpace is the amount of free space in MiB that must be
+	// available in both the archive and data directories for the transfer
+	// health check to report this node as healthy.
+	//
+	// Defaults to 1024 MiB
+	HealthMinimumFreeSpace int `default:"1024" yaml:"health_minimum_free_space"`
+}
+
+// TransferScheduleWindow is a period of the day with its own download limit.
+type TransferScheduleWindow struct {
+	// Window is the time of day the limit applies in the format "HH:MM-HH:MM".
+	// Windows that end before they start wrap around midnight.
+	Window string `json:"window" yaml:"window"`
+
+	// Limit is the download limit in MiB/s during the window, if the value is
+	// less than 1 the download speed is unlimited.
+	Limit int `json:"limit" yaml:"limit"`
 }
 
 type ConsoleThrottles struct {
@@ -313,6 +1001,14 @@ type Configuration struct {
 	// This is required to have the "Server Mounts" feature work properly.
 	AllowedMounts []string `json:"-" yaml:"allowed_mounts"`
 
+	// MountMappings maps the source paths of mounts configured on the Panel to
+	// the path they are found at on this node, for nodes that keep shared data
+	// in a different location to other nodes. The longest matching path is
+	// replaced, for example "/mnt/shared: /data/shared" mounts
+	// "/mnt/shared/maps" from "/data/shared/maps". Mapped paths must still be
+	// within the allowed mounts.
+	MountMappings map[string]string `json:"-" yaml:"mount_mappings"`
+
 	// AllowedOrigins is a list of allowed request origins.
 	// The Panel URL is automatically allowed, this is only needed for adding
 	// additional origins.
@@ -512,12 +1208,34 @@ func FromFile(path string) error {
 	if err := yaml.Unmarshal(b, c); err != nil {
 		return err
 	}
+	if err := c.System.Transfers.validate(); err != nil {
+		return err
+	}
 
 	// Store this configuration in the global state.
 	Set(c)
 	return nil
 }
 
+// validate returns an error if any of the transfer options has a value that
+// is not recognised.
+func (t Transfers) validate() error {
+	switch t.SizeMismatch {
+	case "refuse", "warn", "ignore":
+	default:
+		return fmt.Errorf("config: invalid value for system.transfers.size_mismatch: %q, expected \"refuse\", \"warn\" or \"ignore\"", t.SizeMismatch)
+	}
+	for _, h := range t.AllowedHosts {
+		if !strings.Contains(h, "/") {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(h); err != nil {
+			return fmt.Errorf("config: invalid CIDR range in system.transfers.allowed_hosts: %q: %w", h, err)
+		}
+	}
+	return nil
+}
+
 // ConfigureDirectories ensures that all the system directories exist on the
 // system. These directories are created so that only the owner can read the data,
 // and no other users.
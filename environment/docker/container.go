@@ -147,7 +147,7 @@ func (e *Environment) Create() error {
 	}
 
 	// Try to pull the requested image before creating the container.
-	if err := e.ensureImageExists(e.meta.Image); err != nil {
+	if err := e.ensureImageExists(ctx, e.meta.Image); err != nil {
 		return errors.WithStackIf(err)
 	}
 
@@ -343,7 +343,7 @@ func (e *Environment) Readlog(lines int) ([]string, error) {
 // late, and we don't need to block all the servers from booting just because
 // of that. I'd imagine in a lot of cases an outage shouldn't affect users too
 // badly. It'll at least keep existing servers working correctly if anything.
-func (e *Environment) ensureImageExists(image string) error {
+func (e *Environment) ensureImageExists(ctx context.Context, image string) error {
 	e.Events().Publish(environment.DockerImagePullStarted, "")
 	defer e.Events().Publish(environment.DockerImagePullCompleted, "")
 
@@ -355,32 +355,11 @@ func (e *Environment) ensureImageExists(image string) error {
 	// Give it up to 15 minutes to pull the image. I think this should cover 99.8% of cases where an
 	// image pull might fail. I can't imagine it will ever take more than 15 minutes to fully pull
 	// an image. Let me know when I am inevitably wrong here...
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*15)
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*15)
 	defer cancel()
 
-	// Get a registry auth configuration from the config.
-	var registryAuth *config.RegistryConfiguration
-	for registry, c := range config.Get().Docker.Registries {
-		if !strings.HasPrefix(image, registry) {
-			continue
-		}
-
-		log.WithField("registry", registry).Debug("using authentication for registry")
-		registryAuth = &c
-		break
-	}
-
 	// Get the ImagePullOptions.
-	imagePullOptions := types.ImagePullOptions{All: false}
-	if registryAuth != nil {
-		b64, err := registryAuth.Base64()
-		if err != nil {
-			log.WithError(err).Error("failed to get registry auth credentials")
-		}
-
-		// b64 is a string so if there is an error it will just be empty, not nil.
-		imagePullOptions.RegistryAuth = b64
-	}
+	imagePullOptions := types.ImagePullOptions{All: false, RegistryAuth: registryAuth(image)}
 
 	out, err := e.client.ImagePull(ctx, image, imagePullOptions)
 	if err != nil {
@@ -436,6 +415,62 @@ func (e *Environment) ensureImageExists(image string) error {
 	return nil
 }
 
+// registryAuth returns the encoded credentials configured for the registry of
+// the image, or an empty string if there are none.
+func registryAuth(image string) string {
+	for registry, c := range config.Get().Docker.Registries {
+		if !strings.HasPrefix(image, registry) {
+			continue
+		}
+
+		log.WithField("registry", registry).Debug("using authentication for registry")
+		b64, err := c.Base64()
+		if err != nil {
+			log.WithError(err).Error("failed to get registry auth credentials")
+		}
+
+		// b64 is a string so if there is an error it will just be empty, not nil.
+		return b64
+	}
+	return ""
+}
+
+// Image returns the image the container of this environment is created from.
+func (e *Environment) Image() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.meta.Image
+}
+
+// CheckImage confirms the image of the environment is either present locally
+// or can be pulled from its registry, without pulling it. Local images, which
+// are prefixed with a ~, must be present.
+func (e *Environment) CheckImage(ctx context.Context) error {
+	image := e.Image()
+	_, _, err := e.client.ImageInspectWithRaw(ctx, strings.TrimPrefix(image, "~"))
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return errors.Wrap(err, "environment/docker: failed to inspect image")
+	}
+	if strings.HasPrefix(image, "~") {
+		return errors.Errorf("environment/docker: local image \"%s\" does not exist", strings.TrimPrefix(image, "~"))
+	}
+	if _, err := e.client.DistributionInspect(ctx, image, registryAuth(image)); err != nil {
+		return errors.Wrapf(err, "environment/docker: image \"%s\" cannot be pulled", image)
+	}
+	return nil
+}
+
+// PullImage pulls the image of the environment before its container is
+// created, in the same way the image is pulled when creating the container.
+// Progress is published to the event bus of the environment. The pull is
+// stopped if ctx is canceled.
+func (e *Environment) PullImage(ctx context.Context) error {
+	return e.ensureImageExists(ctx, e.Image())
+}
+
 func (e *Environment) convertMounts() []mount.Mount {
 	var out []mount.Mount
 
@@ -2,6 +2,7 @@ package progress
 
 import (
 	"io"
+	"math"
 	"strings"
 	"sync/atomic"
 
@@ -15,6 +16,10 @@ type Progress struct {
 	written uint64
 	// Total is the total size of the archive in bytes.
 	total uint64
+	// unknown is set when the total size cannot be known in advance.
+	unknown atomic.Bool
+	// estimated is set when the total size is only an approximation.
+	estimated atomic.Bool
 
 	// Writer .
 	Writer io.Writer
@@ -42,6 +47,41 @@ func (p *Progress) Total() uint64 {
 // being written through the progress writer.
 func (p *Progress) SetTotal(total uint64) {
 	atomic.StoreUint64(&p.total, total)
+	p.unknown.Store(false)
+	p.estimated.Store(false)
+}
+
+// SetTotalEstimate sets an approximate total size, such as when an archive is
+// compressed as it is being sent and its final size is not known. The total
+// is shown as approximate and the progress never reaches 100% until Finish is
+// called.
+func (p *Progress) SetTotalEstimate(total uint64) {
+	atomic.StoreUint64(&p.total, total)
+	p.unknown.Store(false)
+	p.estimated.Store(true)
+}
+
+// Finish replaces an approximate total with the number of bytes that were
+// written, once the operation has reached the end of its data.
+func (p *Progress) Finish() {
+	if p.estimated.Load() {
+		p.SetTotal(p.Written())
+	}
+}
+
+// SetWritten sets the number of bytes written, such as when an operation is
+// resumed part of the way through after some of the data was lost.
+func (p *Progress) SetWritten(written uint64) {
+	atomic.StoreUint64(&p.written, written)
+}
+
+// SetTotalUnknown marks the total size as unknown, such as when data is being
+// downloaded without a Content-Length. Only the number of bytes written is
+// shown until a total is set.
+func (p *Progress) SetTotalUnknown() {
+	atomic.StoreUint64(&p.total, 0)
+	p.unknown.Store(true)
+	p.estimated.Store(false)
 }
 
 // Write totals the number of bytes that have been written to the writer.
@@ -69,11 +109,28 @@ func (p *Progress) Progress(width int) string {
 
 	// Values are cast to floats to prevent integer division.
 	current := p.Written()
+	if p.unknown.Load() {
+		return system.FormatBytes(current)
+	}
 	total := p.Total()
 	// width := is passed as a parameter
 	widthPercentage := float64(100) / float64(width)
-	percentageDecimal := float64(current) / float64(total)
+	// Nothing needs to be written when the total is zero, so avoid dividing by
+	// zero and treat it as complete.
+	percentageDecimal := float64(1)
+	if total > 0 {
+		percentageDecimal = float64(current) / float64(total)
+	}
 	percentage := percentageDecimal * 100
+	// An approximate total may be smaller than the actual size, so never show
+	// it as complete and never show less than has already been written.
+	estimated := p.estimated.Load()
+	if estimated {
+		percentage = math.Min(percentage, 99)
+		if current > total {
+			total = current
+		}
+	}
 	ticks := int(percentage / widthPercentage)
 
 	// Ensure that we never get a negative number of ticks, this will prevent strings#Repeat
@@ -86,5 +143,8 @@ func (p *Progress) Progress(width int) string {
 	}
 
 	bar := strings.Repeat("=", ticks) + strings.Repeat(" ", width-ticks)
+	if estimated {
+		return "[" + bar + "] " + system.FormatBytes(current) + " / ~" + system.FormatBytes(total)
+	}
 	return "[" + bar + "] " + system.FormatBytes(current) + " / " + system.FormatBytes(total)
 }
@@ -46,5 +46,41 @@ func TestProgress(t *testing.T) {
 			g.Assert(p.Written()).Equal(uint64(len(v)))
 			g.Assert(p.Progress(25)).Equal("[=========================] 1001 B / 1000 B")
 		})
+
+		g.It("renders a progress bar for an empty archive", func() {
+			p := progress.NewProgress(0)
+			g.Assert(p.Progress(25)).Equal("[=========================] 0 B / 0 B")
+		})
+
+		g.It("renders a progress bar for a 1 byte archive", func() {
+			p := progress.NewProgress(1)
+			g.Assert(p.Progress(25)).Equal("[                         ] 0 B / 1 B")
+			_, err := p.Write([]byte{' '})
+			g.Assert(err).IsNil()
+			g.Assert(p.Progress(25)).Equal("[=========================] 1 B / 1 B")
+		})
+
+		g.It("renders only the bytes written when the total is unknown", func() {
+			p := progress.NewProgress(0)
+			p.SetTotalUnknown()
+			_, err := p.Write(bytes.Repeat([]byte{' '}, 1024))
+			g.Assert(err).IsNil()
+			g.Assert(p.Progress(25)).Equal("1.0 KiB")
+		})
+
+		g.It("renders an approximate total that is never shown as complete", func() {
+			p := progress.NewProgress(0)
+			p.SetTotalEstimate(1000)
+			_, err := p.Write(bytes.Repeat([]byte{' '}, 100))
+			g.Assert(err).IsNil()
+			g.Assert(p.Progress(25)).Equal("[==                       ] 100 B / ~1000 B")
+
+			_, err = p.Write(bytes.Repeat([]byte{' '}, 1000))
+			g.Assert(err).IsNil()
+			g.Assert(p.Progress(25)).Equal("[======================== ] 1.1 KiB / ~1.1 KiB")
+
+			p.Finish()
+			g.Assert(p.Progress(25)).Equal("[=========================] 1.1 KiB / 1.1 KiB")
+		})
 	})
 }
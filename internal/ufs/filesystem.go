@@ -152,6 +152,12 @@ type Filesystem interface {
 	// If there is an error, it will be of type *LinkError.
 	Symlink(oldname, newname string) error
 
+	// Link creates newname as a hard link to the oldname file. Both names
+	// must resolve within the filesystem.
+	//
+	// If there is an error, it will be of type *LinkError.
+	Link(oldname, newname string) error
+
 	// WalkDir walks the file tree rooted at root, calling fn for each file or
 	// directory in the tree, including root.
 	//
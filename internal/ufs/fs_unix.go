@@ -492,6 +492,52 @@ func (fs *UnixFS) Rename(oldpath, newpath string) error {
 	return unix.Renameat(olddirfd, oldname, newdirfd, newname)
 }
 
+// Link creates newpath as a hard link to the oldpath file, creating any
+// missing parent directories of newpath. Unlike a symlink both paths must
+// resolve within the filesystem, and oldpath is never followed if it is a
+// symlink itself.
+//
+// If there is an error, it will be of type *LinkError.
+func (fs *UnixFS) Link(oldpath, newpath string) error {
+	olddirfd, oldname, closeFd, err := fs.safePath(oldpath)
+	defer closeFd()
+	if err != nil {
+		return err
+	}
+	if oldname == "." {
+		return convertErrorType(&PathError{Op: "link", Path: oldpath, Err: ErrBadPathResolution})
+	}
+
+	newdirfd, newname, closeFd2, err := fs.safePath(newpath)
+	if err != nil {
+		closeFd2()
+		var pathErr *PathError
+		if !errors.Is(err, ErrNotExist) || !errors.As(err, &pathErr) {
+			return convertErrorType(err)
+		}
+		if err := fs.MkdirAll(pathErr.Path, 0o755); err != nil {
+			return err
+		}
+		newdirfd, newname, closeFd2, err = fs.safePath(newpath)
+		defer closeFd2()
+		if err != nil {
+			return err
+		}
+	} else {
+		defer closeFd2()
+	}
+	if newname == "." {
+		return convertErrorType(&PathError{Op: "link", Path: newpath, Err: ErrBadPathResolution})
+	}
+
+	if err := ignoringEINTR(func() error {
+		return unix.Linkat(olddirfd, oldname, newdirfd, newname, 0)
+	}); err != nil {
+		return &LinkError{Op: "link", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
 // Stat returns a FileInfo describing the named file.
 //
 // If there is an error, it will be of type *PathError.
@@ -1,8 +1,10 @@
 package remote
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"sync"
 
@@ -10,6 +12,7 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
+	"github.com/goccy/go-json"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -123,6 +126,69 @@ func (c *client) SetTransferStatus(ctx context.Context, uuid string, successful
 	return nil
 }
 
+// SendTransferFailure marks a transfer as failed, including how far the
+// transfer got so that the Panel is able to show where it failed.
+func (c *client) SendTransferFailure(ctx context.Context, uuid string, failure TransferFailure) error {
+	resp, err := c.Post(ctx, fmt.Sprintf("/servers/%s/transfer/failure", uuid), failure)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// SendTransferSuccess marks a transfer as successful. The idempotency key is
+// the same for every attempt at sending the notification for a transfer so the
+// Panel is able to safely ignore any duplicates. The time spent in each phase
+// of the transfer is sent along with it.
+func (c *client) SendTransferSuccess(ctx context.Context, uuid, idempotencyKey string, success TransferSuccess) error {
+	b, err := json.Marshal(success)
+	if err != nil {
+		return err
+	}
+	resp, err := c.request(ctx, http.MethodPost, fmt.Sprintf("/servers/%s/transfer/success", uuid), bytes.NewBuffer(b), func(r *http.Request) {
+		r.Header.Set("Idempotency-Key", idempotencyKey)
+	})
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// GetTransferToken requests a new token that can be used to authenticate with
+// the target node of an in-progress transfer. This is used when a transfer
+// takes longer than the lifetime of the token originally provided.
+func (c *client) GetTransferToken(ctx context.Context, uuid string) (string, error) {
+	res, err := c.Post(ctx, fmt.Sprintf("/servers/%s/transfer/token", uuid), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var data TransferTokenResponse
+	if err := res.BindJSON(&data); err != nil {
+		return "", err
+	}
+	return data.Token, nil
+}
+
+// GetNodePublicKey returns the base64 encoded public key used by the given
+// node to sign the checksums of the archives it sends during transfers.
+func (c *client) GetNodePublicKey(ctx context.Context, node string) (string, error) {
+	res, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/public-key", node), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var data NodePublicKeyResponse
+	if err := res.BindJSON(&data); err != nil {
+		return "", err
+	}
+	return data.PublicKey, nil
+}
+
 // ValidateSftpCredentials makes a request to determine if the username and
 // password combination provided is associated with a valid server on the instance
 // using the Panel's authentication control mechanisms. This will get itself
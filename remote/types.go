@@ -152,6 +152,61 @@ type ProcessConfiguration struct {
 	ConfigurationFiles []parser.ConfigurationFile `json:"configs"`
 }
 
+// TransferTokenResponse is returned by the Panel when a new token is requested
+// for an in-progress transfer.
+type TransferTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// TransferFailure describes how far a transfer got before it failed, it is
+// sent to the Panel along with the failure status.
+type TransferFailure struct {
+	// Phase is the phase of the transfer that was running when it failed.
+	Phase string `json:"phase,omitempty"`
+	// BytesTransferred is the number of bytes of the archive that were written
+	// by the source node, or received by the target node.
+	BytesTransferred uint64 `json:"bytes_transferred"`
+	// BytesTotal is the expected size of the archive, or zero if it is not
+	// known.
+	BytesTotal uint64 `json:"bytes_total"`
+	// Resumable is set if the target node kept the files it received, so
+	// retrying the transfer with delta transfers only sends what is missing.
+	Resumable bool `json:"resumable"`
+	// Cleanup is what happened to the files the target node received, one of
+	// "removed", "quarantined" or "left". It is empty if the files were kept
+	// or restored from a snapshot.
+	Cleanup string `json:"cleanup,omitempty"`
+	// CleanupPath is where the files are if they were not removed.
+	CleanupPath string `json:"cleanup_path,omitempty"`
+	// NeedsAttention is set if the files of the failed transfer were left on
+	// the target node and must be dealt with by an operator.
+	NeedsAttention bool `json:"needs_attention"`
+}
+
+// TransferSuccess is sent to the Panel when a transfer completes successfully,
+// describing where the time was spent so slow transfers can be diagnosed.
+type TransferSuccess struct {
+	// DurationSeconds is the total duration of the transfer on the target
+	// node.
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Timings is the number of seconds the target node spent in each phase
+	// of the transfer, such as "download", "checksum" and "extract".
+	Timings map[string]float64 `json:"timings"`
+	// SourceTimings is the number of seconds the source node spent in each
+	// phase of the transfer, such as "stop", "archive" and "upload". It is
+	// empty if the source node did not send its timings.
+	SourceTimings map[string]float64 `json:"source_timings,omitempty"`
+	// Backups contains the UUIDs of the backups of the server that were
+	// received by the target node during the transfer.
+	Backups []string `json:"backups,omitempty"`
+}
+
+// NodePublicKeyResponse is returned by the Panel when requesting the public key
+// of another node.
+type NodePublicKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
 type BackupRemoteUploadResponse struct {
 	Parts    []string `json:"parts"`
 	PartSize int64    `json:"part_size"`
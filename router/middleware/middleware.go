@@ -200,6 +200,24 @@ func RemoteDownloadEnabled() gin.HandlerFunc {
 	}
 }
 
+// RequireAdminToken must be used after RequireAuthorization, it additionally
+// requires the request to include the administrative token of this instance
+// and aborts the request if the token is not configured.
+func RequireAdminToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := config.Get().Api.AdminToken
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "This functionality is not currently enabled on this instance."})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Token")), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not authorized to access this endpoint."})
+			return
+		}
+		c.Next()
+	}
+}
+
 // ExtractLogger pulls the logger out of the request context and returns it. By
 // default this will include the request ID, but may also include the server ID
 // if that middleware has been used in the chain by the time it is called.
@@ -44,6 +44,11 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	router.GET("/download/file", getDownloadFile)
 	router.POST("/upload/file", postServerUploadFiles)
 
+	// Reports if the transfer subsystem on this node is able to accept new
+	// transfers, this is unauthenticated so it can be used by load balancers
+	// and only reports whether the node is healthy.
+	router.GET("/transfer/health", getTransferHealth)
+
 	// This route is special it sits above all the other requests because we are
 	// using a JWT to authorize access to it, therefore it needs to be publicly
 	// accessible.
@@ -53,6 +58,13 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	// This request does not need the AuthorizationMiddleware as the panel should never call it
 	// and requests are authenticated through a JWT the panel issues to the other daemon.
 	router.POST("/api/transfers", postTransfers)
+	router.POST("/api/transfers/chunks", postTransferChunks)
+	router.POST("/api/transfers/manifest", postTransferManifest)
+	router.POST("/api/transfers/backups", postTransferBackups)
+	router.POST("/api/transfers/environment", postTransferEnvironment)
+	router.GET("/api/transfers/version", getTransferVersion)
+	router.GET("/api/transfers/upload", getTransferUpload)
+	router.POST("/api/transfers/upload", postTransferUpload)
 
 	// All the routes beyond this mount will use an authorization middleware
 	// and will not be accessible without the correct Authorization header provided.
@@ -61,7 +73,15 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	protected.GET("/api/system", getSystemInformation)
 	protected.GET("/api/servers", getAllServers)
 	protected.POST("/api/servers", postCreateServer)
+	protected.GET("/api/transfers", getTransfers)
+	protected.GET("/api/transfers/config", getTransferConfig)
+	protected.GET("/api/transfers/health", getTransferHealthDetails)
+	protected.GET("/api/transfers/archives", getTransferArchives)
+	protected.DELETE("/api/transfers/archives/:server", deleteTransferArchives)
+	protected.POST("/api/transfers/selftest", postTransferSelfTest)
 	protected.DELETE("/api/transfers/:server", deleteTransfer)
+	protected.GET("/api/transfers/:server/log", getTransferLog)
+	protected.POST("/api/transfers/:server/cleanup", middleware.RequireAdminToken(), postTransferCleanup)
 
 	// These are server specific routes, and require that the request be authorized, and
 	// that the server exist on the Daemon.
@@ -82,7 +102,10 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 		// This archive request causes the archive to start being created
 		// this should only be triggered by the panel.
 		server.POST("/transfer", postServerTransfer)
+		server.POST("/transfer/environment", postServerTransferEnvironment)
 		server.DELETE("/transfer", deleteServerTransfer)
+		server.HEAD("/transfer/archive", headServerTransferArchive)
+		server.GET("/archive/estimate", getServerArchiveEstimate)
 
 		files := server.Group("/files")
 		{
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
@@ -17,6 +18,10 @@ import (
 	"github.com/pterodactyl/wings/server/transfer"
 )
 
+// deleteTransferTimeout is how long deleting a server waits for a transfer of
+// the server that was aborted to stop before its files are removed.
+const deleteTransferTimeout = 30 * time.Second
+
 // Returns a single server from the collection of servers.
 func getServer(c *gin.Context) {
 	c.JSON(http.StatusOK, ExtractServer(c).ToAPIResponse())
@@ -192,6 +197,23 @@ func postServerReinstall(c *gin.Context) {
 func deleteServer(c *gin.Context) {
 	s := middleware.ExtractServer(c)
 
+	// Removing the files of a server while a transfer is reading or writing
+	// them would leave either node in an inconsistent state. The transfer must
+	// be cancelled first, unless the deletion is forced in which case it is
+	// aborted and the Panel is told it failed.
+	if t := transfer.Running(s.ID()); t != nil {
+		if c.Query("force") != "true" && t.Status() != transfer.StatusCancelling {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "This server is currently being transferred, cancel the transfer before deleting it.",
+			})
+			return
+		}
+		t.Log().Warn("server is being deleted, aborting transfer")
+		if !t.AbortForDeletion(deleteTransferTimeout) {
+			t.Log().WithField("timeout", deleteTransferTimeout).Warn("transfer did not stop in time, deleting server anyway")
+		}
+	}
+
 	// Immediately suspend the server to prevent a user from attempting
 	// to start it while this process is running.
 	s.Config().SetSuspended(true)
@@ -3,12 +3,16 @@ package router
 import (
 	"context"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"emperror.dev/errors"
+	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
 
+	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/environment"
 	"github.com/pterodactyl/wings/router/middleware"
 	"github.com/pterodactyl/wings/server"
@@ -21,9 +25,76 @@ type serverTransferRequest struct {
 	URL    string                  `binding:"required" json:"url"`
 	Token  string                  `binding:"required" json:"token"`
 	Server installer.ServerDetails `json:"server"`
+
+	// ObjectStorage is set by the Panel when the archive should be routed
+	// through an S3-compatible bucket rather than being streamed directly to
+	// the target node.
+	ObjectStorage *transfer.ObjectStorage `json:"object_storage"`
+
+	// Deduplicate enables the content-addressed chunk mode, where only the
+	// chunks of the archive the target node does not already have are sent.
+	Deduplicate bool `json:"deduplicate"`
+
+	// Upload enables the upload mode, where the archive is created on this
+	// node first and then sent to the target node in chunks that are
+	// continued from where they stopped if the connection is lost. This is
+	// intended for networks where long-lived connections are unreliable.
+	Upload bool `json:"upload"`
+
+	// Priority controls the order transfers are started in when every transfer
+	// slot on this node is in use, it is one of "low", "normal" or "high". It
+	// is also sent to the target node, where higher priority transfers are
+	// given a larger share of the global download limit.
+	Priority string `json:"priority"`
+
+	// AutoStart starts the server on the target node once the transfer has
+	// completed successfully.
+	AutoStart bool `json:"auto_start"`
+
+	// Include and Exclude are glob patterns, relative to the root of the
+	// server, limiting the files that are transferred.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+
+	// Backups contains the UUIDs of the local backups of the server to send
+	// to the target node before its files. No backups are sent unless they
+	// are listed, as they can make the transfer considerably larger.
+	Backups []string `json:"backups"`
+}
+
+// stopServerForTransfer waits for the server to stop gracefully, and if it has
+// not stopped in time and force stopping is enabled, kills it instead.
+func stopServerForTransfer(s *server.Server) error {
+	cfg := config.Get().System.Transfers
+	timeout := time.Duration(cfg.StopTimeout) * time.Second
+	logger := s.Log().WithField("subsystem", "transfer").WithField("timeout", timeout)
+
+	err := s.Environment.WaitForStop(s.Context(), timeout, false)
+	if err == nil || isNoSuchContainer(err) {
+		logger.Info("server stopped gracefully for transfer")
+		return nil
+	}
+	if !cfg.ForceStop {
+		return err
+	}
+
+	logger.WithError(err).Warn("server did not stop gracefully in time, killing it to continue the transfer")
+	if err := s.Environment.Terminate(s.Context(), os.Kill); err != nil && !isNoSuchContainer(err) {
+		return err
+	}
+	logger.Info("server was killed for transfer")
+	return nil
+}
+
+// isNoSuchContainer returns true if the error is caused by the container not
+// existing, which means the server is already stopped.
+func isNoSuchContainer(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "no such container")
 }
 
-// postServerTransfer handles the start of a transfer for a server.
+// postServerTransfer handles the start of a transfer for a server. If the force
+// query parameter is "true", the archive is rebuilt from the current files of
+// the server without using the blob cache or resuming an archive checkpoint.
 func postServerTransfer(c *gin.Context) {
 	var data serverTransferRequest
 	if err := c.BindJSON(&data); err != nil {
@@ -42,10 +113,80 @@ func postServerTransfer(c *gin.Context) {
 		return
 	}
 
+	// Make sure every URL the Panel sent can be requested before anything is
+	// done to the server, rather than failing once it has been stopped.
+	urls := []string{data.URL}
+	if data.ObjectStorage.Valid() {
+		urls = append(urls, data.ObjectStorage.UploadURL, data.ObjectStorage.DownloadURL)
+		if data.ObjectStorage.ChecksumUploadURL != "" && data.ObjectStorage.ChecksumDownloadURL != "" {
+			urls = append(urls, data.ObjectStorage.ChecksumUploadURL, data.ObjectStorage.ChecksumDownloadURL)
+		}
+	}
+	for _, v := range urls {
+		if err := transfer.ValidateURL(v); err != nil {
+			s.Log().WithField("subsystem", "transfer").WithError(err).Warn("refusing transfer with an invalid url")
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	filter, err := transfer.NewPathFilter(s.Filesystem().Path(), data.Include, data.Exclude)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	backups, err := transfer.ParseBackups(data.Backups)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// The contents of custom mounts are not included in the archive, make sure
+	// this does not go unnoticed.
+	mounts := transfer.Mounts(s)
+	if len(mounts.Excluded) > 0 && transfer.RefusesMounts() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":  "This server has custom mounts which cannot be transferred.",
+			"mounts": mounts,
+		})
+		return
+	}
+
+	// Transfers that stage the archive on the disk need a writable archive
+	// directory, check this now rather than after the server has been stopped.
+	if data.ObjectStorage.Valid() || data.Upload || data.Deduplicate {
+		if err := transfer.EnsureArchiveDirectory(); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		size, err := s.Filesystem().DiskUsage(true)
+		if err == nil {
+			err = transfer.HasArchiveSpace(s.ID(), size)
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, transfer.ErrArchiveQuotaExceeded) {
+				status = http.StatusInsufficientStorage
+			}
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
 	manager := middleware.ExtractManager(c)
 
-	notifyPanelOfFailure := func() {
-		if err := manager.Client().SetTransferStatus(context.Background(), s.ID(), false); err != nil {
+	notifyPanelOfFailure := func(trnsfr *transfer.Transfer) {
+		if err := manager.Client().SendTransferFailure(context.Background(), s.ID(), trnsfr.Failure(transfer.DirectionOutgoing)); err != nil {
 			s.Log().WithField("subsystem", "transfer").
 				WithField("status", false).
 				WithError(err).
@@ -59,30 +200,83 @@ func postServerTransfer(c *gin.Context) {
 	// Block the server from starting while we are transferring it.
 	s.SetTransferring(true)
 
-	// Ensure the server is offline. Sometimes a "No such container" error gets through
-	// which means the server is already stopped. We can ignore that.
-	if s.Environment.State() != environment.ProcessOfflineState {
-		if err := s.Environment.WaitForStop(
-			s.Context(),
-			time.Second*15,
-			false,
-		); err != nil && !strings.Contains(strings.ToLower(err.Error()), "no such container") {
-			s.SetTransferring(false)
-			middleware.CaptureAndAbort(c, errors.Wrap(err, "failed to stop server for transfer"))
-			return
-		}
-	}
-
 	// Create a new transfer instance for this server.
 	trnsfr := transfer.New(context.Background(), s)
+	trnsfr.SetSourceNode(config.Get().Uuid)
+	trnsfr.SetAutoStart(data.AutoStart)
+	trnsfr.SetPriority(transfer.ParsePriority(data.Priority))
+	trnsfr.SetPathFilter(filter)
+	trnsfr.SetForce(c.Query("force") == "true")
+	trnsfr.SetTokenRefresh(func(ctx context.Context) (string, error) {
+		return manager.Client().GetTransferToken(ctx, s.ID())
+	})
 	transfer.Outgoing().Add(trnsfr)
 
+	for _, m := range mounts.Excluded {
+		trnsfr.Log().WithFields(log.Fields{"source": m.Source, "target": m.Target}).Warn("custom mount will not be transferred")
+		trnsfr.SendMessage("Warning: the contents of the mount " + m.Source + " -> " + m.Target + " are not included in the transfer and must be copied to the target node separately.")
+	}
+
 	go func() {
 		defer transfer.Outgoing().Remove(trnsfr)
 
-		if _, err := trnsfr.PushArchiveToTarget(data.URL, data.Token); err != nil {
-			notifyPanelOfFailure()
+		// Wait for a transfer slot if this node is already running the maximum
+		// number of transfers.
+		err := trnsfr.Acquire(trnsfr.Context())
+		if err == nil {
+			defer trnsfr.Release()
+
+			// Agree on the features that can be used with the target node
+			// before anything is sent to it, and before the server is stopped
+			// so it keeps running if the target cannot be reached.
+			err = trnsfr.NegotiateVersion(data.URL, data.Token)
+		}
+		if err == nil {
+			// Send the backups of the server first, the target node reports
+			// the transfer as successful as soon as it has the server's files.
+			// They do not change while the server is running, so they are sent
+			// before it is stopped to keep the downtime of the server short.
+			err = trnsfr.PushBackups(data.URL, data.Token, backups)
+		}
+		if err == nil {
+			// Ensure the server is offline, this is only done once the transfer
+			// has a slot so the server keeps running while it is queued.
+			// Sometimes a "No such container" error gets through which means
+			// the server is already stopped. We can ignore that.
+			stopStarted := time.Now()
+			if s.Environment.State() != environment.ProcessOfflineState {
+				if err = stopServerForTransfer(s); err != nil {
+					err = errors.Wrap(err, "failed to stop server for transfer")
+				}
+			}
+			trnsfr.Timings().Add(transfer.PhaseStop, time.Since(stopStarted))
+		}
+		if err == nil {
+			// Archive a point-in-time view of the server if configured to.
+			trnsfr.SnapshotSource(trnsfr.Context())
+			defer trnsfr.ReleaseSource()
+
+			switch {
+			case data.ObjectStorage.Valid():
+				_, err = trnsfr.PushArchiveToObjectStorage(data.URL, data.Token, *data.ObjectStorage)
+			case data.Upload:
+				_, err = trnsfr.PushArchiveUploaded(data.URL, data.Token)
+			case data.Deduplicate:
+				_, err = trnsfr.PushArchiveDeduplicated(data.URL, data.Token)
+			case config.Get().System.Transfers.DeltaTransfers:
+				_, err = trnsfr.PushDeltaToTarget(data.URL, data.Token)
+			default:
+				_, err = trnsfr.PushArchiveToTarget(data.URL, data.Token)
+			}
+			trnsfr.LogExcluded()
+		}
+		if err != nil {
+			notifyPanelOfFailure(trnsfr)
 
+			if trnsfr.Deleted() {
+				trnsfr.Log().Warn("transfer aborted as the server was deleted")
+				return
+			}
 			if err == context.Canceled {
 				trnsfr.Log().Debug("canceled")
 				trnsfr.SendMessage("Canceled.")
@@ -99,10 +293,60 @@ func postServerTransfer(c *gin.Context) {
 		// the server state on the destination node, we just need to make sure
 		// we clean up our statuses for failure.
 
+		trnsfr.LogTimings()
 		trnsfr.Log().Debug("transfer complete")
 	}()
 
-	c.Status(http.StatusAccepted)
+	c.JSON(http.StatusAccepted, gin.H{
+		"transfer_id": trnsfr.ID(),
+		"mounts":      mounts,
+	})
+}
+
+// Data passed over to prepare the environment of a server on the target node
+// ahead of its transfer.
+type serverTransferEnvironmentRequest struct {
+	URL   string `binding:"required" json:"url"`
+	Token string `binding:"required" json:"token"`
+}
+
+// postServerTransferEnvironment asks the target node to create the environment
+// of the server without sending any of its files. The server is left running,
+// allowing the Panel to do this well before the transfer itself so that only
+// the files need to be sent while the server is offline.
+func postServerTransferEnvironment(c *gin.Context) {
+	var data serverTransferEnvironmentRequest
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	s := ExtractServer(c)
+	if s.IsTransferring() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A transfer is already in progress for this server.",
+		})
+		return
+	}
+	if err := transfer.ValidateURL(data.URL); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	trnsfr := transfer.New(c.Request.Context(), s)
+	trnsfr.SetSourceNode(config.Get().Uuid)
+	if err := trnsfr.PrepareEnvironment(c.Request.Context(), data.URL, data.Token); err != nil {
+		if errors.Is(err, transfer.ErrEnvironmentUnsupported) {
+			c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{
+				"error": "The target node does not support preparing environments ahead of a transfer.",
+			})
+			return
+		}
+		middleware.CaptureAndAbort(c, errors.Wrap(err, "failed to prepare environment on target node"))
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 // deleteServerTransfer cancels an outgoing transfer for a server.
@@ -128,3 +372,57 @@ func deleteServerTransfer(c *gin.Context) {
 
 	c.Status(http.StatusAccepted)
 }
+
+// headServerTransferArchive returns the checksum, size and mime type of the
+// archive staged for the server without sending the archive itself, allowing
+// the Panel to confirm the archive is intact before starting a transfer. The
+// archive is never read while handling the request. A 202 is returned while
+// the archive is still being staged by a transfer, or while its checksum is
+// being calculated, in which case only what is already known is sent.
+func headServerTransferArchive(c *gin.Context) {
+	s := ExtractServer(c)
+
+	meta, err := transfer.StagedArchiveMetadata(s.ID())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			if transfer.Outgoing().Get(s.ID()) != nil {
+				c.Status(http.StatusAccepted)
+				return
+			}
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.Header("X-Mime-Type", meta.MimeType)
+	c.Header("Content-Length", strconv.FormatInt(meta.Size, 10))
+	if meta.Checksum == "" {
+		c.Status(http.StatusAccepted)
+		return
+	}
+	c.Header("X-Checksum", meta.Checksum)
+	c.Status(http.StatusOK)
+}
+
+// getServerArchiveEstimate returns the estimated size of the archive that would
+// be created to transfer the server, allowing the Panel to check the target
+// node has enough space before starting the transfer.
+func getServerArchiveEstimate(c *gin.Context) {
+	s := ExtractServer(c)
+
+	estimate, err := transfer.EstimateArchive(c.Request.Context(), s)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The data directory for this server does not exist.",
+			})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
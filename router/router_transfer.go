@@ -1,10 +1,7 @@
 package router
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -12,43 +9,284 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
 	"github.com/google/uuid"
 
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/environment"
 	"github.com/pterodactyl/wings/router/middleware"
 	"github.com/pterodactyl/wings/router/tokens"
 	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/server/filesystem"
 	"github.com/pterodactyl/wings/server/installer"
 	"github.com/pterodactyl/wings/server/transfer"
+	"github.com/pterodactyl/wings/system"
 )
 
-// postTransfers .
-func postTransfers(c *gin.Context) {
+// parseTransferToken validates the transfer JWT sent by the source node and
+// returns it along with the UUID of the server being transferred. Tokens that
+// have already been used to complete a transfer are rejected. If false is
+// returned the request has already been aborted.
+func parseTransferToken(c *gin.Context) (*tokens.TransferPayload, uuid.UUID, bool) {
+	if err := transfer.RequireClientCertificate(c.Request); err != nil {
+		log.WithField("remote_addr", c.ClientIP()).Warn("rejecting transfer request without a valid client certificate")
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "A valid client certificate is required to transfer servers to this node.",
+		})
+		return nil, uuid.UUID{}, false
+	}
+	if err := transfer.RequireTLSVersion(c.Request); err != nil {
+		log.WithField("remote_addr", c.ClientIP()).WithError(err).Warn("rejecting transfer request made over an older version of TLS")
+		c.AbortWithStatusJSON(http.StatusUpgradeRequired, gin.H{
+			"error": "Transfers to this node must use a newer version of TLS: " + err.Error(),
+		})
+		return nil, uuid.UUID{}, false
+	}
+
 	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
 	if len(auth) != 2 || auth[0] != "Bearer" {
 		c.Header("WWW-Authenticate", "Bearer")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"error": "The required authorization heads were not present in the request.",
 		})
-		return
+		return nil, uuid.UUID{}, false
 	}
 
 	token := tokens.TransferPayload{}
 	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
 		middleware.CaptureAndAbort(c, err)
+		return nil, uuid.UUID{}, false
+	}
+	if token.IsConsumed() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "This transfer token has already been used.",
+		})
+		return nil, uuid.UUID{}, false
+	}
+
+	u, err := uuid.Parse(token.Subject)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return nil, uuid.UUID{}, false
+	}
+	return &token, u, true
+}
+
+// getTransferVersion returns the range of transfer versions this node
+// supports, allowing the source node to only use features this node is able
+// to handle.
+func getTransferVersion(c *gin.Context) {
+	if _, _, ok := parseTransferToken(c); !ok {
+		return
+	}
+
+	c.Header(transfer.VersionHeader, strconv.Itoa(transfer.Version))
+	c.JSON(http.StatusOK, transfer.Versions())
+}
+
+// postTransferChunks returns the chunks of a deduplicated transfer that are not
+// already present in the chunk store of this node.
+func postTransferChunks(c *gin.Context) {
+	if _, _, ok := parseTransferToken(c); !ok {
+		return
+	}
+
+	var data transfer.ChunksRequest
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	cs, err := transfer.NewChunkStore()
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer.ChunksResponse{Missing: cs.Missing(data.Chunks)})
+}
+
+// postTransferManifest returns the files this node already has for the server
+// being transferred so that the source node is able to send only the files that
+// are missing or have changed.
+func postTransferManifest(c *gin.Context) {
+	_, u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+
+	manifest, err := transfer.BuildManifest(c.Request.Context(), filepath.Join(config.Get().System.Data, u.String()))
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// getTransferUpload returns how much of an archive the source node has
+// uploaded for the server being transferred.
+func getTransferUpload(c *gin.Context) {
+	_, u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+
+	status, err := transfer.Upload(u.String(), c.GetHeader(transfer.UploadChecksumHeader))
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// postTransferUpload receives a chunk of an archive uploaded by the source
+// node, the server is only transferred once the source node sends the
+// transfer request referencing the completed upload.
+func postTransferUpload(c *gin.Context) {
+	_, u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader(transfer.UploadOffsetHeader), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The upload offset header is missing or invalid.",
+		})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader(transfer.UploadLengthHeader), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The upload length header is missing or invalid.",
+		})
+		return
+	}
+
+	status, err := transfer.ReceiveUpload(c.Request.Context(), u.String(), c.GetHeader(transfer.UploadChecksumHeader), offset, length, c.Request.Body)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, status)
+	case errors.Is(err, transfer.ErrUploadOffset):
+		c.AbortWithStatusJSON(http.StatusConflict, status)
+	case errors.Is(err, transfer.ErrUploadLength):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, transfer.ErrUploadChecksum):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, transfer.ErrArchiveQuotaExceeded):
+		c.AbortWithStatusJSON(http.StatusInsufficientStorage, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		middleware.CaptureAndAbort(c, err)
+	}
+}
+
+// postTransferBackups stores a backup of the server being transferred, these
+// are sent by the source node before the files of the server itself.
+func postTransferBackups(c *gin.Context) {
+	_, u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+
+	err := transfer.ReceiveBackup(u.String(), c.GetHeader(transfer.BackupHeader), c.GetHeader(transfer.BackupChecksumHeader), c.Request.Body)
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, transfer.ErrBackupsUnsupported):
+		c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{
+			"error": "This node does not accept the backups of transferred servers.",
+		})
+	case errors.Is(err, transfer.ErrBackupExists):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, transfer.ErrBackupChecksum):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		middleware.CaptureAndAbort(c, err)
+	}
+}
+
+// postTransferEnvironment fetches the configuration of the server being
+// transferred and creates its environment, without receiving any of its
+// files. The server is kept marked as transferring until its files are sent
+// to postTransfers, which then uses the environment created here.
+func postTransferEnvironment(c *gin.Context) {
+	_, u, ok := parseTransferToken(c)
+	if !ok {
 		return
 	}
 
 	manager := middleware.ExtractManager(c)
-	u, err := uuid.Parse(token.Subject)
+	logger := log.WithField("subsystem", "transfer").WithField("server", u.String())
+
+	if transfer.IsPrepared(u.String()) {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if transfer.Incoming().Get(u.String()) != nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "This server is already being transferred to this node.",
+		})
+		return
+	}
+	if _, ok := manager.Get(u.String()); ok {
+		logger.Warn("refusing to prepare environment for a server that already exists on this node")
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "This server already exists on the target node.",
+		})
+		return
+	}
+
+	i, err := installer.New(c.Request.Context(), manager, installer.ServerDetails{
+		UUID:              u.String(),
+		StartOnCompletion: false,
+	})
 	if err != nil {
 		middleware.CaptureAndAbort(c, err)
 		return
 	}
 
+	s := i.Server()
+	s.SetTransferring(true)
+	manager.Add(s)
+	if err := s.CreateEnvironment(); err != nil {
+		manager.Remove(func(match *server.Server) bool {
+			return match.ID() == s.ID()
+		})
+		logger.WithError(err).Error("failed to prepare environment for transfer")
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	transfer.AddPrepared(s)
+	logger.Info("prepared environment for server ahead of its transfer")
+
+	c.Status(http.StatusNoContent)
+}
+
+// postTransfers .
+func postTransfers(c *gin.Context) {
+	token, u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+
+	manager := middleware.ExtractManager(c)
+
 	// Get or create a new transfer instance for this server.
 	var (
 		ctx    context.Context
@@ -56,30 +294,72 @@ func postTransfers(c *gin.Context) {
 	)
 	trnsfr := transfer.Incoming().Get(u.String())
 	if trnsfr == nil {
+		// Refuse to accept the transfer if this node is already running the
+		// server, the incoming data would otherwise be written over the files
+		// of the running instance. This is checked before anything is touched
+		// so that the existing server is left exactly as it was.
+		if s, ok := manager.Get(u.String()); ok && !s.IsTransferring() && s.Environment.State() != environment.ProcessOfflineState {
+			log.WithField("server", u.String()).Warn("refusing incoming transfer for a server that is already running on this node")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "This server is already running on the target node.",
+			})
+			return
+		}
+
 		// TODO: should this use the request context?
 		trnsfr = transfer.New(c, nil)
+		trnsfr.SetSourceNode(token.SourceNode)
+		trnsfr.SetID(c.GetHeader(transfer.IDHeader))
+		trnsfr.SetPriority(transfer.ParsePriority(c.GetHeader(transfer.PriorityHeader)))
+
+		if !trnsfr.TryAcquire() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "This node is already running the maximum number of transfers.",
+			})
+			return
+		}
+		defer trnsfr.Release()
 
 		ctx, cancel = context.WithCancel(trnsfr.Context())
 		defer cancel()
 
-		i, err := installer.New(ctx, manager, installer.ServerDetails{
-			UUID:              u.String(),
-			StartOnCompletion: false,
-		})
-		if err != nil {
-			if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), false); err != nil {
-				trnsfr.Log().WithField("status", false).WithError(err).Error("failed to set transfer status")
+		// Use the environment created by postTransferEnvironment if the source
+		// node prepared it ahead of the transfer, syncing the configuration in
+		// case it was changed on the Panel since.
+		if s := transfer.TakePrepared(u.String()); s != nil {
+			if err := s.Sync(); err != nil {
+				transfer.DiscardPrepared(context.Background(), manager, s)
+				middleware.CaptureAndAbort(c, err)
+				return
+			}
+			trnsfr.Server = s
+		} else {
+			i, err := installer.New(ctx, manager, installer.ServerDetails{
+				UUID:              u.String(),
+				StartOnCompletion: false,
+			})
+			if err != nil {
+				if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), false); err != nil {
+					trnsfr.Log().WithField("status", false).WithError(err).Error("failed to set transfer status")
+				}
+				middleware.CaptureAndAbort(c, err)
+				return
 			}
-			middleware.CaptureAndAbort(c, err)
-			return
-		}
 
-		i.Server().SetTransferring(true)
-		manager.Add(i.Server())
+			i.Server().SetTransferring(true)
+			manager.Add(i.Server())
+			trnsfr.Server = i.Server()
+		}
 
 		// We add the transfer to the list of transfers once we have a server instance to use.
-		trnsfr.Server = i.Server()
 		transfer.Incoming().Add(trnsfr)
+
+		// Warn about mounts that will be missing once the server is started on
+		// this node, rather than leaving it to be discovered when it boots.
+		for _, problem := range trnsfr.Server.CheckMounts() {
+			trnsfr.Log().Warn(problem)
+			trnsfr.SendMessage("Warning: " + problem + ", the server will start without it.")
+		}
 	} else {
 		ctx, cancel = context.WithCancel(trnsfr.Context())
 		defer cancel()
@@ -89,38 +369,105 @@ func postTransfers(c *gin.Context) {
 	// the transfer.
 
 	successful := false
+	var snapshot *transfer.Snapshot
 	defer func(ctx context.Context, trnsfr *transfer.Transfer) {
 		// Remove the transfer from the list of incoming transfers.
 		transfer.Incoming().Remove(trnsfr)
 
 		if !successful {
+			trnsfr.Forget()
 			trnsfr.Server.Events().Publish(server.TransferStatusEvent, "failure")
+			transfer.DiscardReceivedBackups(trnsfr.Server.ID())
 			manager.Remove(func(match *server.Server) bool {
 				return match.ID() == trnsfr.Server.ID()
 			})
+
+			// If a snapshot was taken the directory is restored to exactly how it
+			// was before the transfer. Nothing is restored if the server was
+			// deleted, as its files are removed along with it.
+			if trnsfr.Deleted() {
+				trnsfr.Log().Warn("transfer aborted as the server was deleted")
+				if snapshot != nil {
+					if err := snapshot.Discard(context.Background()); err != nil {
+						trnsfr.Log().WithField("snapshot", snapshot.Name()).WithError(err).Warn("failed to remove snapshot of server files")
+					}
+				}
+			} else if snapshot != nil {
+				_ = trnsfr.Server.Filesystem().UnixFS().Close()
+				if err := snapshot.Rollback(context.Background()); err != nil {
+					trnsfr.Log().WithField("snapshot", snapshot.Name()).WithError(err).Error("failed to roll back server files to snapshot")
+					transfer.MarkIncomplete(trnsfr.Server.ID(), trnsfr.Server.Filesystem().Path(), trnsfr.ID())
+				} else {
+					trnsfr.Log().WithField("snapshot", snapshot.Name()).Info("rolled back server files to snapshot")
+				}
+			}
 		}
 
-		if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), successful); err != nil {
-			// Only delete the files if the transfer actually failed, otherwise we could have
-			// unrecoverable data-loss.
-			if !successful && err != nil {
-				// Delete all extracted files.
-				go func(trnsfr *transfer.Transfer) {
+		if !successful {
+			failure := trnsfr.Failure(transfer.DirectionIncoming)
+			failure.Resumable = snapshot == nil && config.Get().System.Transfers.DeltaTransfers && !trnsfr.Deleted()
+			if err := manager.Client().SendTransferFailure(context.Background(), trnsfr.Server.ID(), failure); err != nil {
+				trnsfr.Log().WithField("status", false).WithError(err).Error("failed to set transfer status on panel")
+
+				// The Panel resets the server on this node once it knows the
+				// transfer failed, so the extracted files are only removed here
+				// if it could not be told. They are left marked as incomplete
+				// otherwise. When delta transfers are enabled the files are
+				// kept, allowing a retry to only send the files that are still
+				// missing.
+				if snapshot == nil && !trnsfr.Deleted() && !config.Get().System.Transfers.DeltaTransfers {
 					_ = trnsfr.Server.Filesystem().UnixFS().Close()
-					if err := os.RemoveAll(trnsfr.Server.Filesystem().Path()); err != nil && !os.IsNotExist(err) {
-						trnsfr.Log().WithError(err).Warn("failed to delete local server files")
+					res := transfer.CleanupFailedFiles(trnsfr.Server.ID(), trnsfr.Server.Filesystem().Path())
+					if res.Outcome == transfer.CleanupLeft {
+						transfer.MarkIncomplete(trnsfr.Server.ID(), trnsfr.Server.Filesystem().Path(), trnsfr.ID())
 					}
-				}(trnsfr)
+				}
 			}
-
-			trnsfr.Log().WithField("status", successful).WithError(err).Error("failed to set transfer status on panel")
 			return
 		}
 
-		trnsfr.Server.SetTransferring(false)
-		trnsfr.Server.Events().Publish(server.TransferStatusEvent, "success")
+		// The token cannot be used to send the server again now the transfer
+		// has been completed.
+		token.Consume()
+
+		if snapshot != nil {
+			if config.Get().System.Transfers.KeepSnapshots {
+				trnsfr.Log().WithField("snapshot", snapshot.Name()).Info("keeping snapshot of server files from before the transfer")
+			} else if err := snapshot.Discard(context.Background()); err != nil {
+				trnsfr.Log().WithField("snapshot", snapshot.Name()).WithError(err).Warn("failed to remove snapshot of server files")
+			}
+		}
+
+		// The server is only released once the Panel knows the transfer was
+		// successful, which may happen after this request if the notification
+		// has to be retried. The record of the transfer is removed once it
+		// does.
+		transfer.NotifySuccess(context.Background(), manager.Client(), trnsfr, func() {
+			transfer.ForgetReceivedBackups(trnsfr.Server.ID())
+			trnsfr.LogTimings()
+			trnsfr.Server.SetTransferring(false)
+			trnsfr.Server.Events().Publish(server.TransferStatusEvent, "success")
+
+			go func() {
+				trnsfr.RunPostTransferCommand()
+				if trnsfr.AutoStart() {
+					trnsfr.Start()
+				}
+			}()
+		})
 	}(ctx, trnsfr)
 
+	// Source nodes that do not send a version are on the baseline version,
+	// which this node supports unless it has been dropped.
+	if _, err := transfer.Negotiate(transfer.VersionInfo{Version: transfer.ParseVersion(c.GetHeader(transfer.VersionHeader))}); err != nil {
+		trnsfr.Log().WithError(err).Error("refusing transfer from a source node with an incompatible transfer version")
+		trnsfr.SendMessage("Error: incompatible transfer versions.")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
 	if err != nil {
 		trnsfr.Log().Debug("failed to parse content type header")
@@ -134,18 +481,201 @@ func postTransfers(c *gin.Context) {
 		return
 	}
 
-	// Used to calculate the hash of the file as it is being uploaded.
-	h := sha256.New()
+	// Make sure the server can be written to before anything is received, a
+	// data directory on a read-only mount would otherwise only be discovered
+	// once extraction fails.
+	if err := trnsfr.Server.EnsureDataDirectoryExists(); err == nil {
+		err = transfer.CheckWritable(trnsfr.Server.Filesystem().Path())
+	} else {
+		err = fmt.Errorf("%w: %s", transfer.ErrNotWritable, err)
+	}
+	if err != nil {
+		trnsfr.Log().WithError(err).Error("refusing transfer as the server data directory cannot be written to")
+		trnsfr.SendMessage("Error: the target filesystem is not writable.")
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	// Refuse a request compressed in transit in a way this node cannot
+	// decompress.
+	if err := transfer.CheckTransportEncoding(c.GetHeader("Content-Encoding")); err != nil {
+		trnsfr.Log().WithError(err).Error("refusing transfer with an unsupported content encoding")
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Refuse an archive compressed with a dictionary this node does not have
+	// before anything is received, it would fail part way through extracting.
+	if err := transfer.CheckDictionary(c.GetHeader(transfer.DictionaryHeader)); err != nil {
+		trnsfr.Log().WithError(err).Error("refusing transfer compressed with an unknown dictionary")
+		trnsfr.SendMessage("Error: the archive is compressed with a dictionary this node does not have.")
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// The compressed size of the archive can never be much larger than the
+	// files it contains, if it is the source node is misbehaving.
+	totalSize := transfer.ParseTotalSize(c.GetHeader(transfer.TotalSizeHeader))
+	err = trnsfr.CheckArchiveSize("Content-Length", c.Request.ContentLength, totalSize)
+	if err == nil {
+		err = trnsfr.CheckArchiveSize(transfer.EstimatedSizeHeader, transfer.ParseTotalSize(c.GetHeader(transfer.EstimatedSizeHeader)), totalSize)
+	}
+	if err != nil {
+		trnsfr.SendMessage("Error: " + err.Error())
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Make sure the image of the server can be used on this node before the
+	// archive is received, and pull it while the archive is being received if
+	// configured to.
+	if err := trnsfr.CheckImage(ctx); err != nil {
+		trnsfr.Log().WithError(err).Error("refusing transfer as the image of the server is not available")
+		trnsfr.SendMessage("Error: the Docker image of the server cannot be pulled on this node.")
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	waitForImage := trnsfr.PullImage(ctx)
+
+	// Take a snapshot of any files this node already has for the server before
+	// anything is changed, so they can be restored if the transfer fails.
+	if snapshot, err = transfer.CreateSnapshot(ctx, trnsfr.Server.Filesystem().Path(), trnsfr.ID()); err != nil {
+		trnsfr.Log().WithError(err).Error("failed to create snapshot of server files")
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	if snapshot != nil {
+		trnsfr.Log().WithField("snapshot", snapshot.Name()).Info("created snapshot of server files before transfer")
+	}
+
+	// Record that the transfer is being received so it can be cleaned up if
+	// Wings is stopped before it finishes.
+	if err := trnsfr.Persist(snapshot); err != nil {
+		trnsfr.Log().WithError(err).Warn("failed to record incoming transfer")
+	}
+
+	// Extract a signed archive to a staging directory, its files are only moved
+	// to the server once the signature of its checksum has been verified.
+	var staging *transfer.ExtractionStaging
+	if c.GetHeader(transfer.SignedHeader) != "" || config.Get().System.Transfers.RequireSignature {
+		if staging, err = transfer.NewExtractionStaging(trnsfr.Server, trnsfr.ID()); err != nil {
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+		defer func() {
+			if err := staging.Discard(); err != nil {
+				trnsfr.Log().WithError(err).Warn("failed to remove staged files of transfer")
+			}
+		}()
+	}
+
+	// Used to calculate the hash of the file as it is being uploaded. Only the
+	// algorithms the source node said it would send checksums for are used.
+	h := transfer.NewArchiveHash(transfer.ParseChecksumAlgorithms(c.GetHeader(transfer.ChecksumsHeader)))
+
+	// Used to read the file and checksum from the request body. The download
+	// limit applies to the bytes received over the wire, before the body is
+	// decompressed if the source node compressed it in transit.
+	body := trnsfr.DecodeTransport(trnsfr.LimitReader(transfer.NewDisconnectReader(c.Request.Body)), c.GetHeader("Content-Encoding"))
+	mr := multipart.NewReader(body, params["boundary"])
+
+	// abort fails the transfer, making it clear when this happened because the
+	// source node went away part way through sending the archive.
+	abort := func(err error) {
+		if transfer.IsRetryable(err) {
+			trnsfr.Log().WithError(err).Warn("source node disconnected during transfer, it can safely be retried")
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+				"error":     err.Error(),
+				"retryable": true,
+			})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+	}
+
+	// The compression format of the archive, this is sent by the source node
+	// before the archive. Older nodes do not send this so default to gzip.
+	format := filesystem.CompressionGzip
+	// How the archive was compressed, this is also sent before the archive and
+	// is used to choose how many goroutines to decompress it with.
+	var compression filesystem.CompressionInfo
+
+	// markIncomplete flags the server's data directory as incomplete before
+	// anything in it is changed, the marker is only removed once the transfer
+	// has succeeded so a server left half-extracted cannot be started.
+	var marked bool
+	markIncomplete := func() error {
+		if marked {
+			return nil
+		}
+		if err := trnsfr.Server.EnsureDataDirectoryExists(); err != nil {
+			return err
+		}
+		if err := filesystem.MarkExtractionIncomplete(trnsfr.Server.Filesystem().Path(), trnsfr.ID()); err != nil {
+			return fmt.Errorf("failed to mark server files as incomplete: %w", err)
+		}
+		marked = true
+		return nil
+	}
 
-	// Used to read the file and checksum from the request body.
-	mr := multipart.NewReader(c.Request.Body, params["boundary"])
+	// extract writes the archive to the server's data directory, or to the
+	// staging directory for a signed archive, while calculating the checksum of
+	// the archive.
+	extract := func(r io.Reader) error {
+		// Refuse to extract an empty archive, this would otherwise result in an
+		// empty server being reported to the Panel as successfully transferred.
+		r, err := transfer.RequireMinimumSize(r)
+		if err != nil {
+			trnsfr.Log().WithError(err).Error("refusing to extract archive received from source node")
+			return err
+		}
+		if err := markIncomplete(); err != nil {
+			return err
+		}
+		fs := trnsfr.Server.Filesystem()
+		if staging != nil {
+			fs = staging.Filesystem()
+		}
+		err = fs.ExtractStreamWithOptions(ctx, "/", "archive"+format.Extension(), io.TeeReader(r, io.MultiWriter(h, trnsfr.Received())), transfer.ExtractOptions(compression))
+		if errors.Is(err, filesystem.ErrDecompressionLimit) {
+			trnsfr.Log().WithError(err).Error("stopped extracting archive received from source node")
+		}
+		return err
+	}
 
 	// Loop through the parts of the request body and process them.
 	var (
 		hasArchive       bool
+		segmented        bool
+		archiveName      string
 		hasChecksum      bool
 		checksumVerified bool
+		manifest         []string
+		chunkEncoding    string
+		chunks           *transfer.ChunkStore
+		verifier         *transfer.ChunkVerifier
+		checksum         string
+		checksums        = make(map[string]string)
+		verifiedWith     string
+		signature        string
+		expectedSize     int64 = -1
+		fileManifest     transfer.Manifest
 	)
+	// Stop the workers verifying chunks if the transfer fails before they
+	// have all been received.
+	defer func() {
+		if verifier != nil {
+			_ = verifier.Wait()
+		}
+	}()
 out:
 	for {
 		select {
@@ -157,63 +687,473 @@ out:
 				break out
 			}
 			if err != nil {
-				middleware.CaptureAndAbort(c, err)
+				abort(err)
 				return
 			}
 
 			name := p.FormName()
 			switch name {
+			case "format":
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				format = filesystem.ParseCompressionFormat(string(v))
+				trnsfr.Log().WithField("format", format).Debug("received archive format")
+			case "compression_info":
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				info, err := transfer.ParseCompressionInfo(v)
+				if err != nil {
+					// The description is only used to tune extraction, fall back to the
+					// defaults rather than failing the transfer.
+					trnsfr.Log().WithError(err).Warn("failed to parse archive compression info")
+					break
+				}
+				compression = info
+				trnsfr.Log().WithFields(log.Fields{"codec": info.Codec, "level": info.Level, "threads": info.Threads, "block_size": info.BlockSize}).Debug("received archive compression info")
+			case "transfer_id":
+				// Older nodes do not send the header, the identifier is also part of
+				// the body so the logs of both nodes can still be correlated.
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if c.GetHeader(transfer.IDHeader) == "" {
+					trnsfr.SetID(string(v))
+				}
+			case "files":
+				// Check there are enough free inodes for every file in the archive,
+				// this would otherwise only fail part of the way through extracting
+				// a server with a large number of small files.
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				files, err := strconv.ParseUint(string(v), 10, 64)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if err := trnsfr.Server.EnsureDataDirectoryExists(); err != nil {
+					abort(err)
+					return
+				}
+				if err := transfer.CheckInodes(trnsfr.Server.Filesystem().Path(), files); err != nil {
+					trnsfr.Log().WithError(err).Error("refusing transfer that would exhaust inodes")
+					abort(err)
+					return
+				}
+			case "disk_usage":
+				// Check the server fits on this node with the configured amount of
+				// free space to spare. Files already on this node, such as those
+				// from a previous transfer when receiving a delta, are overwritten
+				// and do not need any more space.
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				size, err := strconv.ParseInt(string(v), 10, 64)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if err := trnsfr.Server.EnsureDataDirectoryExists(); err != nil {
+					abort(err)
+					return
+				}
+				if err := transfer.CheckSpace(trnsfr.Server.Filesystem().Path(), size-trnsfr.Server.Filesystem().CachedUsage()); err != nil {
+					trnsfr.Log().WithError(err).Error("refusing transfer that would leave too little free space")
+					abort(err)
+					return
+				}
+			case "auto_start":
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				trnsfr.SetAutoStart(string(v) == "true")
+			case "state":
+				// Apply the administrative state of the server on the source node,
+				// such as suspension, which is not part of the server's files.
+				var state transfer.ServerState
+				if err := json.NewDecoder(p).Decode(&state); err != nil {
+					abort(err)
+					return
+				}
+				transfer.ApplyState(trnsfr.Server, state)
+			case transfer.FileManifestField:
+				// The manifest of every file being transferred, the extracted
+				// files are checked against it once the archive is applied.
+				m, err := transfer.ReadFileManifest(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				fileManifest = m
+			case "delete":
+				// The source node is sending a delta, remove any files that no
+				// longer exist on the source before the archive is applied.
+				var deleted []string
+				if err := json.NewDecoder(p).Decode(&deleted); err != nil {
+					abort(err)
+					return
+				}
+				trnsfr.Log().WithField("files", len(deleted)).Debug("removing files deleted on source node")
+				if err := markIncomplete(); err != nil {
+					abort(err)
+					return
+				}
+				for _, f := range deleted {
+					if staging != nil {
+						staging.Delete(f)
+						continue
+					}
+					if err := trnsfr.Server.Filesystem().Delete(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+						abort(err)
+						return
+					}
+				}
 			case "archive":
 				trnsfr.Log().Debug("received archive")
 
-				if err := trnsfr.Server.EnsureDataDirectoryExists(); err != nil {
-					middleware.CaptureAndAbort(c, err)
+				// The archive is extracted as it is received, so both are
+				// tracked as part of the download phase.
+				var r io.Reader = p
+				if segmented {
+					r = transfer.SegmentReader(p)
+				}
+				// The source node creates the archive as it is sent, so only
+				// an estimate of its size is known.
+				stopProgress := func() {}
+				if v, err := strconv.ParseUint(c.GetHeader(transfer.EstimatedSizeHeader), 10, 64); err == nil && v > 0 {
+					trnsfr.Received().SetTotalEstimate(v)
+					stopProgress = trnsfr.ReportProgress("Receiving ", trnsfr.Received())
+				}
+				done := trnsfr.Timings().Start(transfer.PhaseDownload)
+				err := extract(r)
+				done()
+				if err == nil {
+					trnsfr.Received().Finish()
+				}
+				stopProgress()
+				if errors.Is(err, transfer.ErrSegmentMismatch) {
+					trnsfr.Log().WithError(err).Error("archive received from source node is corrupted")
+				}
+				if err != nil {
+					abort(err)
 					return
 				}
 
-				tee := io.TeeReader(p, h)
-				if err := trnsfr.Server.Filesystem().ExtractStreamUnsafe(ctx, "/", tee); err != nil {
-					middleware.CaptureAndAbort(c, err)
+				hasArchive = true
+			case "segments":
+				// The archive that follows is split into segments which are each
+				// verified before being extracted.
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if string(v) != transfer.SegmentsSHA256 {
+					abort(fmt.Errorf("unsupported archive segments \"%s\"", string(v)))
+					return
+				}
+				segmented = true
+			case "archive_url":
+				// The source node uploaded the archive to object storage, so we
+				// need to pull it down from there ourselves.
+				trnsfr.Log().Debug("received archive url")
+
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+
+				done := trnsfr.Timings().Start(transfer.PhaseDownload)
+				rc, err := transfer.DownloadArchive(ctx, string(v))
+				if err != nil {
+					done()
+					abort(err)
+					return
+				}
+				if !rc.Estimated {
+					if err := trnsfr.CheckArchiveSize("Content-Length", rc.Size, totalSize); err != nil {
+						_ = rc.Close()
+						done()
+						trnsfr.SendMessage("Error: " + err.Error())
+						abort(err)
+						return
+					}
+				}
+				if rc.Estimated {
+					trnsfr.Received().SetTotalEstimate(uint64(rc.Size))
+				} else if rc.Size >= 0 {
+					trnsfr.Received().SetTotal(uint64(rc.Size))
+				} else {
+					trnsfr.Received().SetTotalUnknown()
+				}
+				stopProgress := trnsfr.ReportProgress("Downloading ", trnsfr.Received())
+				err = extract(trnsfr.LimitReader(rc))
+				if err == nil {
+					trnsfr.Received().Finish()
+				}
+				stopProgress()
+				_ = rc.Close()
+				done()
+				if err != nil {
+					abort(err)
 					return
 				}
 
 				hasArchive = true
-			case "checksum":
-				trnsfr.Log().Debug("received checksum")
+			case "archive_upload":
+				// The source node uploaded the archive to this node before
+				// sending the transfer, it is referenced by its checksum.
+				trnsfr.Log().Debug("received uploaded archive")
+
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				f, err := transfer.OpenUpload(trnsfr.Server.ID(), string(v))
+				if err != nil {
+					abort(err)
+					return
+				}
+				if st, err := f.Stat(); err == nil {
+					trnsfr.Received().SetTotal(uint64(st.Size()))
+					if err := trnsfr.CheckArchiveSize(transfer.UploadLengthHeader, st.Size(), totalSize); err != nil {
+						_ = f.Close()
+						trnsfr.SendMessage("Error: " + err.Error())
+						abort(err)
+						return
+					}
+				}
+				done := trnsfr.Timings().Start(transfer.PhaseExtract)
+				stopProgress := trnsfr.ReportProgress("Extracting ", trnsfr.Received())
+				err = extract(f)
+				if err == nil {
+					trnsfr.Received().Finish()
+				}
+				stopProgress()
+				_ = f.Close()
+				done()
+				if err != nil {
+					abort(err)
+					return
+				}
+				// The upload is kept if the archive could not be extracted, so
+				// that the transfer can be retried without sending it again.
+				transfer.RemoveUpload(trnsfr.Server.ID(), string(v))
+
+				hasArchive = true
+			case "chunk_encoding":
+				// The chunks that follow are each compressed on their own.
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if err := transfer.CheckChunkEncoding(string(v)); err != nil {
+					abort(err)
+					return
+				}
+				chunkEncoding = string(v)
+			case "manifest":
+				// The source node is sending a deduplicated archive, only the
+				// chunks we do not already have will follow the manifest.
+				trnsfr.Log().Debug("received chunk manifest")
+
+				// Only one set of workers is started, they would never be
+				// stopped if another manifest replaced them.
+				if verifier != nil {
+					middleware.CaptureAndAbort(c, errors.New("manifest must only be sent once"))
+					return
+				}
+				if err := json.NewDecoder(p).Decode(&manifest); err != nil {
+					abort(err)
+					return
+				}
+				if chunks, err = transfer.NewChunkStore(); err != nil {
+					abort(err)
+					return
+				}
+				verifier = transfer.NewChunkVerifier(chunks)
+			case "chunk":
+				if verifier == nil {
+					middleware.CaptureAndAbort(c, errors.New("manifest must be sent before any chunks"))
+					return
+				}
+				done := trnsfr.Timings().Start(transfer.PhaseDownload)
+				r, err := transfer.DecodeChunk(p, chunkEncoding)
+				if err == nil {
+					err = verifier.Put(p.FileName(), r)
+				}
+				done()
+				if errors.Is(err, transfer.ErrInvalidChunk) {
+					trnsfr.Log().WithError(err).Error("chunk received from source node is corrupted")
+				}
+				if err != nil {
+					abort(err)
+					return
+				}
+			case "archive_name":
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				archiveName = string(v)
+			case "checksum_url":
+				// The checksum is in a checksum file next to the archive, this is
+				// verified in addition to the checksum field if both are sent.
+				trnsfr.Log().Debug("received checksum file url")
 
 				if !hasArchive {
 					middleware.CaptureAndAbort(c, errors.New("archive must be sent before the checksum"))
 					return
 				}
 
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				expected, err := transfer.DownloadChecksumFile(ctx, string(v), archiveName)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if actual := h.Sum(transfer.ChecksumSHA256); expected != actual {
+					trnsfr.Log().WithFields(log.Fields{"expected": expected, "actual": actual}).Debug("checksums")
+					middleware.CaptureAndAbort(c, errors.New("checksum file does not match archive"))
+					return
+				}
+				trnsfr.Log().Debug("checksum file matches")
 				hasChecksum = true
-
+				checksumVerified = true
+				verifiedWith = transfer.ChecksumSHA256
+				checksum = expected
+			case "checksum_" + transfer.ChecksumBLAKE2b:
+				// Checksums calculated with other algorithms are sent before
+				// the SHA-256 checksum, which is verified in their place if
+				// they are not supported by this node.
 				v, err := io.ReadAll(p)
 				if err != nil {
-					middleware.CaptureAndAbort(c, err)
+					abort(err)
 					return
 				}
+				checksums[strings.TrimPrefix(name, "checksum_")] = string(v)
+			case "checksum":
+				trnsfr.Log().Debug("received checksum")
+
+				// Reassemble a deduplicated archive from the chunk store now that
+				// all the missing chunks have been received.
+				if !hasArchive && chunks != nil {
+					// Wait for the chunks that are still being verified.
+					done := trnsfr.Timings().Start(transfer.PhaseDownload)
+					err := verifier.Wait()
+					done()
+					if errors.Is(err, transfer.ErrInvalidChunk) {
+						trnsfr.Log().WithError(err).Error("chunk received from source node is corrupted")
+					}
+					if err != nil {
+						abort(err)
+						return
+					}
+
+					trnsfr.Log().WithField("chunks", len(manifest)).Debug("reassembling archive from chunks")
+					done = trnsfr.Timings().Start(transfer.PhaseExtract)
+					rc := chunks.Reader(manifest)
+					err = extract(rc)
+					_ = rc.Close()
+					done()
+					if err != nil {
+						abort(err)
+						return
+					}
+					hasArchive = true
+					if err := chunks.Prune(); err != nil {
+						trnsfr.Log().WithError(err).Warn("failed to remove old chunks from chunk store")
+					}
+				}
 
-				expected := make([]byte, hex.DecodedLen(len(v)))
-				n, err := hex.Decode(expected, v)
+				if !hasArchive {
+					middleware.CaptureAndAbort(c, errors.New("archive must be sent before the checksum"))
+					return
+				}
+
+				hasChecksum = true
+				done := trnsfr.Timings().Start(transfer.PhaseChecksum)
+
+				v, err := io.ReadAll(p)
 				if err != nil {
-					middleware.CaptureAndAbort(c, err)
+					done()
+					abort(err)
 					return
 				}
-				actual := h.Sum(nil)
+				checksum = string(v)
+				checksums[transfer.ChecksumSHA256] = checksum
 
-				trnsfr.Log().WithFields(log.Fields{
-					"expected": hex.EncodeToString(expected),
-					"actual":   hex.EncodeToString(actual),
-				}).Debug("checksums")
+				// Verify the strongest checksum that both nodes support.
+				algorithm := h.Strongest(checksums)
+				l := trnsfr.Log().WithFields(log.Fields{
+					"algorithm": algorithm,
+					"expected":  checksums[algorithm],
+					"actual":    h.Sum(algorithm),
+				})
+				l.Debug("checksums")
 
-				if !bytes.Equal(expected[:n], actual) {
-					middleware.CaptureAndAbort(c, errors.New("checksums don't match"))
+				err = h.Verify(algorithm, checksums[algorithm])
+				done()
+				if err != nil {
+					if errors.Is(err, transfer.ErrChecksumMismatch) {
+						middleware.CaptureAndAbort(c, err)
+					} else {
+						abort(err)
+					}
 					return
 				}
 
-				trnsfr.Log().Debug("checksums match")
+				l.Debug("checksums match")
 				checksumVerified = true
+				verifiedWith = algorithm
+			case "size":
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				if expectedSize, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+					abort(err)
+					return
+				}
+			case transfer.TimingsField:
+				// The time the source node spent in each phase, which is
+				// reported to the Panel along with the timings of this node.
+				var timings map[string]float64
+				if err := json.NewDecoder(io.LimitReader(p, 64*1024)).Decode(&timings); err != nil {
+					trnsfr.Log().WithError(err).Warn("ignoring invalid phase timings sent by source node")
+					continue
+				}
+				trnsfr.SetSourceTimings(timings)
+			case "checksum_signature":
+				v, err := io.ReadAll(p)
+				if err != nil {
+					abort(err)
+					return
+				}
+				signature = string(v)
 			default:
 				continue
 			}
@@ -224,18 +1164,138 @@ out:
 		middleware.CaptureAndAbort(c, errors.New("missing archive or checksum"))
 		return
 	}
+	trnsfr.LogTransport()
 
 	if !checksumVerified {
 		middleware.CaptureAndAbort(c, errors.New("checksums don't match"))
 		return
 	}
 
+	// Verify the archive was sent by the node it claims to be from if the source
+	// signed the checksum, or if the archive was staged because the source said
+	// it would sign it or this node requires all transfers to be signed.
+	if signature != "" || staging != nil {
+		if signature == "" {
+			middleware.CaptureAndAbort(c, errors.New("archive checksum signature is required but was not sent"))
+			return
+		}
+		if trnsfr.SourceNode() == "" {
+			middleware.CaptureAndAbort(c, errors.New("unable to verify archive checksum signature: source node is unknown"))
+			return
+		}
+		key, err := manager.Client().GetNodePublicKey(ctx, trnsfr.SourceNode())
+		if err != nil {
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+		// The signature only covers the SHA-256 checksum, so it must also match
+		// the archive if a different checksum was verified.
+		if verifiedWith != transfer.ChecksumSHA256 {
+			if err := h.Verify(transfer.ChecksumSHA256, checksum); err != nil {
+				middleware.CaptureAndAbort(c, err)
+				return
+			}
+		}
+		if err := transfer.VerifyChecksum(key, trnsfr.Server.ID(), trnsfr.ID(), checksum, signature); err != nil {
+			trnsfr.Log().WithError(err).Error("refusing transfer with an invalid checksum signature")
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+		trnsfr.Log().Debug("archive checksum signature verified")
+	}
+	if staging != nil {
+		if err := staging.Apply(trnsfr.Server.Filesystem()); err != nil {
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+	}
+
+	// The checksum only covers the compressed archive, so check that the size of
+	// the extracted server is close to what the source node sent as a sanity
+	// check that nothing was silently lost while extracting it. Older nodes do
+	// not send the size.
+	if expectedSize >= 0 {
+		actual, err := trnsfr.Server.Filesystem().DirectorySize("/")
+		if err != nil {
+			trnsfr.Log().WithError(err).Warn("failed to calculate size of extracted server")
+		} else {
+			l := trnsfr.Log().WithField("expected_size", expectedSize).WithField("actual_size", actual)
+			if transfer.SizeMatches(expectedSize, actual) {
+				l.Debug("extracted server size matches source node")
+				trnsfr.SendMessage(fmt.Sprintf("Extracted %s of server data.", system.FormatBytes(actual)))
+			} else {
+				l.Warn("extracted server size does not match the size reported by the source node")
+				trnsfr.SendMessage(fmt.Sprintf("Warning: extracted %s of server data but the source node reported %s.", system.FormatBytes(actual), system.FormatBytes(expectedSize)))
+			}
+		}
+	}
+
+	// Read the extracted files back from the disk to catch any that were
+	// corrupted while being written, which the archive checksum cannot detect.
+	if transfer.IntegrityScanEnabled() {
+		trnsfr.SendMessage("Verifying the integrity of the extracted files...")
+		done := trnsfr.Timings().Start(transfer.PhaseIntegrity)
+		res, err := transfer.ScanIntegrity(ctx, trnsfr.Server.Filesystem().Path())
+		done()
+		if err == nil {
+			err = res.Err()
+		}
+		l := trnsfr.Log().WithFields(log.Fields{"files": res.Files, "scanned": res.Scanned, "bytes": res.Bytes})
+		if err != nil {
+			l.WithError(err).Error("integrity scan of extracted server failed")
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+		l.Debug("integrity scan of extracted server passed")
+		trnsfr.SendMessage(fmt.Sprintf("Verified %d of %d extracted files.", res.Scanned, res.Files))
+	}
+
+	// Check every extracted file against the manifest sent by the source node,
+	// which catches files that were lost or altered anywhere between being
+	// archived and extracted.
+	if fileManifest != nil {
+		trnsfr.SendMessage("Verifying extracted files against the manifest from the source node...")
+		done := trnsfr.Timings().Start(transfer.PhaseManifest)
+		err := transfer.VerifyFileManifest(ctx, trnsfr.Server.Filesystem().Path(), fileManifest)
+		done()
+		var merr *transfer.ManifestError
+		if errors.As(err, &merr) {
+			trnsfr.Log().WithFields(log.Fields{"missing": merr.Missing, "extra": merr.Extra, "mismatched": merr.Mismatched}).Error("extracted files do not match the manifest of the source node")
+			trnsfr.SendMessage("Error: " + err.Error())
+		}
+		if err != nil {
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+		trnsfr.SendMessage(fmt.Sprintf("Verified %d extracted files against the manifest.", len(fileManifest)))
+	}
+
+	// Run any finalization required by this type of server now that its files
+	// are in place, failing the transfer if it does not succeed.
+	if err := trnsfr.RunFinalizeCommand(); err != nil {
+		trnsfr.Log().WithError(err).Error("finalize command failed")
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
 	// Transfer is almost complete, we just want to ensure the environment is
 	// configured correctly.  We might want to not fail the transfer at this
-	// stage, but we will just to be safe.
+	// stage, but we will just to be safe. This is still done if the
+	// environment was prepared ahead of the transfer, in which case it is
+	// only updated.
 
 	// Ensure the server environment gets configured.
-	if err := trnsfr.Server.CreateEnvironment(); err != nil {
+	done := trnsfr.Timings().Start(transfer.PhaseEnvironment)
+	waitForImage()
+	err = trnsfr.Server.CreateEnvironment()
+	done()
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	if err := filesystem.ClearExtractionIncomplete(trnsfr.Server.Filesystem().Path()); err != nil {
+		trnsfr.Log().WithError(err).Error("failed to remove incomplete marker from server files")
 		middleware.CaptureAndAbort(c, err)
 		return
 	}
@@ -249,6 +1309,126 @@ out:
 	trnsfr.Log().Debug("done!")
 }
 
+// getTransferHealth returns whether the transfer subsystem is healthy,
+// responding with a 503 if this node is unable to accept new transfers. The
+// result of each check is left out as this endpoint is unauthenticated.
+func getTransferHealth(c *gin.Context) {
+	h := transfer.CheckHealth()
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{"healthy": h.Healthy})
+}
+
+// getTransferHealthDetails returns the health of the transfer subsystem along
+// with the result of each check.
+func getTransferHealthDetails(c *gin.Context) {
+	h := transfer.CheckHealth()
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, h)
+}
+
+// postTransferSelfTest performs a transfer locally to confirm that this node is
+// able to create, send and extract transfer archives.
+func postTransferSelfTest(c *gin.Context) {
+	res := transfer.SelfTest(c.Request.Context())
+	status := http.StatusOK
+	if !res.Success {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, res)
+}
+
+// getTransferConfig returns the transfer settings being applied by this node.
+func getTransferConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, transfer.EffectiveSettings())
+}
+
+// getTransferArchives returns every archive in the archive directory.
+func getTransferArchives(c *gin.Context) {
+	archives, err := transfer.StagedArchives()
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, archives)
+}
+
+// deleteTransferArchives removes the archives in the archive directory that
+// belong to a server, as long as it is not currently being transferred.
+func deleteTransferArchives(c *gin.Context) {
+	u, err := uuid.Parse(c.Param("server"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The server identifier is not a valid UUID.",
+		})
+		return
+	}
+	removed, err := transfer.RemoveStagedArchives(u.String())
+	if err != nil {
+		if errors.Is(err, transfer.ErrTransferInProgress) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "Server is currently being transferred.",
+			})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	if len(removed) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "There are no archives for this server.",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, removed)
+}
+
+// getTransferLog returns the persisted log of the most recent transfer of a
+// server, or of the transfer given by the transfer query parameter. The
+// identifier of the transfer is sent in the X-Transfer-Id header.
+func getTransferLog(c *gin.Context) {
+	u, err := uuid.Parse(c.Param("server"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The server identifier is not a valid UUID.",
+		})
+		return
+	}
+	p, id, err := transfer.FindLog(u.String(), c.Query("transfer"))
+	if err != nil {
+		switch {
+		case errors.Is(err, transfer.ErrLogsDisabled):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Transfer logs are not persisted on this node.",
+			})
+		case errors.Is(err, os.ErrNotExist):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "There is no transfer log for this server.",
+			})
+		case errors.Is(err, transfer.ErrInvalidTransferID):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The transfer identifier is not a valid UUID.",
+			})
+		default:
+			middleware.CaptureAndAbort(c, err)
+		}
+		return
+	}
+	c.Header(transfer.IDHeader, id)
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.File(p)
+}
+
+// getTransfers returns every transfer currently active on this node.
+func getTransfers(c *gin.Context) {
+	c.JSON(http.StatusOK, transfer.Active())
+}
+
 // deleteTransfer cancels an incoming transfer for a server.
 func deleteTransfer(c *gin.Context) {
 	s := ExtractServer(c)
@@ -272,3 +1452,83 @@ func deleteTransfer(c *gin.Context) {
 
 	c.Status(http.StatusAccepted)
 }
+
+// transferCleanup describes what was done when forcibly cleaning up the
+// transfer of a server.
+type transferCleanup struct {
+	CancelledIncoming   bool                     `json:"cancelled_incoming"`
+	CancelledOutgoing   bool                     `json:"cancelled_outgoing"`
+	ClearedTransferring bool                     `json:"cleared_transferring"`
+	RemovedServer       bool                     `json:"removed_server"`
+	RemovedArchives     []transfer.StagedArchive `json:"removed_archives"`
+	RemovedBackups      []string                 `json:"removed_backups"`
+}
+
+// postTransferCleanup forcibly cleans up a transfer that has become stuck, for
+// example because the goroutine running it stopped without cleaning up after
+// itself. Any transfer still tracked for the server is cancelled, the server
+// is no longer marked as transferring and its staged archives, along with any
+// backups received for it, are removed. A
+// server that was being received by this node is removed from the servers on
+// this node, as the transfer can no longer complete.
+func postTransferCleanup(c *gin.Context) {
+	u, err := uuid.Parse(c.Param("server"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The server identifier is not a valid UUID.",
+		})
+		return
+	}
+	id := u.String()
+	manager := middleware.ExtractManager(c)
+	logger := middleware.ExtractLogger(c).WithField("server", id)
+
+	var res transferCleanup
+	if t := transfer.Incoming().Get(id); t != nil {
+		t.Cancel()
+		transfer.Incoming().Remove(t)
+		res.CancelledIncoming = true
+	}
+	if t := transfer.Outgoing().Get(id); t != nil {
+		t.Cancel()
+		transfer.Outgoing().Remove(t)
+		res.CancelledOutgoing = true
+	}
+	prepared := transfer.TakePrepared(id) != nil
+	journaled, err := transfer.ForgetIncoming(id)
+	if err != nil {
+		logger.WithError(err).Warn("failed to remove incoming transfer record")
+	}
+
+	s := manager.Find(func(s *server.Server) bool {
+		return s.ID() == id
+	})
+	if s != nil && s.IsTransferring() {
+		s.SetTransferring(false)
+		res.ClearedTransferring = true
+	}
+	if s != nil && (res.CancelledIncoming || journaled || prepared) {
+		manager.Remove(func(match *server.Server) bool {
+			return match.ID() == id
+		})
+		res.RemovedServer = true
+	}
+
+	res.RemovedBackups = transfer.DiscardReceivedBackups(id)
+	res.RemovedArchives, err = transfer.RemoveStagedArchives(id)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"cancelled_incoming":   res.CancelledIncoming,
+		"cancelled_outgoing":   res.CancelledOutgoing,
+		"cleared_transferring": res.ClearedTransferring,
+		"removed_server":       res.RemovedServer,
+		"removed_archives":     len(res.RemovedArchives),
+		"removed_backups":      len(res.RemovedBackups),
+	}).Warn("forcibly cleaned up server transfer")
+
+	c.JSON(http.StatusOK, res)
+}
@@ -1,14 +1,68 @@
 package tokens
 
 import (
+	"sync"
+	"time"
+
 	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/patrickmn/go-cache"
 )
 
 type TransferPayload struct {
 	jwt.Payload
+	// UniqueId is a nonce generated by the Panel for each transfer token. It
+	// is optional so that tokens from versions of the Panel that do not send
+	// one continue to work.
+	UniqueId string `json:"unique_id"`
+	// SourceNode is the UUID of the node the Panel issued the token to for
+	// sending the server. Unlike the header sent by the source node it is
+	// covered by the signature of the token, so it is used to look up the key
+	// the checksum of the archive must be signed with.
+	SourceNode string `json:"source_node"`
 }
 
 // GetPayload returns the JWT payload.
 func (p *TransferPayload) GetPayload() *jwt.Payload {
 	return &p.Payload
 }
+
+var consumedTransfers struct {
+	sync.Once
+	cache *cache.Cache
+}
+
+// Returns the cache of transfer token nonces that have been used to complete
+// a transfer. Nonces are kept until the token they belong to expires, after
+// which the token would be rejected anyway.
+func getConsumedTransfers() *cache.Cache {
+	consumedTransfers.Do(func() {
+		consumedTransfers.cache = cache.New(time.Minute*60, time.Minute*5)
+	})
+	return consumedTransfers.cache
+}
+
+// IsConsumed returns true if a transfer has already been completed using this
+// token. A token can be used any number of times until then, allowing the
+// source node to retry a transfer that failed part of the way through.
+func (p *TransferPayload) IsConsumed() bool {
+	if p.UniqueId == "" {
+		return false
+	}
+	_, exists := getConsumedTransfers().Get(p.UniqueId)
+	return exists
+}
+
+// Consume marks the token as used once a transfer has been completed using it,
+// any further requests with the same token are rejected.
+func (p *TransferPayload) Consume() {
+	if p.UniqueId == "" {
+		return
+	}
+	ttl := time.Minute * 60
+	if p.ExpirationTime != nil {
+		if d := time.Until(p.ExpirationTime.Time); d > 0 {
+			ttl = d
+		}
+	}
+	getConsumedTransfers().Set(p.UniqueId, "", ttl)
+}
@@ -63,6 +63,7 @@ func (b *LocalBackup) Generate(ctx context.Context, fsys *filesystem.Filesystem,
 	a := &filesystem.Archive{
 		Filesystem: fsys,
 		Ignore:     ignore,
+		Filter:     excludeFilter(fsys.Path()),
 	}
 
 	b.log().WithField("path", b.Path()).Info("creating backup for server")
@@ -54,6 +54,7 @@ func (s *S3Backup) Generate(ctx context.Context, fsys *filesystem.Filesystem, ig
 	a := &filesystem.Archive{
 		Filesystem: fsys,
 		Ignore:     ignore,
+		Filter:     excludeFilter(fsys.Path()),
 	}
 
 	s.log().WithField("path", s.Path()).Info("creating backup for server")
@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// excluded contains the absolute paths of files created by other parts of
+// Wings that must never be included in a backup, along with the number of
+// times each has been excluded.
+var excluded = struct {
+	mu    sync.Mutex
+	paths map[string]int
+}{paths: make(map[string]int)}
+
+// Exclude stops the file at the absolute path p from being included in any
+// backup until the returned function is called. This is used for transient
+// files, such as staged transfer archives, that may be written to a directory
+// that overlaps with the data directory of a server. Excluding a path that
+// is not within a server has no effect.
+func Exclude(p string) func() {
+	p = filepath.Clean(p)
+	excluded.mu.Lock()
+	excluded.paths[p]++
+	excluded.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			excluded.mu.Lock()
+			defer excluded.mu.Unlock()
+			if excluded.paths[p]--; excluded.paths[p] <= 0 {
+				delete(excluded.paths, p)
+			}
+		})
+	}
+}
+
+// isExcluded returns true if the file at relative within root has been
+// excluded from backups.
+func isExcluded(root, relative string) bool {
+	excluded.mu.Lock()
+	defer excluded.mu.Unlock()
+	if len(excluded.paths) == 0 {
+		return false
+	}
+	_, ok := excluded.paths[filepath.Join(root, relative)]
+	return ok
+}
+
+// excludeFilter returns a filter for a filesystem.Archive that skips every
+// excluded file within root. Exclusions are checked as each file is reached,
+// so a file excluded after the backup has started is still skipped.
+func excludeFilter(root string) func(relative string) bool {
+	return func(relative string) bool {
+		return !isExcluded(root, relative)
+	}
+}
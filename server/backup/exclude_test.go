@@ -0,0 +1,37 @@
+package backup
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestExclude(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("Exclude", func() {
+		g.It("excludes a file until it is released", func() {
+			release := Exclude("/srv/data/archive.tar.gz")
+			g.Assert(isExcluded("/srv/data", "archive.tar.gz")).IsTrue()
+			g.Assert(excludeFilter("/srv/data")("archive.tar.gz")).IsFalse()
+			g.Assert(excludeFilter("/srv/data")("server.jar")).IsTrue()
+
+			release()
+			g.Assert(isExcluded("/srv/data", "archive.tar.gz")).IsFalse()
+		})
+
+		g.It("keeps a file excluded until every exclusion is released", func() {
+			first := Exclude("/srv/data/archive.tar.gz")
+			second := Exclude("/srv/data//archive.tar.gz")
+
+			first()
+			// Releasing the same exclusion again must not release the other.
+			first()
+			g.Assert(isExcluded("/srv/data", "archive.tar.gz")).IsTrue()
+
+			second()
+			g.Assert(isExcluded("/srv/data", "archive.tar.gz")).IsFalse()
+			g.Assert(len(excluded.paths)).Equal(0)
+		})
+	})
+}
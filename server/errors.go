@@ -10,6 +10,7 @@ var (
 	ErrServerIsInstalling   = errors.New("server is currently installing")
 	ErrServerIsTransferring = errors.New("server is currently being transferred")
 	ErrServerIsRestoring    = errors.New("server is currently being restored")
+	ErrTransferIncomplete   = errors.New("server files are incomplete as a transfer did not finish extracting them")
 )
 
 type crashTooFrequent struct{}
@@ -13,6 +13,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/apex/log"
 	"github.com/juju/ratelimit"
+	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 	ignore "github.com/sabhiram/go-gitignore"
 
@@ -30,6 +31,66 @@ var pool = sync.Pool{
 	},
 }
 
+// CompressionFormat is the compression applied to the tar stream of an
+// archive.
+type CompressionFormat string
+
+const (
+	// CompressionGzip compresses the archive using gzip, this is the default.
+	CompressionGzip CompressionFormat = "gzip"
+	// CompressionZstd compresses the archive using zstd.
+	CompressionZstd CompressionFormat = "zstd"
+	// CompressionNone does not compress the archive at all, producing a plain
+	// tar file. This is useful when the underlying storage is already
+	// compressed (such as ZFS) to avoid wasting CPU on double compression.
+	CompressionNone CompressionFormat = "tar"
+)
+
+// ParseCompressionFormat returns the compression format matching the given
+// value, falling back to gzip for unknown values.
+func ParseCompressionFormat(v string) CompressionFormat {
+	switch CompressionFormat(strings.ToLower(v)) {
+	case CompressionZstd:
+		return CompressionZstd
+	case CompressionNone, "none":
+		return CompressionNone
+	default:
+		return CompressionGzip
+	}
+}
+
+// Extension returns the file extension for archives using the format.
+func (f CompressionFormat) Extension() string {
+	switch f {
+	case CompressionZstd:
+		return ".tar.zst"
+	case CompressionNone:
+		return ".tar"
+	default:
+		return ".tar.gz"
+	}
+}
+
+// MimeType returns the mime type for archives using the format.
+func (f CompressionFormat) MimeType() string {
+	switch f {
+	case CompressionZstd:
+		return "application/zstd"
+	case CompressionNone:
+		return "application/x-tar"
+	default:
+		return "application/gzip"
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
 // TarProgress .
 type TarProgress struct {
 	*tar.Writer
@@ -74,7 +135,54 @@ type Archive struct {
 	// Progress wraps the writer of the archive to pass through the progress tracker.
 	Progress *progress.Progress
 
-	w *TarProgress
+	// Compression is the compression format to use for the archive, if unset
+	// the archive will be compressed using gzip.
+	Compression CompressionFormat
+
+	// Threads is the number of goroutines used to compress the archive, values
+	// less than 1 will compress the archive using a single goroutine.
+	Threads int
+
+	// Dictionary, if set, is the zstd dictionary used to compress the archive.
+	// It is ignored by other formats. The archive can only be decompressed by
+	// a reader that has the same dictionary.
+	Dictionary []byte
+
+	// Filter, if set, is called with the relative path of every file that would
+	// otherwise be added to the archive. Only files for which it returns true
+	// are included. This is applied in addition to the Files and Ignore options.
+	Filter func(relative string) bool
+
+	// BlobCache, if set, is used to reuse the compressed contents of files that
+	// have not changed since they were last archived. This is only supported
+	// for gzip archives.
+	BlobCache BlobCache
+
+	// Checkpointer, if set, is called periodically while the archive is
+	// written so that it can be resumed if it is interrupted.
+	Checkpointer Checkpointer
+
+	// Xattrs stores the extended attributes of files and directories in the
+	// archive, which includes their POSIX ACLs and SELinux contexts.
+	Xattrs bool
+
+	// Resume, if set, continues an interrupted archive from a checkpoint
+	// rather than starting it again. The files covered by the checkpoint are
+	// skipped, ErrCheckpointStale is returned before anything is written if
+	// they have changed.
+	Resume *ResumePoint
+
+	w       *TarProgress
+	members *memberWriter
+	// boundary finishes the current block of compressed output, so that
+	// everything written so far can be decompressed without the rest.
+	boundary func() error
+	// files is the number of files added to the archive so far.
+	files   int
+	resumed bool
+	// links contains the name every file with more than one hard link was
+	// first added to the archive with.
+	links map[linkIdentity]string
 }
 
 // Create creates an archive at dst with all the files defined in the
@@ -129,27 +237,66 @@ func (a *Archive) Stream(ctx context.Context, w io.Writer) error {
 		a.Files = files
 	}
 
-	// Choose which compression level to use based on the compression_level configuration option
-	var compressionLevel int
-	switch config.Get().System.Backups.CompressionLevel {
-	case "none":
-		compressionLevel = pgzip.NoCompression
-	case "best_compression":
-		compressionLevel = pgzip.BestCompression
+	compressionLevel := compressionLevel()
+	threads := a.threads()
+
+	// Create a new compression writer around the file. Concatenated gzip
+	// members and zstd frames are read as a single stream, so a checkpoint
+	// finishes the current one and starts another.
+	var cw io.WriteCloser
+	a.boundary = func() error { return nil }
+	switch a.Compression {
+	case CompressionNone:
+		cw = nopWriteCloser{w}
+	case CompressionZstd:
+		level := zstd.SpeedFastest
+		if compressionLevel == pgzip.BestCompression {
+			level = zstd.SpeedBestCompression
+		}
+		opts := []zstd.EOption{zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(threads)}
+		if len(a.Dictionary) > 0 {
+			opts = append(opts, zstd.WithEncoderDict(a.Dictionary))
+		}
+		zw, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return errors.Wrap(err, "filesystem: failed to create zstd writer")
+		}
+		cw = zw
+		a.boundary = func() error {
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			zw.Reset(w)
+			return nil
+		}
 	default:
-		compressionLevel = pgzip.BestSpeed
+		if a.BlobCache != nil {
+			a.members = &memberWriter{out: w, level: compressionLevel}
+			cw = a.members
+			a.boundary = a.members.Close
+			break
+		}
+		gw, _ := pgzip.NewWriterLevel(w, compressionLevel)
+		_ = gw.SetConcurrency(gzipBlockSize, threads)
+		cw = gw
+		a.boundary = func() error {
+			if err := gw.Close(); err != nil {
+				return err
+			}
+			gw.Reset(w)
+			return gw.SetConcurrency(gzipBlockSize, threads)
+		}
 	}
+	defer cw.Close()
 
-	// Create a new gzip writer around the file.
-	gw, _ := pgzip.NewWriterLevel(w, compressionLevel)
-	_ = gw.SetConcurrency(1<<20, 1)
-	defer gw.Close()
-
-	// Create a new tar writer around the gzip writer.
-	tw := tar.NewWriter(gw)
+	// Create a new tar writer around the compression writer.
+	tw := tar.NewWriter(cw)
 	defer tw.Close()
 
 	a.w = NewTarProgress(tw, a.Progress)
+	a.links = nil
+	a.files = 0
+	a.resumed = false
 
 	fs := a.Filesystem.unixFS
 
@@ -179,7 +326,7 @@ func (a *Archive) Stream(ctx context.Context, w io.Writer) error {
 	}
 
 	// Recursively walk the base directory.
-	return fs.WalkDirat(dirfd, name, func(dirfd int, name, relative string, d ufs.DirEntry, err error) error {
+	err = fs.WalkDirat(dirfd, name, func(dirfd int, name, relative string, d ufs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -190,6 +337,11 @@ func (a *Archive) Stream(ctx context.Context, w io.Writer) error {
 			return callback(dirfd, name, relative, d)
 		}
 	})
+	if err == nil && a.Resume != nil && !a.resumed {
+		// The last file covered by the checkpoint no longer exists.
+		return ErrCheckpointStale
+	}
+	return err
 }
 
 // Callback function used to determine if a given file should be included in the archive
@@ -204,8 +356,9 @@ func (a *Archive) callback(opts ...walkFunc) walkFunc {
 		base = filepath.Base(a.BaseDirectory) + "/"
 	}
 	return func(dirfd int, name, relative string, d ufs.DirEntry) error {
-		// Skip directories because we are walking them recursively.
-		if d.IsDir() {
+		// Skip directories because we are walking them recursively, unless
+		// their extended attributes are being stored.
+		if d.IsDir() && !a.Xattrs {
 			return nil
 		}
 
@@ -217,6 +370,10 @@ func (a *Archive) callback(opts ...walkFunc) walkFunc {
 			relative = strings.TrimPrefix(relative, base)
 		}
 
+		if a.Filter != nil && !a.Filter(relative) {
+			return nil
+		}
+
 		// Call the additional options passed to this callback function. If any of them return
 		// a non-nil error we will exit immediately.
 		for _, opt := range opts {
@@ -228,9 +385,25 @@ func (a *Archive) callback(opts ...walkFunc) walkFunc {
 			}
 		}
 
+		if d.IsDir() {
+			// Directories covered by a checkpoint are already in the archive.
+			if a.Resume != nil && !a.resumed {
+				return nil
+			}
+			return a.addDirectory(dirfd, name, relative, d)
+		}
+
+		if a.Resume != nil && !a.resumed {
+			return a.skipResumed(relative, d)
+		}
+
 		// Add the file to the archive, if it is nested in a directory,
 		// the directory will be automatically "created" in the archive.
-		return a.addToArchive(dirfd, name, relative, d)
+		a.files++
+		if err := a.addToArchive(dirfd, name, relative, d); err != nil {
+			return err
+		}
+		return a.checkpoint(relative)
 	}
 }
 
@@ -303,6 +476,18 @@ func (a *Archive) addToArchive(dirfd int, name, relative string, entry ufs.DirEn
 		header.Name = relative
 	}
 
+	// Additional hard links to a file already in the archive are added as a
+	// link to it rather than another copy of its contents.
+	if first, ok := a.hardlink(s, header.Name); ok {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = first
+		header.Size = 0
+	}
+
+	if a.Xattrs {
+		a.addXattrs(dirfd, name, header)
+	}
+
 	// Write the tar FileInfoHeader to the archive.
 	if err := a.w.WriteHeader(header); err != nil {
 		return errors.WrapIff(err, "failed to write tar#FileInfoHeader for '%s'", name)
@@ -336,6 +521,10 @@ func (a *Archive) addToArchive(dirfd int, name, relative string, entry ufs.DirEn
 	}
 	defer f.Close()
 
+	if a.members != nil && header.Typeflag == tar.TypeReg {
+		return a.addCachedContents(f, header.Name, header.Size, buf)
+	}
+
 	// Copy the file's contents to the archive using our buffer.
 	if _, err := io.CopyBuffer(a.w, io.LimitReader(f, header.Size), buf); err != nil {
 		return errors.WrapIff(err, "failed to copy '%s' to archive", header.Name)
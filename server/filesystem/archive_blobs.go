@@ -0,0 +1,171 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// BlobCache stores the compressed contents of files keyed by the hash of
+// their contents, allowing a file that has not changed since it was last
+// archived to be added to a new archive without being compressed again.
+type BlobCache interface {
+	// Hash returns the hex encoded SHA-256 hash of the contents of the open
+	// file. The file may be read by the implementation, the caller is
+	// responsible for seeking back to the start of the file afterwards.
+	Hash(f ufs.File, st ufs.FileInfo) (string, error)
+	// Open returns the compressed blob with the given key if it exists.
+	Open(key string) (io.ReadCloser, bool)
+	// Create returns a writer for a new blob with the given key.
+	Create(key string) (BlobWriter, error)
+}
+
+// BlobWriter is returned by BlobCache.Create, the blob is only made available
+// once it has been committed.
+type BlobWriter interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
+// memberWriter writes a gzip stream made up of multiple members. Every file
+// added to an archive using a BlobCache has its contents compressed as a
+// separate member, which allows previously compressed contents to be copied
+// directly into the output. Readers treat the concatenated members as a single
+// gzip stream.
+type memberWriter struct {
+	out   io.Writer
+	level int
+	gz    *gzip.Writer
+
+	// tee receives a copy of the compressed output of the current member.
+	tee io.Writer
+	// discard drops everything written while it is set.
+	discard bool
+}
+
+func (m *memberWriter) Write(p []byte) (int, error) {
+	if m.discard {
+		return len(p), nil
+	}
+	if m.gz == nil {
+		dst := m.out
+		if m.tee != nil {
+			dst = io.MultiWriter(m.out, m.tee)
+		}
+		gz, err := gzip.NewWriterLevel(dst, m.level)
+		if err != nil {
+			return 0, err
+		}
+		m.gz = gz
+	}
+	return m.gz.Write(p)
+}
+
+// Close finishes the current member, if one has been started.
+func (m *memberWriter) Close() error {
+	if m.gz == nil {
+		return nil
+	}
+	err := m.gz.Close()
+	m.gz = nil
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// addCachedContents adds the contents of a regular file to the archive, using
+// the compressed contents from the blob cache if the file has been archived
+// before. The tar header for the file must have already been written.
+func (a *Archive) addCachedContents(f ufs.File, header string, size int64, buf []byte) error {
+	st, err := f.Stat()
+	if err != nil {
+		return errors.WrapIff(err, "failed to stat '%s'", header)
+	}
+	hash, err := a.BlobCache.Hash(f, st)
+	if err != nil {
+		return errors.WrapIff(err, "failed to hash '%s'", header)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.WrapIff(err, "failed to seek '%s'", header)
+	}
+	key := hash + "-" + strconv.Itoa(a.members.level)
+
+	// The contents of the file, including the padding added by the tar writer,
+	// are always compressed as their own member.
+	if err := a.members.Close(); err != nil {
+		return err
+	}
+
+	if rc, ok := a.BlobCache.Open(key); ok {
+		defer rc.Close()
+
+		// The tar writer still needs to account for the contents of the file, so
+		// zeros are written to it and discarded while the cached blob is copied
+		// directly into the output.
+		a.members.discard = true
+		_, err := io.CopyBuffer(a.w, io.LimitReader(zeroReader{}, size), buf)
+		if err == nil {
+			err = a.w.Flush()
+		}
+		a.members.discard = false
+		if err != nil {
+			return errors.WrapIff(err, "failed to copy '%s' to archive", header)
+		}
+		if _, err := io.Copy(a.members.out, rc); err != nil {
+			return errors.WrapIff(err, "failed to copy cached '%s' to archive", header)
+		}
+		return nil
+	}
+
+	bw, err := a.BlobCache.Create(key)
+	if err != nil {
+		// Caching is only an optimisation, add the file as normal.
+		bw = nil
+	} else {
+		a.members.tee = bw
+	}
+
+	// Hash the contents as they are read, the blob is only stored if they still
+	// match the hash it is keyed by.
+	h := sha256.New()
+	_, err = io.CopyBuffer(a.w, io.TeeReader(io.LimitReader(f, size), h), buf)
+	if err == nil {
+		err = a.w.Flush()
+	}
+	if err == nil {
+		err = a.members.Close()
+	}
+	a.members.tee = nil
+	if err != nil {
+		if bw != nil {
+			_ = bw.Abort()
+		}
+		return errors.WrapIff(err, "failed to copy '%s' to archive", header)
+	}
+	if bw == nil {
+		return nil
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		// The file changed while it was being archived.
+		return bw.Abort()
+	}
+	if err := bw.Commit(); err != nil {
+		log.WithField("file", header).WithError(err).Warn("failed to store compressed file in blob cache")
+	}
+	return nil
+}
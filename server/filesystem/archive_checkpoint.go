@@ -0,0 +1,94 @@
+package filesystem
+
+import (
+	"time"
+
+	"emperror.dev/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// ErrCheckpointStale is returned when an archive cannot be resumed from a
+// checkpoint because the files it covers are no longer the ones that were
+// written to the archive before it was interrupted.
+var ErrCheckpointStale = errors.New("filesystem: archive checkpoint is stale")
+
+// Checkpointer is used to periodically record how much of an archive has been
+// written, allowing an archive that was interrupted to be resumed rather than
+// created again from the start.
+type Checkpointer interface {
+	// Due returns true once enough of the archive has been written since the
+	// last checkpoint that another one should be taken.
+	Due() bool
+	// Checkpoint is called once everything up to and including the file at
+	// the relative path last, the files-th file added to the archive, has
+	// been written to the output. The output written so far is a complete
+	// compressed stream that the rest of the archive can be appended to.
+	Checkpoint(last string, files int) error
+}
+
+// ResumePoint is the checkpoint an archive is resumed from. The output must
+// already contain everything written before the checkpoint was taken, and
+// nothing after it.
+type ResumePoint struct {
+	// Last is the relative path of the last file covered by the checkpoint.
+	Last string
+	// Files is the number of files covered by the checkpoint.
+	Files int
+	// Since is when the interrupted archive was started. A file covered by
+	// the checkpoint that has been modified since makes it stale.
+	Since time.Time
+}
+
+// checkpoint finishes the current compressed block and reports the file that
+// was just added to the Checkpointer, if a checkpoint is due.
+func (a *Archive) checkpoint(last string) error {
+	if a.Checkpointer == nil || !a.Checkpointer.Due() {
+		return nil
+	}
+	if err := a.w.Flush(); err != nil {
+		return errors.WrapIf(err, "filesystem: failed to flush archive for checkpoint")
+	}
+	if err := a.boundary(); err != nil {
+		return errors.WrapIf(err, "filesystem: failed to finish compressed block for checkpoint")
+	}
+	return a.Checkpointer.Checkpoint(last, a.files)
+}
+
+// skipResumed skips a file that has already been written to the archive
+// before the checkpoint it is being resumed from. ErrCheckpointStale is
+// returned if the files before the checkpoint are not the same as when it was
+// taken, or have been modified since the interrupted archive was started.
+func (a *Archive) skipResumed(relative string, d ufs.DirEntry) error {
+	a.files++
+	if a.files > a.Resume.Files {
+		return ErrCheckpointStale
+	}
+	st, err := d.Info()
+	if err != nil || changedSince(st, a.Resume.Since) {
+		return ErrCheckpointStale
+	}
+	if relative != a.Resume.Last {
+		return nil
+	}
+	if a.files != a.Resume.Files {
+		return ErrCheckpointStale
+	}
+	a.resumed = true
+	return nil
+}
+
+// changedSince returns true if the contents or metadata of the file have been
+// modified after t. The change time is used as well as the modification time
+// as it is updated by the kernel and cannot be set by a user.
+func changedSince(st ufs.FileInfo, t time.Time) bool {
+	if st.ModTime().After(t) {
+		return true
+	}
+	if sys, ok := st.Sys().(*unix.Stat_t); ok {
+		// Do not remove these "redundant" type-casts, they are required for 32-bit builds to work.
+		return time.Unix(int64(sys.Ctim.Sec), int64(sys.Ctim.Nsec)).After(t)
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// testCheckpointer takes a checkpoint after every file, failing once the
+// given number of checkpoints have been taken to simulate Wings stopping.
+type testCheckpointer struct {
+	buf    *bytes.Buffer
+	after  int
+	last   string
+	files  int
+	offset int
+}
+
+func (c *testCheckpointer) Due() bool {
+	return true
+}
+
+func (c *testCheckpointer) Checkpoint(last string, files int) error {
+	if c.after == 0 {
+		return errInterrupted
+	}
+	c.after--
+	c.last, c.files, c.offset = last, files, c.buf.Len()
+	return nil
+}
+
+func archivedFiles(format CompressionFormat, b []byte) (map[string]string, error) {
+	var r io.Reader
+	switch format {
+	case CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		gr, err := pgzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := files[h.Name]; ok {
+			return nil, errors.New("duplicate file in archive: " + h.Name)
+		}
+		v, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[h.Name] = string(v)
+	}
+}
+
+func TestArchive_Checkpoint(t *testing.T) {
+	g := Goblin(t)
+	fs, _ := NewFs()
+
+	g.Describe("Archive checkpoints", func() {
+		var since time.Time
+
+		g.BeforeEach(func() {
+			for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+				r := strings.NewReader(strings.Repeat(name, 100))
+				g.Assert(fs.Write(name, r, r.Size(), 0o644)).IsNil()
+			}
+			since = time.Now()
+		})
+
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+
+		for _, format := range []CompressionFormat{CompressionGzip, CompressionZstd} {
+			format := format
+
+			g.It("resumes an interrupted "+string(format)+" archive from the last checkpoint", func() {
+				var buf bytes.Buffer
+				c := &testCheckpointer{buf: &buf, after: 2}
+				a := &Archive{Filesystem: fs, Compression: format, Checkpointer: c}
+				err := a.Stream(context.Background(), &buf)
+				g.Assert(errors.Is(err, errInterrupted)).IsTrue()
+				g.Assert(c.files).Equal(2)
+
+				// Anything written after the checkpoint is discarded.
+				buf.Truncate(c.offset)
+				a = &Archive{
+					Filesystem:  fs,
+					Compression: format,
+					Resume:      &ResumePoint{Last: c.last, Files: c.files, Since: since},
+				}
+				g.Assert(a.Stream(context.Background(), &buf)).IsNil()
+
+				files, err := archivedFiles(format, buf.Bytes())
+				g.Assert(err).IsNil()
+				g.Assert(len(files)).Equal(4)
+				for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+					g.Assert(files[name]).Equal(strings.Repeat(name, 100))
+				}
+			})
+		}
+
+		g.It("does not resume if a file covered by the checkpoint has changed", func() {
+			var buf bytes.Buffer
+			c := &testCheckpointer{buf: &buf, after: 2}
+			a := &Archive{Filesystem: fs, Checkpointer: c}
+			g.Assert(errors.Is(a.Stream(context.Background(), &buf), errInterrupted)).IsTrue()
+
+			time.Sleep(10 * time.Millisecond)
+			r := strings.NewReader("changed")
+			g.Assert(fs.Write(c.last, r, r.Size(), 0o644)).IsNil()
+
+			buf.Truncate(c.offset)
+			a = &Archive{Filesystem: fs, Resume: &ResumePoint{Last: c.last, Files: c.files, Since: since}}
+			err := a.Stream(context.Background(), &buf)
+			g.Assert(errors.Is(err, ErrCheckpointStale)).IsTrue()
+		})
+
+		g.It("does not resume if the last file covered by the checkpoint was removed", func() {
+			var buf bytes.Buffer
+			c := &testCheckpointer{buf: &buf, after: 2}
+			a := &Archive{Filesystem: fs, Checkpointer: c}
+			g.Assert(errors.Is(a.Stream(context.Background(), &buf), errInterrupted)).IsTrue()
+			g.Assert(fs.Delete(c.last)).IsNil()
+
+			buf.Truncate(c.offset)
+			a = &Archive{Filesystem: fs, Resume: &ResumePoint{Last: c.last, Files: c.files, Since: time.Now()}}
+			err := a.Stream(context.Background(), &buf)
+			g.Assert(errors.Is(err, ErrCheckpointStale)).IsTrue()
+		})
+	})
+}
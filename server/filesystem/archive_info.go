@@ -0,0 +1,113 @@
+package filesystem
+
+import (
+	"emperror.dev/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// gzipBlockSize is the size of the blocks gzip archives are compressed in when
+// using multiple goroutines.
+const gzipBlockSize = 1 << 20
+
+// CompressionInfo describes how an archive was compressed, allowing the reader
+// of the archive to choose how to decompress it.
+type CompressionInfo struct {
+	// Codec is the compression format of the archive.
+	Codec CompressionFormat `json:"codec"`
+	// Level is the compression level, this is one of "none", "best_speed" or
+	// "best_compression".
+	Level string `json:"level"`
+	// Threads is the number of goroutines the archive was compressed with.
+	Threads int `json:"threads"`
+	// BlockSize is the size of the independently compressed blocks of the
+	// archive, this is 0 if the archive is not made up of fixed size blocks.
+	BlockSize int `json:"block_size"`
+	// Dictionary is the ID of the zstd dictionary the archive was compressed
+	// with, this is 0 if no dictionary was used.
+	Dictionary uint32 `json:"dictionary,omitempty"`
+}
+
+// compressionLevel returns the gzip compression level matching the
+// compression_level configuration option.
+func compressionLevel() int {
+	switch config.Get().System.Backups.CompressionLevel {
+	case "none":
+		return pgzip.NoCompression
+	case "best_compression":
+		return pgzip.BestCompression
+	default:
+		return pgzip.BestSpeed
+	}
+}
+
+func (a *Archive) threads() int {
+	if a.Threads < 1 {
+		return 1
+	}
+	return a.Threads
+}
+
+// CompressionInfo returns a description of how the archive is compressed.
+func (a *Archive) CompressionInfo() CompressionInfo {
+	info := CompressionInfo{Codec: a.Compression, Threads: a.threads()}
+	if info.Codec == "" {
+		info.Codec = CompressionGzip
+	}
+	switch compressionLevel() {
+	case pgzip.NoCompression:
+		info.Level = "none"
+	case pgzip.BestCompression:
+		info.Level = "best_compression"
+	default:
+		info.Level = "best_speed"
+	}
+	switch info.Codec {
+	case CompressionNone:
+		info.Level = "none"
+		info.Threads = 1
+	case CompressionGzip:
+		if a.BlobCache != nil {
+			// Every file is compressed as its own member by a single goroutine.
+			info.Threads = 1
+		} else {
+			info.BlockSize = gzipBlockSize
+		}
+	case CompressionZstd:
+		if id, err := DictionaryID(a.Dictionary); err == nil {
+			info.Dictionary = id
+		}
+	}
+	return info
+}
+
+// DecoderThreads returns the number of goroutines that should be used to
+// decompress the archive, limited to max. Archives that were compressed as a
+// single stream gain nothing from decompressing ahead in parallel, while
+// archives compressed in parallel are decompressed with up to as many
+// goroutines as they were compressed with. A value of 0 is returned if the
+// archive does not describe how it was compressed, which uses the default.
+func (i CompressionInfo) DecoderThreads(max int) int {
+	if i.Threads < 1 {
+		return 0
+	}
+	if i.Codec == CompressionNone || i.Threads == 1 {
+		return 1
+	}
+	if max > 0 && i.Threads > max {
+		return max
+	}
+	return i.Threads
+}
+
+// DictionaryID returns the ID of the zstd dictionary b, an error is returned
+// if b is not a valid dictionary.
+func DictionaryID(b []byte) (uint32, error) {
+	d, err := zstd.InspectDictionary(b)
+	if err != nil {
+		return 0, errors.Wrap(err, "filesystem: invalid zstd dictionary")
+	}
+	return d.ID(), nil
+}
@@ -0,0 +1,72 @@
+package filesystem
+
+import (
+	"path/filepath"
+
+	"emperror.dev/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// linkIdentity identifies a file on the disk that may be known by more than
+// one name.
+type linkIdentity struct {
+	dev, ino uint64
+}
+
+// hardlink returns the name a file was first added to the archive with if it
+// is a hard link to a file that is already in the archive. Otherwise the file
+// is recorded under name so any later links to it can refer to it.
+func (a *Archive) hardlink(s ufs.FileInfo, name string) (string, bool) {
+	sys, ok := s.Sys().(*unix.Stat_t)
+	if !ok || sys.Nlink < 2 || !s.Mode().IsRegular() {
+		return "", false
+	}
+	id := linkIdentity{dev: uint64(sys.Dev), ino: sys.Ino}
+	if first, ok := a.links[id]; ok {
+		return first, true
+	}
+	if a.links == nil {
+		a.links = make(map[linkIdentity]string)
+	}
+	a.links[id] = name
+	return "", false
+}
+
+// extractHardlink recreates a hard link entry from an archive, linking p to
+// the file at target, relative to dir, rather than writing another copy of it.
+// Any existing file at p is replaced. The link is skipped if its target is
+// ignored or was not extracted, such as when it was skipped earlier in the
+// archive, rather than failing the rest of the extraction.
+func (fs *Filesystem) extractHardlink(dir, target, p string) error {
+	target = filepath.Join(dir, target)
+	if err := fs.IsIgnored(target); err != nil {
+		return nil
+	}
+	if _, err := fs.unixFS.Lstat(target); err != nil {
+		if errors.Is(err, ufs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	// Remove whatever is currently at p, the link takes up no additional space
+	// so only the space used by the file being replaced needs to be accounted
+	// for.
+	st, err := fs.unixFS.Lstat(p)
+	switch {
+	case err == nil:
+		if st.IsDir() {
+			return errors.WithStack(&Error{code: ErrCodeIsDirectory, resolved: p})
+		}
+		if err := fs.unixFS.Remove(p); err != nil {
+			return err
+		}
+		if sys, ok := st.Sys().(*unix.Stat_t); ok && sys.Nlink == 1 && st.Mode().IsRegular() {
+			fs.unixFS.Add(-st.Size())
+		}
+	case !errors.Is(err, ufs.ErrNotExist):
+		return err
+	}
+	return fs.unixFS.Link(target, p)
+}
@@ -0,0 +1,60 @@
+package filesystem
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// newArchivePathError returns an error for an archive entry with a path that
+// cannot be safely extracted. The name is quoted so that control characters
+// in a malicious name are not written to the logs as-is.
+func newArchivePathError(name, reason string) error {
+	return newFilesystemError(ErrCodeArchivePath, errors.New(strconv.Quote(name)+" "+reason))
+}
+
+// normalizeEntryPath returns the cleaned path of an archive entry relative to
+// the directory it is extracted to. Entries with an absolute path, a ".."
+// element, a backslash or a null byte are rejected rather than extracted to a
+// location that differs from the one their name suggests; redundant slashes
+// and "." elements are removed. Paths that resolve outside of the server root
+// are already refused when writing the file, this also catches those that
+// stay within the root but not where they appear to point.
+func normalizeEntryPath(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", newArchivePathError(name, "has an empty path")
+	case strings.ContainsRune(name, 0):
+		return "", newArchivePathError(name, "contains a null byte")
+	case strings.Contains(name, "\\"):
+		return "", newArchivePathError(name, "contains a backslash")
+	case strings.HasPrefix(name, "/"):
+		return "", newArchivePathError(name, "is an absolute path")
+	}
+	for _, e := range strings.Split(name, "/") {
+		if e == ".." {
+			return "", newArchivePathError(name, "contains a \"..\" element")
+		}
+	}
+	return path.Clean(name), nil
+}
+
+// entryPath returns the path an entry of the archive is extracted to. Archives
+// received by a transfer are created by Wings, so any entry normalizeEntryPath
+// rejects means the archive has been tampered with and the extraction fails.
+// Archives uploaded by users are often created by other tools which store
+// absolute paths, these are extracted relative to the directory instead and
+// any other entry that would be rejected is skipped, in which case an empty
+// path is returned.
+func (o extractStreamOptions) entryPath(name string) (string, error) {
+	if o.strict {
+		return normalizeEntryPath(name)
+	}
+	p, err := normalizeEntryPath(strings.TrimLeft(name, "/"))
+	if err != nil {
+		return "", nil
+	}
+	return p, nil
+}
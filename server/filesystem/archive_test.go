@@ -1,7 +1,13 @@
 package filesystem
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
 	iofs "io/fs"
 	"os"
 	"path/filepath"
@@ -11,6 +17,9 @@ import (
 
 	. "github.com/franela/goblin"
 	"github.com/mholt/archiver/v4"
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/internal/ufs"
 )
 
 func TestArchive_Stream(t *testing.T) {
@@ -84,9 +93,256 @@ func TestArchive_Stream(t *testing.T) {
 
 			g.Assert(files).Equal(expected)
 		})
+
+		for _, format := range []CompressionFormat{CompressionNone, CompressionZstd} {
+			format := format
+			g.It("creates "+string(format)+" archives that can be extracted", func() {
+				r := strings.NewReader("hello, world!\n")
+				err := fs.Write("test_file.txt", r, r.Size(), 0o644)
+				g.Assert(err).IsNil()
+
+				a := &Archive{Filesystem: fs, Compression: format}
+				archivePath := filepath.Join(rfs.root, "archive"+format.Extension())
+				g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+				f, err := os.Open(archivePath)
+				g.Assert(err).IsNil()
+				defer f.Close()
+
+				g.Assert(fs.TruncateRootDirectory()).IsNil()
+				g.Assert(fs.ExtractStreamUnsafe(context.Background(), "/", filepath.Base(archivePath), f)).IsNil()
+
+				st, err := fs.Stat("test_file.txt")
+				g.Assert(err).IsNil()
+				g.Assert(st.Size()).Equal(int64(14))
+			})
+		}
+
+		for _, format := range []CompressionFormat{CompressionGzip, CompressionZstd} {
+			format := format
+			g.It("creates "+string(format)+" archives using multiple threads that can be extracted by a single thread", func() {
+				// Larger than a single block so it is compressed in parallel.
+				data := bytes.Repeat([]byte("hello, world!\n"), 3*gzipBlockSize/14)
+				g.Assert(fs.Write("test_file.txt", bytes.NewReader(data), int64(len(data)), 0o644)).IsNil()
+
+				a := &Archive{Filesystem: fs, Compression: format, Threads: 4}
+				archivePath := filepath.Join(rfs.root, "archive"+format.Extension())
+				g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+				f, err := os.Open(archivePath)
+				g.Assert(err).IsNil()
+				defer f.Close()
+
+				g.Assert(fs.TruncateRootDirectory()).IsNil()
+				err = fs.ExtractStreamWithOptions(context.Background(), "/", filepath.Base(archivePath), f, ExtractOptions{Threads: 1})
+				g.Assert(err).IsNil()
+
+				b, err := os.ReadFile(filepath.Join(rfs.root, "/server/test_file.txt"))
+				g.Assert(err).IsNil()
+				g.Assert(bytes.Equal(b, data)).IsTrue()
+			})
+		}
+
+		g.It("preserves hard links when archiving and extracting", func() {
+			data := strings.Repeat("a", 4096)
+			g.Assert(fs.Write("world/region.mca", strings.NewReader(data), int64(len(data)), 0o644)).IsNil()
+			root := filepath.Join(rfs.root, "server")
+			g.Assert(os.MkdirAll(filepath.Join(root, "backup"), 0o755)).IsNil()
+			g.Assert(os.Link(filepath.Join(root, "world/region.mca"), filepath.Join(root, "backup/region.mca"))).IsNil()
+
+			a := &Archive{Filesystem: fs, Compression: CompressionNone}
+			archivePath := filepath.Join(rfs.root, "archive.tar")
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			// Only one copy of the contents is stored in the archive.
+			f, err := os.Open(archivePath)
+			g.Assert(err).IsNil()
+			defer f.Close()
+			var links, contents int
+			tr := tar.NewReader(f)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				g.Assert(err).IsNil()
+				if hdr.Typeflag == tar.TypeLink {
+					links++
+					g.Assert(hdr.Size).Equal(int64(0))
+				} else {
+					contents++
+				}
+			}
+			g.Assert(links).Equal(1)
+			g.Assert(contents).Equal(1)
+
+			_, err = f.Seek(0, io.SeekStart)
+			g.Assert(err).IsNil()
+			g.Assert(fs.TruncateRootDirectory()).IsNil()
+			g.Assert(fs.ExtractStreamUnsafe(context.Background(), "/", filepath.Base(archivePath), f)).IsNil()
+
+			st1, err := os.Stat(filepath.Join(root, "world/region.mca"))
+			g.Assert(err).IsNil()
+			st2, err := os.Stat(filepath.Join(root, "backup/region.mca"))
+			g.Assert(err).IsNil()
+			g.Assert(os.SameFile(st1, st2)).IsTrue()
+			g.Assert(st2.Size()).Equal(int64(len(data)))
+		})
+
+		g.It("skips hard links to files that were not extracted", func() {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			g.Assert(tw.WriteHeader(&tar.Header{Name: "backup/region.mca", Typeflag: tar.TypeLink, Linkname: "world/region.mca", Mode: 0o644})).IsNil()
+			g.Assert(tw.WriteHeader(&tar.Header{Name: "server.properties", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4})).IsNil()
+			_, err := tw.Write([]byte("data"))
+			g.Assert(err).IsNil()
+			g.Assert(tw.Close()).IsNil()
+
+			g.Assert(fs.ExtractStreamUnsafe(context.Background(), "/", "archive.tar", &buf)).IsNil()
+			_, err = os.Lstat(filepath.Join(rfs.root, "server/backup/region.mca"))
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+			b, err := os.ReadFile(filepath.Join(rfs.root, "server/server.properties"))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("data")
+		})
+
+		g.It("creates archives with cached blobs that can be extracted", func() {
+			r := strings.NewReader("hello, world!\n")
+			g.Assert(fs.Write("test_file.txt", r, r.Size(), 0o644)).IsNil()
+			r = strings.NewReader(strings.Repeat("a", 1000))
+			g.Assert(fs.Write("test/other.txt", r, r.Size(), 0o644)).IsNil()
+
+			cache := &memoryBlobCache{blobs: make(map[string][]byte)}
+			for i := 0; i < 2; i++ {
+				a := &Archive{Filesystem: fs, BlobCache: cache}
+				archivePath := filepath.Join(rfs.root, "archive.tar.gz")
+				g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+				g.Assert(len(cache.blobs)).Equal(2)
+
+				f, err := os.Open(archivePath)
+				g.Assert(err).IsNil()
+				g.Assert(fs.TruncateRootDirectory()).IsNil()
+				g.Assert(fs.ExtractStreamUnsafe(context.Background(), "/", filepath.Base(archivePath), f)).IsNil()
+				_ = f.Close()
+
+				b, err := os.ReadFile(filepath.Join(rfs.root, "/server/test_file.txt"))
+				g.Assert(err).IsNil()
+				g.Assert(string(b)).Equal("hello, world!\n")
+				st, err := fs.Stat("test/other.txt")
+				g.Assert(err).IsNil()
+				g.Assert(st.Size()).Equal(int64(1000))
+			}
+			g.Assert(cache.hits).Equal(2)
+		})
+
+		g.It("preserves extended attributes when archiving and extracting", func() {
+			r := strings.NewReader("hello, world!\n")
+			g.Assert(fs.Write("config/server.properties", r, r.Size(), 0o644)).IsNil()
+			file := filepath.Join(rfs.root, "server/config/server.properties")
+			dir := filepath.Join(rfs.root, "server/config")
+			if err := unix.Setxattr(file, "user.wings.test", []byte("file"), 0); err != nil {
+				// The filesystem the tests are run on does not support them.
+				g.Assert(errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM)).IsTrue()
+				return
+			}
+			g.Assert(unix.Setxattr(dir, "user.wings.test", []byte("directory"), 0)).IsNil()
+
+			archivePath := filepath.Join(rfs.root, "archive.tar")
+			for _, preserve := range []bool{false, true} {
+				a := &Archive{Filesystem: fs, Compression: CompressionNone, Xattrs: preserve}
+				g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+				f, err := os.Open(archivePath)
+				g.Assert(err).IsNil()
+				g.Assert(fs.TruncateRootDirectory()).IsNil()
+				g.Assert(fs.ExtractStreamWithOptions(context.Background(), "/", filepath.Base(archivePath), f, ExtractOptions{Xattrs: true})).IsNil()
+				_ = f.Close()
+
+				b, err := os.ReadFile(file)
+				g.Assert(err).IsNil()
+				g.Assert(string(b)).Equal("hello, world!\n")
+
+				v := make([]byte, 64)
+				n, err := unix.Getxattr(file, "user.wings.test", v)
+				if !preserve {
+					g.Assert(errors.Is(err, unix.ENODATA)).IsTrue()
+					// Restore the attributes removed by extracting the archive.
+					g.Assert(unix.Setxattr(file, "user.wings.test", []byte("file"), 0)).IsNil()
+					g.Assert(unix.Setxattr(dir, "user.wings.test", []byte("directory"), 0)).IsNil()
+					continue
+				}
+				g.Assert(err).IsNil()
+				g.Assert(string(v[:n])).Equal("file")
+				n, err = unix.Getxattr(dir, "user.wings.test", v)
+				g.Assert(err).IsNil()
+				g.Assert(string(v[:n])).Equal("directory")
+			}
+		})
+
+		g.It("only restores user attributes and ACLs by default", func() {
+			hdr := &tar.Header{PAXRecords: map[string]string{
+				paxXattrPrefix + "user.wings.test":          "user",
+				paxXattrPrefix + "system.posix_acl_access":  "acl",
+				paxXattrPrefix + "system.posix_acl_default": "acl",
+				paxXattrPrefix + "security.selinux":         "system_u:object_r:container_file_t:s0",
+				paxXattrPrefix + "security.capability":      "cap",
+				paxXattrPrefix + "trusted.overlay.opaque":   "y",
+			}}
+			attrs := headerXattrs(hdr, false)
+			g.Assert(len(attrs)).Equal(3)
+			g.Assert(attrs["user.wings.test"]).Equal("user")
+			_, ok := attrs["security.selinux"]
+			g.Assert(ok).IsFalse()
+
+			attrs = headerXattrs(hdr, true)
+			g.Assert(len(attrs)).Equal(4)
+			g.Assert(attrs["security.selinux"]).Equal("system_u:object_r:container_file_t:s0")
+			_, ok = attrs["security.capability"]
+			g.Assert(ok).IsFalse()
+		})
 	})
 }
 
+type memoryBlobCache struct {
+	blobs map[string][]byte
+	hits  int
+}
+
+func (c *memoryBlobCache) Hash(f ufs.File, _ ufs.FileInfo) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *memoryBlobCache) Open(key string) (io.ReadCloser, bool) {
+	b, ok := c.blobs[key]
+	if ok {
+		c.hits++
+	}
+	return io.NopCloser(bytes.NewReader(b)), ok
+}
+
+func (c *memoryBlobCache) Create(key string) (BlobWriter, error) {
+	return &memoryBlobWriter{cache: c, key: key}, nil
+}
+
+type memoryBlobWriter struct {
+	bytes.Buffer
+	cache *memoryBlobCache
+	key   string
+}
+
+func (w *memoryBlobWriter) Commit() error {
+	w.cache.blobs[w.key] = w.Bytes()
+	return nil
+}
+
+func (w *memoryBlobWriter) Abort() error {
+	return nil
+}
+
 func getFiles(f iofs.ReadDirFS, name string) ([]string, error) {
 	var v []string
 
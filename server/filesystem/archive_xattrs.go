@@ -0,0 +1,168 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/internal/ufs"
+)
+
+// paxXattrPrefix is the prefix of the PAX records used to store the extended
+// attributes of a file in a tar archive. This is the same format used by GNU
+// tar and bsdtar, so archives can also be extracted with them.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// readXattrs returns every extended attribute of the open file. POSIX ACLs are
+// stored as the "system.posix_acl_access" and "system.posix_acl_default"
+// attributes and are returned along with the rest.
+func readXattrs(fd int) (map[string]string, error) {
+	size, err := unix.Flistxattr(fd, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	list := make([]byte, size)
+	size, err = unix.Flistxattr(fd, list)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]string)
+	for _, name := range bytes.Split(list[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := unix.Fgetxattr(fd, string(name), nil)
+		if err != nil {
+			// The attribute was removed since the list was read.
+			if errors.Is(err, unix.ENODATA) {
+				continue
+			}
+			return nil, err
+		}
+		v := make([]byte, n)
+		if n > 0 {
+			if n, err = unix.Fgetxattr(fd, string(name), v); err != nil {
+				return nil, err
+			}
+		}
+		attrs[string(name)] = string(v[:n])
+	}
+	return attrs, nil
+}
+
+// addXattrs stores the extended attributes of a regular file or directory in
+// its header. Symlinks and other special files are skipped, as are additional
+// hard links which share the attributes of the file they link to. A file whose
+// attributes cannot be read is still added to the archive without them.
+func (a *Archive) addXattrs(dirfd int, name string, header *tar.Header) {
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+		return
+	}
+	f, err := a.Filesystem.unixFS.OpenFileat(dirfd, name, ufs.O_RDONLY|ufs.O_NOFOLLOW, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	attrs, err := readXattrs(int(f.Fd()))
+	if err != nil {
+		if !errors.Is(err, unix.ENOTSUP) {
+			log.WithField("name", header.Name).WithError(err).Warn("failed to read extended attributes of file, archiving it without them")
+		}
+		return
+	}
+	if len(attrs) == 0 {
+		return
+	}
+	if header.PAXRecords == nil {
+		header.PAXRecords = make(map[string]string, len(attrs))
+	}
+	for k, v := range attrs {
+		header.PAXRecords[paxXattrPrefix+k] = v
+	}
+	header.Format = tar.FormatPAX
+}
+
+// addDirectory adds a directory to the archive if it has any extended
+// attributes. Other directories are not added, they are created as the parents
+// of the files in them when the archive is extracted.
+func (a *Archive) addDirectory(dirfd int, name, relative string, entry ufs.DirEntry) error {
+	if relative == "" || relative == "." {
+		return nil
+	}
+	s, err := entry.Info()
+	if err != nil {
+		if errors.Is(err, ufs.ErrNotExist) {
+			return nil
+		}
+		return errors.WrapIff(err, "failed executing os.Lstat on '%s'", name)
+	}
+	header, err := tar.FileInfoHeader(s, "")
+	if err != nil {
+		return errors.WrapIff(err, "failed to get tar#FileInfoHeader for '%s'", name)
+	}
+	header.Name = strings.TrimSuffix(relative, "/") + "/"
+	a.addXattrs(dirfd, name, header)
+	if header.Format != tar.FormatPAX {
+		return nil
+	}
+	if err := a.w.WriteHeader(header); err != nil {
+		return errors.WrapIff(err, "failed to write tar#FileInfoHeader for '%s'", name)
+	}
+	return nil
+}
+
+// restorableXattr returns true if an extended attribute stored in an archive
+// may be restored. Only user attributes and POSIX ACLs are restored, along
+// with SELinux contexts if selinux is true. Every other attribute, such as
+// file capabilities and trusted attributes, would let the archive grant
+// privileges to the files of the server and is always dropped.
+func restorableXattr(name string, selinux bool) bool {
+	switch {
+	case strings.HasPrefix(name, "user."):
+		return true
+	case name == "system.posix_acl_access", name == "system.posix_acl_default":
+		return true
+	case name == "security.selinux":
+		return selinux
+	default:
+		return false
+	}
+}
+
+// headerXattrs returns the extended attributes stored in a tar header that
+// may be restored, see restorableXattr.
+func headerXattrs(hdr *tar.Header, selinux bool) map[string]string {
+	var attrs map[string]string
+	for k, v := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(k, paxXattrPrefix); ok && restorableXattr(name, selinux) {
+			if attrs == nil {
+				attrs = make(map[string]string)
+			}
+			attrs[name] = v
+		}
+	}
+	return attrs
+}
+
+// restoreXattrs sets the extended attributes stored in the header of an
+// archive entry on the file that was extracted to p. Attributes that cannot be
+// set, such as those in a namespace this node does not have permission to
+// write or that the filesystem does not support, are logged and skipped so a
+// single attribute does not prevent the rest of the archive from extracting.
+func (fs *Filesystem) restoreXattrs(p string, attrs map[string]string) error {
+	f, err := fs.unixFS.OpenFile(p, ufs.O_RDONLY|ufs.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for k, v := range attrs {
+		if err := unix.Fsetxattr(int(f.Fd()), k, []byte(v), 0); err != nil {
+			log.WithField("name", p).WithField("attribute", k).WithError(err).Warn("failed to restore extended attribute of file")
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"archive/tar"
 	"context"
 	"fmt"
 	"io"
@@ -163,9 +164,30 @@ func (fs *Filesystem) DecompressFile(ctx context.Context, dir string, file strin
 	})
 }
 
-// ExtractStreamUnsafe .
-func (fs *Filesystem) ExtractStreamUnsafe(ctx context.Context, dir string, r io.Reader) error {
-	format, input, err := archiver.Identify("archive.tar.gz", r)
+// ExtractStreamUnsafe extracts the archive read from r into dir. The name of
+// the archive is used alongside the contents of the stream to identify the
+// format of the archive.
+func (fs *Filesystem) ExtractStreamUnsafe(ctx context.Context, dir, name string, r io.Reader) error {
+	return fs.ExtractStreamLimited(ctx, dir, name, r, ExtractLimit{})
+}
+
+// ExtractStreamLimited extracts the archive read from r into dir in the same
+// way as ExtractStreamUnsafe, returning ErrDecompressionLimit and stopping once
+// the amount of data extracted exceeds the limit. Anything extracted before the
+// limit was reached is left in place.
+func (fs *Filesystem) ExtractStreamLimited(ctx context.Context, dir, name string, r io.Reader, limit ExtractLimit) error {
+	return fs.ExtractStreamWithOptions(ctx, dir, name, r, ExtractOptions{Limit: limit})
+}
+
+// ExtractStreamWithOptions extracts the archive read from r into dir in the
+// same way as ExtractStreamLimited, decompressing it as configured by opts.
+func (fs *Filesystem) ExtractStreamWithOptions(ctx context.Context, dir, name string, r io.Reader, opts ExtractOptions) error {
+	var counter *extractCounter
+	if opts.Limit.enabled() {
+		counter = &extractCounter{limit: opts.Limit}
+		r = counter.input(r)
+	}
+	format, input, err := identifyArchive(name, r, opts.Dictionaries)
 	if err != nil {
 		if errors.Is(err, archiver.ErrNoMatch) {
 			return newFilesystemError(ErrCodeUnknownArchive, err)
@@ -174,11 +196,44 @@ func (fs *Filesystem) ExtractStreamUnsafe(ctx context.Context, dir string, r io.
 	}
 	return fs.extractStream(ctx, extractStreamOptions{
 		Directory: dir,
-		Format:    format,
+		Format:    decompressionFormat(format, opts.Threads, opts.MemoryBudget, opts.Dictionaries),
 		Reader:    input,
+		counter:   counter,
+		xattrs:    opts.Xattrs,
+		selinux:   opts.SELinux,
+		strict:    true,
 	})
 }
 
+// identifyArchive returns the format of the archive read from r. Identifying
+// an archive decompresses the start of it without any dictionaries, which
+// fails for zstd archives compressed with one, so if dictionaries are given a
+// ".tar.zst" archive is assumed to be exactly that.
+func identifyArchive(name string, r io.Reader, dicts [][]byte) (archiver.Format, io.Reader, error) {
+	if len(dicts) > 0 && strings.HasSuffix(name, CompressionZstd.Extension()) {
+		return archiver.CompressedArchive{Compression: archiver.Zstd{}, Archival: archiver.Tar{}}, r, nil
+	}
+	return archiver.Identify(name, r)
+}
+
+// chownParents sets the ownership of the directories between dir and p, which
+// are created as required while extracting an archive, to the user servers run
+// as. Directories in owned have already been updated and are skipped, so each
+// directory is only changed once per archive.
+func (fs *Filesystem) chownParents(dir, p string, owned map[string]struct{}) error {
+	dir = filepath.Clean(dir)
+	for d := filepath.Dir(p); d != dir && d != "." && d != "/"; d = filepath.Dir(d) {
+		if _, ok := owned[d]; ok {
+			break
+		}
+		owned[d] = struct{}{}
+		if err := fs.chownFile(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type extractStreamOptions struct {
 	// The directory to extract the archive to.
 	Directory string
@@ -188,6 +243,15 @@ type extractStreamOptions struct {
 	Format archiver.Format
 	// Reader for the archive.
 	Reader io.Reader
+	// counter limits the amount of data extracted, if set.
+	counter *extractCounter
+	// xattrs restores the extended attributes stored in the archive.
+	xattrs bool
+	// selinux also restores the SELinux contexts stored in the archive.
+	selinux bool
+	// strict fails the extraction for entries with a path that cannot be
+	// safely extracted, rather than skipping them.
+	strict bool
 }
 
 func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptions) error {
@@ -216,6 +280,10 @@ func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptio
 			return err
 		}
 		defer reader.Close()
+		var src io.Reader = reader
+		if opts.counter != nil {
+			src = opts.counter.output(reader)
+		}
 
 		// Open the file for creation/writing
 		f, err := fs.unixFS.OpenFile(p, ufs.O_WRONLY|ufs.O_CREATE, 0o644)
@@ -227,7 +295,7 @@ func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptio
 		// Read in 4 KB chunks
 		buf := make([]byte, 4096)
 		for {
-			n, err := reader.Read(buf)
+			n, err := src.Read(buf)
 			if n > 0 {
 
 				// Check quota before writing the chunk
@@ -258,24 +326,82 @@ func (fs *Filesystem) extractStream(ctx context.Context, opts extractStreamOptio
 		return nil
 	}
 
-	// Decompress and extract archive
+	// Decompress and extract archive. Files are owned by the user servers run
+	// as regardless of the ownership stored in the archive, which is only
+	// meaningful on the machine it was created on.
+	owned := make(map[string]struct{})
 	return ex.Extract(ctx, opts.Reader, nil, func(ctx context.Context, f archiver.File) error {
+		name, err := opts.entryPath(f.NameInArchive)
+		if err != nil || name == "" {
+			return err
+		}
+		p := filepath.Join(opts.Directory, name)
+		var attrs map[string]string
+		if hdr, ok := f.Header.(*tar.Header); ok && opts.xattrs {
+			attrs = headerXattrs(hdr, opts.selinux)
+		}
 		if f.IsDir() {
-			return nil
+			// Directories are otherwise only created as the parents of the
+			// files in them, but their attributes have to be set before any
+			// of their files are extracted so default ACLs are inherited.
+			if len(attrs) == 0 || fs.IsIgnored(p) != nil {
+				return nil
+			}
+			if err := fs.unixFS.MkdirAll(p, 0o755); err != nil {
+				return wrapError(err, opts.FileName)
+			}
+			if err := fs.chownParents(opts.Directory, p, owned); err != nil {
+				return wrapError(err, opts.FileName)
+			}
+			if _, ok := owned[p]; !ok {
+				owned[p] = struct{}{}
+				if err := fs.chownFile(p); err != nil {
+					return wrapError(err, opts.FileName)
+				}
+			}
+			return wrapError(fs.restoreXattrs(p, attrs), opts.FileName)
 		}
-		p := filepath.Join(opts.Directory, f.NameInArchive)
 		// If it is ignored, just don't do anything with the file and skip over it.
 		if err := fs.IsIgnored(p); err != nil {
 			return nil
 		}
-		r, err := f.Open()
+		if opts.counter != nil {
+			// Reject a file as soon as its header claims it is larger than what
+			// is left of the limit.
+			if err := opts.counter.checkSize(f.Size()); err != nil {
+				return err
+			}
+		}
+		if hdr, ok := f.Header.(*tar.Header); ok && hdr.Typeflag == tar.TypeLink {
+			target, err := opts.entryPath(hdr.Linkname)
+			if err != nil || target == "" {
+				return err
+			}
+			if err := fs.extractHardlink(opts.Directory, target, p); err != nil {
+				return wrapError(err, opts.FileName)
+			}
+			return fs.chownParents(opts.Directory, p, owned)
+		}
+		rc, err := f.Open()
 		if err != nil {
 			return err
 		}
-		defer r.Close()
+		defer rc.Close()
+		var r io.Reader = rc
+		if opts.counter != nil {
+			r = opts.counter.output(rc)
+		}
 		if err := fs.Write(p, r, f.Size(), f.Mode()); err != nil {
 			return wrapError(err, opts.FileName)
 		}
+		if err := fs.chownParents(opts.Directory, p, owned); err != nil {
+			return wrapError(err, opts.FileName)
+		}
+		if len(attrs) > 0 {
+			if err := fs.restoreXattrs(p, attrs); err != nil {
+				return wrapError(err, opts.FileName)
+			}
+		}
 		// Update the file modification time to the one set in the archive.
 		if err := fs.Chtimes(p, f.ModTime(), f.ModTime()); err != nil {
 			return wrapError(err, opts.FileName)
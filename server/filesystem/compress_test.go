@@ -1,11 +1,20 @@
 package filesystem
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"context"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"emperror.dev/errors"
 	. "github.com/franela/goblin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/mholt/archiver/v4"
 )
 
 // Given an archive named test.{ext}, with the following file structure:
@@ -52,3 +61,145 @@ func TestFilesystem_DecompressFile(t *testing.T) {
 		})
 	})
 }
+
+func TestFilesystem_ExtractStreamLimited(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	archive := func(size int) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		_ = tw.WriteHeader(&tar.Header{Name: "file.txt", Mode: 0o644, Size: int64(size), Typeflag: tar.TypeReg})
+		_, _ = tw.Write([]byte(strings.Repeat("a", size)))
+		_ = tw.Close()
+		_ = gw.Close()
+		return buf.Bytes()
+	}
+
+	g.Describe("ExtractStreamLimited", func() {
+		g.It("extracts an archive within the limit", func() {
+			err := fs.ExtractStreamLimited(context.Background(), "/", "archive.tar.gz", bytes.NewReader(archive(1024)), ExtractLimit{MaxSize: 4096})
+			g.Assert(err).IsNil()
+
+			st, err := rfs.StatServerFile("file.txt")
+			g.Assert(err).IsNil()
+			g.Assert(st.Size()).Equal(int64(1024))
+		})
+
+		g.It("stops extracting once the maximum size is exceeded", func() {
+			err := fs.ExtractStreamLimited(context.Background(), "/", "archive.tar.gz", bytes.NewReader(archive(1024)), ExtractLimit{MaxSize: 512})
+			g.Assert(errors.Is(err, ErrDecompressionLimit)).IsTrue()
+		})
+
+		g.It("only checks the ratio once enough data has been extracted", func() {
+			c := &extractCounter{limit: ExtractLimit{MaxRatio: 10}}
+			c.read.Store(1)
+			g.Assert(c.check(minRatioCheckSize)).IsNil()
+			g.Assert(errors.Is(c.check(minRatioCheckSize+1), ErrDecompressionLimit)).IsTrue()
+		})
+
+		g.It("extracts an archive within a memory budget", func() {
+			for _, budget := range []int64{1, 20 << 20} {
+				err := fs.ExtractStreamWithOptions(context.Background(), "/", "archive.tar.gz", bytes.NewReader(archive(1024)), ExtractOptions{MemoryBudget: budget})
+				g.Assert(err).IsNil()
+
+				st, err := rfs.StatServerFile("file.txt")
+				g.Assert(err).IsNil()
+				g.Assert(st.Size()).Equal(int64(1024))
+			}
+		})
+
+		g.It("reads fewer blocks ahead when the memory budget is tight", func() {
+			gz := archiver.CompressedArchive{Compression: archiver.Gz{}, Archival: archiver.Tar{}}
+			f := decompressionFormat(gz, 0, 1, nil).(archiver.CompressedArchive)
+			g.Assert(f.Compression.(boundedGz).blocks).Equal(1)
+			f = decompressionFormat(gz, 0, 1<<30, nil).(archiver.CompressedArchive)
+			g.Assert(f.Compression.(boundedGz).blocks).Equal(gzipReadAheadBlocks)
+		})
+
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+	})
+}
+
+func TestFilesystem_ExtractStreamEntryPaths(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+
+	archive := func(name string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 4, Typeflag: tar.TypeReg, Format: tar.FormatPAX})
+		_, _ = tw.Write([]byte("test"))
+		_ = tw.Close()
+		return buf.Bytes()
+	}
+
+	g.Describe("ExtractStream entry paths", func() {
+		g.It("extracts entries with redundant path elements", func() {
+			err := fs.ExtractStreamLimited(context.Background(), "/", "archive.tar", bytes.NewReader(archive("./config//server.properties")), ExtractLimit{})
+			g.Assert(err).IsNil()
+
+			st, err := rfs.StatServerFile("config/server.properties")
+			g.Assert(err).IsNil()
+			g.Assert(st.Size()).Equal(int64(4))
+		})
+
+		for _, name := range []string{"/etc/passwd", "../outside.txt", "config/../../outside.txt", "config\\server.properties"} {
+			name := name
+			g.It("rejects an entry named "+strconv.Quote(name), func() {
+				err := fs.ExtractStreamLimited(context.Background(), "/", "archive.tar", bytes.NewReader(archive(name)), ExtractLimit{})
+				g.Assert(IsErrorCode(err, ErrCodeArchivePath)).IsTrue()
+
+				_, err = rfs.StatServerFile("outside.txt")
+				g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+			})
+		}
+
+		g.It("rejects an entry with a null byte in its name", func() {
+			// The tar writer refuses to write such a name, zip does not.
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			w, _ := zw.Create("server.properties\x00.txt")
+			_, _ = w.Write([]byte("test"))
+			_ = zw.Close()
+
+			err := fs.ExtractStreamLimited(context.Background(), "/", "archive.zip", bytes.NewReader(buf.Bytes()), ExtractLimit{})
+			g.Assert(IsErrorCode(err, ErrCodeArchivePath)).IsTrue()
+		})
+
+		g.It("extracts absolute paths of an uploaded archive relative to the directory", func() {
+			g.Assert(rfs.CreateServerFile("upload.tar", archive("/config/server.properties"))).IsNil()
+			g.Assert(fs.DecompressFile(context.Background(), "/", "upload.tar")).IsNil()
+
+			st, err := rfs.StatServerFile("config/server.properties")
+			g.Assert(err).IsNil()
+			g.Assert(st.Size()).Equal(int64(4))
+		})
+
+		g.It("skips unsafe entries of an uploaded archive", func() {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, name := range []string{"../outside.txt", "config\\server.properties", "server.properties"} {
+				_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 4, Typeflag: tar.TypeReg})
+				_, _ = tw.Write([]byte("test"))
+			}
+			_ = tw.Close()
+			g.Assert(rfs.CreateServerFile("upload.tar", buf.Bytes())).IsNil()
+			g.Assert(fs.DecompressFile(context.Background(), "/", "upload.tar")).IsNil()
+
+			_, err := rfs.StatServerFile("server.properties")
+			g.Assert(err).IsNil()
+			_, err = rfs.StatServerFile("config\\server.properties")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+			_, err = os.Stat(filepath.Join(rfs.root, "outside.txt"))
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.AfterEach(func() {
+			_ = fs.TruncateRootDirectory()
+		})
+	})
+}
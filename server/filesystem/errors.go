@@ -18,6 +18,7 @@ const (
 	ErrCodeUnknownArchive ErrorCode = "E_UNKNFMT"
 	ErrCodePathResolution ErrorCode = "E_BADPATH"
 	ErrCodeDenylistFile   ErrorCode = "E_DENYLIST"
+	ErrCodeArchivePath    ErrorCode = "E_ARCHIVEPATH"
 	ErrCodeUnknownError   ErrorCode = "E_UNKNOWN"
 	ErrNotExist           ErrorCode = "E_NOTEXIST"
 )
@@ -70,6 +71,8 @@ func (e *Error) Error() string {
 			r = "<empty>"
 		}
 		return fmt.Sprintf("filesystem: server path [%s] resolves to a location outside the server root: %s", e.path, r)
+	case ErrCodeArchivePath:
+		return fmt.Sprintf("filesystem: refusing to extract archive entry: %s", e.Unwrap())
 	case ErrNotExist:
 		return "filesystem: does not exist"
 	case ErrCodeUnknownError:
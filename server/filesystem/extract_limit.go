@@ -0,0 +1,102 @@
+package filesystem
+
+import (
+	"io"
+	"sync/atomic"
+
+	"emperror.dev/errors"
+)
+
+// ErrDecompressionLimit is returned when extracting an archive would write
+// more data than is allowed by the ExtractLimit the archive is extracted with.
+var ErrDecompressionLimit = errors.New("filesystem: decompression limit exceeded")
+
+// minRatioCheckSize is the amount of data that can always be extracted before
+// the compression ratio of an archive is checked. Small archives of highly
+// compressible files could otherwise be rejected.
+const minRatioCheckSize = 64 * 1024 * 1024
+
+// ExtractLimit limits the amount of data that can be written when extracting
+// an archive, protecting against archives that expand to many times their own
+// size.
+type ExtractLimit struct {
+	// MaxSize is the maximum number of bytes that can be extracted, if the
+	// value is less than 1 there is no limit.
+	MaxSize int64
+	// MaxRatio is the maximum number of bytes that can be extracted for each
+	// byte of the archive that has been read, if the value is less than 1
+	// there is no limit.
+	MaxRatio int64
+}
+
+func (l ExtractLimit) enabled() bool {
+	return l.MaxSize > 0 || l.MaxRatio > 0
+}
+
+// extractCounter tracks the data read from an archive and the data extracted
+// from it. The archive may be read ahead of extraction by another goroutine
+// when it is decompressed in parallel.
+type extractCounter struct {
+	limit     ExtractLimit
+	read      atomic.Int64
+	extracted int64
+}
+
+// checkSize returns ErrDecompressionLimit if extracting n more bytes would
+// exceed the maximum size.
+func (c *extractCounter) checkSize(n int64) error {
+	if total := c.extracted + n; c.limit.MaxSize > 0 && total > c.limit.MaxSize {
+		return errors.WithDetails(ErrDecompressionLimit, "extracted", total, "limit", c.limit.MaxSize)
+	}
+	return nil
+}
+
+// check returns ErrDecompressionLimit if extracting n more bytes would exceed
+// the maximum size, or the maximum ratio to the data read from the archive.
+func (c *extractCounter) check(n int64) error {
+	if err := c.checkSize(n); err != nil {
+		return err
+	}
+	if total := c.extracted + n; c.limit.MaxRatio > 0 && total > minRatioCheckSize && total > c.read.Load()*c.limit.MaxRatio {
+		return errors.WithDetails(ErrDecompressionLimit, "extracted", total, "read", c.read.Load(), "ratio", c.limit.MaxRatio)
+	}
+	return nil
+}
+
+// input wraps the reader for the archive so the data read from it is counted.
+func (c *extractCounter) input(r io.Reader) io.Reader {
+	return &countedInput{r: r, c: c}
+}
+
+// output wraps a reader for data extracted from the archive so extraction is
+// stopped once the limit has been exceeded.
+func (c *extractCounter) output(r io.Reader) io.Reader {
+	return &countedOutput{r: r, c: c}
+}
+
+type countedInput struct {
+	r io.Reader
+	c *extractCounter
+}
+
+func (i *countedInput) Read(p []byte) (int, error) {
+	n, err := i.r.Read(p)
+	i.c.read.Add(int64(n))
+	return n, err
+}
+
+type countedOutput struct {
+	r io.Reader
+	c *extractCounter
+}
+
+func (o *countedOutput) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	if n > 0 {
+		if lerr := o.c.check(int64(n)); lerr != nil {
+			return 0, lerr
+		}
+		o.c.extracted += int64(n)
+	}
+	return n, err
+}
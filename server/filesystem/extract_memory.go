@@ -0,0 +1,110 @@
+package filesystem
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/mholt/archiver/v4"
+)
+
+const (
+	// minMemoryBudget is the smallest memory budget archives are decompressed
+	// with, this is the window size of zstd archives created by Wings.
+	minMemoryBudget = 8 << 20
+	// lowMemoryBudget is the budget below which zstd archives are decoded
+	// without decompressing blocks ahead of the extraction.
+	lowMemoryBudget = 32 << 20
+	// gzipReadAheadBlocks is the maximum number of blocks of a gzip archive
+	// decompressed ahead of the extraction.
+	gzipReadAheadBlocks = 4
+)
+
+// ExtractOptions controls how an archive is decompressed and extracted.
+type ExtractOptions struct {
+	// Limit limits the amount of data that can be extracted.
+	Limit ExtractLimit
+	// Threads is the number of goroutines used to decompress the archive, if
+	// the value is less than 1 GOMAXPROCS goroutines are used.
+	Threads int
+	// MemoryBudget is the approximate number of bytes the decompressor is
+	// allowed to buffer. If the value is less than 1 there is no budget,
+	// otherwise it is raised to at least 8 MiB. A tight budget reduces the
+	// data decompressed ahead of the extraction, favouring lower memory usage
+	// over speed. Zstd archives with a window larger than the budget are
+	// rejected rather than being allowed to allocate it.
+	MemoryBudget int64
+	// Dictionaries are the zstd dictionaries that zstd archives may have been
+	// compressed with. An archive compressed with any other dictionary cannot
+	// be decompressed.
+	Dictionaries [][]byte
+	// Xattrs restores the extended attributes stored in the archive on the
+	// files and directories that are extracted. Only user attributes and
+	// POSIX ACLs are restored.
+	Xattrs bool
+	// SELinux also restores the SELinux contexts stored in the archive when
+	// extended attributes are restored.
+	SELinux bool
+}
+
+// boundedGz decompresses gzip archives with a fixed number of blocks read
+// ahead, or in a single goroutine if blocks is less than 2.
+type boundedGz struct {
+	archiver.Gz
+	blocks int
+}
+
+func (gz boundedGz) OpenReader(r io.Reader) (io.ReadCloser, error) {
+	if gz.blocks < 2 {
+		return archiver.Gz{}.OpenReader(r)
+	}
+	return pgzip.NewReaderN(r, gzipBlockSize, gz.blocks)
+}
+
+// decompressionFormat returns the format with multithreaded decompression
+// enabled if the compression used by the archive supports it and threads is
+// not 1, limited by the memory budget if one is set. Zstd archives are able to
+// use any of the given dictionaries.
+func decompressionFormat(format archiver.Format, threads int, budget int64, dicts [][]byte) archiver.Format {
+	ca, ok := format.(archiver.CompressedArchive)
+	if !ok {
+		return format
+	}
+	if threads < 1 {
+		// A concurrency of 0 uses GOMAXPROCS goroutines.
+		threads = 0
+	}
+	if budget > 0 && budget < minMemoryBudget {
+		budget = minMemoryBudget
+	}
+	switch ca.Compression.(type) {
+	case archiver.Gz:
+		if budget <= 0 {
+			ca.Compression = archiver.Gz{Multithreaded: threads != 1}
+			break
+		}
+		// Every block read ahead holds both its compressed and decompressed
+		// contents, leaving room for the block currently being extracted.
+		blocks := int(budget/(4*gzipBlockSize)) - 1
+		if blocks > gzipReadAheadBlocks {
+			blocks = gzipReadAheadBlocks
+		}
+		if threads == 1 {
+			blocks = 0
+		}
+		ca.Compression = boundedGz{blocks: blocks}
+	case archiver.Zstd:
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(threads)}
+		if len(dicts) > 0 {
+			opts = append(opts, zstd.WithDecoderDicts(dicts...))
+		}
+		if budget > 0 {
+			opts = append(opts, zstd.WithDecoderMaxWindow(uint64(budget)), zstd.WithDecoderMaxMemory(uint64(budget)))
+			if budget < lowMemoryBudget {
+				opts = append(opts, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+			}
+		}
+		ca.Compression = archiver.Zstd{DecoderOptions: opts}
+	}
+	return ca
+}
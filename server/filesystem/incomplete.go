@@ -0,0 +1,56 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// IncompleteMarker is the name of the file written to the root of a server's
+// data directory while a transfer is extracting files into it. It is only
+// removed once the transfer has completed successfully, so a directory that
+// still contains it may be missing files or contain a mix of old and new ones.
+const IncompleteMarker = ".wings-transfer-incomplete"
+
+// MarkExtractionIncomplete writes the incomplete marker to the root of the
+// directory, recording the identifier of the transfer extracting files into
+// it. The marker is written directly rather than through the server root, the
+// directory is owned by Wings and the marker is never followed if it has been
+// replaced by a symlink.
+func MarkExtractionIncomplete(dir, id string) error {
+	p := filepath.Join(dir, IncompleteMarker)
+	if st, err := os.Lstat(p); err == nil && !st.Mode().IsRegular() {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|unix.O_NOFOLLOW, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(id + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ClearExtractionIncomplete removes the incomplete marker from the directory.
+func ClearExtractionIncomplete(dir string) error {
+	if err := os.Remove(filepath.Join(dir, IncompleteMarker)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ExtractionIncomplete reports whether the directory contains the incomplete
+// marker left by a transfer that did not finish extracting files into it.
+func ExtractionIncomplete(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, IncompleteMarker))
+	return err == nil
+}
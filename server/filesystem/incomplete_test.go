@@ -0,0 +1,46 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestFilesystem_ExtractionIncomplete(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ExtractionIncomplete", func() {
+		g.It("reports a directory as incomplete until the marker is cleared", func() {
+			dir := t.TempDir()
+			g.Assert(ExtractionIncomplete(dir)).IsFalse()
+
+			g.Assert(MarkExtractionIncomplete(dir, "transfer")).IsNil()
+			g.Assert(ExtractionIncomplete(dir)).IsTrue()
+			b, err := os.ReadFile(filepath.Join(dir, IncompleteMarker))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("transfer\n")
+
+			g.Assert(ClearExtractionIncomplete(dir)).IsNil()
+			g.Assert(ExtractionIncomplete(dir)).IsFalse()
+			g.Assert(ClearExtractionIncomplete(dir)).IsNil()
+		})
+
+		g.It("replaces a symlink rather than writing through it", func() {
+			dir := t.TempDir()
+			target := filepath.Join(t.TempDir(), "target")
+			g.Assert(os.WriteFile(target, []byte("keep"), 0o600)).IsNil()
+			g.Assert(os.Symlink(target, filepath.Join(dir, IncompleteMarker))).IsNil()
+
+			g.Assert(MarkExtractionIncomplete(dir, "transfer")).IsNil()
+			b, err := os.ReadFile(target)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("keep")
+
+			st, err := os.Lstat(filepath.Join(dir, IncompleteMarker))
+			g.Assert(err).IsNil()
+			g.Assert(st.Mode().IsRegular()).IsTrue()
+		})
+	})
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -40,7 +42,7 @@ func (s *Server) customMounts() []environment.Mount {
 
 	// TODO: probably need to handle things trying to mount directories that do not exist.
 	for _, m := range s.Config().Mounts {
-		source := filepath.Clean(m.Source)
+		source := MapMountSource(m.Source)
 		target := filepath.Clean(m.Target)
 
 		logger := s.Log().WithFields(log.Fields{
@@ -49,28 +51,71 @@ func (s *Server) customMounts() []environment.Mount {
 			"read_only":   m.ReadOnly,
 		})
 
-		mounted := false
-		for _, allowed := range config.Get().AllowedMounts {
-			// Check if the source path is included in the allowed mounts list.
-			// filepath.Clean will strip all trailing slashes (unless the path is a root directory).
-			if !strings.HasPrefix(source, filepath.Clean(allowed)) {
-				continue
-			}
+		if !isAllowedMount(source) {
+			logger.Warn("skipping custom server mount, not in list of allowed mount points")
+			continue
+		}
+
+		mounts = append(mounts, environment.Mount{
+			Source:   source,
+			Target:   target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
 
-			mounted = true
-			mounts = append(mounts, environment.Mount{
-				Source:   source,
-				Target:   target,
-				ReadOnly: m.ReadOnly,
-			})
+	return mounts
+}
 
-			break
+// isAllowedMount checks if the source path is included in the allowed mounts
+// list of the node.
+func isAllowedMount(source string) bool {
+	for _, allowed := range config.Get().AllowedMounts {
+		// filepath.Clean will strip all trailing slashes (unless the path is a root directory).
+		if strings.HasPrefix(source, filepath.Clean(allowed)) {
+			return true
 		}
+	}
+	return false
+}
 
-		if !mounted {
-			logger.Warn("skipping custom server mount, not in list of allowed mount points")
+// MapMountSource returns the path the source of a mount is found at on this
+// node. Nodes that keep shared data in a different location to other nodes can
+// configure mount mappings, the longest mapping that matches the start of the
+// path is replaced.
+func MapMountSource(source string) string {
+	source = filepath.Clean(source)
+	var match, to string
+	for from, v := range config.Get().MountMappings {
+		from = filepath.Clean(from)
+		if len(from) <= len(match) {
+			continue
 		}
+		if source == from || strings.HasPrefix(source, strings.TrimSuffix(from, "/")+"/") {
+			match, to = from, v
+		}
+	}
+	if match == "" {
+		return source
 	}
+	return filepath.Join(filepath.Clean(to), strings.TrimPrefix(source, match))
+}
 
-	return mounts
+// CheckMounts returns a description of every custom mount of the server that
+// cannot be mounted on this node, either because it is not in the list of
+// allowed mount points or because its source does not exist. The server will
+// start without these mounts.
+func (s *Server) CheckMounts() []string {
+	var problems []string
+	for _, m := range s.Config().Mounts {
+		source := MapMountSource(m.Source)
+		target := filepath.Clean(m.Target)
+		if !isAllowedMount(source) {
+			problems = append(problems, fmt.Sprintf("mount %s -> %s is not in the list of allowed mount points", source, target))
+			continue
+		}
+		if _, err := os.Stat(source); err != nil {
+			problems = append(problems, fmt.Sprintf("mount %s -> %s is not available: %s", source, target, err))
+		}
+	}
+	return problems
 }
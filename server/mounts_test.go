@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestMapMountSource(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("MapMountSource", func() {
+		g.BeforeEach(func() {
+			config.Set(&config.Configuration{
+				AuthenticationToken: "abc",
+				MountMappings: map[string]string{
+					"/mnt/shared":      "/data/shared",
+					"/mnt/shared/maps": "/srv/maps",
+				},
+			})
+		})
+
+		g.It("replaces the longest matching path", func() {
+			g.Assert(MapMountSource("/mnt/shared/plugins")).Equal("/data/shared/plugins")
+			g.Assert(MapMountSource("/mnt/shared/maps/world")).Equal("/srv/maps/world")
+			g.Assert(MapMountSource("/mnt/shared")).Equal("/data/shared")
+		})
+
+		g.It("does not match a partial directory name", func() {
+			g.Assert(MapMountSource("/mnt/shared-other")).Equal("/mnt/shared-other")
+		})
+
+		g.It("returns unmapped paths unchanged", func() {
+			g.Assert(MapMountSource("/var/lib/other/")).Equal("/var/lib/other")
+		})
+	})
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/environment"
+	"github.com/pterodactyl/wings/server/filesystem"
 )
 
 type PowerAction string
@@ -181,6 +182,14 @@ func (s *Server) onBeforeStart() error {
 		return ErrSuspended
 	}
 
+	// Refuse to start a server that a transfer failed part way through
+	// extracting, it needs to be transferred again rather than run with files
+	// that may be missing or corrupt.
+	if filesystem.ExtractionIncomplete(s.Filesystem().Path()) {
+		s.PublishConsoleOutputFromDaemon("The files of this server are incomplete as a transfer did not finish, transfer the server again before starting it.")
+		return ErrTransferIncomplete
+	}
+
 	// Ensure we sync the server information with the environment so that any new environment variables
 	// and process resource limits are correctly applied.
 	s.SyncWithEnvironment()
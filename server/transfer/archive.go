@@ -4,41 +4,142 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"runtime"
 
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/internal/progress"
 	"github.com/pterodactyl/wings/server/filesystem"
+	"github.com/pterodactyl/wings/system"
 )
 
 // Archive returns an archive that can be used to stream the contents of the
 // contents of a server.
 func (t *Transfer) Archive() (*Archive, error) {
-	if t.archive == nil {
-		// Get the disk usage of the server (used to calculate the progress of the archive process)
-		rawSize, err := t.Server.Filesystem().DiskUsage(true)
-		if err != nil {
-			return nil, fmt.Errorf("transfer: failed to get server disk usage: %w", err)
-		}
+	if a := t.archive.Load(); a != nil {
+		return a, nil
+	}
 
-		// Create a new archive instance and assign it to the transfer.
-		t.archive = NewArchive(t, uint64(rawSize))
+	// Get the disk usage of the server (used to calculate the progress of the archive process)
+	rawSize, err := t.Server.Filesystem().DiskUsage(true)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to get server disk usage: %w", err)
 	}
 
-	return t.archive, nil
+	// Create a new archive instance and assign it to the transfer.
+	a := NewArchive(t, uint64(rawSize))
+	t.archive.Store(a)
+	return a, nil
 }
 
 // Archive represents an archive used to transfer the contents of a server.
 type Archive struct {
 	archive *filesystem.Archive
+
+	// deleted contains the files the target node should remove before the
+	// archive is extracted when performing a delta transfer.
+	deleted []string
+	// existing is the size of the files the target node already has and that
+	// are not included in the archive.
+	existing int64
 }
 
 // NewArchive returns a new archive associated with the given transfer.
 func NewArchive(t *Transfer, size uint64) *Archive {
-	return &Archive{
-		archive: &filesystem.Archive{
-			Filesystem: t.Server.Filesystem(),
-			Progress:   progress.NewProgress(size),
-		},
+	return newArchive(t, size, t.compressionFormat())
+}
+
+// newArchive returns a new archive associated with the given transfer that is
+// compressed using the given format.
+func newArchive(t *Transfer, size uint64, format filesystem.CompressionFormat) *Archive {
+	a := &filesystem.Archive{
+		Filesystem:  t.sourceFilesystem(),
+		Progress:    progress.NewProgress(size),
+		Compression: format,
+		Threads:     compressionThreads(),
+		Xattrs:      config.Get().System.Transfers.PreserveXattrs,
+	}
+	if t.force {
+		t.Log().WithField("format", a.Compression).Info("forced rebuild of archive, ignoring cached blobs and archive checkpoints")
+		t.SendMessage("Rebuilding archive of server data from its current files, cached data will not be used.")
+	} else if config.Get().System.Transfers.BlobCache && a.Compression == filesystem.CompressionGzip {
+		a.BlobCache = Blobs()
+	}
+	if a.Compression == filesystem.CompressionZstd {
+		a.Dictionary = t.dictionary()
+	}
+	if t.filter != nil {
+		a.Filter = t.filter.Include
+	}
+	return &Archive{archive: a}
+}
+
+// compressionFormat returns the compression format used for the archive of
+// the server, sampling its files if the format is chosen automatically. The
+// format that was chosen is logged and sent to the console.
+func (t *Transfer) compressionFormat() filesystem.CompressionFormat {
+	var include func(string) bool
+	if t.filter != nil {
+		include = t.filter.allows
+	}
+	format, sample, err := compressionFormat(t.ctx, t.sourceFilesystem().Path(), include)
+	if err != nil {
+		t.Log().WithError(err).Warn("failed to sample server files to choose a compression format, using gzip")
+		return format
+	}
+	// Older nodes extract every archive as gzip, whatever format it is sent
+	// with.
+	if format != filesystem.CompressionGzip && !t.Supports(VersionArchiveFormats) {
+		t.Log().WithField("format", format).WithField("version", t.Version()).Warn("destination only supports gzip archives, using gzip")
+		t.SendMessage("Destination does not support " + string(format) + " archives, using gzip compression.")
+		return filesystem.CompressionGzip
 	}
+	if sample != nil {
+		t.Log().WithFields(log.Fields{
+			"format":  format,
+			"sampled": sample.Sampled,
+			"ratio":   fmt.Sprintf("%.2f", sample.Ratio()),
+		}).Info("chose compression format from a sample of the server files")
+		t.SendMessage(fmt.Sprintf("Sampled %s of server data (compressed to %.0f%%), using %s compression.", system.FormatBytes(sample.Sampled), sample.Ratio()*100, format))
+	}
+	return format
+}
+
+// dictionary returns the zstd dictionary used to compress the archive of the
+// server, or nil if there is none. An archive is compressed without a
+// dictionary if the one that is configured cannot be loaded.
+func (t *Transfer) dictionary() []byte {
+	d, err := LoadDictionary()
+	if err != nil {
+		t.Log().WithError(err).Warn("failed to load compression dictionary, compressing archive without it")
+		return nil
+	}
+	if d == nil {
+		return nil
+	}
+	t.Log().WithField("dictionary", d.ID).Debug("compressing archive with zstd dictionary")
+	return d.Content
+}
+
+// compressionThreads returns the number of goroutines to use when compressing
+// transfer archives.
+func compressionThreads() int {
+	if n := config.Get().System.Transfers.CompressionThreads; n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Format returns the compression format used by the archive.
+func (a *Archive) Format() filesystem.CompressionFormat {
+	return a.archive.Compression
+}
+
+// Deleted returns the files the target node should remove from its existing
+// copy of the server, this is only set for delta transfers.
+func (a *Archive) Deleted() []string {
+	return a.deleted
 }
 
 // Stream returns a reader that can be used to stream the contents of the archive.
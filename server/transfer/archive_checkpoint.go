@@ -0,0 +1,387 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+	"github.com/pterodactyl/wings/system"
+)
+
+// ArchiveCheckpoint is written to the disk while an archive is being staged,
+// recording how much of it has been safely written. If Wings stops before the
+// archive is finished, the next transfer of the server continues writing the
+// partial archive from the last checkpoint.
+type ArchiveCheckpoint struct {
+	Server     string `json:"server"`
+	TransferID string `json:"transfer_id"`
+	// Settings identifies the options the archive is being created with, an
+	// archive can only be resumed with exactly the same options.
+	Settings string `json:"settings"`
+	// Archive is the name of the partial archive in the checkpoint directory.
+	Archive string `json:"archive"`
+	// Offset is the size of the partial archive when the checkpoint was taken,
+	// anything written after it is discarded when resuming.
+	Offset int64  `json:"offset"`
+	Last   string `json:"last"`
+	Files  int    `json:"files"`
+	// Hash is the state of the checksum of the archive at the offset, so the
+	// partial archive does not need to be read again when it is resumed.
+	Hash      []byte    `json:"hash"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func checkpointDirectory() string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, "checkpoints")
+}
+
+func checkpointPath(server string) string {
+	return filepath.Join(checkpointDirectory(), filepath.Base(server)+".json")
+}
+
+// checkpointsEnabled returns true if archives should be checkpointed while
+// they are staged in the given store. Only archives staged on the local disk
+// can be resumed.
+func checkpointsEnabled(store ArchiveStore) bool {
+	_, ok := store.(*LocalArchiveStore)
+	return ok && config.Get().System.Transfers.ArchiveCheckpointInterval > 0
+}
+
+func checkpointMaxAge() time.Duration {
+	return time.Duration(config.Get().System.Transfers.ArchiveCheckpointMaxAge) * time.Second
+}
+
+// checkpointSettings returns a value identifying every option that affects
+// the contents of the archive.
+func (t *Transfer) checkpointSettings(a *Archive) string {
+	v := struct {
+		Format    filesystem.CompressionFormat `json:"format"`
+		Level     string                       `json:"level"`
+		BlobCache bool                         `json:"blob_cache"`
+		Include   []string                     `json:"include,omitempty"`
+		Exclude   []string                     `json:"exclude,omitempty"`
+		Xattrs    bool                         `json:"xattrs,omitempty"`
+	}{
+		Format:    a.Format(),
+		Level:     config.Get().System.Backups.CompressionLevel,
+		BlobCache: a.archive.BlobCache != nil,
+		Xattrs:    a.archive.Xattrs,
+	}
+	if t.filter != nil {
+		v.Include, v.Exclude = t.filter.include, t.filter.exclude
+	}
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCheckpoint returns the archive checkpoint left for the server by a
+// previous transfer, if there is one.
+func loadCheckpoint(server string) (*ArchiveCheckpoint, bool) {
+	b, err := os.ReadFile(checkpointPath(server))
+	if err != nil {
+		return nil, false
+	}
+	var rec ArchiveCheckpoint
+	if err := json.Unmarshal(b, &rec); err != nil || rec.Server != server {
+		return nil, false
+	}
+	return &rec, true
+}
+
+// saveCheckpoint replaces the checkpoint of the server with rec.
+func saveCheckpoint(rec *ArchiveCheckpoint) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := createTemporary(checkpointPath(rec.Server))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		removeTemporary(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		removeTemporary(f.Name())
+		return err
+	}
+	return commitTemporary(f.Name(), checkpointPath(rec.Server))
+}
+
+// RemoveArchiveCheckpoint removes the checkpoint of the server along with the
+// partial archive it describes.
+func RemoveArchiveCheckpoint(server string) error {
+	if rec, ok := loadCheckpoint(server); ok && rec.Archive != "" {
+		p := filepath.Join(checkpointDirectory(), filepath.Base(rec.Archive))
+		includeInBackups(p)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(checkpointPath(server)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveStaleArchiveCheckpoints removes every checkpoint that is too old to be
+// resumed from, along with any partial archive that no longer has one.
+func RemoveStaleArchiveCheckpoints() error {
+	entries, err := os.ReadDir(checkpointDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	keep := make(map[string]struct{})
+	for _, e := range entries {
+		server, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		rec, ok := loadCheckpoint(server)
+		if ok && time.Since(rec.UpdatedAt) <= checkpointMaxAge() {
+			keep[rec.Archive] = struct{}{}
+			keep[e.Name()] = struct{}{}
+			continue
+		}
+		log.WithField("subsystem", "transfer").WithField("server", server).Info("removing stale archive checkpoint")
+		if err := RemoveArchiveCheckpoint(server); err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		if _, ok := keep[e.Name()]; ok || strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		p := filepath.Join(checkpointDirectory(), e.Name())
+		includeInBackups(p)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpointWriter writes a partial archive to the checkpoint directory,
+// recording a checkpoint each time the archive asks for one.
+type checkpointWriter struct {
+	t   *Transfer
+	rec ArchiveCheckpoint
+	f   *os.File
+	h   hash.Hash
+	n   int64
+	// mark is the size of the partial archive when the last checkpoint was
+	// attempted.
+	mark     int64
+	interval int64
+}
+
+var _ filesystem.Checkpointer = (*checkpointWriter)(nil)
+
+func (w *checkpointWriter) path() string {
+	return filepath.Join(checkpointDirectory(), w.rec.Archive)
+}
+
+func (w *checkpointWriter) Write(b []byte) (int, error) {
+	n, err := w.f.Write(b)
+	w.h.Write(b[:n])
+	w.n += int64(n)
+	return n, err
+}
+
+// Due returns true once the configured amount of the archive has been written
+// since the last checkpoint.
+func (w *checkpointWriter) Due() bool {
+	return w.n-w.mark >= w.interval
+}
+
+// Checkpoint syncs the partial archive to the disk and records how much of it
+// has been written. Failing to record a checkpoint only means the archive
+// cannot be resumed from it, so it does not stop the archive being created.
+func (w *checkpointWriter) Checkpoint(last string, files int) error {
+	w.mark = w.n
+	state, err := w.h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if err == nil {
+		rec := w.rec
+		rec.Offset, rec.Last, rec.Files, rec.Hash, rec.UpdatedAt = w.n, last, files, state, time.Now()
+		if err = saveCheckpoint(&rec); err == nil {
+			w.rec = rec
+		}
+	}
+	if err != nil {
+		w.t.Log().WithError(err).Warn("failed to record archive checkpoint")
+	}
+	return nil
+}
+
+// start begins a new partial archive, replacing any previous checkpoint of the
+// server.
+func (w *checkpointWriter) start(settings, name string) error {
+	if w.f != nil {
+		_ = w.f.Close()
+	}
+	if err := RemoveArchiveCheckpoint(w.t.Server.ID()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(checkpointDirectory(), 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	w.rec = ArchiveCheckpoint{
+		Server:     w.t.Server.ID(),
+		TransferID: w.t.id,
+		Settings:   settings,
+		Archive:    name,
+		StartedAt:  now,
+		UpdatedAt:  now,
+	}
+	f, err := os.OpenFile(w.path(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	excludeFromBackups(w.path())
+	w.f, w.h, w.n, w.mark = f, sha256.New(), 0, 0
+	// Record the partial archive straight away so that it is removed once it
+	// is stale, even if Wings stops before the first checkpoint.
+	return saveCheckpoint(&w.rec)
+}
+
+// resume continues the partial archive of a previous checkpoint, discarding
+// anything written after it.
+func (w *checkpointWriter) resume(rec *ArchiveCheckpoint, settings string) error {
+	switch {
+	case rec.Settings != settings:
+		return errors.New("transfer settings have changed")
+	case rec.Offset == 0:
+		return errors.New("no checkpoint was taken")
+	case time.Since(rec.UpdatedAt) > checkpointMaxAge():
+		return errors.New("checkpoint is too old")
+	}
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(rec.Hash); err != nil {
+		return err
+	}
+	p := filepath.Join(checkpointDirectory(), filepath.Base(rec.Archive))
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err == nil && st.Size() < rec.Offset {
+		err = errors.New("partial archive is shorter than the checkpoint")
+	}
+	if err == nil {
+		err = f.Truncate(rec.Offset)
+	}
+	if err == nil {
+		_, err = f.Seek(rec.Offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.rec = *rec
+	w.rec.TransferID = w.t.id
+	w.f, w.h, w.n, w.mark = f, h, rec.Offset, rec.Offset
+	excludeFromBackups(w.path())
+	return nil
+}
+
+// commit moves the completed archive to p and removes the checkpoint.
+func (w *checkpointWriter) commit(p string) (string, error) {
+	if err := w.f.Close(); err != nil {
+		return "", err
+	}
+	excludeFromBackups(p)
+	if err := os.Rename(w.path(), p); err != nil {
+		includeInBackups(p)
+		return "", fmt.Errorf("transfer: failed to move completed archive into place: %w", err)
+	}
+	includeInBackups(w.path())
+	sum := hex.EncodeToString(w.h.Sum(nil))
+	Checksums().Put(p, sum)
+	if err := RemoveArchiveCheckpoint(w.rec.Server); err != nil {
+		w.t.Log().WithError(err).Warn("failed to remove archive checkpoint")
+	}
+	return sum, nil
+}
+
+// writeCheckpointedArchive writes the archive to the store, resuming it from
+// a checkpoint left by a previous transfer of the server if possible. The
+// checkpoint is kept if the archive cannot be completed, so a later transfer
+// can continue from it.
+func (t *Transfer) writeCheckpointedArchive(ctx context.Context, a *Archive, store *LocalArchiveStore, name string) (string, error) {
+	w := &checkpointWriter{
+		t:        t,
+		interval: int64(config.Get().System.Transfers.ArchiveCheckpointInterval) * 1024 * 1024,
+	}
+	settings := t.checkpointSettings(a)
+	partial := filepath.Base(t.Server.ID()) + a.Format().Extension()
+
+	var resumed bool
+	var from string
+	if rec, ok := loadCheckpoint(t.Server.ID()); ok && t.force {
+		t.Log().WithField("checkpoint_transfer_id", rec.TransferID).Info("discarding archive checkpoint for forced rebuild")
+	} else if ok {
+		if err := w.resume(rec, settings); err != nil {
+			t.Log().WithError(err).Info("cannot resume archive from checkpoint, creating it from the start")
+		} else {
+			resumed, from = true, rec.TransferID
+		}
+	}
+	if !resumed {
+		if err := w.start(settings, partial); err != nil {
+			return "", fmt.Errorf("transfer: failed to create local archive: %w", err)
+		}
+	}
+
+	a.archive.Checkpointer = w
+	a.archive.Resume = nil
+	if resumed {
+		t.Log().WithFields(log.Fields{
+			"offset":                 w.rec.Offset,
+			"files":                  w.rec.Files,
+			"checkpoint_transfer_id": from,
+		}).Info("resuming archive from checkpoint")
+		t.SendMessage(fmt.Sprintf("Resuming archive of server data from a checkpoint, %s was already written.", system.FormatBytes(w.rec.Offset)))
+		a.archive.Resume = &filesystem.ResumePoint{Last: w.rec.Last, Files: w.rec.Files, Since: w.rec.StartedAt}
+	}
+
+	err := a.Stream(ctx, w)
+	if resumed && errors.Is(err, filesystem.ErrCheckpointStale) {
+		t.Log().Info("server files have changed since the archive checkpoint was taken, creating the archive from the start")
+		t.SendMessage("Server files have changed since the checkpoint, creating the archive from the start.")
+		a.archive.Resume = nil
+		if err = w.start(settings, partial); err == nil {
+			err = a.Stream(ctx, w)
+		}
+	}
+	if err != nil {
+		_ = w.f.Close()
+		return "", fmt.Errorf("transfer: failed to stream archive to disk: %w", err)
+	}
+	return w.commit(store.path(name))
+}
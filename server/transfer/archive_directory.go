@@ -0,0 +1,30 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// EnsureArchiveDirectory ensures that the configured archive directory exists,
+// creating it if it is missing, and that Wings is able to write files into it.
+// This should be called before starting any transfer that needs to stage data
+// on the disk so that a misconfiguration is reported immediately rather than
+// part of the way through the transfer.
+func EnsureArchiveDirectory() error {
+	dir := config.Get().System.ArchiveDirectory
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("archive directory is not writable: %s: %w", dir, err)
+	}
+
+	f, err := os.CreateTemp(dir, ".wings-write-test-*")
+	if err != nil {
+		return fmt.Errorf("archive directory is not writable: %s: %w", dir, err)
+	}
+	_ = f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("archive directory is not writable: %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// ErrTransferInProgress is returned when trying to remove the staged archives
+// of a server that is currently being transferred.
+var ErrTransferInProgress = errors.New("transfer: server is currently being transferred")
+
+// StagedArchive is an archive left in the archive directory.
+type StagedArchive struct {
+	Name       string    `json:"name"`
+	Server     string    `json:"server,omitempty"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+	// Orphaned is set if no transfer is currently running for the server the
+	// archive belongs to.
+	Orphaned bool `json:"orphaned"`
+	// RetainedUntil is when the archive is going to be removed if it is being
+	// kept after the server was transferred successfully.
+	RetainedUntil *time.Time `json:"retained_until,omitempty"`
+}
+
+// archiveServer returns the UUID of the server an archive belongs to, staged
+// archives are named starting with the UUID of their server unless a custom
+// name has been configured.
+func archiveServer(name string) string {
+	if len(name) < 36 {
+		return ""
+	}
+	u, err := uuid.Parse(name[:36])
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+func isTransferring(server string) bool {
+	return Incoming().Get(server) != nil || Outgoing().Get(server) != nil
+}
+
+// StagedArchives returns every completed archive in the archive directory.
+// Archives that are still being written, along with the blob and chunk
+// stores, are not included.
+func StagedArchives() ([]StagedArchive, error) {
+	entries, err := os.ReadDir(config.Get().System.ArchiveDirectory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []StagedArchive{}, nil
+		}
+		return nil, err
+	}
+
+	temporaryFiles.mu.Lock()
+	defer temporaryFiles.mu.Unlock()
+
+	out := make([]StagedArchive, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		p := filepath.Join(config.Get().System.ArchiveDirectory, e.Name())
+		if _, ok := temporaryFiles.paths[p]; ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		a := StagedArchive{
+			Name:       e.Name(),
+			Server:     archiveServer(e.Name()),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+			AgeSeconds: int64(time.Since(info.ModTime()).Seconds()),
+		}
+		a.Orphaned = a.Server == "" || !isTransferring(a.Server)
+		if rec, ok := loadRetention(e.Name()); ok {
+			a.RetainedUntil = &rec.DeleteAt
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// RemoveStagedArchives removes every archive in the archive directory that
+// belongs to the server and returns the archives that were removed, along
+// with any partial archive left to resume from. Nothing is removed while the
+// server is being transferred.
+func RemoveStagedArchives(server string) ([]StagedArchive, error) {
+	if isTransferring(server) {
+		return nil, ErrTransferInProgress
+	}
+	if err := RemoveArchiveCheckpoint(server); err != nil {
+		return nil, err
+	}
+	archives, err := StagedArchives()
+	if err != nil {
+		return nil, err
+	}
+	store := NewLocalArchiveStore()
+	removed := make([]StagedArchive, 0)
+	for _, a := range archives {
+		if a.Server != server {
+			continue
+		}
+		if err := store.Remove(a.Name); err != nil {
+			return removed, err
+		}
+		if err := removeRetention(a.Name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, a)
+	}
+	return removed, nil
+}
+
+// ArchiveMetadata describes a staged archive without including its contents.
+type ArchiveMetadata struct {
+	Name     string
+	Size     int64
+	Checksum string
+	MimeType string
+}
+
+// hashingArchives are the staged archives whose checksum is being calculated
+// in the background.
+var hashingArchives sync.Map
+
+// StagedArchiveMetadata returns the checksum, size and mime type of the most
+// recently staged archive of the server. The checksum is only read from the
+// cache, if it was not calculated when the archive was written it is
+// calculated in the background and the metadata is returned without it. An
+// error matching os.ErrNotExist is returned if the server has no staged
+// archive.
+func StagedArchiveMetadata(server string) (*ArchiveMetadata, error) {
+	archives, err := StagedArchives()
+	if err != nil {
+		return nil, err
+	}
+	var latest *StagedArchive
+	for i, a := range archives {
+		if a.Server == server && (latest == nil || a.ModifiedAt.After(latest.ModifiedAt)) {
+			latest = &archives[i]
+		}
+	}
+	if latest == nil {
+		return nil, os.ErrNotExist
+	}
+	p := NewLocalArchiveStore().path(latest.Name)
+	sum, ok := Checksums().Cached(p)
+	if !ok {
+		if _, hashing := hashingArchives.LoadOrStore(p, true); !hashing {
+			go func() {
+				defer hashingArchives.Delete(p)
+				if _, err := Checksums().Sum(p); err != nil && !os.IsNotExist(err) {
+					log.WithField("subsystem", "transfer").WithField("archive", latest.Name).WithError(err).Warn("failed to calculate checksum of staged archive")
+				}
+			}()
+		}
+	}
+	return &ArchiveMetadata{
+		Name:     latest.Name,
+		Size:     latest.Size,
+		Checksum: sum,
+		MimeType: archiveFormat(latest.Name).MimeType(),
+	}, nil
+}
+
+// archiveFormat returns the compression format of an archive based on the
+// extension of its name.
+func archiveFormat(name string) filesystem.CompressionFormat {
+	for _, f := range []filesystem.CompressionFormat{filesystem.CompressionZstd, filesystem.CompressionNone} {
+		if strings.HasSuffix(name, f.Extension()) {
+			return f
+		}
+	}
+	return filesystem.CompressionGzip
+}
@@ -0,0 +1,52 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestStagedArchiveMetadata(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("StagedArchiveMetadata", func() {
+		const srv = "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f"
+		var dir string
+
+		g.BeforeEach(func() {
+			dir = t.TempDir()
+			setConfig(config.SystemConfiguration{ArchiveDirectory: dir})
+		})
+
+		g.It("reports a server without a staged archive", func() {
+			_, err := StagedArchiveMetadata(srv)
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.It("returns the checksum once it has been calculated in the background", func() {
+			p := filepath.Join(dir, srv+".tar.gz")
+			g.Assert(os.WriteFile(p, []byte("archive"), 0o600)).IsNil()
+
+			meta, err := StagedArchiveMetadata(srv)
+			g.Assert(err).IsNil()
+			g.Assert(meta.Size).Equal(int64(7))
+			g.Assert(meta.MimeType).Equal("application/gzip")
+
+			deadline := time.Now().Add(5 * time.Second)
+			for meta.Checksum == "" && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+				meta, err = StagedArchiveMetadata(srv)
+				g.Assert(err).IsNil()
+			}
+			sum, err := Checksums().Sum(p)
+			g.Assert(err).IsNil()
+			g.Assert(meta.Checksum).Equal(sum)
+		})
+	})
+}
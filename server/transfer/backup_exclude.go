@@ -0,0 +1,54 @@
+package transfer
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/backup"
+)
+
+// backupExclusions contains the function that removes the backup exclusion
+// of every staged file that is currently excluded.
+var backupExclusions = struct {
+	mu      sync.Mutex
+	release map[string]func()
+}{release: make(map[string]func())}
+
+// excludeFromBackups stops the staged file at p from being included in the
+// backup of a server whose data directory overlaps with the archive directory,
+// until includeInBackups is called for it.
+func excludeFromBackups(p string) {
+	if !config.Get().System.Transfers.ExcludeFromBackups {
+		return
+	}
+	backupExclusions.mu.Lock()
+	defer backupExclusions.mu.Unlock()
+	if _, ok := backupExclusions.release[p]; !ok {
+		backupExclusions.release[p] = backup.Exclude(p)
+	}
+}
+
+// pruneBackupExclusions removes the exclusion of every staged file that no
+// longer exists, such as an archive removed by hand while Wings was running.
+func pruneBackupExclusions() {
+	backupExclusions.mu.Lock()
+	defer backupExclusions.mu.Unlock()
+	for p, fn := range backupExclusions.release {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			fn()
+			delete(backupExclusions.release, p)
+		}
+	}
+}
+
+// includeInBackups removes the exclusion of a staged file once it has been
+// removed or moved to another path.
+func includeInBackups(p string) {
+	backupExclusions.mu.Lock()
+	defer backupExclusions.mu.Unlock()
+	if fn, ok := backupExclusions.release[p]; ok {
+		fn()
+		delete(backupExclusions.release, p)
+	}
+}
@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestBackupExclusions(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("backup exclusions", func() {
+		var dir string
+
+		g.BeforeEach(func() {
+			dir = t.TempDir()
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: dir,
+				Transfers:        config.Transfers{ExcludeFromBackups: true},
+			})
+		})
+
+		excluded := func(p string) bool {
+			backupExclusions.mu.Lock()
+			defer backupExclusions.mu.Unlock()
+			_, ok := backupExclusions.release[p]
+			return ok
+		}
+
+		g.It("excludes a staged archive until it is removed from the store", func() {
+			store := NewLocalArchiveStore()
+			w, err := store.Create("archive.tar.gz")
+			g.Assert(err).IsNil()
+			_, err = w.Write([]byte("archive"))
+			g.Assert(err).IsNil()
+			g.Assert(w.Commit()).IsNil()
+			g.Assert(excluded(store.path("archive.tar.gz"))).IsTrue()
+
+			g.Assert(store.Remove("archive.tar.gz")).IsNil()
+			g.Assert(excluded(store.path("archive.tar.gz"))).IsFalse()
+		})
+
+		g.It("does not exclude anything when disabled", func() {
+			config.Update(func(c *config.Configuration) {
+				c.System.Transfers.ExcludeFromBackups = false
+			})
+			p := filepath.Join(dir, "archive.tar.gz")
+			excludeFromBackups(p)
+			g.Assert(excluded(p)).IsFalse()
+		})
+
+		g.It("drops the exclusion of a file removed some other way", func() {
+			kept := filepath.Join(dir, "kept.tar.gz")
+			removed := filepath.Join(dir, "removed.tar.gz")
+			for _, p := range []string{kept, removed} {
+				g.Assert(os.WriteFile(p, []byte("archive"), 0o600)).IsNil()
+				excludeFromBackups(p)
+			}
+			g.Assert(os.Remove(removed)).IsNil()
+
+			pruneBackupExclusions()
+			g.Assert(excluded(kept)).IsTrue()
+			g.Assert(excluded(removed)).IsFalse()
+			includeInBackups(kept)
+		})
+	})
+}
@@ -0,0 +1,327 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/internal/progress"
+	"github.com/pterodactyl/wings/server/backup"
+	"github.com/pterodactyl/wings/system"
+)
+
+// BackupHeader is the header used by the source node to send the UUID of the
+// backup in a request to the backups endpoint of the target node.
+const BackupHeader = "X-Backup-Uuid"
+
+// BackupChecksumHeader is the header used by the source node to send the hex
+// encoded SHA-256 checksum of a backup.
+const BackupChecksumHeader = "X-Backup-Checksum"
+
+var (
+	// ErrBackupsUnsupported is returned when the target node does not accept
+	// the backups of servers being transferred to it.
+	ErrBackupsUnsupported = errors.New("transfer: destination does not accept backups")
+	// ErrBackupExists is returned when the target node already has a
+	// different backup with the same UUID.
+	ErrBackupExists = errors.New("transfer: a different backup with the same uuid already exists")
+	// ErrBackupChecksum is returned when a received backup does not match the
+	// checksum sent by the source node.
+	ErrBackupChecksum = errors.New("transfer: backup checksum does not match")
+)
+
+// BackupsURL returns the URL used to send a backup to the target node for the
+// given transfer URL.
+func BackupsURL(url string) string {
+	return strings.TrimSuffix(url, "/") + "/backups"
+}
+
+// ParseBackups validates the UUIDs of the backups to send with a transfer.
+func ParseBackups(ids []string) ([]string, error) {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		u, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("transfer: invalid backup uuid \"%s\"", id)
+		}
+		out = append(out, u.String())
+	}
+	return out, nil
+}
+
+// PushBackups sends the local backups of the server with the given UUIDs to
+// the target node before the files of the server are sent. Backups that no
+// longer exist on this node are skipped. If the target node does not accept
+// backups they are kept on this node and nil is returned, so the transfer of
+// the server itself can continue.
+func (t *Transfer) PushBackups(url, token string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	defer t.timings.Start(PhaseBackups)()
+
+	type local struct {
+		id   string
+		path string
+		size int64
+	}
+	backups := make([]local, 0, len(ids))
+	var total int64
+	for _, id := range ids {
+		b, st, err := backup.LocateLocal(nil, id)
+		if err != nil {
+			t.Log().WithField("backup", id).WithError(err).Warn("skipping backup that could not be found on this node")
+			t.SendMessage("Warning: backup " + id + " was not found on this node and will not be transferred.")
+			continue
+		}
+		backups = append(backups, local{id: id, path: b.Path(), size: st.Size()})
+		total += st.Size()
+	}
+	if len(backups) == 0 {
+		return nil
+	}
+
+	p := progress.NewProgress(uint64(total))
+	t.backups.Store(p)
+	t.SendMessage(fmt.Sprintf("Sending %d backups (%s) to destination...", len(backups), system.FormatBytes(total)))
+	for i, b := range backups {
+		err := t.pushBackup(url, token, b.id, b.path, b.size, p, fmt.Sprintf("Sending backup %d of %d ", i+1, len(backups)))
+		if errors.Is(err, ErrBackupsUnsupported) {
+			t.Log().Warn("destination does not accept backups, they will be kept on this node")
+			t.SendMessage("Warning: the destination does not accept backups, they will remain on this node.")
+			return nil
+		}
+		if err != nil {
+			t.Error(err, "Failed to send backup "+b.id+" to destination.")
+			return err
+		}
+	}
+	t.SendMessage("Finished sending backups to destination.")
+	return nil
+}
+
+// pushBackup sends a single backup to the target node.
+func (t *Transfer) pushBackup(url, token, id, path string, size int64, p *progress.Progress, prefix string) error {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	sum, err := Checksums().SumContext(ctx, path)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to checksum backup: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, BackupsURL(url), io.TeeReader(f, p))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	t.setHeaders(ctx, req, token)
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set(BackupHeader, id)
+	req.Header.Set(BackupChecksumHeader, sum)
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	defer t.sendProgress(prefix, p, 5*time.Second)()
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	v, _ := io.ReadAll(res.Body)
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// A 404 comes from a node without the backups endpoint and a 501 from
+		// one that does not accept backups, in both cases the remaining
+		// backups are kept on this node rather than failing the transfer.
+		return ErrBackupsUnsupported
+	default:
+		return fmt.Errorf("%w: %s", unexpectedStatus(res), string(v))
+	}
+}
+
+// BackupsProgress returns the progress of the backups being sent by an
+// outgoing transfer, or nil if no backups are being sent.
+func (t *Transfer) BackupsProgress() *progress.Progress {
+	return t.backups.Load()
+}
+
+// receivedBackup is a backup received for a server being transferred to this
+// node. Created is false if the backup was already present, in which case it
+// is not removed if the transfer fails.
+type receivedBackup struct {
+	id      string
+	created bool
+	at      time.Time
+}
+
+var receivedBackups = struct {
+	mu      sync.Mutex
+	servers map[string][]receivedBackup
+}{servers: make(map[string][]receivedBackup)}
+
+// ReceiveBackup stores a backup of the server sent by the source node of a
+// transfer in the backup directory of this node. The backup is only moved
+// into place once it matches the checksum. Receiving a backup that is already
+// present is not an error, allowing the transfer to be retried.
+func ReceiveBackup(server, id, checksum string, r io.Reader) error {
+	if !config.Get().System.Transfers.AcceptBackups {
+		return ErrBackupsUnsupported
+	}
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("transfer: invalid backup uuid \"%s\"", id)
+	}
+	id = u.String()
+	p := backup.NewLocal(nil, id, "").Path()
+	l := log.WithField("subsystem", "transfer").WithField("server", server).WithField("backup", id)
+
+	if _, err := os.Stat(p); err == nil {
+		sum, err := Checksums().Sum(p)
+		if err != nil {
+			return err
+		}
+		if sum != checksum {
+			return ErrBackupExists
+		}
+		l.Debug("backup received from source node is already present")
+		_, _ = io.Copy(io.Discard, r)
+		recordReceivedBackup(server, id, false)
+		return nil
+	}
+
+	if err := os.MkdirAll(config.Get().System.BackupDirectory, 0o700); err != nil {
+		return err
+	}
+	f, err := createTemporary(p)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		_ = f.Close()
+		removeTemporary(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		removeTemporary(f.Name())
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != checksum {
+		removeTemporary(f.Name())
+		return ErrBackupChecksum
+	}
+	if err := commitTemporary(f.Name(), p); err != nil {
+		return err
+	}
+	l.Info("received backup from source node")
+	recordReceivedBackup(server, id, true)
+	return nil
+}
+
+func recordReceivedBackup(server, id string, created bool) {
+	receivedBackups.mu.Lock()
+	defer receivedBackups.mu.Unlock()
+	for _, v := range receivedBackups.servers[server] {
+		if v.id == id {
+			return
+		}
+	}
+	receivedBackups.servers[server] = append(receivedBackups.servers[server], receivedBackup{id: id, created: created, at: time.Now()})
+}
+
+// ReceivedBackups returns the backups received for the server during the
+// transfer that is currently running.
+func ReceivedBackups(server string) []string {
+	receivedBackups.mu.Lock()
+	defer receivedBackups.mu.Unlock()
+	var ids []string
+	for _, v := range receivedBackups.servers[server] {
+		ids = append(ids, v.id)
+	}
+	return ids
+}
+
+// ForgetReceivedBackups stops tracking the backups received for the server,
+// this is called once the Panel knows the transfer was successful.
+func ForgetReceivedBackups(server string) {
+	receivedBackups.mu.Lock()
+	defer receivedBackups.mu.Unlock()
+	delete(receivedBackups.servers, server)
+}
+
+// DiscardReceivedBackups removes the backups received for the server, this is
+// called when the transfer fails as the source node still has every backup.
+// Backups that were already on this node before the transfer are kept. The
+// identifiers of the removed backups are returned.
+func DiscardReceivedBackups(server string) []string {
+	receivedBackups.mu.Lock()
+	backups := receivedBackups.servers[server]
+	delete(receivedBackups.servers, server)
+	receivedBackups.mu.Unlock()
+
+	var removed []string
+	for _, b := range backups {
+		if !b.created {
+			continue
+		}
+		id := b.id
+		p := backup.NewLocal(nil, id, "").Path()
+		Checksums().Forget(p)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithField("subsystem", "transfer").WithField("server", server).WithField("backup", id).WithError(err).Warn("failed to remove backup received for failed transfer")
+			continue
+		}
+		removed = append(removed, id)
+	}
+	return removed
+}
+
+// expiredBackups returns the servers whose backups were received longer than
+// the prepared retention period ago without their transfer being started.
+func expiredBackups() []string {
+	retention := config.Get().System.Transfers.PreparedRetention
+	if retention < 1 {
+		return nil
+	}
+	receivedBackups.mu.Lock()
+	defer receivedBackups.mu.Unlock()
+	var out []string
+	for server, backups := range receivedBackups.servers {
+		if Incoming().Get(server) != nil {
+			continue
+		}
+		expired := true
+		for _, b := range backups {
+			if time.Since(b.at) <= time.Duration(retention)*time.Second {
+				expired = false
+				break
+			}
+		}
+		if expired {
+			out = append(out, server)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestReceiveBackup(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ReceiveBackup", func() {
+		var dir string
+		id := "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f"
+		contents := "backup"
+		sum := sha256.Sum256([]byte(contents))
+		checksum := hex.EncodeToString(sum[:])
+
+		g.BeforeEach(func() {
+			dir = t.TempDir()
+			setConfig(config.SystemConfiguration{
+				BackupDirectory: dir,
+				Transfers:       config.Transfers{AcceptBackups: true},
+			})
+		})
+
+		g.AfterEach(func() {
+			ForgetReceivedBackups("server")
+		})
+
+		g.It("stores a backup that matches its checksum", func() {
+			g.Assert(ReceiveBackup("server", id, checksum, strings.NewReader(contents))).IsNil()
+			g.Assert(exists(filepath.Join(dir, id+".tar.gz"))).IsTrue()
+			g.Assert(ReceivedBackups("server")).Equal([]string{id})
+		})
+
+		g.It("rejects a backup that does not match its checksum", func() {
+			err := ReceiveBackup("server", id, checksum, strings.NewReader("corrupted"))
+			g.Assert(errors.Is(err, ErrBackupChecksum)).IsTrue()
+			g.Assert(exists(filepath.Join(dir, id+".tar.gz"))).IsFalse()
+			g.Assert(len(ReceivedBackups("server"))).Equal(0)
+		})
+
+		g.It("rejects backups if they are not accepted", func() {
+			config.Update(func(c *config.Configuration) {
+				c.System.Transfers.AcceptBackups = false
+			})
+			err := ReceiveBackup("server", id, checksum, strings.NewReader(contents))
+			g.Assert(errors.Is(err, ErrBackupsUnsupported)).IsTrue()
+		})
+
+		g.It("only discards backups received during the transfer", func() {
+			present := "9c7d2e10-1f2a-4b3c-8d4e-5f6a7b8c9d0e"
+			g.Assert(os.WriteFile(filepath.Join(dir, present+".tar.gz"), []byte(contents), 0o600)).IsNil()
+
+			g.Assert(ReceiveBackup("server", present, checksum, strings.NewReader(contents))).IsNil()
+			g.Assert(ReceiveBackup("server", id, checksum, strings.NewReader(contents))).IsNil()
+			g.Assert(DiscardReceivedBackups("server")).Equal([]string{id})
+
+			g.Assert(exists(filepath.Join(dir, present+".tar.gz"))).IsTrue()
+			g.Assert(exists(filepath.Join(dir, id+".tar.gz"))).IsFalse()
+		})
+
+		g.It("expires backups received for a transfer that never started", func() {
+			config.Update(func(c *config.Configuration) {
+				c.System.Transfers.PreparedRetention = 60
+			})
+			g.Assert(ReceiveBackup("server", id, checksum, strings.NewReader(contents))).IsNil()
+			g.Assert(len(expiredBackups())).Equal(0)
+
+			receivedBackups.mu.Lock()
+			receivedBackups.servers["server"][0].at = time.Now().Add(-time.Hour)
+			receivedBackups.mu.Unlock()
+			g.Assert(expiredBackups()).Equal([]string{"server"})
+		})
+	})
+}
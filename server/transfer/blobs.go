@@ -0,0 +1,237 @@
+package transfer
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/internal/ufs"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// blobIdentity identifies a specific version of a file on the disk. The change
+// time is included as it is updated by the kernel whenever the contents of the
+// file are modified and cannot be set by a user.
+type blobIdentity struct {
+	dev, ino uint64
+	size     int64
+	mtime    unix.Timespec
+	ctime    unix.Timespec
+}
+
+type blobEntry struct {
+	key  string
+	size int64
+}
+
+// BlobStore is a filesystem.BlobCache that keeps the compressed contents of
+// files in the archive directory. The least recently used blobs are removed
+// once the total size of the store is larger than the configured limit.
+type BlobStore struct {
+	dir string
+
+	mu     sync.Mutex
+	loaded bool
+	size   int64
+	lru    *list.List
+	blobs  map[string]*list.Element
+	hashes map[blobIdentity]string
+}
+
+var _ filesystem.BlobCache = (*BlobStore)(nil)
+
+var blobs = &BlobStore{
+	lru:    list.New(),
+	blobs:  make(map[string]*list.Element),
+	hashes: make(map[blobIdentity]string),
+}
+
+// Blobs returns the blob store used by transfers on this node.
+func Blobs() *BlobStore {
+	return blobs
+}
+
+func (b *BlobStore) path(key string) string {
+	return filepath.Join(b.dir, key)
+}
+
+// load indexes the blobs left in the store by a previous run of Wings. The
+// caller must hold the lock.
+func (b *BlobStore) load() {
+	if b.loaded {
+		return
+	}
+	b.loaded = true
+	b.dir = filepath.Join(config.Get().System.ArchiveDirectory, "blobs")
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		log.WithField("path", b.dir).WithError(err).Warn("transfer: failed to create blob directory")
+		return
+	}
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		log.WithField("path", b.dir).WithError(err).Warn("transfer: failed to read blob directory")
+		return
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".") {
+			// Blobs that were never committed.
+			_ = os.Remove(b.path(e.Name()))
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		b.add(e.Name(), info.Size())
+	}
+	b.evict()
+}
+
+// add records a blob in the index as the most recently used. The caller must
+// hold the lock.
+func (b *BlobStore) add(key string, size int64) {
+	if el, ok := b.blobs[key]; ok {
+		b.size -= el.Value.(*blobEntry).size
+		b.lru.Remove(el)
+	}
+	b.blobs[key] = b.lru.PushFront(&blobEntry{key: key, size: size})
+	b.size += size
+}
+
+// evict removes the least recently used blobs until the store is within the
+// configured size limit. The caller must hold the lock.
+func (b *BlobStore) evict() {
+	limit := int64(config.Get().System.Transfers.BlobCacheSize) * 1024 * 1024
+	for b.size > limit && b.lru.Len() > 0 {
+		el := b.lru.Back()
+		e := el.Value.(*blobEntry)
+		b.lru.Remove(el)
+		delete(b.blobs, e.key)
+		b.size -= e.size
+		if err := os.Remove(b.path(e.key)); err != nil && !os.IsNotExist(err) {
+			log.WithField("blob", e.key).WithError(err).Warn("transfer: failed to remove blob")
+		}
+	}
+}
+
+// Hash returns the SHA-256 hash of the contents of the open file. Hashes are
+// remembered for the device, inode, size and modification times of the file so
+// an unchanged file is only read the first time it is archived. Nothing is
+// looked up by path, so a file can never be confused with another file that
+// later takes its place.
+func (b *BlobStore) Hash(f ufs.File, st ufs.FileInfo) (string, error) {
+	id, ok := identity(st)
+	if ok {
+		b.mu.Lock()
+		v, ok := b.hashes[id]
+		b.mu.Unlock()
+		if ok {
+			return v, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if ok {
+		b.mu.Lock()
+		if len(b.hashes) >= maxChecksumCacheEntries {
+			b.hashes = make(map[blobIdentity]string)
+		}
+		b.hashes[id] = sum
+		b.mu.Unlock()
+	}
+	return sum, nil
+}
+
+func identity(st ufs.FileInfo) (blobIdentity, bool) {
+	sys, ok := st.Sys().(*unix.Stat_t)
+	if !ok {
+		return blobIdentity{}, false
+	}
+	return blobIdentity{
+		dev:   uint64(sys.Dev),
+		ino:   sys.Ino,
+		size:  sys.Size,
+		mtime: sys.Mtim,
+		ctime: sys.Ctim,
+	}, true
+}
+
+// Open returns the blob with the given key if it is in the store.
+func (b *BlobStore) Open(key string) (io.ReadCloser, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.load()
+	el, ok := b.blobs[key]
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(b.path(key))
+	if err != nil {
+		b.size -= el.Value.(*blobEntry).size
+		b.lru.Remove(el)
+		delete(b.blobs, key)
+		return nil, false
+	}
+	b.lru.MoveToFront(el)
+	return f, true
+}
+
+// Create returns a writer for a new blob, the blob is written to a temporary
+// file and only added to the store once it has been committed.
+func (b *BlobStore) Create(key string) (filesystem.BlobWriter, error) {
+	b.mu.Lock()
+	b.load()
+	b.mu.Unlock()
+	f, err := createTemporary(b.path(key))
+	if err != nil {
+		return nil, err
+	}
+	return &blobWriter{store: b, key: key, f: f}, nil
+}
+
+type blobWriter struct {
+	store *BlobStore
+	key   string
+	f     *os.File
+	size  int64
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *blobWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		removeTemporary(w.f.Name())
+		return err
+	}
+	if err := commitTemporary(w.f.Name(), w.store.path(w.key)); err != nil {
+		return err
+	}
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.add(w.key, w.size)
+	w.store.evict()
+	return nil
+}
+
+func (w *blobWriter) Abort() error {
+	_ = w.f.Close()
+	removeTemporary(w.f.Name())
+	return nil
+}
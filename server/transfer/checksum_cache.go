@@ -0,0 +1,218 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxChecksumCacheEntries is the number of checksums that are kept before the
+// cache is reset, preventing unbounded growth on nodes with many files.
+const maxChecksumCacheEntries = 1 << 20
+
+// maxPartialChecksums is the number of interrupted checksums that are kept to
+// be resumed from before they are discarded.
+const maxPartialChecksums = 64
+
+// checksumChunkSize is the amount of a file hashed between checks of whether
+// the checksum has been canceled.
+var checksumChunkSize int64 = 4 << 20
+
+type checksumKey struct {
+	path  string
+	size  int64
+	mtime time.Time
+	// ctime and inode catch files whose contents were changed without their
+	// size or modification time changing, such as when the modification time
+	// is set back by the program that wrote the file, or when the file is
+	// replaced with another one.
+	ctime time.Time
+	inode uint64
+}
+
+// fileKey returns the key a checksum of the file is cached with.
+func fileKey(p string, st os.FileInfo) checksumKey {
+	key := checksumKey{path: p, size: st.Size(), mtime: st.ModTime()}
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		key.ctime = time.Unix(int64(sys.Ctim.Sec), int64(sys.Ctim.Nsec))
+		key.inode = sys.Ino
+	}
+	return key
+}
+
+// ChecksumCache caches the SHA-256 checksum of files keyed by their path,
+// size, modification and change times and inode. A cached checksum is only
+// returned if none of those have changed since it was computed, so repeat
+// requests for an unchanged file do not need to hash the entire file again.
+type ChecksumCache struct {
+	mu      sync.Mutex
+	entries map[string]checksumEntry
+	partial map[string]partialChecksum
+}
+
+type checksumEntry struct {
+	key  checksumKey
+	hash string
+}
+
+// partialChecksum is the state of a checksum that was canceled part way
+// through the file, allowing it to be continued from the same offset as long
+// as the file has not changed.
+type partialChecksum struct {
+	key    checksumKey
+	offset int64
+	state  []byte
+}
+
+var checksums = NewChecksumCache()
+
+// Checksums returns the checksum cache used by transfers on this node.
+func Checksums() *ChecksumCache {
+	return checksums
+}
+
+// NewChecksumCache returns a new, empty, checksum cache.
+func NewChecksumCache() *ChecksumCache {
+	return &ChecksumCache{entries: make(map[string]checksumEntry), partial: make(map[string]partialChecksum)}
+}
+
+// Sum returns the hex encoded SHA-256 checksum of the file at the given path,
+// using the cached value if the file has not changed.
+func (cc *ChecksumCache) Sum(p string) (string, error) {
+	return cc.SumContext(context.Background(), p)
+}
+
+// SumContext returns the checksum of the file in the same way as Sum, but
+// stops hashing the file once the context is canceled. The progress made is
+// kept, so the next checksum of the same unchanged file continues from where
+// it stopped rather than hashing the whole file again. The checksum is always
+// the SHA-256 checksum of the entire file, regardless of how many times it was
+// interrupted.
+func (cc *ChecksumCache) SumContext(ctx context.Context, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	key := fileKey(p, st)
+
+	cc.mu.Lock()
+	e, ok := cc.entries[p]
+	cc.mu.Unlock()
+	if ok && e.key == key {
+		return e.hash, nil
+	}
+
+	h := sha256.New()
+	var offset int64
+	cc.mu.Lock()
+	pc, ok := cc.partial[p]
+	delete(cc.partial, p)
+	cc.mu.Unlock()
+	if ok && pc.key == key {
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(pc.state); err == nil {
+			if _, err := f.Seek(pc.offset, io.SeekStart); err == nil {
+				offset = pc.offset
+			} else {
+				h.Reset()
+			}
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			cc.savePartial(p, key, offset, h)
+			return "", err
+		}
+		n, err := io.CopyBuffer(h, io.LimitReader(f, checksumChunkSize), buf)
+		offset += n
+		if err != nil {
+			return "", err
+		}
+		if n < checksumChunkSize {
+			break
+		}
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	cc.mu.Lock()
+	if len(cc.entries) >= maxChecksumCacheEntries {
+		cc.entries = make(map[string]checksumEntry)
+	}
+	cc.entries[p] = checksumEntry{key: key, hash: sum}
+	cc.mu.Unlock()
+
+	return sum, nil
+}
+
+// Cached returns the cached checksum of the file at the given path without
+// hashing it, false is returned if it has no checksum cached or the file has
+// changed since it was calculated.
+func (cc *ChecksumCache) Cached(p string) (string, bool) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return "", false
+	}
+	key := fileKey(p, st)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	e, ok := cc.entries[p]
+	if !ok || e.key != key {
+		return "", false
+	}
+	return e.hash, true
+}
+
+// Put records the checksum of a file that was calculated elsewhere, such as
+// while the file was being written.
+func (cc *ChecksumCache) Put(p, sum string) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if len(cc.entries) >= maxChecksumCacheEntries {
+		cc.entries = make(map[string]checksumEntry)
+	}
+	cc.entries[p] = checksumEntry{key: fileKey(p, st), hash: sum}
+}
+
+// savePartial keeps the state of a checksum that was canceled so it can be
+// resumed from the offset it reached.
+func (cc *ChecksumCache) savePartial(p string, key checksumKey, offset int64, h io.Writer) {
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok || offset == 0 {
+		return
+	}
+	state, err := m.MarshalBinary()
+	if err != nil {
+		return
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if len(cc.partial) >= maxPartialChecksums {
+		cc.partial = make(map[string]partialChecksum)
+	}
+	cc.partial[p] = partialChecksum{key: key, offset: offset, state: state}
+}
+
+// Forget removes the cached checksum for the given path.
+func (cc *ChecksumCache) Forget(p string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.entries, p)
+	delete(cc.partial, p)
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+// cancelAfter is a context that is canceled once Err has been called n times.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestChecksumCache(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ChecksumCache", func() {
+		data := bytes.Repeat([]byte("checksum"), 1024)
+		sum := sha256.Sum256(data)
+		want := hex.EncodeToString(sum[:])
+
+		g.It("continues a canceled checksum from where it stopped", func() {
+			size := checksumChunkSize
+			checksumChunkSize = 1024
+			defer func() {
+				checksumChunkSize = size
+			}()
+
+			p := filepath.Join(t.TempDir(), "archive.tar.gz")
+			g.Assert(os.WriteFile(p, data, 0o600)).IsNil()
+
+			cc := NewChecksumCache()
+			_, err := cc.SumContext(&cancelAfter{Context: context.Background(), n: 3}, p)
+			g.Assert(errors.Is(err, context.Canceled)).IsTrue()
+			g.Assert(cc.partial[p].offset).Equal(int64(3 * 1024))
+
+			got, err := cc.SumContext(context.Background(), p)
+			g.Assert(err).IsNil()
+			g.Assert(got).Equal(want)
+			g.Assert(len(cc.partial)).Equal(0)
+		})
+
+		g.It("starts over if the file changed after the checksum was canceled", func() {
+			size := checksumChunkSize
+			checksumChunkSize = 1024
+			defer func() {
+				checksumChunkSize = size
+			}()
+
+			p := filepath.Join(t.TempDir(), "archive.tar.gz")
+			g.Assert(os.WriteFile(p, bytes.Repeat([]byte("x"), len(data)+1), 0o600)).IsNil()
+
+			cc := NewChecksumCache()
+			_, err := cc.SumContext(&cancelAfter{Context: context.Background(), n: 2}, p)
+			g.Assert(errors.Is(err, context.Canceled)).IsTrue()
+
+			g.Assert(os.WriteFile(p, data, 0o600)).IsNil()
+			got, err := cc.Sum(p)
+			g.Assert(err).IsNil()
+			g.Assert(got).Equal(want)
+		})
+
+		g.It("hashes a file again if it changed without its size or modification time changing", func() {
+			p := filepath.Join(t.TempDir(), "archive.tar.gz")
+			g.Assert(os.WriteFile(p, bytes.Repeat([]byte("x"), len(data)), 0o600)).IsNil()
+			st, err := os.Stat(p)
+			g.Assert(err).IsNil()
+
+			cc := NewChecksumCache()
+			_, err = cc.Sum(p)
+			g.Assert(err).IsNil()
+
+			// Give the change time of the file a chance to move on.
+			time.Sleep(10 * time.Millisecond)
+			g.Assert(os.WriteFile(p, data, 0o600)).IsNil()
+			g.Assert(os.Chtimes(p, st.ModTime(), st.ModTime())).IsNil()
+			got, err := cc.Sum(p)
+			g.Assert(err).IsNil()
+			g.Assert(got).Equal(want)
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxChecksumFileSize is the largest checksum file the target node will read.
+const maxChecksumFileSize = 64 * 1024
+
+// checksumFile returns the contents of a checksum file for the archive in the
+// format used by sha256sum, so it can be checked with standard tools.
+func checksumFile(name, checksum string) string {
+	return checksum + "  " + name + "\n"
+}
+
+// ParseChecksumFile returns the SHA-256 checksum from a checksum file in the
+// format used by sha256sum. If the file lists multiple files the checksum for
+// the given archive name is returned, otherwise the first checksum is used. A
+// file containing only a checksum is also accepted.
+func ParseChecksumFile(r io.Reader, name string) (string, error) {
+	var first string
+	s := bufio.NewScanner(io.LimitReader(r, maxChecksumFileSize))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		sum := strings.ToLower(fields[0])
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+			return "", fmt.Errorf("transfer: invalid checksum in checksum file: %q", fields[0])
+		}
+		if len(fields) > 1 && name != "" && strings.TrimPrefix(fields[1], "*") == name {
+			return sum, nil
+		}
+		if first == "" {
+			first = sum
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	if first == "" {
+		return "", fmt.Errorf("transfer: checksum file does not contain a checksum")
+	}
+	return first, nil
+}
+
+// DownloadChecksumFile downloads and parses the checksum file for an archive.
+func DownloadChecksumFile(ctx context.Context, url, name string) (string, error) {
+	res, err := getWithGrace(checkHosts(ctx), url)
+	if err != nil {
+		return "", fmt.Errorf("transfer: failed to download checksum file: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transfer: unexpected status code when downloading checksum file: %d", res.StatusCode)
+	}
+	return ParseChecksumFile(res.Body, name)
+}
+
+// uploadChecksumFile PUTs the checksum file for the archive to the presigned
+// upload URL.
+func (t *Transfer) uploadChecksumFile(ctx context.Context, url, name, checksum string) error {
+	body := checksumFile(name, checksum)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to upload checksum file: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("transfer: failed to put checksum file to object storage: [HTTP/%d] %s", res.StatusCode, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package transfer
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestParseChecksumFile(t *testing.T) {
+	g := Goblin(t)
+	sum := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+
+	g.Describe("ParseChecksumFile", func() {
+		g.It("parses a checksum file written by the source node", func() {
+			v, err := ParseChecksumFile(strings.NewReader(checksumFile("archive.tar.gz", sum)), "archive.tar.gz")
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(sum)
+		})
+
+		g.It("returns the checksum for the named archive", func() {
+			file := other + "  other.tar.gz\n" + strings.ToUpper(sum) + " *archive.tar.gz\n"
+			v, err := ParseChecksumFile(strings.NewReader(file), "archive.tar.gz")
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(sum)
+		})
+
+		g.It("accepts a file containing only a checksum", func() {
+			v, err := ParseChecksumFile(strings.NewReader(sum+"\n"), "")
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(sum)
+		})
+
+		g.It("rejects an invalid checksum", func() {
+			_, err := ParseChecksumFile(strings.NewReader("abc  archive.tar.gz\n"), "archive.tar.gz")
+			g.Assert(err == nil).IsFalse()
+			_, err = ParseChecksumFile(strings.NewReader(""), "archive.tar.gz")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
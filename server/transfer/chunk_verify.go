@@ -0,0 +1,160 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrVerifierClosed is returned when a chunk is received after the verifier
+// has stopped accepting chunks.
+var ErrVerifierClosed = errors.New("transfer: chunk received after the archive was reassembled")
+
+// chunkBuffers holds the buffers chunks are read into before being verified.
+var chunkBuffers = sync.Pool{
+	New: func() interface{} {
+		return bytes.NewBuffer(make([]byte, 0, maxChunkSize+1))
+	},
+}
+
+// chunkVerifyWorkers returns the number of goroutines used to verify the
+// chunks of deduplicated transfers.
+func chunkVerifyWorkers() int {
+	if n := config.Get().System.Transfers.ChunkVerifyWorkers; n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// chunkVerifyBuffers returns the number of chunks a deduplicated transfer may
+// hold in memory while they wait to be verified.
+func chunkVerifyBuffers() int {
+	n := config.Get().System.Transfers.ChunkVerifyMemory * 1024 * 1024 / maxChunkSize
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+type pendingChunk struct {
+	hash string
+	buf  *bytes.Buffer
+}
+
+// ChunkVerifier stores the chunks of a deduplicated transfer as they are
+// received. Every chunk is read into memory and queued, a pool of workers then
+// verifies the contents of each chunk match its hash before writing it to the
+// chunk store. This allows the next chunk to be received while the previous
+// ones are still being hashed. The number of chunks held in memory is limited
+// separately from the number of workers.
+type ChunkVerifier struct {
+	cs    *ChunkStore
+	queue chan pendingChunk
+	// buffers has a slot for every chunk that may be held in memory.
+	buffers chan struct{}
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// NewChunkVerifier returns a verifier writing to the chunk store, its workers
+// run until Wait is called.
+func NewChunkVerifier(cs *ChunkStore) *ChunkVerifier {
+	n := chunkVerifyWorkers()
+	b := chunkVerifyBuffers()
+	v := &ChunkVerifier{cs: cs, queue: make(chan pendingChunk, b), buffers: make(chan struct{}, b)}
+	v.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go v.work()
+	}
+	return v
+}
+
+func (v *ChunkVerifier) work() {
+	defer v.wg.Done()
+	for c := range v.queue {
+		// Keep draining the queue after a failure so Put never blocks, there
+		// is no point storing the chunks of a transfer that has failed.
+		if v.Err() == nil {
+			if err := v.cs.write(c.hash, c.buf.Bytes()); err != nil {
+				v.fail(fmt.Errorf("%w: chunk %s", err, c.hash))
+			}
+		}
+		c.buf.Reset()
+		chunkBuffers.Put(c.buf)
+		<-v.buffers
+	}
+}
+
+func (v *ChunkVerifier) fail(err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.err == nil {
+		v.err = err
+	}
+}
+
+// Err returns the first error a worker encountered while verifying or storing
+// a chunk, or nil if every chunk so far has been stored.
+func (v *ChunkVerifier) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.err
+}
+
+// Put reads the chunk with the given hash from r and queues it to be verified,
+// waiting for a previous chunk to be verified first if the memory limit has
+// been reached. An error is returned if r cannot be read, if a chunk that was
+// previously queued failed to be verified, or with ErrVerifierClosed if Wait
+// has already been called.
+func (v *ChunkVerifier) Put(hash string, r io.Reader) error {
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if _, err := v.cs.path(hash); err != nil {
+		return err
+	}
+	v.buffers <- struct{}{}
+	buf := chunkBuffers.Get().(*bytes.Buffer)
+	release := func() {
+		buf.Reset()
+		chunkBuffers.Put(buf)
+		<-v.buffers
+	}
+	if _, err := io.Copy(buf, io.LimitReader(r, maxChunkSize+1)); err != nil {
+		release()
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		release()
+		return ErrVerifierClosed
+	}
+	// The queue has room for every buffer, so this never blocks while the
+	// lock is held.
+	v.queue <- pendingChunk{hash: hash, buf: buf}
+	return nil
+}
+
+// Wait stops accepting chunks and waits for the workers to finish with the
+// ones that have been queued, returning the first error encountered. It is
+// safe to call more than once.
+func (v *ChunkVerifier) Wait() error {
+	v.mu.Lock()
+	if !v.closed {
+		v.closed = true
+		close(v.queue)
+	}
+	v.mu.Unlock()
+	v.wg.Wait()
+	return v.Err()
+}
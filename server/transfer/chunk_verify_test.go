@@ -0,0 +1,102 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestChunkVerifier(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ChunkVerifier", func() {
+		var cs *ChunkStore
+
+		g.BeforeEach(func() {
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: t.TempDir(),
+				Transfers:        config.Transfers{ChunkVerifyWorkers: 4},
+			})
+			var err error
+			cs, err = NewChunkStore()
+			g.Assert(err).IsNil()
+		})
+
+		chunk := func(i int) (string, []byte) {
+			data := bytes.Repeat([]byte("chunk "+strconv.Itoa(i)), 1024)
+			sum := sha256.Sum256(data)
+			return hex.EncodeToString(sum[:]), data
+		}
+
+		g.It("stores every chunk that matches its hash", func() {
+			v := NewChunkVerifier(cs)
+			var hashes []string
+			var want []byte
+			for i := 0; i < 32; i++ {
+				hash, data := chunk(i)
+				g.Assert(v.Put(hash, bytes.NewReader(data))).IsNil()
+				hashes = append(hashes, hash)
+				want = append(want, data...)
+			}
+			g.Assert(v.Wait()).IsNil()
+			g.Assert(len(cs.Missing(hashes))).Equal(0)
+
+			rc := cs.Reader(hashes)
+			defer rc.Close()
+			got, err := io.ReadAll(rc)
+			g.Assert(err).IsNil()
+			g.Assert(bytes.Equal(got, want)).IsTrue()
+		})
+
+		g.It("reports a chunk that does not match its hash", func() {
+			v := NewChunkVerifier(cs)
+			hash, data := chunk(0)
+			other, _ := chunk(1)
+			g.Assert(v.Put(hash, bytes.NewReader(data))).IsNil()
+			g.Assert(v.Put(other, bytes.NewReader(data))).IsNil()
+
+			g.Assert(errors.Is(v.Wait(), ErrInvalidChunk)).IsTrue()
+			g.Assert(cs.Has(other)).IsFalse()
+			g.Assert(errors.Is(v.Put(hash, bytes.NewReader(data)), ErrInvalidChunk)).IsTrue()
+		})
+
+		g.It("refuses chunks once it has stopped", func() {
+			v := NewChunkVerifier(cs)
+			g.Assert(v.Wait()).IsNil()
+			g.Assert(v.Wait()).IsNil()
+
+			hash, data := chunk(0)
+			g.Assert(errors.Is(v.Put(hash, bytes.NewReader(data)), ErrVerifierClosed)).IsTrue()
+			g.Assert(cs.Has(hash)).IsFalse()
+		})
+
+		g.It("limits the chunks held in memory", func() {
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: t.TempDir(),
+				Transfers:        config.Transfers{ChunkVerifyWorkers: 8, ChunkVerifyMemory: 1},
+			})
+			g.Assert(chunkVerifyBuffers()).Equal(1)
+
+			v := NewChunkVerifier(cs)
+			g.Assert(cap(v.buffers)).Equal(1)
+			var hashes []string
+			for i := 0; i < 8; i++ {
+				hash, data := chunk(i)
+				g.Assert(v.Put(hash, bytes.NewReader(data))).IsNil()
+				g.Assert(len(v.buffers) <= 1).IsTrue()
+				hashes = append(hashes, hash)
+			}
+			g.Assert(v.Wait()).IsNil()
+			g.Assert(len(v.buffers)).Equal(0)
+			g.Assert(len(cs.Missing(hashes))).Equal(0)
+		})
+	})
+}
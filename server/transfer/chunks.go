@@ -0,0 +1,328 @@
+package transfer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// Chunk boundaries are determined using a gear based rolling hash, with the
+// average chunk size being determined by the number of bits in chunkMask.
+const (
+	minChunkSize = 512 * 1024
+	maxChunkSize = 4 * 1024 * 1024
+	chunkMask    = (1 << 20) - 1
+)
+
+// gear is the table of random values used by the rolling hash. It is generated
+// from a fixed seed so that every node produces identical chunk boundaries for
+// identical data, which is required for deduplication across nodes to work.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range gear {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+var chunkHashRegex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// ErrInvalidChunk is returned when a chunk's contents do not match its hash.
+var ErrInvalidChunk = errors.New("transfer: chunk contents do not match hash")
+
+// ChunkEncoding is the encoding of the chunks of a deduplicated transfer when
+// each chunk is compressed on its own. The hash of a chunk is always that of
+// its uncompressed contents.
+const ChunkEncoding = "gzip"
+
+// CheckChunkEncoding returns an error if chunks sent with the given encoding
+// cannot be decoded by this node.
+func CheckChunkEncoding(v string) error {
+	if v != "" && v != ChunkEncoding {
+		return fmt.Errorf("transfer: unsupported chunk encoding \"%s\"", v)
+	}
+	return nil
+}
+
+// DecodeChunk returns a reader for the uncompressed contents of a chunk sent
+// with the given encoding, which must have been checked with
+// CheckChunkEncoding.
+func DecodeChunk(r io.Reader, encoding string) (io.Reader, error) {
+	if encoding != ChunkEncoding {
+		return r, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to decompress chunk: %w", err)
+	}
+	return gz, nil
+}
+
+// chunkMinAge is how long a chunk is kept after it was last used, even if the
+// chunk store is larger than its limit. This keeps the chunks a transfer that
+// is still in progress was told the store already has.
+var chunkMinAge = time.Hour
+
+// chunkStoreMu prevents chunks from being evicted while they are being looked
+// up for a transfer.
+var chunkStoreMu sync.Mutex
+
+// chunkStoreSize returns the maximum size in bytes of the chunk store, or 0
+// if it is not limited.
+func chunkStoreSize() int64 {
+	return int64(config.Get().System.Transfers.ChunkStoreSize) * 1024 * 1024
+}
+
+// SplitChunks reads from r and calls fn for every content-defined chunk found
+// in the stream along with the hex encoded SHA-256 hash of the chunk. The data
+// slice passed to fn is only valid until fn returns.
+func SplitChunks(r io.Reader, fn func(hash string, data []byte) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	buf := make([]byte, 0, maxChunkSize)
+	var hash uint64
+
+	emit := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		sum := sha256.Sum256(buf)
+		if err := fn(hex.EncodeToString(sum[:]), buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+		hash = 0
+		return nil
+	}
+
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return emit()
+			}
+			return err
+		}
+		buf = append(buf, b)
+		hash = (hash << 1) + gear[b]
+		if (len(buf) >= minChunkSize && hash&chunkMask == 0) || len(buf) >= maxChunkSize {
+			if err := emit(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ChunkStore is a content-addressed store of archive chunks received from
+// previous transfers. It lives inside the configured archive directory.
+type ChunkStore struct {
+	dir string
+}
+
+// NewChunkStore returns the chunk store for this node, creating the underlying
+// directory if it does not yet exist.
+func NewChunkStore() (*ChunkStore, error) {
+	if err := EnsureArchiveDirectory(); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(config.Get().System.ArchiveDirectory, "chunks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("transfer: failed to create chunk store: %w", err)
+	}
+	return &ChunkStore{dir: dir}, nil
+}
+
+func (cs *ChunkStore) path(hash string) (string, error) {
+	if !chunkHashRegex.MatchString(hash) {
+		return "", fmt.Errorf("transfer: invalid chunk hash \"%s\"", hash)
+	}
+	return filepath.Join(cs.dir, hash), nil
+}
+
+// Has returns true if a chunk with the given hash exists in the store. The
+// chunk is marked as used so it is not evicted before it is needed.
+func (cs *ChunkStore) Has(hash string) bool {
+	chunkStoreMu.Lock()
+	defer chunkStoreMu.Unlock()
+	return cs.has(hash)
+}
+
+func (cs *ChunkStore) has(hash string) bool {
+	p, err := cs.path(hash)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	return os.Chtimes(p, now, now) == nil
+}
+
+// Missing returns the hashes that are not currently present in the store.
+func (cs *ChunkStore) Missing(hashes []string) []string {
+	chunkStoreMu.Lock()
+	defer chunkStoreMu.Unlock()
+	missing := make([]string, 0)
+	seen := make(map[string]struct{}, len(hashes))
+	for _, h := range hashes {
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		if !cs.has(h) {
+			missing = append(missing, h)
+		}
+	}
+	return missing
+}
+
+// Put writes a chunk to the store, verifying that its contents match the hash
+// before it is made available to future transfers.
+func (cs *ChunkStore) Put(hash string, r io.Reader) error {
+	p, err := cs.path(hash)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(cs.dir, hash+".part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, maxChunkSize+1)); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return ErrInvalidChunk
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// write verifies that the contents of a chunk that has already been read into
+// memory match the hash, and then writes it to the store.
+func (cs *ChunkStore) write(hash string, data []byte) error {
+	p, err := cs.path(hash)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); len(data) > maxChunkSize || hex.EncodeToString(sum[:]) != hash {
+		return ErrInvalidChunk
+	}
+	f, err := os.CreateTemp(cs.dir, hash+".part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// Reader returns a reader that reassembles the chunks in the given order.
+func (cs *ChunkStore) Reader(hashes []string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, hash := range hashes {
+			p, err := cs.path(hash)
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				_ = pw.CloseWithError(fmt.Errorf("transfer: missing chunk %s: %w", hash, err))
+				return
+			}
+			_, err = io.Copy(pw, f)
+			_ = f.Close()
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		_ = pw.Close()
+	}()
+	return pr
+}
+
+// Prune removes the least recently used chunks until the store is no larger
+// than its limit, along with any chunks that were never completed. Chunks used
+// within chunkMinAge are always kept, so the store may stay over its limit
+// until they are no longer needed.
+func (cs *ChunkStore) Prune() error {
+	chunkStoreMu.Lock()
+	defer chunkStoreMu.Unlock()
+
+	entries, err := os.ReadDir(cs.dir)
+	if err != nil {
+		return err
+	}
+	type chunk struct {
+		path string
+		size int64
+		used time.Time
+	}
+	chunks := make([]chunk, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		p := filepath.Join(cs.dir, e.Name())
+		if !chunkHashRegex.MatchString(e.Name()) {
+			// A chunk that was still being written when Wings was stopped.
+			if strings.Contains(e.Name(), ".part-") && time.Since(info.ModTime()) > chunkMinAge {
+				_ = os.Remove(p)
+			}
+			continue
+		}
+		chunks = append(chunks, chunk{path: p, size: info.Size(), used: info.ModTime()})
+		total += info.Size()
+	}
+	limit := chunkStoreSize()
+	if limit <= 0 || total <= limit {
+		return nil
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].used.Before(chunks[j].used)
+	})
+	for _, c := range chunks {
+		if total <= limit || time.Since(c.used) < chunkMinAge {
+			break
+		}
+		if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= c.size
+	}
+	return nil
+}
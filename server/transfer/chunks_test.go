@@ -0,0 +1,79 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestChunkStore(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ChunkStore", func() {
+		var cs *ChunkStore
+
+		g.BeforeEach(func() {
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: t.TempDir(),
+				Transfers:        config.Transfers{ChunkStoreSize: 1},
+			})
+			var err error
+			cs, err = NewChunkStore()
+			g.Assert(err).IsNil()
+		})
+
+		// put stores a chunk of 512 KiB that was last used at the given time.
+		put := func(b byte, used time.Time) string {
+			data := bytes.Repeat([]byte{b}, 512*1024)
+			sum := sha256.Sum256(data)
+			hash := hex.EncodeToString(sum[:])
+			g.Assert(cs.write(hash, data)).IsNil()
+			g.Assert(os.Chtimes(filepath.Join(cs.dir, hash), used, used)).IsNil()
+			return hash
+		}
+
+		g.It("evicts the least recently used chunks over the limit", func() {
+			old := put('a', time.Now().Add(-3*time.Hour))
+			older := put('b', time.Now().Add(-4*time.Hour))
+			recent := put('c', time.Now().Add(-2*time.Hour))
+			inUse := put('d', time.Now())
+
+			g.Assert(cs.Prune()).IsNil()
+			g.Assert(cs.Missing([]string{old, older, recent, inUse})).Equal([]string{old, older})
+		})
+
+		g.It("keeps chunks that were used recently even if over the limit", func() {
+			a := put('a', time.Now())
+			b := put('b', time.Now())
+			c := put('c', time.Now())
+
+			g.Assert(cs.Prune()).IsNil()
+			g.Assert(len(cs.Missing([]string{a, b, c}))).Equal(0)
+		})
+
+		g.It("decodes chunks that were compressed on their own", func() {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, _ = gz.Write([]byte("chunk"))
+			g.Assert(gz.Close()).IsNil()
+
+			g.Assert(CheckChunkEncoding(ChunkEncoding)).IsNil()
+			g.Assert(CheckChunkEncoding("br") == nil).IsFalse()
+			r, err := DecodeChunk(&buf, ChunkEncoding)
+			g.Assert(err).IsNil()
+			b, err := io.ReadAll(r)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("chunk")
+		})
+	})
+}
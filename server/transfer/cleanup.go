@@ -0,0 +1,137 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/remote"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+const (
+	// CleanupRetry retries removing the files of a failed transfer before
+	// giving up, this is the default.
+	CleanupRetry = "retry"
+	// CleanupQuarantine moves the files of a failed transfer aside so they
+	// can be inspected, rather than removing them.
+	CleanupQuarantine = "quarantine"
+	// CleanupLeave tries to remove the files of a failed transfer once and
+	// leaves them in place if that fails.
+	CleanupLeave = "leave"
+)
+
+// Outcomes of cleaning up the files of a failed transfer, reported to the
+// Panel with the failure.
+const (
+	CleanupRemoved     = "removed"
+	CleanupQuarantined = "quarantined"
+	CleanupLeft        = "left"
+)
+
+// cleanupAttempts is the number of times removing the files of a failed
+// transfer is attempted when retrying.
+const cleanupAttempts = 3
+
+// cleanupBackoff is the delay before the first retry, it is doubled after
+// every attempt.
+var cleanupBackoff = time.Second
+
+// CleanupResult describes what happened to the files of a failed transfer.
+type CleanupResult struct {
+	// Outcome is one of CleanupRemoved, CleanupQuarantined or CleanupLeft.
+	Outcome string
+	// Path is where the files are if they were not removed.
+	Path string
+	// Err is the last error encountered removing the files.
+	Err error
+}
+
+// quarantineDirectory returns the directory the files of failed transfers are
+// moved to. It is kept in the data directory, on the same filesystem as the
+// files of the servers, so they can be moved in and out of it with a rename
+// rather than a copy. The extraction staging directory relies on the same.
+func quarantineDirectory() string {
+	return filepath.Join(config.Get().System.Data, ".quarantine")
+}
+
+// CleanupFailedFiles removes the files extracted by an incoming transfer that
+// failed, using the configured cleanup_failure behaviour. Files that could not
+// be removed are logged as an error, as the Panel will no longer consider the
+// server to be on this node.
+func CleanupFailedFiles(server, dir string) CleanupResult {
+	l := log.WithField("subsystem", "transfer").WithField("server", server).WithField("path", dir)
+	res := cleanupFailedFiles(config.Get().System.Transfers.CleanupFailure, server, dir)
+	switch res.Outcome {
+	case CleanupQuarantined:
+		l.WithField("quarantine", res.Path).Warn("moved server files of failed transfer aside for inspection")
+	case CleanupLeft:
+		l.WithError(res.Err).Error("failed to remove server files of failed transfer, the directory must be cleaned up manually")
+	}
+	return res
+}
+
+// MarkIncomplete flags the files of a failed transfer that could not be
+// removed or restored as incomplete, preventing the server from being started
+// until it has been transferred again. The marker written when extraction
+// started may have been among the files that were removed.
+func MarkIncomplete(server, dir, id string) {
+	if !exists(dir) {
+		return
+	}
+	if err := filesystem.MarkExtractionIncomplete(dir, id); err != nil {
+		log.WithField("subsystem", "transfer").WithField("server", server).WithField("path", dir).WithError(err).Error("failed to mark server files of failed transfer as incomplete")
+	}
+}
+
+func cleanupFailedFiles(mode, server, dir string) CleanupResult {
+	if !exists(dir) {
+		return CleanupResult{Outcome: CleanupRemoved}
+	}
+	if mode == CleanupQuarantine {
+		p := filepath.Join(quarantineDirectory(), filepath.Base(server)+"-"+strconv.FormatInt(time.Now().Unix(), 10))
+		err := os.MkdirAll(quarantineDirectory(), 0o700)
+		if err == nil {
+			err = os.Rename(dir, p)
+		}
+		if err != nil {
+			// The files could not be moved aside, leave them where they are
+			// rather than removing what could have been inspected.
+			return CleanupResult{Outcome: CleanupLeft, Path: dir, Err: err}
+		}
+		return CleanupResult{Outcome: CleanupQuarantined, Path: p}
+	}
+
+	attempts := 1
+	if mode != CleanupLeave {
+		attempts = cleanupAttempts
+	}
+	var err error
+	backoff := cleanupBackoff
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = os.RemoveAll(dir); err == nil || os.IsNotExist(err) {
+			return CleanupResult{Outcome: CleanupRemoved}
+		}
+	}
+	return CleanupResult{Outcome: CleanupLeft, Path: dir, Err: err}
+}
+
+// Apply records the result in the failure reported to the Panel.
+func (r CleanupResult) Apply(failure *remote.TransferFailure) {
+	failure.Cleanup = r.Outcome
+	failure.CleanupPath = r.Path
+	failure.NeedsAttention = r.Outcome != CleanupRemoved
+}
+
+func exists(p string) bool {
+	_, err := os.Lstat(p)
+	return err == nil
+}
@@ -0,0 +1,55 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/remote"
+)
+
+func TestCleanupFailedFiles(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("cleanupFailedFiles", func() {
+		var data, dir string
+		g.BeforeEach(func() {
+			data = t.TempDir()
+			dir = filepath.Join(data, "server")
+			setConfig(config.SystemConfiguration{Data: data})
+			_ = os.MkdirAll(filepath.Join(dir, "world"), 0o700)
+			_ = os.WriteFile(filepath.Join(dir, "world", "level.dat"), []byte("data"), 0o600)
+		})
+
+		g.It("removes the files", func() {
+			res := cleanupFailedFiles(CleanupRetry, "server", dir)
+			g.Assert(res.Outcome).Equal(CleanupRemoved)
+			g.Assert(exists(dir)).IsFalse()
+
+			var failure remote.TransferFailure
+			res.Apply(&failure)
+			g.Assert(failure.NeedsAttention).IsFalse()
+		})
+
+		g.It("moves the files aside when quarantining", func() {
+			res := cleanupFailedFiles(CleanupQuarantine, "server", dir)
+			g.Assert(res.Outcome).Equal(CleanupQuarantined)
+			g.Assert(exists(dir)).IsFalse()
+			g.Assert(exists(filepath.Join(res.Path, "world", "level.dat"))).IsTrue()
+			g.Assert(filepath.Dir(res.Path)).Equal(filepath.Join(data, ".quarantine"))
+
+			var failure remote.TransferFailure
+			res.Apply(&failure)
+			g.Assert(failure.NeedsAttention).IsTrue()
+			g.Assert(failure.CleanupPath).Equal(res.Path)
+		})
+
+		g.It("reports a directory that does not exist as removed", func() {
+			res := cleanupFailedFiles(CleanupQuarantine, "server", filepath.Join(data, "missing"))
+			g.Assert(res.Outcome).Equal(CleanupRemoved)
+		})
+	})
+}
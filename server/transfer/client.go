@@ -0,0 +1,164 @@
+package transfer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// maxRedirects is the number of redirects a transfer request will follow.
+const maxRedirects = 10
+
+// clientSettings are the settings the shared client was created with.
+type clientSettings struct {
+	proxy               string
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     int
+	socketBufferSize    int
+	clientCert          string
+	clientKey           string
+	minTLSVersion       string
+}
+
+var clients = struct {
+	mu       sync.Mutex
+	settings clientSettings
+	client   *http.Client
+}{}
+
+// httpClient returns the client used for every request made by a transfer,
+// routing requests through the configured proxy if there is one. A single
+// client and transport is shared by every transfer and reused while the
+// configuration stays the same, so that connections to the target node are
+// kept alive between requests and the connection limits apply to all
+// transfers running on this node.
+//
+// Only the connection to the proxy is affected, requests are still made to the
+// URL of the target node or object storage so any checks on the destination
+// of a request continue to apply to the real destination rather than the
+// proxy.
+func httpClient() (*http.Client, error) {
+	cfg := config.Get().System.Transfers
+	settings := clientSettings{
+		proxy:               cfg.Proxy,
+		maxIdleConns:        cfg.MaxIdleConns,
+		maxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		maxConnsPerHost:     cfg.MaxConnsPerHost,
+		idleConnTimeout:     cfg.IdleConnTimeout,
+		socketBufferSize:    cfg.SocketBufferSize,
+		clientCert:          cfg.ClientCert,
+		clientKey:           cfg.ClientKey,
+		minTLSVersion:       cfg.MinTLSVersion,
+	}
+	p := settings.proxy
+
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	if clients.client != nil && clients.settings == settings {
+		return clients.client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = settings.maxIdleConns
+	transport.MaxIdleConnsPerHost = settings.maxIdleConnsPerHost
+	transport.MaxConnsPerHost = settings.maxConnsPerHost
+	transport.IdleConnTimeout = time.Duration(settings.idleConnTimeout) * time.Second
+	if settings.socketBufferSize > 0 {
+		transport.DialContext = socketDialer(settings.socketBufferSize * 1024)
+	}
+	if p != "" {
+		u, err := url.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("transfer: invalid proxy url: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("transfer: unsupported proxy scheme \"%s\"", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	minVersion, err := ParseTLSVersion(settings.minTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	if transport.TLSClientConfig != nil {
+		transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+	} else {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.MinVersion = minVersion
+
+	var rt http.RoundTripper = transport
+	cert, err := clientCertificate(settings.clientCert, settings.clientKey)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		// The certificate is always sent, even if it is not signed by one of
+		// the authorities requested by the destination, so it is clear from
+		// the error that it was rejected rather than never sent.
+		transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+		rt = certificateTransport{transport}
+	}
+
+	if clients.client != nil {
+		// Connections made with the old settings are not reused.
+		clients.client.CloseIdleConnections()
+	}
+	clients.settings = settings
+	rt = hostCheckTransport{versionTransport{RoundTripper: rt, min: minVersion}}
+	clients.client = &http.Client{Timeout: 0, Transport: rt, CheckRedirect: checkRedirect}
+	return clients.client, nil
+}
+
+// checkRedirect follows up to maxRedirects redirects, allowing transfers to
+// pass through proxies that redirect to the real location of the target node.
+// The Authorization header is removed by Go when redirected to another host,
+// it is added back if both the original request and the redirect use HTTPS.
+// A redirect that would send the header over plain HTTP after it was
+// originally sent over HTTPS is refused.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("transfer: stopped after %d redirects", maxRedirects)
+	}
+	orig := via[0]
+	// Go changes the method to GET and drops the body when a POST receives a
+	// 301, 302 or 303, which would never reach the transfer endpoint of the
+	// target node.
+	if orig.Method != req.Method {
+		return http.ErrUseLastResponse
+	}
+	auth := orig.Header.Get("Authorization")
+	if auth == "" || orig.URL.Scheme != "https" {
+		return nil
+	}
+	if req.URL.Scheme != "https" {
+		return errors.New("transfer: refusing to follow redirect from https to " + req.URL.Scheme)
+	}
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return nil
+}
+
+// unexpectedStatus returns the error for an unsuccessful response from the
+// target node. Redirects only reach this point if they could not be followed,
+// which is always the case for archives that are streamed to the target node
+// as the request body cannot be sent a second time.
+func unexpectedStatus(res *http.Response) error {
+	if loc := res.Header.Get("Location"); loc != "" && res.StatusCode >= 300 && res.StatusCode < 400 {
+		return fmt.Errorf("destination redirected to %s with status code %d, the redirect could not be followed as the request cannot be sent again", loc, res.StatusCode)
+	}
+	return fmt.Errorf("unexpected status code from destination: %d", res.StatusCode)
+}
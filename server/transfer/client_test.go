@@ -0,0 +1,107 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestHttpClient(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("httpClient", func() {
+		g.After(func() {
+			resetConfig()
+		})
+
+		g.It("routes requests through the configured proxy", func() {
+			var requested string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requested = r.URL.String()
+				_, _ = w.Write([]byte("archive"))
+			}))
+			defer proxy.Close()
+
+			setTransfers(config.Transfers{Proxy: proxy.URL})
+
+			rc, err := DownloadArchive(context.Background(), "http://storage.example.com/archive.tar.gz")
+			g.Assert(err).IsNil()
+			defer rc.Close()
+
+			b, err := io.ReadAll(rc)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("archive")
+			g.Assert(requested).Equal("http://storage.example.com/archive.tar.gz")
+		})
+
+		// redirected returns the request Go sends when following a redirect of
+		// orig to u, which has no Authorization header if u is another host.
+		redirected := func(orig *http.Request, u string) *http.Request {
+			req, err := http.NewRequest(orig.Method, u, nil)
+			g.Assert(err).IsNil()
+			if req.URL.Host == orig.URL.Host {
+				req.Header.Set("Authorization", orig.Header.Get("Authorization"))
+			}
+			return req
+		}
+
+		g.It("adds the authorization header back when redirected to another host over https", func() {
+			orig, err := http.NewRequest(http.MethodPost, "https://proxy.example.com/api/transfers", nil)
+			g.Assert(err).IsNil()
+			orig.Header.Set("Authorization", "Bearer token")
+
+			req := redirected(orig, "https://node.example.com/api/transfers")
+			g.Assert(checkRedirect(req, []*http.Request{orig})).IsNil()
+			g.Assert(req.Header.Get("Authorization")).Equal("Bearer token")
+		})
+
+		g.It("refuses to send the authorization header over http after https", func() {
+			orig, err := http.NewRequest(http.MethodPost, "https://proxy.example.com/api/transfers", nil)
+			g.Assert(err).IsNil()
+			orig.Header.Set("Authorization", "Bearer token")
+
+			g.Assert(checkRedirect(redirected(orig, "http://node.example.com/api/transfers"), []*http.Request{orig}) == nil).IsFalse()
+			g.Assert(checkRedirect(redirected(orig, "http://proxy.example.com/api/transfers"), []*http.Request{orig}) == nil).IsFalse()
+		})
+
+		g.It("does not add the authorization header back when redirected from http", func() {
+			orig, err := http.NewRequest(http.MethodPost, "http://proxy.example.com/api/transfers", nil)
+			g.Assert(err).IsNil()
+			orig.Header.Set("Authorization", "Bearer token")
+
+			req := redirected(orig, "https://node.example.com/api/transfers")
+			g.Assert(checkRedirect(req, []*http.Request{orig})).IsNil()
+			g.Assert(req.Header.Get("Authorization")).Equal("")
+		})
+
+		g.It("does not turn a redirected POST into a GET", func() {
+			resetConfig()
+
+			redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			}))
+			defer redirect.Close()
+
+			client, err := httpClient()
+			g.Assert(err).IsNil()
+			res, err := client.Post(redirect.URL, "application/json", strings.NewReader("{}"))
+			g.Assert(err).IsNil()
+			_ = res.Body.Close()
+			g.Assert(res.StatusCode).Equal(http.StatusFound)
+		})
+
+		g.It("rejects an unsupported proxy scheme", func() {
+			setTransfers(config.Transfers{Proxy: "ftp://proxy.example.com"})
+
+			_, err := httpClient()
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
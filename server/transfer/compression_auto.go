@@ -0,0 +1,137 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// CompressionAuto is the compression_format that picks the format used for an
+// archive by sampling the files of the server.
+const CompressionAuto = "auto"
+
+// ArchiveFormatHeader is the header used by the source node to send the
+// compression format of the archive, allowing it to be seen without reading
+// the body of the request.
+const ArchiveFormatHeader = "X-Archive-Format"
+
+const (
+	// sampleFileLimit is the most read from a single file when sampling, so
+	// that one large file does not make up the whole sample.
+	sampleFileLimit = 1024 * 1024
+	// storeRatio is the compressed size of a sample, as a fraction of its
+	// original size, at or above which the archive is not compressed.
+	storeRatio = 0.9
+	// zstdRatio is the ratio at or below which zstd is used, as the data
+	// compresses well enough for its better ratio to matter. Anything in
+	// between uses gzip.
+	zstdRatio = 0.5
+)
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// CompressionSample is the result of sampling the files of a server to choose
+// a compression format.
+type CompressionSample struct {
+	// Sampled is the number of bytes read from the files.
+	Sampled int64
+	// Compressed is the size of the sample once compressed.
+	Compressed int64
+}
+
+// Ratio returns the compressed size of the sample as a fraction of its
+// original size, or 1 if nothing was sampled.
+func (s CompressionSample) Ratio() float64 {
+	if s.Sampled == 0 {
+		return 1
+	}
+	return float64(s.Compressed) / float64(s.Sampled)
+}
+
+// Format returns the compression format to use for data that compresses like
+// the sample.
+func (s CompressionSample) Format() filesystem.CompressionFormat {
+	switch r := s.Ratio(); {
+	case r >= storeRatio:
+		return filesystem.CompressionNone
+	case r <= zstdRatio:
+		return filesystem.CompressionZstd
+	default:
+		return filesystem.CompressionGzip
+	}
+}
+
+// sampleCompression compresses up to limit bytes taken from the start of the
+// regular files within root, in the order they are walked, using the fastest
+// zstd level. Files for which include returns false are skipped.
+func sampleCompression(ctx context.Context, root string, limit int64, include func(relative string) bool) (CompressionSample, error) {
+	var s CompressionSample
+	var out countingWriter
+	enc, err := zstd.NewWriter(&out, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return s, err
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.Sampled >= limit {
+			return filepath.SkipAll
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, p); err == nil && include != nil && !include(filepath.ToSlash(rel)) {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		n, _ := io.Copy(enc, io.LimitReader(f, min(limit-s.Sampled, sampleFileLimit)))
+		s.Sampled += n
+		return nil
+	})
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	s.Compressed = out.n
+	return s, err
+}
+
+// compressionFormat returns the compression format configured for archives.
+// When it is set to "auto" the files within root are sampled to pick it.
+func compressionFormat(ctx context.Context, root string, include func(relative string) bool) (filesystem.CompressionFormat, *CompressionSample, error) {
+	cfg := config.Get().System.Transfers
+	if !strings.EqualFold(cfg.CompressionFormat, CompressionAuto) {
+		return filesystem.ParseCompressionFormat(cfg.CompressionFormat), nil, nil
+	}
+	s, err := sampleCompression(ctx, root, int64(cfg.CompressionSampleSize)*1024*1024, include)
+	if err != nil {
+		return filesystem.CompressionGzip, nil, err
+	}
+	return s.Format(), &s, nil
+}
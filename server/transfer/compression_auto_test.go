@@ -0,0 +1,64 @@
+package transfer
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+func TestSampleCompression(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("sampleCompression", func() {
+		g.It("stores data that does not compress", func() {
+			dir := t.TempDir()
+			b := make([]byte, 256*1024)
+			_, _ = rand.Read(b)
+			g.Assert(os.WriteFile(filepath.Join(dir, "random.bin"), b, 0o600)).IsNil()
+
+			s, err := sampleCompression(context.Background(), dir, 1024*1024, nil)
+			g.Assert(err).IsNil()
+			g.Assert(s.Sampled).Equal(int64(len(b)))
+			g.Assert(s.Format()).Equal(filesystem.CompressionNone)
+		})
+
+		g.It("uses zstd for data that compresses well", func() {
+			dir := t.TempDir()
+			g.Assert(os.WriteFile(filepath.Join(dir, "server.properties"), []byte(strings.Repeat("motd=hello\n", 10000)), 0o600)).IsNil()
+
+			s, err := sampleCompression(context.Background(), dir, 1024*1024, nil)
+			g.Assert(err).IsNil()
+			g.Assert(s.Format()).Equal(filesystem.CompressionZstd)
+		})
+
+		g.It("only reads up to the sample size", func() {
+			dir := t.TempDir()
+			for _, name := range []string{"a", "b", "c"} {
+				g.Assert(os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("a", 1000)), 0o600)).IsNil()
+			}
+
+			s, err := sampleCompression(context.Background(), dir, 1500, nil)
+			g.Assert(err).IsNil()
+			g.Assert(s.Sampled).Equal(int64(1500))
+
+			s, err = sampleCompression(context.Background(), dir, 1500, func(relative string) bool {
+				return relative == "c"
+			})
+			g.Assert(err).IsNil()
+			g.Assert(s.Sampled).Equal(int64(1000))
+		})
+
+		g.It("does not compress an empty server", func() {
+			s, err := sampleCompression(context.Background(), t.TempDir(), 1024, nil)
+			g.Assert(err).IsNil()
+			g.Assert(s.Format()).Equal(filesystem.CompressionNone)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package transfer
+
+import (
+	"mime/multipart"
+
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// writeFormat sends the compression format of the archive so the target node
+// is able to pick the correct format when extracting it, followed by a
+// description of how it was compressed so it can choose how many goroutines to
+// decompress it with. Older nodes ignore the description.
+func (a *Archive) writeFormat(mp *multipart.Writer) error {
+	if err := mp.WriteField("format", string(a.Format())); err != nil {
+		return err
+	}
+	v, err := json.Marshal(a.archive.CompressionInfo())
+	if err != nil {
+		return err
+	}
+	return mp.WriteField("compression_info", string(v))
+}
+
+// ParseCompressionInfo parses the description of how an archive was compressed
+// sent by the source node.
+func ParseCompressionInfo(v []byte) (filesystem.CompressionInfo, error) {
+	var info filesystem.CompressionInfo
+	if err := json.Unmarshal(v, &info); err != nil {
+		return filesystem.CompressionInfo{}, err
+	}
+	return info, nil
+}
+
+// ExtractOptions returns the options an archive described by info is
+// extracted with on this node. A zero value info, sent by nodes that do not
+// describe their archives, is decompressed using the default number of
+// goroutines.
+func ExtractOptions(info filesystem.CompressionInfo) filesystem.ExtractOptions {
+	return filesystem.ExtractOptions{
+		Limit:        ExtractLimit(),
+		Threads:      info.DecoderThreads(compressionThreads()),
+		MemoryBudget: int64(config.Get().System.Transfers.ExtractMemoryBudget) * 1024 * 1024,
+		Dictionaries: dictionaries(),
+		Xattrs:       config.Get().System.Transfers.PreserveXattrs,
+		SELinux:      config.Get().System.Transfers.RestoreSELinuxLabels,
+	}
+}
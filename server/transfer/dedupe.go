@@ -0,0 +1,280 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// ChunksRequest is sent to the target node to determine which chunks of an
+// archive it does not already have in its chunk store.
+type ChunksRequest struct {
+	Chunks []string `json:"chunks"`
+}
+
+// ChunksResponse is returned by the target node and contains the chunks that
+// must be sent by the source node.
+type ChunksResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// ChunksURL returns the URL used to query the chunk store of the target node
+// for the given transfer URL.
+func ChunksURL(url string) string {
+	return strings.TrimSuffix(url, "/") + "/chunks"
+}
+
+// PushArchiveDeduplicated archives the server to the local archive directory,
+// splits it into content-defined chunks and only sends the chunks that the
+// target node does not already have from a previous transfer. The target node
+// reassembles the archive locally before verifying and extracting it. If the
+// target node supports it the archive is left uncompressed and every chunk is
+// compressed as it is sent, as a change to a single file changes every chunk
+// after it once the archive has been compressed.
+func (t *Transfer) PushArchiveDeduplicated(url, token string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	t.SendMessage("Preparing to send deduplicated server data to destination...")
+	t.SetStatus(StatusProcessing)
+
+	if err := EnsureArchiveDirectory(); err != nil {
+		t.Error(err, "Failed to prepare archive directory for transfer.")
+		return nil, err
+	}
+
+	a, err := t.chunkedArchive()
+	if err != nil {
+		t.Error(err, "Failed to get archive for transfer.")
+		return nil, errors.New("failed to get archive for transfer")
+	}
+	compress := a.Format() == filesystem.CompressionNone && t.Supports(VersionChunkCompression)
+
+	if err := t.reserveArchiveSpace(int64(a.Progress().Total())); err != nil {
+		t.Error(err, "Not enough space in the archive directory for transfer.")
+		return nil, err
+	}
+	defer t.releaseArchiveSpace()
+
+	store := t.ArchiveStore()
+	name := t.StagingName(a.Format())
+	defer t.removeArchive(store, name)
+
+	t.SendMessage("Creating archive of server data...")
+	done := t.timings.Start(PhaseArchive)
+	checksum, err := t.writeArchive(ctx, a, store, name)
+	if err != nil {
+		done()
+		t.Error(err, "Failed to create archive for transfer.")
+		return nil, err
+	}
+
+	manifest, err := chunkArchive(store, name)
+	done()
+	if err != nil {
+		t.Error(err, "Failed to split archive into chunks.")
+		return nil, err
+	}
+
+	defer t.timings.Start(PhaseUpload)()
+
+	missing, err := t.missingChunks(ctx, url, token, manifest)
+	if err != nil {
+		t.Error(err, "Failed to query destination for existing chunks.")
+		return nil, err
+	}
+	t.SendMessage(fmt.Sprintf("Destination already has %d of %d chunks, sending %d.", len(manifest)-len(missing), len(manifest), len(missing)))
+
+	body, writer := io.Pipe()
+	defer body.Close()
+	mp := multipart.NewWriter(writer)
+
+	go func() {
+		err := t.writeState(mp)
+		if err == nil {
+			err = t.writeFileManifest(ctx, mp)
+		}
+		if err == nil {
+			err = a.writeFormat(mp)
+		}
+		if err == nil {
+			err = a.writeSize(mp)
+		}
+		if err == nil {
+			err = t.writeChunkedBody(mp, store, name, manifest, missing, checksum, compress)
+		}
+		if err == nil {
+			err = mp.Close()
+		}
+		if err == nil {
+			t.markSent()
+		}
+		_ = writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(ctx, req, token)
+	req.Header.Set("Content-Type", mp.FormDataContentType())
+	a.setFormatHeaders(req)
+
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, context.Canceled
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	v, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", unexpectedStatus(res), string(v))
+	}
+	t.SendMessage("Finished sending deduplicated archive to destination.")
+	t.retainArchive(store, name, checksum)
+	return v, nil
+}
+
+// chunkedArchive returns the archive that is split into chunks. It is left
+// uncompressed if the target node supports compressing every chunk on its own,
+// so that identical files produce identical chunks.
+func (t *Transfer) chunkedArchive() (*Archive, error) {
+	if t.archive.Load() == nil && t.Supports(VersionChunkCompression) {
+		rawSize, err := t.Server.Filesystem().DiskUsage(true)
+		if err != nil {
+			return nil, fmt.Errorf("transfer: failed to get server disk usage: %w", err)
+		}
+		t.archive.Store(newArchive(t, uint64(rawSize), filesystem.CompressionNone))
+	}
+	return t.Archive()
+}
+
+// chunkArchive returns the ordered list of chunk hashes that make up the archive.
+func chunkArchive(store ArchiveStore, name string) ([]string, error) {
+	f, err := store.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hashes []string
+	err = SplitChunks(f, func(hash string, _ []byte) error {
+		hashes = append(hashes, hash)
+		return nil
+	})
+	return hashes, err
+}
+
+// missingChunks asks the target node which of the chunks it needs.
+func (t *Transfer) missingChunks(ctx context.Context, url, token string, manifest []string) ([]string, error) {
+	b, err := json.Marshal(ChunksRequest{Chunks: manifest})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ChunksURL(url), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(ctx, req, token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(res)
+	}
+	var data ChunksResponse
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data.Missing, nil
+}
+
+// writeChunkedBody writes the manifest, every missing chunk and finally the
+// checksum of the complete archive to the multipart writer. If compress is
+// true every chunk is compressed with ChunkEncoding.
+func (t *Transfer) writeChunkedBody(mp *multipart.Writer, store ArchiveStore, name string, manifest, missing []string, checksum string, compress bool) error {
+	if compress {
+		if err := mp.WriteField("chunk_encoding", ChunkEncoding); err != nil {
+			return err
+		}
+	}
+	m, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := mp.WriteField("manifest", string(m)); err != nil {
+		return err
+	}
+	var gz *gzip.Writer
+	if compress {
+		gz, _ = gzip.NewWriterLevel(io.Discard, gzip.BestSpeed)
+	}
+
+	want := make(map[string]struct{}, len(missing))
+	for _, h := range missing {
+		want[h] = struct{}{}
+	}
+
+	f, err := store.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = SplitChunks(f, func(hash string, data []byte) error {
+		if _, ok := want[hash]; !ok {
+			return nil
+		}
+		// Only send each chunk once, even if it appears multiple times.
+		delete(want, hash)
+		w, err := mp.CreateFormFile("chunk", hash)
+		if err != nil {
+			return err
+		}
+		if gz == nil {
+			_, err = w.Write(data)
+			return err
+		}
+		gz.Reset(w)
+		if _, err := gz.Write(data); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := t.writeTimings(mp); err != nil {
+		return err
+	}
+	return t.writeChecksum(mp, checksum)
+}
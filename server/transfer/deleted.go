@@ -0,0 +1,78 @@
+package transfer
+
+import (
+	"time"
+)
+
+// PhaseDeleted is reported to the Panel for a transfer that was aborted
+// because its server was deleted while it was running.
+const PhaseDeleted Phase = "deleted"
+
+// Running returns the transfer of the server that deleting the server would
+// break, or nil if there is none. An outgoing transfer stops depending on the
+// files of the server once they have all been sent to the target node, which
+// allows the Panel to delete the server from this node as soon as the target
+// node has reported the transfer as successful.
+func Running(server string) *Transfer {
+	if t := Incoming().Get(server); t != nil && !t.finished() {
+		return t
+	}
+	if t := Outgoing().Get(server); t != nil && !t.Sent() && !t.finished() {
+		return t
+	}
+	return nil
+}
+
+// finished returns true if the transfer has reached a final status.
+func (t *Transfer) finished() bool {
+	switch t.Status() {
+	case StatusCancelled, StatusFailed, StatusCompleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// markSent records that an outgoing transfer has sent everything it needs
+// from the files of the server.
+func (t *Transfer) markSent() {
+	t.sent.Store(true)
+}
+
+// Sent returns true once an outgoing transfer no longer needs the files of
+// the server.
+func (t *Transfer) Sent() bool {
+	return t.sent.Load()
+}
+
+// Deleted returns true if the transfer was aborted because its server was
+// deleted.
+func (t *Transfer) Deleted() bool {
+	return t.deleted.Load()
+}
+
+// AbortForDeletion cancels the transfer because its server is being deleted
+// and waits up to timeout for it to stop, so the files of the server are not
+// removed while the transfer is still reading or writing them. False is
+// returned if the transfer did not stop in time.
+func (t *Transfer) AbortForDeletion(timeout time.Duration) bool {
+	t.deleted.Store(true)
+	t.Cancel()
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// finish is called once the transfer has been removed from its manager, it
+// also closes the persisted log of the transfer.
+func (t *Transfer) finish() {
+	t.doneOnce.Do(func() {
+		if t.done != nil {
+			close(t.done)
+		}
+	})
+	t.closeLog()
+}
@@ -0,0 +1,60 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestDeletedDuringTransfer(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("deleting a server during a transfer", func() {
+		g.BeforeEach(func() {
+			resetConfig()
+		})
+
+		g.It("is blocked while an incoming transfer is running", func() {
+			trnsfr := New(context.Background(), &server.Server{})
+			Incoming().Add(trnsfr)
+			defer Incoming().Remove(trnsfr)
+
+			g.Assert(Running(trnsfr.Server.ID()) == trnsfr).IsTrue()
+		})
+
+		g.It("is not blocked once an outgoing transfer has sent the server's files", func() {
+			trnsfr := New(context.Background(), &server.Server{})
+			Outgoing().Add(trnsfr)
+			defer Outgoing().Remove(trnsfr)
+
+			g.Assert(Running(trnsfr.Server.ID()) == trnsfr).IsTrue()
+			trnsfr.markSent()
+			g.Assert(Running(trnsfr.Server.ID()) == nil).IsTrue()
+		})
+
+		g.It("aborts the transfer and waits for it to stop", func() {
+			trnsfr := New(context.Background(), &server.Server{})
+			Outgoing().Add(trnsfr)
+			go func() {
+				<-trnsfr.Context().Done()
+				Outgoing().Remove(trnsfr)
+			}()
+
+			g.Assert(trnsfr.AbortForDeletion(time.Second)).IsTrue()
+			g.Assert(trnsfr.Deleted()).IsTrue()
+			g.Assert(trnsfr.Failure(DirectionOutgoing).Phase).Equal(string(PhaseDeleted))
+		})
+
+		g.It("stops waiting if the transfer does not stop in time", func() {
+			trnsfr := New(context.Background(), &server.Server{})
+			Outgoing().Add(trnsfr)
+			defer Outgoing().Remove(trnsfr)
+
+			g.Assert(trnsfr.AbortForDeletion(10 * time.Millisecond)).IsFalse()
+		})
+	})
+}
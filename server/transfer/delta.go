@@ -0,0 +1,249 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// ErrDeltaUnsupported is returned when the target node does not support delta
+// transfers, in which case a full transfer should be performed instead.
+var ErrDeltaUnsupported = errors.New("transfer: target does not support delta transfers")
+
+// ManifestEntry describes a single regular file that already exists on a node.
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// Manifest is the list of files present in a server's data directory.
+type Manifest []ManifestEntry
+
+// ManifestURL returns the URL used to request the manifest of files the target
+// node already has for the given transfer URL.
+func ManifestURL(url string) string {
+	return strings.TrimSuffix(url, "/") + "/manifest"
+}
+
+// BuildManifest walks the given directory and returns a manifest containing
+// every regular file within it. Symlinks and other special files are skipped,
+// they are always included in a delta archive. If the directory does not
+// exist an empty manifest is returned.
+func BuildManifest(ctx context.Context, dir string) (Manifest, error) {
+	manifest := make(Manifest, 0)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(ctx, p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		manifest = append(manifest, ManifestEntry{Path: filepath.ToSlash(rel), Size: info.Size(), Hash: hash})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Delta is the result of comparing the local copy of a server against the
+// manifest returned by the target node.
+type Delta struct {
+	// Changed contains the relative paths of files that are missing or differ
+	// on the target node and therefore must be sent.
+	Changed map[string]struct{}
+	// Deleted contains the relative paths of files that exist on the target
+	// node but no longer exist on this node.
+	Deleted []string
+	// Unchanged is the number of files that do not need to be sent.
+	Unchanged int
+	// UnchangedSize is the total size in bytes of the unchanged files.
+	UnchangedSize int64
+
+	unchanged map[string]struct{}
+}
+
+// Include reports whether the file at the relative path should be added to
+// the delta archive. Anything that is not a regular file on this node was not
+// compared, so it is always included.
+func (d *Delta) Include(relative string) bool {
+	_, ok := d.unchanged[relative]
+	return !ok
+}
+
+// ComputeDelta compares the files in dir against the manifest of the target
+// node. Files are only hashed if their size matches the remote copy.
+func ComputeDelta(ctx context.Context, dir string, remote Manifest) (*Delta, error) {
+	byPath := make(map[string]ManifestEntry, len(remote))
+	for _, e := range remote {
+		byPath[e.Path] = e
+	}
+
+	d := &Delta{Changed: make(map[string]struct{}), unchanged: make(map[string]struct{})}
+	seen := make(map[string]struct{}, len(remote))
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = struct{}{}
+
+		e, ok := byPath[rel]
+		if ok {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() == e.Size {
+				hash, err := hashFile(ctx, p)
+				if err != nil {
+					return err
+				}
+				if hash == e.Hash {
+					d.unchanged[rel] = struct{}{}
+					d.Unchanged++
+					d.UnchangedSize += e.Size
+					return nil
+				}
+			}
+		}
+		d.Changed[rel] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range remote {
+		if _, ok := seen[e.Path]; !ok {
+			d.Deleted = append(d.Deleted, e.Path)
+		}
+	}
+	return d, nil
+}
+
+// fetchManifest requests the manifest of files the target node already has for
+// this server. ErrDeltaUnsupported is returned if the target node does not
+// expose the manifest endpoint.
+func (t *Transfer) fetchManifest(ctx context.Context, url, token string) (Manifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ManifestURL(url), bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(ctx, req, token)
+
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed {
+		return nil, ErrDeltaUnsupported
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(res)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(res.Body).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// PushDeltaToTarget sends only the files that are missing or have changed on
+// the target node, along with a list of files the target should delete. If the
+// target node does not support delta transfers, or its manifest cannot be
+// retrieved, a full transfer is performed instead.
+func (t *Transfer) PushDeltaToTarget(url, token string) ([]byte, error) {
+	manifest, err := t.fetchManifest(t.ctx, url, token)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		// Only a 404 or 405 means the destination does not support delta
+		// transfers, anything else is a failure that is worth reporting.
+		if errors.Is(err, ErrDeltaUnsupported) {
+			t.Log().Info("destination does not support delta transfers, falling back to a full transfer")
+			t.SendMessage("Destination does not support delta transfers, sending all server data...")
+		} else {
+			t.Log().WithError(err).Warn("failed to retrieve manifest from destination, falling back to a full transfer")
+			t.SendMessage("Warning: failed to retrieve the manifest of the destination, sending all server data: " + err.Error())
+		}
+		return t.PushArchiveToTarget(url, token)
+	}
+
+	t.SendMessage("Comparing server data against the copy on the destination...")
+	delta, err := ComputeDelta(t.ctx, t.sourceFilesystem().Path(), manifest)
+	if err != nil {
+		t.Error(err, "Failed to compare server data against the destination.")
+		return nil, err
+	}
+	t.SendMessage(fmt.Sprintf("Destination already has %d unchanged files, sending %d and removing %d.", delta.Unchanged, len(delta.Changed), len(delta.Deleted)))
+
+	a, err := t.Archive()
+	if err != nil {
+		t.Error(err, "Failed to get archive for transfer.")
+		return nil, errors.New("failed to get archive for transfer")
+	}
+	if filter := a.archive.Filter; filter != nil {
+		a.archive.Filter = func(relative string) bool {
+			return delta.Include(relative) && filter(relative)
+		}
+	} else {
+		a.archive.Filter = delta.Include
+	}
+	a.deleted = delta.Deleted
+	a.existing = delta.UnchangedSize
+
+	return t.PushArchiveToTarget(url, token)
+}
+
+// hashFile returns the checksum of the file, files that have not changed since
+// a previous manifest was built are not hashed again. A file is only treated
+// as unchanged if its inode and change time are the same as well as its size
+// and modification time, see ChecksumCache.
+func hashFile(ctx context.Context, p string) (string, error) {
+	return Checksums().SumContext(ctx, p)
+}
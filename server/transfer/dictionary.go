@@ -0,0 +1,97 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// DictionaryHeader is the header used by the source node to send the ID of the
+// zstd dictionary the archive is compressed with, allowing the target node to
+// check it has the same dictionary before anything is received. It is not
+// sent for archives compressed without a dictionary.
+const DictionaryHeader = "X-Compression-Dictionary"
+
+// ErrDictionaryMismatch is returned when the archive of a transfer has been
+// compressed with a dictionary this node does not have.
+var ErrDictionaryMismatch = errors.New("transfer: destination does not have the compression dictionary used by the source")
+
+// Dictionary is the zstd dictionary configured for this node.
+type Dictionary struct {
+	// ID is the ID of the dictionary, this is written to every zstd frame
+	// compressed with it.
+	ID uint32
+	// Content is the dictionary itself.
+	Content []byte
+}
+
+// LoadDictionary reads the zstd dictionary archives are compressed with, or
+// returns nil if no dictionary has been configured for this node.
+func LoadDictionary() (*Dictionary, error) {
+	p := config.Get().System.Transfers.CompressionDictionary
+	if p == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to read compression dictionary: %w", err)
+	}
+	id, err := filesystem.DictionaryID(b)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to load compression dictionary: %w", err)
+	}
+	if id == 0 {
+		// Frames compressed with a dictionary without an ID cannot be told
+		// apart from ones compressed without a dictionary at all.
+		return nil, errors.New("transfer: compression dictionary does not have an id")
+	}
+	return &Dictionary{ID: id, Content: b}, nil
+}
+
+// CheckDictionary checks this node has the dictionary with the ID sent by the
+// source node in the DictionaryHeader. An empty value, sent for archives that
+// are not compressed with a dictionary, is always accepted.
+func CheckDictionary(v string) error {
+	if v == "" {
+		return nil
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return fmt.Errorf("transfer: invalid compression dictionary id \"%s\"", v)
+	}
+	d, err := LoadDictionary()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrDictionaryMismatch, err)
+	}
+	if d == nil || d.ID != uint32(id) {
+		return fmt.Errorf("%w (dictionary %d)", ErrDictionaryMismatch, id)
+	}
+	return nil
+}
+
+// dictionaries returns the dictionaries archives received by this node may
+// have been compressed with.
+func dictionaries() [][]byte {
+	d, err := LoadDictionary()
+	if err != nil || d == nil {
+		return nil
+	}
+	return [][]byte{d.Content}
+}
+
+// setFormatHeaders sets the headers describing how the archive is compressed
+// on a request sending it to the target node.
+func (a *Archive) setFormatHeaders(req *http.Request) {
+	req.Header.Set(ArchiveFormatHeader, string(a.Format()))
+	if v := a.Progress().Total(); v > 0 {
+		req.Header.Set(TotalSizeHeader, strconv.FormatUint(v, 10))
+	}
+	if id := a.archive.CompressionInfo().Dictionary; id != 0 {
+		req.Header.Set(DictionaryHeader, strconv.FormatUint(uint64(id), 10))
+	}
+}
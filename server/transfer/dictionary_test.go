@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+func TestDictionary(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("compression dictionaries", func() {
+		var contents [][]byte
+		for i := 0; i < 16; i++ {
+			var b strings.Builder
+			for j := 0; j < 64; j++ {
+				b.WriteString("level-name=world" + strconv.Itoa(i*j%7) + "\nmotd=A Minecraft Server " + strconv.Itoa(i+j) + "\nmax-players=" + strconv.Itoa(j) + "\n")
+			}
+			contents = append(contents, []byte(b.String()))
+		}
+		dict, err := zstd.BuildDict(zstd.BuildDictOptions{ID: 1234, Contents: contents, History: contents[0], Offsets: [3]int{1, 4, 8}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var dir string
+		g.BeforeEach(func() {
+			dir = t.TempDir()
+			p := filepath.Join(dir, "dictionary")
+			g.Assert(os.WriteFile(p, dict, 0o600)).IsNil()
+			setTransfers(config.Transfers{CompressionDictionary: p})
+		})
+
+		g.It("accepts archives compressed with the same dictionary or none", func() {
+			g.Assert(CheckDictionary("")).IsNil()
+			g.Assert(CheckDictionary("1234")).IsNil()
+		})
+
+		g.It("rejects archives compressed with a different dictionary", func() {
+			g.Assert(errors.Is(CheckDictionary("4321"), ErrDictionaryMismatch)).IsTrue()
+
+			config.Update(func(c *config.Configuration) {
+				c.System.Transfers.CompressionDictionary = ""
+			})
+			g.Assert(errors.Is(CheckDictionary("1234"), ErrDictionaryMismatch)).IsTrue()
+		})
+
+		g.It("extracts an archive compressed with the dictionary", func() {
+			src, err := filesystem.New(filepath.Join(dir, "source"), 0, nil)
+			g.Assert(err).IsNil()
+			g.Assert(src.Write("server.properties", bytes.NewReader(contents[0]), int64(len(contents[0])), 0o644)).IsNil()
+
+			a := &filesystem.Archive{Filesystem: src, Compression: filesystem.CompressionZstd, Dictionary: dict}
+			g.Assert(a.CompressionInfo().Dictionary).Equal(uint32(1234))
+			var buf bytes.Buffer
+			g.Assert(a.Stream(context.Background(), &buf)).IsNil()
+
+			dst, err := filesystem.New(filepath.Join(dir, "target"), 0, nil)
+			g.Assert(err).IsNil()
+			g.Assert(dst.ExtractStreamWithOptions(context.Background(), "/", "archive.tar.zst", bytes.NewReader(buf.Bytes()), ExtractOptions(a.CompressionInfo()))).IsNil()
+			b, err := os.ReadFile(filepath.Join(dir, "target", "server.properties"))
+			g.Assert(err).IsNil()
+			g.Assert(b).Equal(contents[0])
+
+			dst, err = filesystem.New(filepath.Join(dir, "other"), 0, nil)
+			g.Assert(err).IsNil()
+			g.Assert(dst.ExtractStreamWithOptions(context.Background(), "/", "archive.tar.zst", bytes.NewReader(buf.Bytes()), filesystem.ExtractOptions{}) == nil).IsFalse()
+		})
+	})
+}
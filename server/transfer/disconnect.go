@@ -0,0 +1,66 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// ErrSourceDisconnected is returned when the connection to the source of a
+// transfer archive is lost part way through the download. Transfers that fail
+// with this error can safely be retried.
+var ErrSourceDisconnected = errors.New("transfer: source disconnected during download")
+
+// IsRetryable returns true if the transfer failed because the connection was
+// lost while the archive was being downloaded, rather than because of a
+// problem with the archive itself.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrSourceDisconnected)
+}
+
+// disconnectErrors are the errors returned when the connection to the remote
+// end is lost or it stops responding.
+var disconnectErrors = []error{
+	io.ErrUnexpectedEOF,
+	net.ErrClosed,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EPIPE,
+	syscall.ETIMEDOUT,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+}
+
+// isDisconnect returns true if the error was caused by the remote end of the
+// connection going away, or by the connection timing out.
+func isDisconnect(err error) bool {
+	for _, v := range disconnectErrors {
+		if errors.Is(err, v) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// disconnectReader wraps the body of a download and classifies any error that
+// is caused by the connection being lost as ErrSourceDisconnected.
+type disconnectReader struct {
+	io.ReadCloser
+}
+
+// NewDisconnectReader returns a reader that returns ErrSourceDisconnected when
+// reading from r fails because the connection to the source was lost.
+func NewDisconnectReader(r io.ReadCloser) io.ReadCloser {
+	return &disconnectReader{ReadCloser: r}
+}
+
+func (r *disconnectReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && isDisconnect(err) {
+		return n, fmt.Errorf("%w: %v", ErrSourceDisconnected, err)
+	}
+	return n, err
+}
@@ -0,0 +1,217 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestDownloadArchive(t *testing.T) {
+	g := Goblin(t)
+	resetConfig()
+
+	g.Describe("DownloadArchive", func() {
+		g.It("classifies a connection closed mid-body as retryable", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(1024*1024))
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(strings.Repeat("a", 1024)))
+				w.(http.Flusher).Flush()
+
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					panic(err)
+				}
+				_ = conn.Close()
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+
+			_, err = io.Copy(io.Discard, rc)
+			g.Assert(err == nil).IsFalse()
+			g.Assert(IsRetryable(err)).IsTrue()
+		})
+
+		g.It("does not classify a complete download as retryable", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("archive"))
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+
+			b, err := io.ReadAll(rc)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("archive")
+		})
+
+		g.It("downloads an archive sent with chunked encoding", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Flushing before the handler returns causes the response to be
+				// sent without a Content-Length.
+				_, _ = w.Write([]byte("arch"))
+				w.(http.Flusher).Flush()
+				_, _ = w.Write([]byte("ive"))
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+			g.Assert(rc.Size).Equal(int64(-1))
+
+			b, err := io.ReadAll(rc)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("archive")
+		})
+
+		g.It("uses the estimated size of an archive generated as it is sent", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(EstimatedSizeHeader, "4096")
+				_, _ = w.Write([]byte("archive"))
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+			g.Assert(rc.Size).Equal(int64(4096))
+			g.Assert(rc.Estimated).IsTrue()
+		})
+
+		g.It("retries the initial request while the archive is not available", func() {
+			setTransfers(config.Transfers{DownloadRetries: 2})
+			defer resetConfig()
+			delay := downloadGraceDelay
+			downloadGraceDelay = time.Millisecond
+			defer func() {
+				downloadGraceDelay = delay
+			}()
+
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte("archive"))
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+			g.Assert(requests).Equal(2)
+
+			b, err := io.ReadAll(rc)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("archive")
+		})
+
+		g.It("resumes a download from the bytes already received", func() {
+			setTransfers(config.Transfers{DownloadResumes: 1})
+			defer resetConfig()
+
+			var ranges []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("ETag", "\"v1\"")
+				if v := r.Header.Get("Range"); v != "" {
+					ranges = append(ranges, v+" "+r.Header.Get("If-Range"))
+					w.Header().Set("Content-Range", "bytes 4-6/7")
+					w.WriteHeader(http.StatusPartialContent)
+					_, _ = w.Write([]byte("ive"))
+					return
+				}
+				w.Header().Set("Content-Length", "7")
+				_, _ = w.Write([]byte("arch"))
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+
+			b, err := io.ReadAll(rc)
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("archive")
+			g.Assert(ranges).Equal([]string{"bytes=4- \"v1\""})
+		})
+
+		g.It("does not resume a download if the archive has changed", func() {
+			setTransfers(config.Transfers{DownloadResumes: 1})
+			defer resetConfig()
+
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("ETag", "\"v"+strconv.Itoa(requests)+"\"")
+				if r.Header.Get("Range") != "" {
+					// The If-Range does not match, so the whole archive is sent.
+					_, _ = w.Write([]byte("changed"))
+					return
+				}
+				w.Header().Set("Content-Length", "7")
+				_, _ = w.Write([]byte("arch"))
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+			}))
+			defer srv.Close()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			defer rc.Close()
+
+			_, err = io.ReadAll(rc)
+			g.Assert(errors.Is(err, ErrArchiveChanged)).IsTrue()
+			g.Assert(IsRetryable(err)).IsFalse()
+		})
+
+		g.It("returns an error for an unexpected status code", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer srv.Close()
+
+			_, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err == nil).IsFalse()
+			g.Assert(IsRetryable(err)).IsFalse()
+		})
+	})
+
+	g.Describe("isDisconnect", func() {
+		g.It("only matches errors caused by the connection being lost", func() {
+			g.Assert(isDisconnect(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)})).IsTrue()
+			g.Assert(isDisconnect(&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded})).IsTrue()
+			g.Assert(isDisconnect(fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF))).IsTrue()
+
+			g.Assert(isDisconnect(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})).IsFalse()
+			g.Assert(isDisconnect(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("tls: bad record MAC")})).IsFalse()
+		})
+	})
+}
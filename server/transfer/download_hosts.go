@@ -0,0 +1,115 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrInternalHost is returned when a download URL sent by another node points
+// to an internal address of this node's network that has not been allowed.
+var ErrInternalHost = errors.New("transfer: refusing to download from an internal address")
+
+// hostCheckKey is the context key recording whether the host of every request
+// made with the context must be checked before it is sent.
+type hostCheckKey struct{}
+
+// allowInternalHosts returns a context whose downloads may be made from any
+// address. This is only used by the self-test, which serves its archive from
+// this node.
+func allowInternalHosts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hostCheckKey{}, false)
+}
+
+// checkHosts returns a context whose requests, including any redirects they
+// follow, are refused if they are made to an internal address. A context from
+// allowInternalHosts is returned unchanged.
+func checkHosts(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(hostCheckKey{}).(bool); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, hostCheckKey{}, true)
+}
+
+// checksHosts reports whether the hosts of requests made with ctx must be
+// checked.
+func checksHosts(ctx context.Context) bool {
+	v, _ := ctx.Value(hostCheckKey{}).(bool)
+	return v
+}
+
+// internalAddress reports whether ip is on a private, loopback or link-local
+// network, or is the unspecified address.
+func internalAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// checkHost returns ErrInternalHost if the host of u is, or resolves to, an
+// internal address that is not in the allowed hosts of the configuration. A
+// host listed by name is allowed without being resolved, as is any name when
+// requests are sent through a proxy.
+func checkHost(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	var prefixes []netip.Prefix
+	for _, h := range config.Get().System.Transfers.AllowedHosts {
+		if p, err := netip.ParsePrefix(h); err == nil {
+			prefixes = append(prefixes, p.Masked())
+		} else if ip, err := netip.ParseAddr(h); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+		} else if strings.EqualFold(h, host) {
+			return nil
+		}
+	}
+
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{ip}
+	} else if config.Get().System.Transfers.Proxy != "" {
+		// The name is resolved by the proxy, which may be the only way to
+		// reach it, so only addresses in the URL itself can be checked.
+		return nil
+	} else {
+		if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+			return fmt.Errorf("transfer: failed to resolve download host: %w", err)
+		}
+	}
+outer:
+	for _, ip := range addrs {
+		ip = ip.Unmap()
+		if !internalAddress(ip) {
+			continue
+		}
+		for _, p := range prefixes {
+			if p.Contains(ip) {
+				continue outer
+			}
+		}
+		return fmt.Errorf("%w: %s resolves to %s", ErrInternalHost, host, ip)
+	}
+	return nil
+}
+
+// hostCheckTransport refuses requests made with a context from checkHosts if
+// they are sent to an internal address. Every redirect is sent through the
+// transport, so a download cannot be redirected to an internal address either.
+type hostCheckTransport struct {
+	http.RoundTripper
+}
+
+func (t hostCheckTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if checksHosts(req.Context()) {
+		if err := checkHost(req.Context(), req.URL); err != nil {
+			return nil, err
+		}
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
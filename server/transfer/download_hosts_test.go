@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestCheckHost(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("download hosts", func() {
+		allow := func(hosts ...string) {
+			setTransfers(config.Transfers{AllowedHosts: hosts})
+		}
+		check := func(v string) error {
+			u, _ := url.Parse(v)
+			return checkHost(context.Background(), u)
+		}
+
+		g.It("refuses internal addresses", func() {
+			allow()
+			for _, v := range []string{
+				"http://127.0.0.1/archive",
+				"http://10.0.0.5/archive",
+				"http://192.168.1.1:9000/archive",
+				"http://169.254.169.254/latest/meta-data",
+				"http://[::1]/archive",
+				"http://[fe80::1]/archive",
+				"http://[::ffff:127.0.0.1]/archive",
+				"http://0.0.0.0/archive",
+				"http://localhost/archive",
+			} {
+				g.Assert(errors.Is(check(v), ErrInternalHost)).IsTrue(v)
+			}
+			g.Assert(check("https://203.0.113.10/archive")).IsNil()
+		})
+
+		g.It("allows internal hosts that are configured", func() {
+			allow("10.0.0.0/8", "192.168.1.1", "LOCALHOST")
+			g.Assert(check("http://10.20.30.40/archive")).IsNil()
+			g.Assert(check("http://192.168.1.1/archive")).IsNil()
+			g.Assert(check("http://localhost/archive")).IsNil()
+			g.Assert(errors.Is(check("http://192.168.1.2/archive"), ErrInternalHost)).IsTrue()
+		})
+
+		g.It("refuses downloads and redirects to internal addresses", func() {
+			allow()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("archive"))
+			}))
+			defer srv.Close()
+
+			_, err := DownloadArchive(context.Background(), srv.URL)
+			g.Assert(errors.Is(err, ErrInternalHost)).IsTrue()
+			_, err = DownloadChecksumFile(context.Background(), srv.URL, "archive.tar.gz")
+			g.Assert(errors.Is(err, ErrInternalHost)).IsTrue()
+
+			rc, err := DownloadArchive(allowInternalHosts(context.Background()), srv.URL)
+			g.Assert(err).IsNil()
+			_ = rc.Close()
+
+			allow("127.0.0.0/8")
+			rc, err = DownloadArchive(context.Background(), srv.URL)
+			g.Assert(err).IsNil()
+			_ = rc.Close()
+
+			redirect := httptest.NewServer(http.RedirectHandler("http://10.1.2.3/archive", http.StatusFound))
+			defer redirect.Close()
+			_, err = DownloadArchive(context.Background(), redirect.URL)
+			g.Assert(errors.Is(err, ErrInternalHost)).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,166 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+// ErrEnvironmentUnsupported is returned when the target node is unable to
+// create the environment of a server before its files are transferred.
+var ErrEnvironmentUnsupported = errors.New("transfer: destination does not support preparing environments")
+
+// EnvironmentURL returns the URL used to prepare the environment of a server
+// on the target node for the given transfer URL.
+func EnvironmentURL(url string) string {
+	return strings.TrimSuffix(url, "/") + "/environment"
+}
+
+type preparedServer struct {
+	server *server.Server
+	at     time.Time
+}
+
+// prepared holds the servers whose environment has been created on this node
+// ahead of the transfer of their files.
+var prepared = struct {
+	mu      sync.Mutex
+	servers map[string]preparedServer
+}{servers: make(map[string]preparedServer)}
+
+// AddPrepared records that the environment of the server has been created on
+// this node and is waiting for the files of the server to be transferred.
+func AddPrepared(s *server.Server) {
+	prepared.mu.Lock()
+	defer prepared.mu.Unlock()
+	prepared.servers[s.ID()] = preparedServer{server: s, at: time.Now()}
+}
+
+// IsPrepared returns true if the environment of the server has been created on
+// this node and its files have not been transferred yet.
+func IsPrepared(id string) bool {
+	prepared.mu.Lock()
+	defer prepared.mu.Unlock()
+	_, ok := prepared.servers[id]
+	return ok
+}
+
+// TakePrepared returns the server whose environment was created ahead of its
+// transfer and stops tracking it, or nil if the environment of the server has
+// not been prepared. Prepared environments are only tracked in memory, if
+// Wings is restarted the environment is created again by the transfer.
+func TakePrepared(id string) *server.Server {
+	prepared.mu.Lock()
+	defer prepared.mu.Unlock()
+	p, ok := prepared.servers[id]
+	if !ok {
+		return nil
+	}
+	delete(prepared.servers, id)
+	p.server.Log().WithField("subsystem", "transfer").WithField("prepared_for", time.Since(p.at).Round(time.Second)).Debug("using environment prepared ahead of transfer")
+	return p.server
+}
+
+// DiscardPrepared destroys the environment created for a server ahead of a
+// transfer that is not going ahead, removes the server from the manager and
+// tells the Panel it is no longer being transferred.
+func DiscardPrepared(ctx context.Context, m *server.Manager, s *server.Server) {
+	l := s.Log().WithField("subsystem", "transfer")
+	if err := s.Environment.Destroy(); err != nil {
+		l.WithError(err).Warn("failed to destroy environment prepared for transfer")
+	}
+	m.Remove(func(match *server.Server) bool {
+		return match.ID() == s.ID()
+	})
+	if err := m.Client().SetTransferStatus(ctx, s.ID(), false); err != nil {
+		l.WithField("status", false).WithError(err).Error("failed to set transfer status")
+	}
+}
+
+// expiredPrepared stops tracking and returns the servers whose environment
+// was prepared longer ago than the configured retention.
+func expiredPrepared() []*server.Server {
+	retention := config.Get().System.Transfers.PreparedRetention
+	if retention < 1 {
+		return nil
+	}
+	prepared.mu.Lock()
+	defer prepared.mu.Unlock()
+	var out []*server.Server
+	for id, p := range prepared.servers {
+		if time.Since(p.at) > time.Duration(retention)*time.Second {
+			delete(prepared.servers, id)
+			out = append(out, p.server)
+		}
+	}
+	return out
+}
+
+// SweepPrepared discards every environment that was prepared, and the backups
+// that were received, ahead of a transfer whose files were never sent,
+// checking once a minute until the context is canceled.
+func SweepPrepared(ctx context.Context, m *server.Manager) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, s := range expiredPrepared() {
+			log.WithField("subsystem", "transfer").WithField("server", s.ID()).Warn("discarding environment prepared for a transfer that was never received")
+			DiscardPrepared(ctx, m, s)
+		}
+		for _, s := range expiredBackups() {
+			log.WithField("subsystem", "transfer").WithField("server", s).Warn("discarding backups received for a transfer that was never started")
+			DiscardReceivedBackups(s)
+		}
+	}
+}
+
+// PrepareEnvironment asks the target node to fetch the configuration of the
+// server and create its environment, without sending any of its files. This
+// allows the environment to be created well before the server is stopped for
+// its files to be transferred, taking it off the critical path of the
+// migration.
+func (t *Transfer) PrepareEnvironment(ctx context.Context, url, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, EnvironmentURL(url), nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(ctx, req, token)
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	v, _ := io.ReadAll(res.Body)
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		t.Log().Info("prepared server environment on destination")
+		return nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// A 404 comes from a node without the environment endpoint and a 501
+		// from one that cannot prepare it, the Panel is told either way so it
+		// can start the transfer without preparing the environment first.
+		return ErrEnvironmentUnsupported
+	default:
+		return fmt.Errorf("%w: %s", unexpectedStatus(res), string(v))
+	}
+}
@@ -0,0 +1,76 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestPrepareEnvironment(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("PrepareEnvironment", func() {
+		g.BeforeEach(func() {
+			resetConfig()
+		})
+
+		prepare := func(status int) (string, error) {
+			var path string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			trnsfr := New(context.Background(), &server.Server{})
+			return path, trnsfr.PrepareEnvironment(context.Background(), srv.URL+"/api/transfers", "token")
+		}
+
+		g.It("sends the request to the environment endpoint of the target node", func() {
+			path, err := prepare(http.StatusNoContent)
+			g.Assert(err).IsNil()
+			g.Assert(path).Equal("/api/transfers/environment")
+		})
+
+		g.It("reports a target node without the environment endpoint", func() {
+			_, err := prepare(http.StatusNotFound)
+			g.Assert(errors.Is(err, ErrEnvironmentUnsupported)).IsTrue()
+		})
+
+		g.It("returns a prepared server only once", func() {
+			s := &server.Server{}
+			AddPrepared(s)
+			g.Assert(IsPrepared(s.ID())).IsTrue()
+			g.Assert(TakePrepared(s.ID()) == s).IsTrue()
+			g.Assert(IsPrepared(s.ID())).IsFalse()
+			g.Assert(TakePrepared(s.ID()) == nil).IsTrue()
+		})
+
+		g.It("expires servers prepared longer ago than the retention", func() {
+			s := &server.Server{}
+			AddPrepared(s)
+			defer TakePrepared(s.ID())
+			g.Assert(len(expiredPrepared())).Equal(0)
+
+			setTransfers(config.Transfers{PreparedRetention: 60})
+			g.Assert(len(expiredPrepared())).Equal(0)
+			g.Assert(IsPrepared(s.ID())).IsTrue()
+
+			prepared.mu.Lock()
+			prepared.servers[s.ID()] = preparedServer{server: s, at: time.Now().Add(-2 * time.Minute)}
+			prepared.mu.Unlock()
+			expired := expiredPrepared()
+			g.Assert(len(expired)).Equal(1)
+			g.Assert(expired[0] == s).IsTrue()
+			g.Assert(IsPrepared(s.ID())).IsFalse()
+		})
+	})
+}
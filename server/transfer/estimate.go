@@ -0,0 +1,119 @@
+package transfer
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// tarBlockSize is the size of a tar header, file contents are padded to a
+// multiple of it.
+const tarBlockSize = 512
+
+// incompressible contains the extensions of files whose contents are already
+// compressed, and are not made any smaller by compressing the archive.
+var incompressible = map[string]struct{}{
+	".7z": {}, ".br": {}, ".bz2": {}, ".gz": {}, ".jar": {}, ".jpeg": {}, ".jpg": {},
+	".lz4": {}, ".mca": {}, ".mp3": {}, ".mp4": {}, ".ogg": {}, ".png": {}, ".rar": {},
+	".tgz": {}, ".webm": {}, ".webp": {}, ".xz": {}, ".zip": {}, ".zst": {},
+}
+
+// compressionRatio is the fraction of its original size compressible data is
+// expected to be reduced to by the given compression format.
+func compressionRatio(format filesystem.CompressionFormat) float64 {
+	if format == filesystem.CompressionNone {
+		return 1
+	}
+	if v := config.Get().System.Transfers.CompressionEstimate; v > 0 {
+		return float64(v) / 100
+	}
+	if format == filesystem.CompressionZstd {
+		return 0.3
+	}
+	return 0.35
+}
+
+// ArchiveEstimate is the estimated size of the archive of a server.
+type ArchiveEstimate struct {
+	Format filesystem.CompressionFormat `json:"format"`
+	Files  uint64                       `json:"files"`
+	// Size is the total size of the files of the server.
+	Size int64 `json:"size"`
+	// IncompressibleSize is the size of the files whose contents are
+	// already compressed.
+	IncompressibleSize int64 `json:"incompressible_size"`
+	// TarSize is the size of the uncompressed archive.
+	TarSize int64 `json:"tar_size"`
+	// EstimatedSize is the expected size of the compressed archive.
+	EstimatedSize int64 `json:"estimated_size"`
+}
+
+// EstimateArchive estimates the size of the archive that would be created to
+// transfer the server. Only the sizes of the files are used, their contents
+// are never read, so the estimate of the compressed size is approximate. The
+// files are not sampled either when the compression format is "auto", the
+// estimate assumes gzip instead.
+func EstimateArchive(ctx context.Context, s *server.Server) (ArchiveEstimate, error) {
+	format := filesystem.ParseCompressionFormat(config.Get().System.Transfers.CompressionFormat)
+	return estimateArchive(ctx, s.Filesystem().Path(), format)
+}
+
+func estimateArchive(ctx context.Context, root string, format filesystem.CompressionFormat) (ArchiveEstimate, error) {
+	e := ArchiveEstimate{Format: format}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p == root {
+			return nil
+		}
+		e.Files++
+		// Every entry has a header, names that do not fit are written as an
+		// extra header.
+		e.TarSize += tarBlockSize
+		if len(p)-len(root) > 100 {
+			e.TarSize += tarBlockSize + padTar(int64(len(p)-len(root)))
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e.Size += info.Size()
+		e.TarSize += padTar(info.Size())
+		if _, ok := incompressible[strings.ToLower(filepath.Ext(d.Name()))]; ok {
+			e.IncompressibleSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return ArchiveEstimate{}, err
+	}
+	// The archive ends with two empty blocks.
+	e.TarSize += 2 * tarBlockSize
+
+	compressible := e.TarSize - e.IncompressibleSize
+	e.EstimatedSize = e.IncompressibleSize + int64(float64(compressible)*compressionRatio(e.Format))
+	return e, nil
+}
+
+// padTar returns n rounded up to a multiple of the tar block size.
+func padTar(n int64) int64 {
+	return (n + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+}
+
+// EstimatedSize returns the approximate size of the compressed archive, based
+// on the size of the files being archived, or zero if it is not known.
+func (a *Archive) EstimatedSize() int64 {
+	return int64(float64(a.Progress().Total()) * compressionRatio(a.Format()))
+}
@@ -0,0 +1,61 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+func TestEstimateArchive(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("estimateArchive", func() {
+		g.BeforeEach(func() {
+			resetConfig()
+		})
+
+		g.It("estimates the size of the archive from the file sizes", func() {
+			dir := t.TempDir()
+			_ = os.Mkdir(filepath.Join(dir, "plugins"), 0o700)
+			_ = os.WriteFile(filepath.Join(dir, "server.properties"), []byte(strings.Repeat("a", 1000)), 0o600)
+			_ = os.WriteFile(filepath.Join(dir, "plugins", "plugin.jar"), []byte(strings.Repeat("b", 2000)), 0o600)
+
+			e, err := estimateArchive(context.Background(), dir, filesystem.CompressionNone)
+			g.Assert(err).IsNil()
+			g.Assert(e.Files).Equal(uint64(3))
+			g.Assert(e.Size).Equal(int64(3000))
+			g.Assert(e.IncompressibleSize).Equal(int64(2000))
+			// Three headers, the padded contents and the end of the archive.
+			g.Assert(e.TarSize).Equal(int64(3*512 + 1024 + 2048 + 2*512))
+			g.Assert(e.EstimatedSize).Equal(e.TarSize)
+
+			gz, err := estimateArchive(context.Background(), dir, filesystem.CompressionGzip)
+			g.Assert(err).IsNil()
+			g.Assert(gz.EstimatedSize < e.EstimatedSize).IsTrue()
+			g.Assert(gz.EstimatedSize > e.IncompressibleSize).IsTrue()
+		})
+
+		g.It("uses the configured compression estimate", func() {
+			dir := t.TempDir()
+			_ = os.WriteFile(filepath.Join(dir, "server.properties"), []byte(strings.Repeat("a", 1536)), 0o600)
+
+			setTransfers(config.Transfers{CompressionEstimate: 50})
+			e, err := estimateArchive(context.Background(), dir, filesystem.CompressionZstd)
+			g.Assert(err).IsNil()
+			// One header, the contents and the end of the archive.
+			g.Assert(e.TarSize).Equal(int64(512 + 1536 + 2*512))
+			g.Assert(e.EstimatedSize).Equal(int64(1536))
+
+			e, err = estimateArchive(context.Background(), dir, filesystem.CompressionNone)
+			g.Assert(err).IsNil()
+			g.Assert(e.EstimatedSize).Equal(e.TarSize)
+		})
+	})
+}
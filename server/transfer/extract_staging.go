@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// extractionStagingDirectory returns the directory signed archives are
+// extracted to before their signature has been verified. It is kept in the
+// data directory next to the servers for the same reason as the quarantine
+// directory, see quarantineDirectory.
+func extractionStagingDirectory() string {
+	return filepath.Join(config.Get().System.Data, ".transfer-staging")
+}
+
+// ExtractionStaging is a directory a signed archive is extracted to, so that
+// nothing from the archive reaches the files of the server until the signature
+// of its checksum has been verified.
+type ExtractionStaging struct {
+	// dir is the data directory of the server.
+	dir  string
+	path string
+	fs   *filesystem.Filesystem
+	// deleted are the files removed on the source node, which are only removed
+	// from the server once the archive has been verified.
+	deleted []string
+}
+
+// NewExtractionStaging creates the staging directory for an incoming transfer
+// of the server. The staged files are extracted with the denylist and disk
+// limit of the server, so nothing is moved to the server that it could not
+// have been extracted to it directly.
+func NewExtractionStaging(s *server.Server, id string) (*ExtractionStaging, error) {
+	p := filepath.Join(extractionStagingDirectory(), s.ID()+"-"+id)
+	if err := os.RemoveAll(p); err != nil {
+		return nil, fmt.Errorf("transfer: failed to remove previous staging directory: %w", err)
+	}
+	fs, err := filesystem.New(p, s.DiskSpace(), s.Config().Egg.FileDenylist)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to create staging directory: %w", err)
+	}
+	return &ExtractionStaging{dir: s.Filesystem().Path(), path: p, fs: fs}, nil
+}
+
+// Filesystem returns the filesystem the archive is extracted to.
+func (s *ExtractionStaging) Filesystem() *filesystem.Filesystem {
+	return s.fs
+}
+
+// Delete records a file that was removed on the source node, it is removed
+// from the server when the staged files are applied.
+func (s *ExtractionStaging) Delete(f string) {
+	s.deleted = append(s.deleted, f)
+}
+
+// Apply removes the files deleted on the source node from the server and moves
+// the extracted files into its data directory, replacing any that already
+// exist. The staging directory is removed once everything has been moved.
+func (s *ExtractionStaging) Apply(fs *filesystem.Filesystem) error {
+	for _, f := range s.deleted {
+		if err := fs.Delete(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	_ = s.fs.UnixFS().Close()
+	if err := mergeDirectory(s.path, s.dir); err != nil {
+		return fmt.Errorf("transfer: failed to move staged files to server: %w", err)
+	}
+	return os.RemoveAll(s.path)
+}
+
+// Discard removes the staging directory along with everything extracted to it.
+func (s *ExtractionStaging) Discard() error {
+	_ = s.fs.UnixFS().Close()
+	return os.RemoveAll(s.path)
+}
+
+// mergeDirectory moves every entry of src into dst. Directories that exist in
+// both are merged, anything else in dst is replaced. Symlinks in dst are never
+// followed, a symlink where the archive has a directory is replaced with it.
+func mergeDirectory(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		from := filepath.Join(src, e.Name())
+		to := filepath.Join(dst, e.Name())
+		st, err := os.Lstat(to)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if e.IsDir() && st.IsDir() {
+				if info, err := e.Info(); err == nil {
+					_ = os.Chmod(to, info.Mode().Perm())
+				}
+				if err := mergeDirectory(from, to); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.RemoveAll(to); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveExtractionStaging removes the files of signed archives that were still
+// being verified when Wings was last stopped.
+func RemoveExtractionStaging() error {
+	return os.RemoveAll(extractionStagingDirectory())
+}
@@ -0,0 +1,44 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestMergeDirectory(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("mergeDirectory", func() {
+		g.It("moves staged files over the files of the server", func() {
+			src, dst := t.TempDir(), t.TempDir()
+			write := func(p, v string) {
+				g.Assert(os.MkdirAll(filepath.Dir(p), 0o755)).IsNil()
+				g.Assert(os.WriteFile(p, []byte(v), 0o644)).IsNil()
+			}
+			write(filepath.Join(src, "world", "level.dat"), "new")
+			write(filepath.Join(src, "plugins", "a.jar"), "a")
+			write(filepath.Join(dst, "world", "level.dat"), "old")
+			write(filepath.Join(dst, "world", "kept.dat"), "kept")
+			outside := t.TempDir()
+			g.Assert(os.Symlink(outside, filepath.Join(dst, "plugins"))).IsNil()
+
+			g.Assert(mergeDirectory(src, dst)).IsNil()
+
+			b, err := os.ReadFile(filepath.Join(dst, "world", "level.dat"))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("new")
+			_, err = os.Stat(filepath.Join(dst, "world", "kept.dat"))
+			g.Assert(err).IsNil()
+
+			// The symlink is replaced rather than followed.
+			st, err := os.Lstat(filepath.Join(dst, "plugins"))
+			g.Assert(err).IsNil()
+			g.Assert(st.IsDir()).IsTrue()
+			entries, _ := os.ReadDir(outside)
+			g.Assert(len(entries)).Equal(0)
+		})
+	})
+}
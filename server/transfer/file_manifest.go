@@ -0,0 +1,174 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// FileManifestField is the name of the form field used by the source node to
+// send the manifest of every file it is transferring, which the target node
+// verifies the extracted files against.
+const FileManifestField = "file_manifest"
+
+// maxFileManifestSize is the largest file manifest accepted from a source node.
+const maxFileManifestSize = 512 * 1024 * 1024
+
+// maxReportedDiscrepancies is the number of paths of each kind of discrepancy
+// included in the error message, every path is written to the log.
+const maxReportedDiscrepancies = 10
+
+// ManifestError is returned when the files extracted from an archive do not
+// match the manifest sent by the source node.
+type ManifestError struct {
+	// Missing are the files in the manifest that were not extracted.
+	Missing []string
+	// Extra are the files that were extracted but are not in the manifest.
+	Extra []string
+	// Mismatched are the files with a size or hash that differs from the
+	// manifest.
+	Mismatched []string
+}
+
+func (e *ManifestError) Error() string {
+	var parts []string
+	for _, v := range []struct {
+		kind  string
+		paths []string
+	}{{"missing", e.Missing}, {"unexpected", e.Extra}, {"mismatched", e.Mismatched}} {
+		if len(v.paths) == 0 {
+			continue
+		}
+		s := fmt.Sprintf("%d %s (%s", len(v.paths), v.kind, strings.Join(v.paths[:min(len(v.paths), maxReportedDiscrepancies)], ", "))
+		if len(v.paths) > maxReportedDiscrepancies {
+			s += ", ..."
+		}
+		parts = append(parts, s+")")
+	}
+	return "transfer: extracted files do not match the manifest of the source node: " + strings.Join(parts, "; ")
+}
+
+// FileManifestEnabled returns true if this node sends a manifest of the files
+// it transfers so the target node can verify them once they are extracted.
+func FileManifestEnabled() bool {
+	return config.Get().System.Transfers.VerifyManifest
+}
+
+// buildFileManifest returns the manifest of every regular file in dir that is
+// included in the transfer. The marker written by the target node while
+// extracting files is never included.
+func buildFileManifest(ctx context.Context, dir string, include func(relative string) bool) (Manifest, error) {
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	out := manifest[:0]
+	for _, e := range manifest {
+		if e.Path == filesystem.IncompleteMarker || (include != nil && !include(e.Path)) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// FileManifest returns the manifest of the files of the server included in
+// the transfer, building it the first time it is requested. Nil is returned
+// if manifests are not enabled.
+func (t *Transfer) FileManifest(ctx context.Context) (Manifest, error) {
+	if !FileManifestEnabled() {
+		return nil, nil
+	}
+	if t.fileManifest != nil {
+		return t.fileManifest, nil
+	}
+	t.SendMessage("Building manifest of server files...")
+	var include func(string) bool
+	if t.filter != nil {
+		include = t.filter.allows
+	}
+	done := t.timings.Start(PhaseManifest)
+	m, err := buildFileManifest(ctx, t.sourceFilesystem().Path(), include)
+	done()
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to build file manifest: %w", err)
+	}
+	t.fileManifest = m
+	return m, nil
+}
+
+// writeFileManifest sends the manifest of the files of the server, if
+// manifests are enabled.
+func (t *Transfer) writeFileManifest(ctx context.Context, mp *multipart.Writer) error {
+	m, err := t.FileManifest(ctx)
+	if err != nil || m == nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return mp.WriteField(FileManifestField, string(b))
+}
+
+// ReadFileManifest reads a file manifest sent by the source node.
+func ReadFileManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(io.LimitReader(r, maxFileManifestSize)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("transfer: invalid file manifest: %w", err)
+	}
+	return m, nil
+}
+
+// VerifyFileManifest compares the files in dir against the manifest sent by
+// the source node, returning a *ManifestError listing every file that is
+// missing, unexpected or has different contents.
+func VerifyFileManifest(ctx context.Context, dir string, expected Manifest) error {
+	actual, err := buildFileManifest(ctx, dir, nil)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to build manifest of extracted files: %w", err)
+	}
+	want := make(map[string]ManifestEntry, len(expected))
+	for _, e := range expected {
+		want[filepath.ToSlash(e.Path)] = e
+	}
+
+	var res ManifestError
+	for _, e := range actual {
+		w, ok := want[e.Path]
+		if !ok {
+			res.Extra = append(res.Extra, e.Path)
+			continue
+		}
+		delete(want, e.Path)
+		if w.Size != e.Size || w.Hash != e.Hash {
+			res.Mismatched = append(res.Mismatched, e.Path)
+		}
+	}
+	for p := range want {
+		// A file that exists but is not regular is reported as mismatched
+		// rather than missing.
+		if st, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(p))); err == nil && !st.Mode().IsRegular() {
+			res.Mismatched = append(res.Mismatched, p)
+			continue
+		}
+		res.Missing = append(res.Missing, p)
+	}
+	if len(res.Missing) == 0 && len(res.Extra) == 0 && len(res.Mismatched) == 0 {
+		return nil
+	}
+	sort.Strings(res.Missing)
+	sort.Strings(res.Extra)
+	sort.Strings(res.Mismatched)
+	return &res
+}
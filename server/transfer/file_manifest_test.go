@@ -0,0 +1,72 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+func TestVerifyFileManifest(t *testing.T) {
+	g := Goblin(t)
+
+	write := func(dir, name, contents string) {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			panic(err)
+		}
+	}
+
+	g.Describe("VerifyFileManifest", func() {
+		var source, target string
+		var manifest Manifest
+
+		g.BeforeEach(func() {
+			source, target = t.TempDir(), t.TempDir()
+			for _, dir := range []string{source, target} {
+				write(dir, "server.properties", "motd=hello")
+				write(dir, "world/level.dat", "level")
+			}
+			var err error
+			manifest, err = buildFileManifest(context.Background(), source, nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		g.It("accepts files matching the manifest", func() {
+			write(target, filesystem.IncompleteMarker, "transfer")
+			g.Assert(VerifyFileManifest(context.Background(), target, manifest)).IsNil()
+		})
+
+		g.It("lists every discrepancy", func() {
+			g.Assert(os.Remove(filepath.Join(target, "world/level.dat"))).IsNil()
+			write(target, "server.properties", "motd=changed")
+			write(target, "extra.txt", "extra")
+
+			err := VerifyFileManifest(context.Background(), target, manifest)
+			var merr *ManifestError
+			g.Assert(errors.As(err, &merr)).IsTrue()
+			g.Assert(merr.Missing).Equal([]string{"world/level.dat"})
+			g.Assert(merr.Extra).Equal([]string{"extra.txt"})
+			g.Assert(merr.Mismatched).Equal([]string{"server.properties"})
+		})
+
+		g.It("leaves files excluded from the transfer out of the manifest", func() {
+			m, err := buildFileManifest(context.Background(), source, func(relative string) bool {
+				return relative != "world/level.dat"
+			})
+			g.Assert(err).IsNil()
+			g.Assert(len(m)).Equal(1)
+			g.Assert(m[0].Path).Equal("server.properties")
+		})
+	})
+}
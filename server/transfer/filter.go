@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pterodactyl/wings/system"
+)
+
+// PathFilter limits the files of a server that are transferred using glob
+// patterns, allowing large data that can be regenerated, such as caches and
+// logs, to be left behind. Patterns use the syntax of path.Match and are
+// matched against paths relative to the root of the server. A pattern that
+// matches a directory also matches everything within it.
+type PathFilter struct {
+	root    string
+	include []string
+	exclude []string
+
+	excludedFiles atomic.Uint64
+	excludedBytes atomic.Int64
+}
+
+// NewPathFilter returns a filter for the files within root. If include is not
+// empty only the files matching one of its patterns are transferred, files
+// matching a pattern in exclude are never transferred. Nil is returned if no
+// patterns are given.
+func NewPathFilter(root string, include, exclude []string) (*PathFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &PathFilter{root: root}
+	var err error
+	if f.include, err = cleanPatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = cleanPatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// cleanPatterns validates every pattern, removing any leading slash as all
+// patterns are relative to the root of the server.
+func cleanPatterns(patterns []string) ([]string, error) {
+	out := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		v := strings.TrimPrefix(strings.TrimSpace(p), "/")
+		if v == "" {
+			return nil, fmt.Errorf("transfer: empty path pattern")
+		}
+		for _, e := range strings.Split(v, "/") {
+			if e == ".." {
+				return nil, fmt.Errorf("transfer: path pattern \"%s\" must not contain \"..\"", p)
+			}
+		}
+		if _, err := path.Match(v, ""); err != nil {
+			return nil, fmt.Errorf("transfer: invalid path pattern \"%s\": %w", p, err)
+		}
+		out = append(out, strings.TrimSuffix(path.Clean(v), "/"))
+	}
+	return out, nil
+}
+
+// matches returns true if the path, or any of its parent directories, matches
+// one of the patterns.
+func matches(patterns []string, relative string) bool {
+	for p := relative; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Include returns true if the file should be transferred. Files that are left
+// out are counted so the amount of data excluded can be reported.
+func (f *PathFilter) Include(relative string) bool {
+	relative = strings.TrimPrefix(filepath.ToSlash(relative), "/")
+	if f.allows(relative) {
+		return true
+	}
+	f.excludedFiles.Add(1)
+	if st, err := os.Lstat(filepath.Join(f.root, relative)); err == nil && st.Mode().IsRegular() {
+		f.excludedBytes.Add(st.Size())
+	}
+	return false
+}
+
+// allows returns true if the file matches the filter, without counting it as
+// excluded if it does not.
+func (f *PathFilter) allows(relative string) bool {
+	relative = strings.TrimPrefix(filepath.ToSlash(relative), "/")
+	return (len(f.include) == 0 || matches(f.include, relative)) && !matches(f.exclude, relative)
+}
+
+// Excluded returns the number of files, and their total size, that have been
+// left out of the transfer.
+func (f *PathFilter) Excluded() (uint64, int64) {
+	return f.excludedFiles.Load(), f.excludedBytes.Load()
+}
+
+// SetPathFilter limits the files that are included in the archive of the
+// server. It must be set before the archive is created.
+func (t *Transfer) SetPathFilter(f *PathFilter) {
+	t.filter = f
+}
+
+// LogExcluded reports the files that were left out of the transfer by the
+// path filter, if one was set.
+func (t *Transfer) LogExcluded() {
+	if t.filter == nil {
+		return
+	}
+	files, size := t.filter.Excluded()
+	t.Log().WithField("excluded_files", files).WithField("excluded_bytes", size).Info("files excluded from transfer by path filter")
+	t.SendMessage(fmt.Sprintf("Excluded %d files (%s) from the transfer.", files, system.FormatBytes(size)))
+}
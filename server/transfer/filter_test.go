@@ -0,0 +1,55 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestPathFilter(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("PathFilter", func() {
+		g.It("returns nil without any patterns", func() {
+			f, err := NewPathFilter("/", nil, nil)
+			g.Assert(err).IsNil()
+			g.Assert(f == nil).IsTrue()
+		})
+
+		g.It("rejects invalid patterns", func() {
+			_, err := NewPathFilter("/", nil, []string{"logs/["})
+			g.Assert(err == nil).IsFalse()
+			_, err = NewPathFilter("/", []string{"../other"}, nil)
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("excludes matching files and everything within matching directories", func() {
+			dir := t.TempDir()
+			_ = os.MkdirAll(filepath.Join(dir, "logs"), 0o700)
+			_ = os.WriteFile(filepath.Join(dir, "logs", "latest.log"), make([]byte, 100), 0o600)
+
+			f, err := NewPathFilter(dir, nil, []string{"/logs", "*.tmp", "world/backups/*"})
+			g.Assert(err).IsNil()
+			g.Assert(f.Include("server.properties")).IsTrue()
+			g.Assert(f.Include("logs/latest.log")).IsFalse()
+			g.Assert(f.Include("cache.tmp")).IsFalse()
+			g.Assert(f.Include("world/backups/1/level.dat")).IsFalse()
+			g.Assert(f.Include("world/level.dat")).IsTrue()
+
+			files, size := f.Excluded()
+			g.Assert(files).Equal(uint64(3))
+			g.Assert(size).Equal(int64(100))
+		})
+
+		g.It("only includes matching files when include patterns are given", func() {
+			f, err := NewPathFilter("/", []string{"world", "*.properties"}, []string{"world/cache"})
+			g.Assert(err).IsNil()
+			g.Assert(f.Include("world/level.dat")).IsTrue()
+			g.Assert(f.Include("server.properties")).IsTrue()
+			g.Assert(f.Include("plugins/plugin.jar")).IsFalse()
+			g.Assert(f.Include("world/cache/chunk")).IsFalse()
+		})
+	})
+}
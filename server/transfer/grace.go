@@ -0,0 +1,76 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// downloadGraceDelay is the delay before the first retry of a download that
+// was not ready, it is doubled after every attempt up to
+// downloadGraceMaxDelay.
+var (
+	downloadGraceDelay    = time.Second
+	downloadGraceMaxDelay = 15 * time.Second
+)
+
+// notReady reports whether the response to the initial request for a download
+// indicates the object is not available yet rather than the request having
+// failed. Object storage may briefly return a 404 for an object that was only
+// just uploaded, and a 503 while it is busy.
+func notReady(res *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	}
+	return res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusServiceUnavailable
+}
+
+// getWithGrace makes the initial GET request for a download, retrying it with
+// a backoff while the object is not ready. This only covers the start of a
+// download, a connection lost once the body is being read is not retried
+// here.
+func getWithGrace(ctx context.Context, url string) (*http.Response, error) {
+	if err := ValidateURL(url); err != nil {
+		return nil, err
+	}
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	retries := config.Get().System.Transfers.DownloadRetries
+	delay := downloadGraceDelay
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(req)
+		if attempt >= retries || !notReady(res, err) {
+			return res, err
+		}
+
+		l := log.WithField("subsystem", "transfer").WithField("attempt", attempt+1).WithField("delay", delay)
+		if err != nil {
+			l = l.WithError(err)
+		} else {
+			l = l.WithField("status", res.StatusCode)
+			_ = res.Body.Close()
+		}
+		l.Warn("download is not available yet, retrying")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > downloadGraceMaxDelay {
+			delay = downloadGraceMaxDelay
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package transfer
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// HealthCheck is the result of a single check performed by CheckHealth.
+type HealthCheck struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// Health is the overall health of the transfer subsystem on this node.
+type Health struct {
+	Healthy bool                   `json:"healthy"`
+	Checks  map[string]HealthCheck `json:"checks"`
+}
+
+// CheckHealth checks that this node is able to accept a new transfer without
+// starting one. The checks only read the state of the node, so they are cheap
+// enough to be run by a load balancer or monitoring system on every probe.
+func CheckHealth() Health {
+	h := Health{
+		Healthy: true,
+		Checks: map[string]HealthCheck{
+			"archive_directory": checkArchiveDirectory(),
+			"disk_space":        checkDiskSpace(),
+		},
+	}
+	for _, c := range h.Checks {
+		if !c.Healthy {
+			h.Healthy = false
+		}
+	}
+	return h
+}
+
+// checkArchiveDirectory checks that the archive directory exists and can be
+// written to, without creating anything in it.
+func checkArchiveDirectory() HealthCheck {
+	dir := config.Get().System.ArchiveDirectory
+	if err := unix.Access(dir, unix.W_OK|unix.X_OK); err != nil {
+		return HealthCheck{Message: fmt.Sprintf("archive directory %s is not writable: %s", dir, err)}
+	}
+	return HealthCheck{Healthy: true}
+}
+
+// checkDiskSpace checks that both the directory archives are staged in and
+// the directory server data is extracted into have enough free space.
+func checkDiskSpace() HealthCheck {
+	cfg := config.Get()
+	min := uint64(cfg.System.Transfers.HealthMinimumFreeSpace) * 1024 * 1024
+	for _, dir := range []string{cfg.System.ArchiveDirectory, cfg.System.Data} {
+		var st unix.Statfs_t
+		if err := unix.Statfs(dir, &st); err != nil {
+			return HealthCheck{Message: fmt.Sprintf("failed to check free space of %s: %s", dir, err)}
+		}
+		if free := st.Bavail * uint64(st.Bsize); free < min {
+			return HealthCheck{Message: fmt.Sprintf("%s has %d MiB free, at least %d MiB is required", dir, free/1024/1024, min/1024/1024)}
+		}
+	}
+	return HealthCheck{Healthy: true}
+}
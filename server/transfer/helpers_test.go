@@ -0,0 +1,24 @@
+package transfer
+
+import (
+	"github.com/pterodactyl/wings/config"
+)
+
+// setConfig replaces the configuration with one using the given system
+// configuration, along with the authentication token of the node that is used
+// to sign transfer tokens.
+func setConfig(system config.SystemConfiguration) {
+	config.Set(&config.Configuration{AuthenticationToken: "abc", System: system})
+}
+
+// setTransfers replaces the configuration with one that only sets the given
+// transfer configuration.
+func setTransfers(transfers config.Transfers) {
+	setConfig(config.SystemConfiguration{Transfers: transfers})
+}
+
+// resetConfig replaces the configuration with one that has nothing but the
+// authentication token set, undoing any configuration set by a test.
+func resetConfig() {
+	setConfig(config.SystemConfiguration{})
+}
@@ -0,0 +1,166 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// maxHookOutput is the amount of output from a transfer hook command that is
+// written to the log, only the end of anything longer is kept.
+const maxHookOutput = 64 * 1024
+
+// hookWaitDelay is how long to wait for the output of a transfer hook command
+// to be closed once it has exited or been killed. Without it, a process started
+// in the background by the command that keeps its output open would stop the
+// hook from ever returning.
+var hookWaitDelay = 5 * time.Second
+
+// ErrHookTimeout is returned when a transfer hook command does not finish
+// within its timeout and is killed.
+var ErrHookTimeout = errors.New("transfer: hook command timed out")
+
+// runHook runs a hook command for the received server. The command is given
+// the UUID of the server and the path to its files as arguments, and in the
+// environment along with the identifier of the transfer and the source node.
+// Its output is written to the transfer log.
+func (t *Transfer) runHook(name, command string, timeout time.Duration) error {
+	path := t.Server.Filesystem().Path()
+	return t.execHook(name, command, timeout, []string{t.Server.ID(), path}, []string{
+		"WINGS_SERVER_ID=" + t.Server.ID(),
+		"WINGS_SERVER_PATH=" + path,
+		"WINGS_TRANSFER_ID=" + t.id,
+		"WINGS_SOURCE_NODE=" + t.SourceNode(),
+		"WINGS_EGG_ID=" + t.Server.Config().Egg.ID,
+	})
+}
+
+// execHook runs a hook command with the given arguments and additional
+// environment variables, killing it if it has not finished within the timeout.
+// The last maxHookOutput bytes of its output are written to the transfer log.
+func (t *Transfer) execHook(name, command string, timeout time.Duration, args, env []string) error {
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = hookWaitDelay
+	out := &tailBuffer{max: maxHookOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	l := t.Log().WithField("command", command)
+	started := time.Now()
+	err := cmd.Run()
+	l = l.WithField("duration", time.Since(started))
+
+	if out.truncated {
+		l.Warn(name + " output was truncated, only the end of it is logged")
+	}
+	s := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	for s.Scan() {
+		l.WithField("output", s.Text()).Info(name + " output")
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrHookTimeout, timeout)
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The command itself succeeded, but left a process running that kept
+		// its output open.
+		l.Warn(name + " left a process running in the background")
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	l.Info(name + " completed")
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	b         []byte
+	max       int
+	truncated bool
+}
+
+func (w *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > w.max {
+		p = p[len(p)-w.max:]
+		w.truncated = true
+	}
+	if over := len(w.b) + len(p) - w.max; over > 0 {
+		w.b = append(w.b[:0], w.b[over:]...)
+		w.truncated = true
+	}
+	w.b = append(w.b, p...)
+	return n, nil
+}
+
+// Bytes returns what was kept of the output. Once it has been truncated, the
+// partial line at the start is left out.
+func (w *tailBuffer) Bytes() []byte {
+	if !w.truncated {
+		return w.b
+	}
+	if i := bytes.IndexByte(w.b, '\n'); i >= 0 {
+		return w.b[i+1:]
+	}
+	return w.b
+}
+
+// RunPostTransferCommand runs the configured post-transfer command once a
+// server has been received successfully. A command that fails or times out
+// only results in a warning, the transfer has already completed.
+func (t *Transfer) RunPostTransferCommand() {
+	cfg := config.Get().System.Transfers
+	if cfg.PostTransferCommand == "" {
+		return
+	}
+	err := t.runHook("post-transfer command", cfg.PostTransferCommand, time.Duration(cfg.PostTransferCommandTimeout)*time.Second)
+	if err != nil {
+		t.Log().WithField("command", cfg.PostTransferCommand).WithError(err).Warn("post-transfer command failed")
+		t.SendMessage("Warning: the post-transfer command failed: " + err.Error())
+	}
+}
+
+// finalizeCommand returns the finalize command for the egg of the server,
+// falling back to the command used for every server.
+func (t *Transfer) finalizeCommand() string {
+	cfg := config.Get().System.Transfers
+	if v, ok := cfg.FinalizeCommands[t.Server.Config().Egg.ID]; ok {
+		return v
+	}
+	return cfg.FinalizeCommand
+}
+
+// RunFinalizeCommand runs the finalize command for the server once its files
+// have been extracted, before the transfer is reported as successful. This
+// allows migration steps that are specific to a type of server, such as
+// rebuilding an index or updating paths that contain the name of the old
+// node, to run automatically. Unlike the post-transfer command, the transfer
+// fails if the command fails.
+func (t *Transfer) RunFinalizeCommand() error {
+	command := t.finalizeCommand()
+	if command == "" {
+		return nil
+	}
+	t.SendMessage("Running finalize command...")
+	err := t.runHook("finalize command", command, time.Duration(config.Get().System.Transfers.FinalizeCommandTimeout)*time.Second)
+	if err != nil {
+		return fmt.Errorf("transfer: finalize command failed: %w", err)
+	}
+	return nil
+}
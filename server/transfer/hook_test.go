@@ -0,0 +1,63 @@
+package transfer
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestHook(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("transfer hooks", func() {
+		trnsfr := &Transfer{id: "id"}
+		delay := hookWaitDelay
+		g.Before(func() {
+			hookWaitDelay = 50 * time.Millisecond
+		})
+		g.After(func() {
+			hookWaitDelay = delay
+		})
+
+		g.It("passes the arguments and environment to the command", func() {
+			err := trnsfr.execHook("hook", "/bin/sh", time.Second, []string{"-c", `test "$1" = server && test "$WINGS_SERVER_ID" = server`, "sh", "server"}, []string{"WINGS_SERVER_ID=server"})
+			g.Assert(err).IsNil()
+		})
+
+		g.It("returns the error of a command that fails", func() {
+			err := trnsfr.execHook("hook", "/bin/sh", time.Second, []string{"-c", "exit 3"}, nil)
+			var exit *exec.ExitError
+			g.Assert(errors.As(err, &exit)).IsTrue()
+			g.Assert(exit.ExitCode()).Equal(3)
+		})
+
+		g.It("kills a command that does not finish in time", func() {
+			err := trnsfr.execHook("hook", "/bin/sh", 50*time.Millisecond, []string{"-c", "exec sleep 10"}, nil)
+			g.Assert(errors.Is(err, ErrHookTimeout)).IsTrue()
+		})
+
+		g.It("does not wait for processes left running by the command", func() {
+			started := time.Now()
+			err := trnsfr.execHook("hook", "/bin/sh", 10*time.Second, []string{"-c", "sleep 2 &"}, nil)
+			g.Assert(err).IsNil()
+			g.Assert(time.Since(started) < time.Second).IsTrue()
+		})
+	})
+
+	g.Describe("tailBuffer", func() {
+		g.It("keeps the end of the output", func() {
+			w := &tailBuffer{max: 8}
+			_, _ = w.Write([]byte("first\n"))
+			g.Assert(string(w.Bytes())).Equal("first\n")
+			_, _ = w.Write([]byte("second\nthird\n"))
+			g.Assert(w.truncated).IsTrue()
+			g.Assert(string(w.Bytes())).Equal("third\n")
+			_, _ = w.Write([]byte(strings.Repeat("x", 20)))
+			g.Assert(string(w.Bytes())).Equal("xxxxxxxx")
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/environment"
+	"github.com/pterodactyl/wings/environment/docker"
+	"github.com/pterodactyl/wings/events"
+)
+
+// imageEnvironment is an environment created from an image that can be
+// checked and pulled before the environment is created, such as the Docker
+// environment.
+type imageEnvironment interface {
+	Image() string
+	CheckImage(ctx context.Context) error
+	PullImage(ctx context.Context) error
+	Events() *events.Bus
+}
+
+var _ imageEnvironment = (*docker.Environment)(nil)
+
+// CheckImage confirms the Docker image of the server being received is either
+// present on this node or can be pulled, so a transfer that would fail when
+// its environment is created is refused before any of its files are received.
+// Nothing is checked for servers that do not use a Docker environment, or if
+// the preflight has been disabled.
+func (t *Transfer) CheckImage(ctx context.Context) error {
+	e, ok := t.Server.Environment.(imageEnvironment)
+	if !ok || !config.Get().System.Transfers.ImagePreflight {
+		return nil
+	}
+	if err := e.CheckImage(ctx); err != nil {
+		return fmt.Errorf("transfer: image of server is not available: %w", err)
+	}
+	return nil
+}
+
+// PullImage starts pulling the Docker image of the server being received in
+// the background when pre-pulling is enabled, reporting its progress in the
+// transfer log. The returned function waits for the pull to finish and must be
+// called before the environment of the server is created, a pull that failed
+// is logged and then attempted again when the environment is created. The pull
+// is stopped if ctx is canceled, and the returned function stops waiting.
+func (t *Transfer) PullImage(ctx context.Context) func() {
+	e, ok := t.Server.Environment.(imageEnvironment)
+	if !ok || !config.Get().System.Transfers.PrePullImage {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stop := t.reportImagePull(e.Events())
+	image := e.Image()
+	t.Log().WithField("image", image).Info("pulling image of server while its files are received")
+	t.SendMessage("Pulling Docker image " + strings.TrimPrefix(image, "~") + " while the server is transferred...")
+	go func() {
+		defer close(done)
+		defer stop()
+
+		start := time.Now()
+		if err := e.PullImage(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			t.Log().WithField("image", image).WithError(err).Warn("failed to pull image of server, it will be pulled again when creating the environment")
+			t.SendMessage("Warning: failed to pull Docker image, it will be pulled again once the server has been transferred.")
+			return
+		}
+		t.Log().WithField("image", image).WithField("duration", time.Since(start).Round(time.Millisecond)).Info("pulled image of server")
+		t.SendMessage("Finished pulling Docker image.")
+	}()
+
+	return func() {
+		select {
+		case <-done:
+		default:
+			t.SendMessage("Waiting for Docker image to finish pulling...")
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// reportImagePull sends the latest status of an image pull published to the
+// event bus to the transfer log every few seconds, until the returned function
+// is called.
+func (t *Transfer) reportImagePull(bus *events.Bus) func() {
+	ch := make(chan []byte, 8)
+	bus.On(ch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tc := time.NewTicker(5 * time.Second)
+		defer tc.Stop()
+		var status string
+		for {
+			select {
+			case b, ok := <-ch:
+				if !ok {
+					return
+				}
+				var e events.Event
+				if err := events.DecodeTo(b, &e); err != nil || e.Topic != environment.DockerImagePullStatus {
+					continue
+				}
+				if v, ok := e.Data.(string); ok {
+					status = strings.TrimSpace(v)
+				}
+			case <-tc.C:
+				if status != "" {
+					t.sendProgressMessage("Pulling image: " + status)
+					status = ""
+				}
+			}
+		}
+	}()
+	return func() {
+		// Removing the channel from the bus closes it, stopping the reporter.
+		bus.Off(ch)
+		<-done
+	}
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/environment"
+	"github.com/pterodactyl/wings/events"
+	"github.com/pterodactyl/wings/server"
+)
+
+// imageEnv is an environment that records which of its image methods were
+// called. Any other method of the environment panics.
+type imageEnv struct {
+	environment.ProcessEnvironment
+	bus     *events.Bus
+	checked bool
+	pulled  chan struct{}
+	pull    func(ctx context.Context) error
+	check   error
+}
+
+func (e *imageEnv) Image() string       { return "ghcr.io/pterodactyl/yolks:java_17" }
+func (e *imageEnv) Events() *events.Bus { return e.bus }
+
+func (e *imageEnv) CheckImage(context.Context) error {
+	e.checked = true
+	return e.check
+}
+
+func (e *imageEnv) PullImage(ctx context.Context) error {
+	defer close(e.pulled)
+	if e.pull != nil {
+		return e.pull(ctx)
+	}
+	return nil
+}
+
+func TestImage(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("transfer images", func() {
+		var env *imageEnv
+		var trnsfr *Transfer
+
+		set := func(preflight, pull bool) {
+			setTransfers(config.Transfers{ImagePreflight: preflight, PrePullImage: pull})
+		}
+
+		g.BeforeEach(func() {
+			env = &imageEnv{bus: events.NewBus(), pulled: make(chan struct{})}
+			trnsfr = New(context.Background(), &server.Server{Environment: env})
+		})
+
+		g.It("only checks the image when the preflight is enabled", func() {
+			set(false, false)
+			env.check = errors.New("no such image")
+			g.Assert(trnsfr.CheckImage(context.Background())).IsNil()
+			g.Assert(env.checked).IsFalse()
+
+			set(true, false)
+			g.Assert(errors.Is(trnsfr.CheckImage(context.Background()), env.check)).IsTrue()
+			g.Assert(env.checked).IsTrue()
+		})
+
+		g.It("only pulls the image when pre-pulling is enabled", func() {
+			set(true, false)
+			trnsfr.PullImage(context.Background())()
+			select {
+			case <-env.pulled:
+				g.Fail("image was pulled")
+			default:
+			}
+
+			set(false, true)
+			trnsfr.PullImage(context.Background())()
+			<-env.pulled
+			g.Assert(env.checked).IsFalse()
+		})
+
+		g.It("stops pulling the image when the transfer is canceled", func() {
+			set(false, true)
+			env.pull = func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			wait := trnsfr.PullImage(ctx)
+			time.AfterFunc(10*time.Millisecond, cancel)
+			wait()
+			<-env.pulled
+		})
+	})
+}
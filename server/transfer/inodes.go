@@ -0,0 +1,77 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInsufficientInodes is returned when the filesystem the server will be
+// extracted to does not have enough free inodes for every file in the archive.
+var ErrInsufficientInodes = errors.New("transfer: insufficient inodes")
+
+// inodeHeadroom is the fraction of the free inodes that must remain available
+// once the archive has been extracted.
+const inodeHeadroom = 0.05
+
+// countFiles returns the number of files and directories in dir, which is the
+// number of inodes needed to extract an archive of it, along with the total
+// size of the regular files. Only the files allowed by include are counted if
+// it is set. Files that cannot be read are skipped, as they are when the
+// archive is created, and the number skipped is returned.
+func countFiles(ctx context.Context, dir string, include func(relative string) bool) (n uint64, size int64, skipped int, err error) {
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			skipped++
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if include != nil && p != dir {
+			if relative, err := filepath.Rel(dir, p); err != nil || !include(relative) {
+				return nil
+			}
+		}
+		n++
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				skipped++
+				return nil
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return n, size, skipped, err
+}
+
+// CheckInodes returns ErrInsufficientInodes if the filesystem containing dir
+// does not have enough free inodes to extract the given number of files.
+// Filesystems that allocate inodes dynamically, and report having none, are
+// never rejected.
+func CheckInodes(dir string, files uint64) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return err
+	}
+	if st.Files == 0 {
+		return nil
+	}
+	required := files + uint64(float64(st.Ffree)*inodeHeadroom)
+	if required > st.Ffree {
+		return fmt.Errorf("%w: the archive contains %d files but only %d inodes are free on this node", ErrInsufficientInodes, files, st.Ffree)
+	}
+	return nil
+}
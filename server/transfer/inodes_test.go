@@ -0,0 +1,57 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestCountFiles(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("countFiles", func() {
+		var dir string
+
+		g.BeforeEach(func() {
+			dir = t.TempDir()
+			g.Assert(os.MkdirAll(filepath.Join(dir, "world", "region"), 0o755)).IsNil()
+			g.Assert(os.WriteFile(filepath.Join(dir, "server.jar"), []byte("jar"), 0o644)).IsNil()
+			g.Assert(os.WriteFile(filepath.Join(dir, "world", "region", "r.0.0.mca"), []byte("region"), 0o644)).IsNil()
+		})
+
+		g.It("counts every file and directory", func() {
+			n, size, skipped, err := countFiles(context.Background(), dir, nil)
+			g.Assert(err).IsNil()
+			g.Assert(n).Equal(uint64(5))
+			g.Assert(size).Equal(int64(9))
+			g.Assert(skipped).Equal(0)
+		})
+
+		g.It("only counts the files allowed by the filter", func() {
+			n, size, _, err := countFiles(context.Background(), dir, func(relative string) bool {
+				return !strings.HasPrefix(relative, "world")
+			})
+			g.Assert(err).IsNil()
+			g.Assert(n).Equal(uint64(2))
+			g.Assert(size).Equal(int64(3))
+		})
+
+		g.It("skips directories that cannot be read", func() {
+			// Remove the directory as soon as it is walked, so reading its
+			// entries fails.
+			n, _, skipped, err := countFiles(context.Background(), dir, func(relative string) bool {
+				if relative == "world" {
+					g.Assert(os.RemoveAll(filepath.Join(dir, "world"))).IsNil()
+				}
+				return true
+			})
+			g.Assert(err).IsNil()
+			g.Assert(n).Equal(uint64(3))
+			g.Assert(skipped).Equal(1)
+		})
+	})
+}
@@ -0,0 +1,135 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// Integrity scan modes for Transfers.IntegrityScan.
+const (
+	IntegrityScanOff    = "off"
+	IntegrityScanSample = "sample"
+	IntegrityScanFull   = "full"
+)
+
+// maxIntegrityErrors is the number of unreadable files included in an
+// integrity scan error, the rest are only counted.
+const maxIntegrityErrors = 10
+
+// IntegrityResult is the result of reading back the files of an extracted
+// server.
+type IntegrityResult struct {
+	Files   uint64
+	Scanned uint64
+	Bytes   int64
+	// Unreadable contains the paths, relative to the root of the server, of
+	// the files that could not be read back.
+	Unreadable []string
+}
+
+// Err returns an error describing the files that could not be read, or nil if
+// every scanned file was read successfully.
+func (r IntegrityResult) Err() error {
+	if len(r.Unreadable) == 0 {
+		return nil
+	}
+	files := r.Unreadable
+	if len(files) > maxIntegrityErrors {
+		files = files[:maxIntegrityErrors]
+	}
+	msg := fmt.Sprintf("transfer: %d extracted file(s) could not be read back: %s", len(r.Unreadable), strings.Join(files, ", "))
+	if len(r.Unreadable) > len(files) {
+		msg += fmt.Sprintf(" and %d more", len(r.Unreadable)-len(files))
+	}
+	return errors.New(msg)
+}
+
+// IntegrityScanEnabled returns true if extracted servers should be read back
+// before a transfer is reported as successful.
+func IntegrityScanEnabled() bool {
+	m := config.Get().System.Transfers.IntegrityScan
+	return m == IntegrityScanSample || m == IntegrityScanFull
+}
+
+// ScanIntegrity reads every regular file below root, or a random sample of
+// them when the integrity scan is set to "sample", to find files that were
+// written to the disk but cannot be read back from it. The archive checksum
+// only covers the data that was received, this catches corruption introduced
+// by the disk of this node while the archive was being extracted.
+func ScanIntegrity(ctx context.Context, root string) (IntegrityResult, error) {
+	cfg := config.Get().System.Transfers
+	sample := 100
+	if cfg.IntegrityScan == IntegrityScanSample {
+		sample = cfg.IntegrityScanSample
+	}
+	return scanIntegrity(ctx, root, sample)
+}
+
+func scanIntegrity(ctx context.Context, root string, sample int) (IntegrityResult, error) {
+	var r IntegrityResult
+	buf := make([]byte, 1024*1024)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(root, p)
+		if err != nil {
+			if p == root {
+				return err
+			}
+			r.Unreadable = append(r.Unreadable, rel)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		r.Files++
+		if sample < 100 && rand.Intn(100) >= sample {
+			return nil
+		}
+		r.Scanned++
+		n, err := readBack(p, buf)
+		r.Bytes += n
+		if err != nil {
+			r.Unreadable = append(r.Unreadable, rel)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// readBack reads the entire contents of the file, without following a
+// symlink that may have replaced it.
+func readBack(p string, buf []byte) (int64, error) {
+	fd, err := unix.Open(p, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return 0, err
+	}
+	f := os.NewFile(uintptr(fd), p)
+	defer f.Close()
+	var total int64
+	for {
+		n, err := f.Read(buf)
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
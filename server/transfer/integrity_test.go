@@ -0,0 +1,53 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestScanIntegrity(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("scanIntegrity", func() {
+		g.It("reads back every regular file", func() {
+			dir := t.TempDir()
+			_ = os.Mkdir(filepath.Join(dir, "world"), 0o700)
+			_ = os.WriteFile(filepath.Join(dir, "server.properties"), []byte(strings.Repeat("a", 1000)), 0o600)
+			_ = os.WriteFile(filepath.Join(dir, "world", "level.dat"), []byte(strings.Repeat("b", 2000)), 0o600)
+			_ = os.Symlink("/etc/passwd", filepath.Join(dir, "passwd"))
+
+			r, err := scanIntegrity(context.Background(), dir, 100)
+			g.Assert(err).IsNil()
+			g.Assert(r.Err()).IsNil()
+			g.Assert(r.Files).Equal(uint64(2))
+			g.Assert(r.Scanned).Equal(uint64(2))
+			g.Assert(r.Bytes).Equal(int64(3000))
+		})
+
+		g.It("only reads the sampled files", func() {
+			dir := t.TempDir()
+			_ = os.WriteFile(filepath.Join(dir, "server.properties"), []byte("a"), 0o600)
+
+			r, err := scanIntegrity(context.Background(), dir, 0)
+			g.Assert(err).IsNil()
+			g.Assert(r.Files).Equal(uint64(1))
+			g.Assert(r.Scanned).Equal(uint64(0))
+		})
+
+		g.It("reports the files that could not be read", func() {
+			r := IntegrityResult{Unreadable: make([]string, 12)}
+			for i := range r.Unreadable {
+				r.Unreadable[i] = "file"
+			}
+			err := r.Err()
+			g.Assert(err == nil).IsFalse()
+			g.Assert(strings.Contains(err.Error(), "12 extracted file(s)")).IsTrue()
+			g.Assert(strings.HasSuffix(err.Error(), "and 2 more")).IsTrue()
+		})
+	})
+}
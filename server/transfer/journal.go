@@ -0,0 +1,193 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/remote"
+)
+
+// PhaseInterrupted is reported to the Panel for an incoming transfer that was
+// still running when Wings stopped.
+const PhaseInterrupted Phase = "interrupted"
+
+// IncomingRecord is written to the disk by the target node while a transfer is
+// being received, so a transfer that was interrupted by Wings stopping can be
+// cleaned up and reported to the Panel once Wings is started again. The record
+// is kept after a transfer completes until the Panel has been told it was
+// successful, in which case Success is set.
+type IncomingRecord struct {
+	Server     string                  `json:"server"`
+	TransferID string                  `json:"transfer_id"`
+	SourceNode string                  `json:"source_node,omitempty"`
+	StartedAt  time.Time               `json:"started_at"`
+	Snapshot   *SnapshotRecord         `json:"snapshot,omitempty"`
+	Success    *remote.TransferSuccess `json:"success,omitempty"`
+}
+
+// SnapshotRecord is the persisted form of a Snapshot.
+type SnapshotRecord struct {
+	Kind    string `json:"kind"`
+	Dir     string `json:"dir"`
+	Name    string `json:"name"`
+	Dataset string `json:"dataset,omitempty"`
+}
+
+func journalDirectory() string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, "incoming")
+}
+
+func journalPath(server string) string {
+	return filepath.Join(journalDirectory(), filepath.Base(server)+".json")
+}
+
+// Persist records that this transfer is being received, along with the
+// snapshot taken of the server's files before it started if there is one.
+func (t *Transfer) Persist(snapshot *Snapshot) error {
+	rec := IncomingRecord{
+		Server:     t.Server.ID(),
+		TransferID: t.id,
+		SourceNode: t.sourceNode,
+		StartedAt:  t.started,
+	}
+	if snapshot != nil {
+		rec.Snapshot = &SnapshotRecord{Kind: snapshot.kind, Dir: snapshot.dir, Name: snapshot.name, Dataset: snapshot.dataset}
+	}
+	return writeRecord(rec)
+}
+
+// persistSuccess records that this transfer has completed, so the Panel is
+// still told about it if Wings is stopped before the notification is
+// accepted.
+func (t *Transfer) persistSuccess(success remote.TransferSuccess) error {
+	return writeRecord(IncomingRecord{
+		Server:     t.Server.ID(),
+		TransferID: t.id,
+		SourceNode: t.sourceNode,
+		StartedAt:  t.started,
+		Success:    &success,
+	})
+}
+
+func writeRecord(rec IncomingRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(journalDirectory(), 0o700); err != nil {
+		return err
+	}
+	f, err := createTemporary(journalPath(rec.Server))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		removeTemporary(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		removeTemporary(f.Name())
+		return err
+	}
+	return commitTemporary(f.Name(), journalPath(rec.Server))
+}
+
+// Forget removes the record of this transfer once it has finished.
+func (t *Transfer) Forget() {
+	if err := os.Remove(journalPath(t.Server.ID())); err != nil && !os.IsNotExist(err) {
+		t.Log().WithError(err).Warn("failed to remove incoming transfer record")
+	}
+}
+
+// ForgetIncoming removes the record of an incoming transfer for the server,
+// returning true if there was one.
+func ForgetIncoming(server string) (bool, error) {
+	err := os.Remove(journalPath(server))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ReconcileIncoming cleans up every incoming transfer that was interrupted by
+// Wings stopping and reports it to the Panel as failed. If the files received
+// so far are kept, which is the case when delta transfers are enabled and no
+// snapshot was taken, the failure is marked as resumable and retrying the
+// transfer only sends the files that are still missing. Transfers that had
+// completed are reported as successful instead, if the Panel had not yet
+// accepted the notification.
+func ReconcileIncoming(ctx context.Context, client remote.Client) {
+	entries, err := os.ReadDir(journalDirectory())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("subsystem", "transfer").WithError(err).Warn("failed to read incoming transfer records")
+		}
+		return
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		p := filepath.Join(journalDirectory(), e.Name())
+		b, err := os.ReadFile(p)
+		var rec IncomingRecord
+		if err == nil {
+			err = json.Unmarshal(b, &rec)
+		}
+		if err != nil || rec.Server == "" {
+			log.WithField("subsystem", "transfer").WithField("path", p).Warn("removing invalid incoming transfer record")
+			_ = os.Remove(p)
+			continue
+		}
+		if rec.Success != nil {
+			renotifySuccess(ctx, client, rec, p)
+			continue
+		}
+		reconcile(ctx, client, rec)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithField("subsystem", "transfer").WithField("path", p).WithError(err).Warn("failed to remove incoming transfer record")
+		}
+	}
+}
+
+func reconcile(ctx context.Context, client remote.Client, rec IncomingRecord) {
+	l := log.WithField("subsystem", "transfer").WithField("server", rec.Server).WithField("transfer_id", rec.TransferID)
+	l.Warn("incoming transfer was interrupted by wings stopping")
+
+	failure := remote.TransferFailure{Phase: string(PhaseInterrupted)}
+	switch {
+	case rec.Snapshot != nil:
+		s := &Snapshot{kind: rec.Snapshot.Kind, dir: rec.Snapshot.Dir, name: rec.Snapshot.Name, dataset: rec.Snapshot.Dataset}
+		if err := s.Rollback(ctx); err != nil {
+			l.WithField("snapshot", s.Name()).WithError(err).Error("failed to roll back server files to snapshot")
+			MarkIncomplete(rec.Server, filepath.Join(config.Get().System.Data, rec.Server), rec.TransferID)
+		} else {
+			l.WithField("snapshot", s.Name()).Info("rolled back server files to snapshot")
+		}
+	case config.Get().System.Transfers.DeltaTransfers:
+		failure.Resumable = true
+		l.Info("keeping server files received before the interruption so the transfer can be resumed")
+	default:
+		dir := filepath.Join(config.Get().System.Data, rec.Server)
+		res := CleanupFailedFiles(rec.Server, dir)
+		if res.Outcome == CleanupLeft {
+			MarkIncomplete(rec.Server, dir, rec.TransferID)
+		}
+		res.Apply(&failure)
+	}
+
+	if err := client.SendTransferFailure(ctx, rec.Server, failure); err != nil {
+		l.WithError(err).Error("failed to set transfer status on panel")
+	}
+}
@@ -0,0 +1,281 @@
+package transfer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrLogsDisabled is returned when trying to read the log of a transfer while
+// transfer logs are not being persisted.
+var ErrLogsDisabled = errors.New("transfer: transfer logs are not persisted on this node")
+
+// ErrInvalidTransferID is returned when the log of a transfer is requested
+// with an identifier that is not a valid UUID.
+var ErrInvalidTransferID = errors.New("transfer: invalid transfer identifier")
+
+// logFlushInterval is how often the lines written to the persisted log of a
+// transfer are flushed to it while the transfer is running.
+const logFlushInterval = time.Second
+
+// logFile is the persisted log of a transfer. It is kept open and written to
+// through a buffer while the transfer is running, and closed once it reaches
+// a terminal status. A failure to write it is only logged once per transfer.
+type logFile struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	flushed time.Time
+	created bool
+	failed  bool
+}
+
+// logDirectory returns the directory the logs of transfers are persisted in,
+// or an empty string if they are not persisted.
+func logDirectory() string {
+	return config.Get().System.Transfers.LogDirectory
+}
+
+// logPath returns the path of the persisted log of a transfer of a server.
+func logPath(server, id string) string {
+	return filepath.Join(logDirectory(), filepath.Base(server), filepath.Base(id)+".log")
+}
+
+// openLog opens the persisted log of a transfer for appending, creating it if
+// it does not exist yet.
+func openLog(server, id string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath(server, id)), 0o700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(logPath(server, id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+}
+
+// appendLog adds a line to the persisted log of a transfer, creating it if it
+// does not exist yet.
+func appendLog(server, id, line string) error {
+	f, err := openLog(server, id)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// record writes a message sent to the console of the server to the persisted
+// log of the transfer, along with the time it was sent. Lines are buffered
+// and flushed at most once every logFlushInterval, so sending a message does
+// not wait on the disk. The logs of previous transfers of the server are
+// pruned when the log of a new transfer is created. Nothing is written if
+// transfer logs are not persisted.
+func (t *Transfer) record(v string) {
+	if logDirectory() == "" || t.Server == nil || t.Server.ID() == "" {
+		return
+	}
+	f := &t.logFile
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line := time.Now().Format(time.RFC3339Nano) + " [" + t.nodeName() + "] " + v
+	if err := f.write(t.Server.ID(), t.id, line); err != nil {
+		if !f.failed {
+			f.failed = true
+			t.Log().WithError(err).Warn("failed to write to persisted transfer log")
+		}
+		return
+	}
+	if !f.created {
+		f.created = true
+		if err := pruneLogs(t.Server.ID(), t.id); err != nil {
+			t.Log().WithError(err).Warn("failed to remove old transfer logs")
+		}
+	}
+}
+
+// write adds a line to the log, opening it if it is not open yet. The caller
+// must hold the lock of the log.
+func (f *logFile) write(server, id, line string) error {
+	if f.f == nil {
+		fd, err := openLog(server, id)
+		if err != nil {
+			return err
+		}
+		f.f, f.w, f.flushed = fd, bufio.NewWriter(fd), time.Now()
+	}
+	if _, err := f.w.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	if time.Since(f.flushed) < logFlushInterval {
+		return nil
+	}
+	f.flushed = time.Now()
+	return f.w.Flush()
+}
+
+// closeLog flushes and closes the persisted log of the transfer. It is opened
+// again if anything else is written to it.
+func (t *Transfer) closeLog() {
+	f := &t.logFile
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return
+	}
+	err := f.w.Flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	f.f, f.w = nil, nil
+	if err != nil && !f.failed {
+		f.failed = true
+		t.Log().WithError(err).Warn("failed to write to persisted transfer log")
+	}
+}
+
+// renameLog moves the persisted log of the transfer to the name of its new
+// identifier, so the lines written before the identifier of the source node
+// was received are kept in the same log. The open log is still written to
+// once it has been renamed.
+func (t *Transfer) renameLog(old string) {
+	f := &t.logFile
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.created || old == t.id {
+		return
+	}
+	if err := os.Rename(logPath(t.Server.ID(), old), logPath(t.Server.ID(), t.id)); err != nil && !os.IsNotExist(err) {
+		t.Log().WithError(err).Warn("failed to rename persisted transfer log")
+	}
+}
+
+// persistedLog is a log of a transfer found in the log directory.
+type persistedLog struct {
+	path    string
+	id      string
+	modTime time.Time
+}
+
+// serverLogs returns the persisted logs of the transfers of a server, from the
+// most recently updated to the oldest.
+func serverLogs(server string) ([]persistedLog, error) {
+	dir := filepath.Dir(logPath(server, "log"))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	logs := make([]persistedLog, 0, len(entries))
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".log")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		logs = append(logs, persistedLog{path: filepath.Join(dir, e.Name()), id: id, modTime: info.ModTime()})
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].modTime.After(logs[j].modTime)
+	})
+	return logs, nil
+}
+
+// pruneLogs removes the persisted logs of a server that have expired, or that
+// exceed the number of logs kept for each server. The log of the transfer with
+// the given identifier is always kept.
+func pruneLogs(server, keep string) error {
+	cfg := config.Get().System.Transfers
+	logs, err := serverLogs(server)
+	if err != nil {
+		return err
+	}
+	retention := time.Duration(cfg.LogRetention) * time.Second
+	var kept int
+	for _, l := range logs {
+		if l.id == keep {
+			kept++
+			continue
+		}
+		expired := cfg.LogRetention > 0 && time.Since(l.modTime) > retention
+		if !expired && (cfg.LogsPerServer < 1 || kept < cfg.LogsPerServer) {
+			kept++
+			continue
+		}
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveExpiredLogs removes the persisted transfer logs of every server that
+// are older than the configured retention period, along with the logs beyond
+// the number kept for each server.
+func RemoveExpiredLogs() error {
+	if logDirectory() == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(logDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if err := pruneLogs(e.Name(), ""); err != nil {
+			return err
+		}
+		// Remove the directory of a server once it has no logs left.
+		_ = os.Remove(filepath.Join(logDirectory(), e.Name()))
+	}
+	return nil
+}
+
+// FindLog returns the path and transfer identifier of the persisted log of a
+// transfer of the server. If no identifier is given the log of the most
+// recent transfer of the server is returned. An error matching os.ErrNotExist
+// is returned if there is no such log.
+func FindLog(server, id string) (string, string, error) {
+	if logDirectory() == "" {
+		return "", "", ErrLogsDisabled
+	}
+	if id != "" {
+		u, err := uuid.Parse(id)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", ErrInvalidTransferID, err)
+		}
+		p := logPath(server, u.String())
+		if _, err := os.Stat(p); err != nil {
+			return "", "", err
+		}
+		return p, u.String(), nil
+	}
+	logs, err := serverLogs(server)
+	if err != nil {
+		return "", "", err
+	}
+	if len(logs) == 0 {
+		return "", "", fmt.Errorf("transfer: no transfer logs for server: %w", os.ErrNotExist)
+	}
+	return logs[0].path, logs[0].id, nil
+}
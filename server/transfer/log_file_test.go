@@ -0,0 +1,106 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestPersistedLogs(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("persisted transfer logs", func() {
+		const srv = "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f"
+		ids := []string{
+			"11111111-1111-4111-8111-111111111111",
+			"22222222-2222-4222-8222-222222222222",
+			"33333333-3333-4333-8333-333333333333",
+		}
+
+		set := func(dir string, retention, perServer int) {
+			setTransfers(config.Transfers{LogDirectory: dir, LogRetention: retention, LogsPerServer: perServer})
+		}
+
+		// write creates a log for each transfer, the first being the oldest.
+		write := func() {
+			for i, id := range ids {
+				g.Assert(appendLog(srv, id, "Streaming archive to destination...")).IsNil()
+				mtime := time.Now().Add(time.Duration(i-len(ids)) * time.Hour)
+				g.Assert(os.Chtimes(logPath(srv, id), mtime, mtime)).IsNil()
+			}
+		}
+
+		g.It("returns the log of the most recent transfer", func() {
+			set(t.TempDir(), 0, 0)
+			write()
+			g.Assert(appendLog(srv, ids[2], "Finished streaming archive to destination.")).IsNil()
+
+			p, id, err := FindLog(srv, "")
+			g.Assert(err).IsNil()
+			g.Assert(id).Equal(ids[2])
+			b, err := os.ReadFile(p)
+			g.Assert(err).IsNil()
+			g.Assert(strings.Count(string(b), "\n")).Equal(2)
+
+			_, id, err = FindLog(srv, ids[0])
+			g.Assert(err).IsNil()
+			g.Assert(id).Equal(ids[0])
+		})
+
+		g.It("buffers lines until the log is closed", func() {
+			set(t.TempDir(), 0, 0)
+			trnsfr := &Transfer{id: ids[0]}
+			g.Assert(trnsfr.logFile.write(srv, ids[0], "first")).IsNil()
+			g.Assert(trnsfr.logFile.write(srv, ids[0], "second")).IsNil()
+			b, err := os.ReadFile(logPath(srv, ids[0]))
+			g.Assert(err).IsNil()
+			g.Assert(len(b)).Equal(0)
+
+			trnsfr.closeLog()
+			g.Assert(trnsfr.logFile.write(srv, ids[0], "third")).IsNil()
+			trnsfr.closeLog()
+			b, err = os.ReadFile(logPath(srv, ids[0]))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("first\nsecond\nthird\n")
+		})
+
+		g.It("reports a missing or invalid log", func() {
+			set(t.TempDir(), 0, 0)
+			_, _, err := FindLog(srv, "")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+			_, _, err = FindLog(srv, "../../etc/passwd")
+			g.Assert(errors.Is(err, ErrInvalidTransferID)).IsTrue()
+
+			set("", 0, 0)
+			_, _, err = FindLog(srv, "")
+			g.Assert(errors.Is(err, ErrLogsDisabled)).IsTrue()
+		})
+
+		g.It("removes logs beyond the number kept for each server", func() {
+			set(t.TempDir(), 0, 2)
+			write()
+			g.Assert(RemoveExpiredLogs()).IsNil()
+			logs, err := serverLogs(srv)
+			g.Assert(err).IsNil()
+			g.Assert(len(logs)).Equal(2)
+			g.Assert(logs[1].id).Equal(ids[1])
+		})
+
+		g.It("removes logs once their retention period has passed", func() {
+			set(t.TempDir(), 90*60, 0)
+			write()
+			g.Assert(pruneLogs(srv, ids[0])).IsNil()
+			logs, err := serverLogs(srv)
+			g.Assert(err).IsNil()
+			g.Assert(len(logs)).Equal(2)
+			g.Assert(logs[0].id).Equal(ids[2])
+			g.Assert(logs[1].id).Equal(ids[0])
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pterodactyl/wings/server"
+)
+
+// logQueueSize is the number of transfer log messages that can be waiting to
+// be published to the event bus of a server before new messages are dropped.
+const logQueueSize = 256
+
+// terminalFlushTimeout is how long queued log messages are given to be
+// published before a terminal status is sent, so the last messages of a
+// transfer normally appear before its final status.
+const terminalFlushTimeout = time.Second
+
+// logQueue publishes transfer log messages to the event bus of a server from
+// a separate goroutine. Publishing can block while a slow websocket client is
+// catching up, which would otherwise stall the transfer that sent the message.
+// Messages are dropped if the queue is full, and the number of dropped messages
+// is published once the queue has caught up.
+type logQueue struct {
+	mu      sync.Mutex
+	ch      chan string
+	running bool
+	dropped uint64
+}
+
+// enqueue adds a message to the queue without blocking, starting the goroutine
+// that publishes them if it is not already running.
+func (t *Transfer) enqueue(v string) {
+	q := &t.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ch == nil {
+		q.ch = make(chan string, logQueueSize)
+	}
+	select {
+	case q.ch <- v:
+	default:
+		q.dropped++
+		return
+	}
+	if !q.running {
+		q.running = true
+		go t.drainLogs()
+	}
+}
+
+// drainLogs publishes queued messages until the queue is empty.
+func (t *Transfer) drainLogs() {
+	q := &t.queue
+	for {
+		q.mu.Lock()
+		var v string
+		select {
+		case v = <-q.ch:
+		default:
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		dropped := q.dropped
+		q.dropped = 0
+		q.mu.Unlock()
+
+		if dropped > 0 {
+			t.Server.Events().Publish(server.TransferLogsEvent, t.format(fmt.Sprintf("%d transfer log messages were dropped as the console could not keep up.", dropped)))
+		}
+		t.Server.Events().Publish(server.TransferLogsEvent, v)
+	}
+}
+
+// idle returns true if every queued message has been published.
+func (q *logQueue) idle() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.running && len(q.ch) == 0
+}
+
+// flushLogs waits for the queued messages to be published, giving up after
+// the timeout.
+func (t *Transfer) flushLogs(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for !t.queue.idle() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
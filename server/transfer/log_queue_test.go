@@ -0,0 +1,59 @@
+package transfer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/events"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestLogQueue(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("transfer log messages", func() {
+		g.BeforeEach(func() {
+			resetConfig()
+		})
+
+		g.It("do not block the transfer while a subscriber is not keeping up", func() {
+			trnsfr := &Transfer{Server: &server.Server{}}
+			// A subscriber that never reads, every publish to it waits for the
+			// event bus to give up on it.
+			ch := make(chan []byte)
+			trnsfr.Server.Events().On(ch)
+			defer trnsfr.Server.Events().Off(ch)
+
+			started := time.Now()
+			for i := 0; i < logQueueSize*2; i++ {
+				trnsfr.SendMessage("message")
+			}
+			g.Assert(time.Since(started) < time.Second).IsTrue()
+
+			trnsfr.queue.mu.Lock()
+			dropped := trnsfr.queue.dropped
+			trnsfr.queue.mu.Unlock()
+			g.Assert(dropped > 0).IsTrue()
+		})
+
+		g.It("publishes queued messages in order", func() {
+			trnsfr := &Transfer{Server: &server.Server{}}
+			ch := make(chan []byte, 8)
+			trnsfr.Server.Events().On(ch)
+			defer trnsfr.Server.Events().Off(ch)
+
+			trnsfr.SendMessage("first")
+			trnsfr.SendMessage("second")
+			trnsfr.flushLogs(time.Second)
+			g.Assert(len(ch)).Equal(2)
+			for _, want := range []string{"first", "second"} {
+				e := events.MustDecode(<-ch)
+				g.Assert(e.Topic).Equal(server.TransferLogsEvent)
+				g.Assert(strings.Contains(e.Data.(string), want)).IsTrue()
+			}
+		})
+	})
+}
@@ -0,0 +1,75 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// messageThrottle limits how often progress messages are sent to the console
+// of a server. Progress messages that arrive too quickly are coalesced so that
+// only the latest one is sent once the limit allows it, every other message is
+// always sent straight away.
+type messageThrottle struct {
+	mu      sync.Mutex
+	last    time.Time
+	pending string
+	timer   *time.Timer
+}
+
+// interval returns the minimum time between messages, or zero if there is no
+// limit.
+func (m *messageThrottle) interval() time.Duration {
+	n := config.Get().System.Transfers.LogRateLimit
+	if n < 1 {
+		return 0
+	}
+	return time.Second / time.Duration(n)
+}
+
+// sendProgressMessage sends a progress message to the server's console, if too
+// many messages have been sent recently it is held back and replaced by any
+// newer progress message.
+func (t *Transfer) sendProgressMessage(v string) {
+	m := &t.logs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wait := m.interval() - time.Since(m.last)
+	if wait <= 0 {
+		m.pending = ""
+		m.last = time.Now()
+		t.publish(v)
+		return
+	}
+	m.pending = v
+	if m.timer == nil {
+		m.timer = time.AfterFunc(wait, t.flushProgressMessage)
+	}
+}
+
+func (t *Transfer) flushProgressMessage() {
+	m := &t.logs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timer = nil
+	if m.pending == "" {
+		return
+	}
+	v := m.pending
+	m.pending = ""
+	m.last = time.Now()
+	t.publish(v)
+}
+
+// sendImportantMessage sends a message straight away, dropping any progress
+// message that is being held back so it is not sent after a newer message.
+func (t *Transfer) sendImportantMessage(v string) {
+	m := &t.logs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = ""
+	m.last = time.Now()
+	t.publish(v)
+}
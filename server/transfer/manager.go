@@ -43,9 +43,22 @@ func (m *Manager) Add(transfer *Transfer) {
 // Remove removes a transfer from the manager.
 func (m *Manager) Remove(transfer *Transfer) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	delete(m.transfers, transfer.Server.ID())
+	m.mu.Unlock()
+	transfer.finish()
+}
+
+// All returns every transfer tracked by the manager.
+func (m *Manager) All() []*Transfer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]*Transfer, 0, len(m.transfers))
+	for _, t := range m.transfers {
+		out = append(out, t)
+	}
+	return out
 }
 
 // Get gets a transfer from the manager using a server ID.
@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"path/filepath"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+// MountPolicyRefuse refuses to transfer servers that have custom mounts.
+const MountPolicyRefuse = "refuse"
+
+// ExcludedMount is a custom mount of a server whose contents are not included
+// in the transfer archive.
+type ExcludedMount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// MountReport lists the paths whose contents are included in the archive of a
+// server and the mounts that are not.
+type MountReport struct {
+	Included []string        `json:"included"`
+	Excluded []ExcludedMount `json:"excluded"`
+}
+
+// Mounts returns which paths of the server are included in its transfer.
+// Only the data directory of the server is archived, the contents of custom
+// mounts are left on this node and must be made available on the target node
+// separately.
+func Mounts(s *server.Server) MountReport {
+	report := MountReport{
+		Included: []string{s.Filesystem().Path()},
+		Excluded: []ExcludedMount{},
+	}
+	for _, m := range s.Config().Mounts {
+		report.Excluded = append(report.Excluded, ExcludedMount{
+			Source:   server.MapMountSource(m.Source),
+			Target:   filepath.Clean(m.Target),
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	return report
+}
+
+// RefusesMounts reports whether servers with custom mounts are refused rather
+// than transferred with a warning.
+func RefusesMounts() bool {
+	return config.Get().System.Transfers.MountPolicy == MountPolicyRefuse
+}
@@ -0,0 +1,95 @@
+package transfer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrClientCertificateRequired is returned for a transfer request that was not
+// made with a valid client certificate when one is required by this node.
+var ErrClientCertificateRequired = errors.New("transfer: a valid client certificate is required")
+
+// clientCertificate loads the certificate this node presents to other nodes,
+// returning nil if one has not been configured.
+func clientCertificate(cert, key string) (*tls.Certificate, error) {
+	if cert == "" && key == "" {
+		return nil, nil
+	}
+	if cert == "" || key == "" {
+		return nil, errors.New("transfer: both client_cert and client_key must be set to use a client certificate")
+	}
+	c, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to load client certificate: %w", err)
+	}
+	return &c, nil
+}
+
+// certificateTransport explains TLS handshake failures caused by the target
+// node rejecting the client certificate of this node.
+type certificateTransport struct {
+	http.RoundTripper
+}
+
+func (t certificateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.RoundTripper.RoundTrip(req)
+	// Alerts sent by the remote end of the connection are not exported by the
+	// tls package, they can only be identified by their message.
+	if err != nil && strings.Contains(err.Error(), "remote error: tls:") && !isVersionError(err) {
+		return nil, fmt.Errorf("transfer: the destination rejected the client certificate of this node: %w", err)
+	}
+	return res, err
+}
+
+// ConfigureServerTLS configures the webserver to ask nodes for their client
+// certificate and verify it against the configured certificate authorities.
+// Certificates are only requested, not required, as the Panel does not send
+// one. Transfer requests are checked by RequireClientCertificate.
+//
+// The minimum TLS version of the webserver is left unchanged as it is also
+// used by the Panel, the version used by a transfer request is checked by
+// RequireTLSVersion instead.
+func ConfigureServerTLS(cfg *tls.Config) error {
+	if _, err := minTLSVersion(); err != nil {
+		return err
+	}
+	p := config.Get().System.Transfers.ClientCA
+	if p == "" {
+		if config.Get().System.Transfers.RequireClientCert {
+			return errors.New("transfer: require_client_cert is enabled but client_ca is not set")
+		}
+		return nil
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to read client certificate authorities: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return fmt.Errorf("transfer: no certificates found in %s", p)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return nil
+}
+
+// RequireClientCertificate returns ErrClientCertificateRequired if this node
+// requires transfers to be authenticated with a client certificate and the
+// request was not made with a certificate signed by one of the configured
+// certificate authorities.
+func RequireClientCertificate(r *http.Request) error {
+	if !config.Get().System.Transfers.RequireClientCert {
+		return nil
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ErrClientCertificateRequired
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package transfer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// writeCertificate writes a self-signed client certificate and its key to dir,
+// returning the paths along with the parsed certificate.
+func writeCertificate(dir, name string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	cp, kp := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	_ = os.WriteFile(cp, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(kp, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600)
+	return cp, kp, cert
+}
+
+func setClientCert(cert, key string) {
+	setTransfers(config.Transfers{ClientCert: cert, ClientKey: key})
+}
+
+func TestClientCertificate(t *testing.T) {
+	g := Goblin(t)
+	dir := t.TempDir()
+	trusted, trustedKey, ca := writeCertificate(dir, "trusted")
+	untrusted, untrustedKey, _ := writeCertificate(dir, "untrusted")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The certificate of the test server is not trusted, as is the case when
+	// running with --ignore-certificate-errors.
+	transport := http.DefaultTransport.(*http.Transport)
+	orig := transport.TLSClientConfig
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	defer func() {
+		transport.TLSClientConfig = orig
+	}()
+
+	g.Describe("client certificates", func() {
+		g.After(func() {
+			resetConfig()
+		})
+
+		g.It("presents the configured certificate", func() {
+			setClientCert(trusted, trustedKey)
+			client, err := httpClient()
+			g.Assert(err).IsNil()
+
+			res, err := client.Get(srv.URL)
+			g.Assert(err).IsNil()
+			_ = res.Body.Close()
+			g.Assert(res.StatusCode).Equal(http.StatusOK)
+		})
+
+		g.It("explains a certificate rejected by the destination", func() {
+			setClientCert(untrusted, untrustedKey)
+			client, err := httpClient()
+			g.Assert(err).IsNil()
+
+			_, err = client.Get(srv.URL)
+			g.Assert(err == nil).IsFalse()
+			g.Assert(strings.Contains(err.Error(), "rejected the client certificate")).IsTrue()
+		})
+
+		g.It("returns an error if the key is missing", func() {
+			setClientCert(trusted, "")
+			_, err := httpClient()
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
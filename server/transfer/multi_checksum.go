@@ -0,0 +1,138 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ChecksumsHeader is the header used by the source node to list the checksum
+// algorithms it sends for the archive, so the target node only calculates
+// the checksums it will be able to verify.
+const ChecksumsHeader = "X-Transfer-Checksums"
+
+// Checksum algorithms archives can be verified with. The checksum field of a
+// transfer is always SHA-256, any others are sent as "checksum_<algorithm>".
+const (
+	ChecksumSHA256  = "sha256"
+	ChecksumBLAKE2b = "blake2b"
+)
+
+// checksumAlgorithms contains every supported algorithm, from the strongest
+// to the weakest.
+var checksumAlgorithms = []string{ChecksumBLAKE2b, ChecksumSHA256}
+
+// ErrChecksumMismatch is returned when the checksum of an archive does not
+// match the checksum sent by the source node.
+var ErrChecksumMismatch = errors.New("checksums don't match")
+
+func newChecksumHash(algorithm string) hash.Hash {
+	if algorithm == ChecksumBLAKE2b {
+		h, _ := blake2b.New256(nil)
+		return h
+	}
+	return sha256.New()
+}
+
+// ParseChecksumAlgorithms returns the supported algorithms in a comma
+// separated list, from the strongest to the weakest. SHA-256 is always
+// included as it is the only algorithm older nodes send and verify.
+func ParseChecksumAlgorithms(v string) []string {
+	requested := make(map[string]struct{})
+	for _, a := range strings.Split(v, ",") {
+		requested[strings.ToLower(strings.TrimSpace(a))] = struct{}{}
+	}
+	requested[ChecksumSHA256] = struct{}{}
+	out := make([]string, 0, len(checksumAlgorithms))
+	for _, a := range checksumAlgorithms {
+		if _, ok := requested[a]; ok {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// ChecksumAlgorithms returns the algorithms this node sends checksums of its
+// archives with.
+func ChecksumAlgorithms() []string {
+	return ParseChecksumAlgorithms(strings.Join(config.Get().System.Transfers.ChecksumAlgorithms, ","))
+}
+
+// ArchiveHash calculates the checksum of an archive with several algorithms
+// at once, allowing nodes that support different algorithms to verify the
+// same archive while they are being upgraded.
+type ArchiveHash struct {
+	algorithms []string
+	hashes     []hash.Hash
+}
+
+// NewArchiveHash returns a hash that calculates a checksum with each of the
+// given algorithms.
+func NewArchiveHash(algorithms []string) *ArchiveHash {
+	h := &ArchiveHash{algorithms: algorithms, hashes: make([]hash.Hash, len(algorithms))}
+	for i, a := range algorithms {
+		h.hashes[i] = newChecksumHash(a)
+	}
+	return h
+}
+
+func (h *ArchiveHash) Write(p []byte) (int, error) {
+	for _, v := range h.hashes {
+		v.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sum returns the hex encoded checksum calculated with the algorithm, or an
+// empty string if it is not being calculated.
+func (h *ArchiveHash) Sum(algorithm string) string {
+	for i, a := range h.algorithms {
+		if a == algorithm {
+			return hex.EncodeToString(h.hashes[i].Sum(nil))
+		}
+	}
+	return ""
+}
+
+// Sums returns every checksum being calculated, keyed by algorithm.
+func (h *ArchiveHash) Sums() map[string]string {
+	out := make(map[string]string, len(h.algorithms))
+	for _, a := range h.algorithms {
+		out[a] = h.Sum(a)
+	}
+	return out
+}
+
+// Strongest returns the strongest algorithm that a checksum was received for
+// and that is being calculated.
+func (h *ArchiveHash) Strongest(received map[string]string) string {
+	for _, a := range h.algorithms {
+		if _, ok := received[a]; ok {
+			return a
+		}
+	}
+	return ""
+}
+
+// Verify compares the hex encoded checksum received for the algorithm with
+// the one that was calculated.
+func (h *ArchiveHash) Verify(algorithm, expected string) error {
+	actual := h.Sum(algorithm)
+	if actual == "" {
+		return errors.New("transfer: checksum algorithm " + algorithm + " is not supported")
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(expected))
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(b) != actual {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestArchiveHash(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ArchiveHash", func() {
+		g.It("always includes SHA-256 and orders algorithms by strength", func() {
+			g.Assert(ParseChecksumAlgorithms("")).Equal([]string{ChecksumSHA256})
+			g.Assert(ParseChecksumAlgorithms("sha256, BLAKE2B, md5")).Equal([]string{ChecksumBLAKE2b, ChecksumSHA256})
+		})
+
+		g.It("verifies the strongest checksum both nodes support", func() {
+			sender := NewArchiveHash(ParseChecksumAlgorithms("blake2b"))
+			_, _ = sender.Write([]byte("archive"))
+
+			// A node that only supports SHA-256 ignores the BLAKE2b checksum.
+			legacy := NewArchiveHash(ParseChecksumAlgorithms(""))
+			_, _ = legacy.Write([]byte("archive"))
+			g.Assert(legacy.Strongest(sender.Sums())).Equal(ChecksumSHA256)
+			g.Assert(legacy.Verify(ChecksumSHA256, sender.Sum(ChecksumSHA256))).IsNil()
+
+			modern := NewArchiveHash(ParseChecksumAlgorithms("blake2b"))
+			_, _ = modern.Write([]byte("archive"))
+			g.Assert(modern.Strongest(sender.Sums())).Equal(ChecksumBLAKE2b)
+			g.Assert(modern.Verify(ChecksumBLAKE2b, sender.Sum(ChecksumBLAKE2b))).IsNil()
+		})
+
+		g.It("returns an error if the checksum does not match", func() {
+			h := NewArchiveHash(ParseChecksumAlgorithms(""))
+			_, _ = h.Write([]byte("archive"))
+			sum := sha256.Sum256([]byte("other"))
+			err := h.Verify(ChecksumSHA256, hex.EncodeToString(sum[:]))
+			g.Assert(errors.Is(err, ErrChecksumMismatch)).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package transfer
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/remote"
+)
+
+// notifyRetryDelay is how long to wait before the first background attempt at
+// notifying the Panel of a successful transfer, the delay doubles after every
+// failed attempt up to notifyRetryMaxDelay.
+var (
+	notifyRetryDelay    = time.Minute
+	notifyRetryMaxDelay = 30 * time.Minute
+)
+
+// notifyRetryMaxAge is how long the notification is retried for before it is
+// given up on.
+const notifyRetryMaxAge = 24 * time.Hour
+
+// NotifySuccess tells the Panel the transfer completed successfully and then
+// calls complete. The transfer ID is sent as an idempotency key, so if the
+// notification fails it can be retried safely in the background even if the
+// Panel did receive an earlier attempt. Retrying stops once the Panel accepts
+// the notification, rejects it with a client error, or ctx is canceled.
+// Without this, the server would stay marked as transferring on the Panel
+// until someone stepped in manually.
+//
+// The record of the transfer is kept until the Panel accepts the
+// notification, so it is sent again when Wings is next started if it is
+// stopped before then.
+func NotifySuccess(ctx context.Context, client remote.Client, t *Transfer, complete func()) {
+	success := t.Success()
+	if err := t.persistSuccess(success); err != nil {
+		t.Log().WithError(err).Warn("failed to record successful transfer")
+	}
+	notify := func(ctx context.Context) error {
+		return client.SendTransferSuccess(ctx, t.Server.ID(), t.id, success)
+	}
+	accepted := func() {
+		t.Forget()
+		complete()
+	}
+
+	err := notify(ctx)
+	if err == nil {
+		accepted()
+		return
+	}
+	t.Log().WithField("status", true).WithError(err).Error("failed to set transfer status on panel, retrying in the background")
+	if !retryable(err) {
+		t.Forget()
+		return
+	}
+	go retryNotifySuccess(ctx, t.Log(), notifyRetryDelay, notifyRetryMaxDelay, notify, accepted, t.Forget)
+}
+
+// renotifySuccess tells the Panel about a transfer that completed before Wings
+// was stopped, removing its record at p once the Panel has accepted it.
+func renotifySuccess(ctx context.Context, client remote.Client, rec IncomingRecord, p string) {
+	l := log.WithField("subsystem", "transfer").WithField("server", rec.Server).WithField("transfer_id", rec.TransferID)
+	remove := func() {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			l.WithField("path", p).WithError(err).Warn("failed to remove incoming transfer record")
+		}
+	}
+	notify := func(ctx context.Context) error {
+		return client.SendTransferSuccess(ctx, rec.Server, rec.TransferID, *rec.Success)
+	}
+
+	l.Info("notifying panel of transfer that completed before wings was stopped")
+	err := notify(ctx)
+	if err == nil {
+		remove()
+		return
+	}
+	l.WithField("status", true).WithError(err).Error("failed to set transfer status on panel, retrying in the background")
+	if !retryable(err) {
+		remove()
+		return
+	}
+	go retryNotifySuccess(ctx, l, notifyRetryDelay, notifyRetryMaxDelay, notify, remove, remove)
+}
+
+// retryNotifySuccess calls notify with a backoff from delay up to maxDelay
+// until it succeeds, then calls accepted. If the Panel rejects the
+// notification or it has been retried for notifyRetryMaxAge, abandon is called
+// instead. Neither is called if ctx is canceled first.
+func retryNotifySuccess(ctx context.Context, l *log.Entry, delay, maxDelay time.Duration, notify func(ctx context.Context) error, accepted, abandon func()) {
+	started := time.Now()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for attempt := 1; time.Since(started) < notifyRetryMaxAge; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		err := notify(ctx)
+		if err == nil {
+			l.WithField("attempt", attempt).Info("notified panel of successful transfer")
+			accepted()
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		l.WithField("attempt", attempt).WithError(err).Warn("failed to set transfer status on panel")
+		if !retryable(err) {
+			abandon()
+			return
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+		timer.Reset(delay)
+	}
+	l.Error("giving up on notifying panel of successful transfer")
+	abandon()
+}
+
+// retryable returns false if the Panel rejected the notification in a way that
+// will not change by sending it again.
+func retryable(err error) bool {
+	rerr := remote.AsRequestError(err)
+	if rerr == nil {
+		return true
+	}
+	code := rerr.StatusCode()
+	return code < 400 || code >= 500 || code == http.StatusTooManyRequests
+}
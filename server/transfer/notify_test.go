@@ -0,0 +1,113 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/remote"
+	"github.com/pterodactyl/wings/server"
+)
+
+// notifyClient is a Panel client that fails the first failures attempts at
+// sending a transfer success. Any other method of the client panics.
+type notifyClient struct {
+	remote.Client
+	mu       sync.Mutex
+	failures int
+	sent     []string
+}
+
+func (c *notifyClient) SendTransferSuccess(_ context.Context, uuid, key string, _ remote.TransferSuccess) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, uuid+"/"+key)
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("panel is unavailable")
+	}
+	return nil
+}
+
+func (c *notifyClient) attempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sent)
+}
+
+func TestNotifySuccess(t *testing.T) {
+	g := Goblin(t)
+	notifyRetryDelay, notifyRetryMaxDelay = time.Millisecond, time.Millisecond
+	defer func() {
+		notifyRetryDelay, notifyRetryMaxDelay = time.Minute, 30*time.Minute
+	}()
+
+	g.Describe("NotifySuccess", func() {
+		g.BeforeEach(func() {
+			setConfig(config.SystemConfiguration{ArchiveDirectory: t.TempDir()})
+		})
+
+		g.It("removes the record once the panel accepts the notification", func() {
+			client := &notifyClient{failures: 2}
+			trnsfr := New(context.Background(), &server.Server{})
+			completed := make(chan struct{})
+			NotifySuccess(context.Background(), client, trnsfr, func() {
+				close(completed)
+			})
+
+			_, err := os.Stat(journalPath(trnsfr.Server.ID()))
+			g.Assert(err).IsNil()
+			<-completed
+			g.Assert(client.attempts()).Equal(3)
+			_, err = os.Stat(journalPath(trnsfr.Server.ID()))
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.It("stops retrying and keeps the record when canceled", func() {
+			client := &notifyClient{failures: 1}
+			trnsfr := New(context.Background(), &server.Server{})
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			called := make(chan struct{}, 1)
+			NotifySuccess(ctx, client, trnsfr, func() {
+				called <- struct{}{}
+			})
+
+			select {
+			case <-called:
+				g.Fail("transfer was completed")
+			case <-time.After(20 * time.Millisecond):
+			}
+			g.Assert(client.attempts()).Equal(1)
+			_, err := os.Stat(journalPath(trnsfr.Server.ID()))
+			g.Assert(err).IsNil()
+		})
+
+		g.It("notifies the panel of a recorded success when reconciling", func() {
+			rec := IncomingRecord{Server: "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f", TransferID: "id", Success: &remote.TransferSuccess{DurationSeconds: 1}}
+			g.Assert(writeRecord(rec)).IsNil()
+
+			client := &notifyClient{}
+			ReconcileIncoming(context.Background(), client)
+			g.Assert(client.sent).Equal([]string{rec.Server + "/id"})
+			_, err := os.Stat(journalPath(rec.Server))
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+
+			b, _ := json.Marshal(rec)
+			g.Assert(os.WriteFile(journalPath(rec.Server), b, 0o600)).IsNil()
+			client = &notifyClient{failures: 1}
+			ReconcileIncoming(context.Background(), client)
+			for client.attempts() < 2 {
+				time.Sleep(time.Millisecond)
+			}
+			g.Assert(client.attempts()).Equal(2)
+		})
+	})
+}
@@ -0,0 +1,283 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pterodactyl/wings/internal/progress"
+)
+
+// ObjectStorage contains the presigned URLs supplied by the Panel when a
+// transfer should be routed through an S3-compatible bucket instead of being
+// streamed directly to the target node. This is used when the source and
+// target nodes are unable to reach each other directly.
+type ObjectStorage struct {
+	// UploadURL is a presigned PUT URL used by the source node to upload the
+	// archive into the bucket.
+	UploadURL string `json:"upload_url"`
+	// DownloadURL is a presigned GET URL used by the target node to download
+	// the archive from the bucket.
+	DownloadURL string `json:"download_url"`
+	// ChecksumUploadURL is an optional presigned PUT URL used by the source
+	// node to upload a checksum file for the archive next to it in the
+	// bucket, in the format used by sha256sum.
+	ChecksumUploadURL string `json:"checksum_upload_url"`
+	// ChecksumDownloadURL is the presigned GET URL for the checksum file,
+	// which the target node verifies the archive against.
+	ChecksumDownloadURL string `json:"checksum_download_url"`
+}
+
+// Valid returns true if both presigned URLs have been provided.
+func (o *ObjectStorage) Valid() bool {
+	return o != nil && o.UploadURL != "" && o.DownloadURL != ""
+}
+
+// PushArchiveToObjectStorage archives the server to the local archive
+// directory, uploads it to the bucket using the presigned upload URL and then
+// notifies the target node of the download URL and checksum for the archive.
+//
+// The target node downloads the archive from the bucket itself, so aside from
+// the transport the checksum verification and extraction logic on the target
+// remains exactly the same as a direct transfer.
+func (t *Transfer) PushArchiveToObjectStorage(url, token string, storage ObjectStorage) ([]byte, error) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	t.SendMessage("Preparing to upload server data to object storage...")
+	t.SetStatus(StatusProcessing)
+
+	if err := EnsureArchiveDirectory(); err != nil {
+		t.Error(err, "Failed to prepare archive directory for transfer.")
+		return nil, err
+	}
+
+	a, err := t.Archive()
+	if err != nil {
+		t.Error(err, "Failed to get archive for transfer.")
+		return nil, errors.New("failed to get archive for transfer")
+	}
+
+	if err := t.reserveArchiveSpace(int64(a.Progress().Total())); err != nil {
+		t.Error(err, "Not enough space in the archive directory for transfer.")
+		return nil, err
+	}
+	defer t.releaseArchiveSpace()
+
+	store := t.ArchiveStore()
+	name := t.StagingName(a.Format())
+	defer t.removeArchive(store, name)
+
+	t.SendMessage("Creating archive of server data...")
+	done := t.timings.Start(PhaseArchive)
+	checksum, err := t.writeArchive(ctx, a, store, name)
+	done()
+	if err != nil {
+		t.Error(err, "Failed to create archive for transfer.")
+		return nil, err
+	}
+
+	defer t.timings.Start(PhaseUpload)()
+	t.SendMessage("Uploading archive to object storage...")
+	if err := t.uploadArchive(ctx, store, name, a.Format().MimeType(), storage.UploadURL); err != nil {
+		t.Error(err, "Failed to upload archive to object storage.")
+		return nil, err
+	}
+	t.SendMessage("Finished uploading archive to object storage.")
+
+	sidecar := storage.ChecksumUploadURL != "" && storage.ChecksumDownloadURL != ""
+	if sidecar {
+		if err := t.uploadChecksumFile(ctx, storage.ChecksumUploadURL, name, checksum); err != nil {
+			t.Error(err, "Failed to upload checksum file to object storage.")
+			return nil, err
+		}
+	}
+
+	// Build the request for the target node, the archive is referenced by the
+	// download URL rather than being included in the request body.
+	var buf bytes.Buffer
+	mp := multipart.NewWriter(&buf)
+	if err := t.writeState(mp); err != nil {
+		return nil, err
+	}
+	if err := t.writeFileManifest(ctx, mp); err != nil {
+		return nil, err
+	}
+	if err := a.writeFormat(mp); err != nil {
+		return nil, err
+	}
+	if err := mp.WriteField("archive_url", storage.DownloadURL); err != nil {
+		return nil, err
+	}
+	if sidecar {
+		if err := mp.WriteField("archive_name", name); err != nil {
+			return nil, err
+		}
+		if err := mp.WriteField("checksum_url", storage.ChecksumDownloadURL); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.writeSize(mp); err != nil {
+		return nil, err
+	}
+	if err := t.writeTimings(mp); err != nil {
+		return nil, err
+	}
+	if err := t.writeChecksum(mp, checksum); err != nil {
+		return nil, err
+	}
+	if err := mp.Close(); err != nil {
+		return nil, err
+	}
+	t.markSent()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(ctx, req, token)
+	req.Header.Set("Content-Type", mp.FormDataContentType())
+	a.setFormatHeaders(req)
+
+	t.Log().Debug("notifying destination of archive in object storage")
+	t.SendMessage("Waiting for destination to download archive from object storage...")
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, context.Canceled
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(res)
+	}
+	v, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	t.retainArchive(store, name, checksum)
+	return v, nil
+}
+
+// writeArchive streams the archive into the store and returns the hex encoded
+// SHA-256 checksum of the archive. The archive is only made available under
+// its name once it is complete, so a partial archive is never mistaken for a
+// complete one. Checkpoints are kept for each server, so an archive that is
+// not created for a server, such as the one written by the self-test, is
+// written without them.
+func (t *Transfer) writeArchive(ctx context.Context, a *Archive, store ArchiveStore, name string) (string, error) {
+	if t.Server != nil && checkpointsEnabled(store) {
+		return t.writeCheckpointedArchive(ctx, a, store.(*LocalArchiveStore), name)
+	}
+	w, err := store.Create(name)
+	if err != nil {
+		return "", fmt.Errorf("transfer: failed to create local archive: %w", err)
+	}
+	if err := a.Stream(ctx, w); err != nil {
+		_ = w.Abort()
+		return "", fmt.Errorf("transfer: failed to stream archive to disk: %w", err)
+	}
+	if err := w.Commit(); err != nil {
+		return "", fmt.Errorf("transfer: failed to write archive to disk: %w", err)
+	}
+	return store.Checksum(name)
+}
+
+// removeArchive removes a staged archive from the store once it is no longer
+// needed, unless it is being retained after the transfer succeeded.
+func (t *Transfer) removeArchive(store ArchiveStore, name string) {
+	if t.retained == name {
+		return
+	}
+	if err := store.Remove(name); err != nil {
+		t.Log().WithField("archive", name).WithError(err).Warn("failed to remove local transfer archive")
+	}
+}
+
+// uploadArchive PUTs the archive in the store to the presigned upload URL.
+func (t *Transfer) uploadArchive(ctx context.Context, store ArchiveStore, name, mimeType, url string) error {
+	f, err := store.Open(name)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to open local archive: %w", err)
+	}
+	defer f.Close()
+
+	st, err := store.Stat(name)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to stat local archive: %w", err)
+	}
+
+	// Track the upload itself rather than the archive creation.
+	up := progress.NewProgress(uint64(st.Size()))
+	defer t.sendProgress("Uploading ", up, 5*time.Second)()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, io.TeeReader(f, up))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = st.Size()
+	req.Header.Set("Content-Type", mimeType)
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to upload archive: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("transfer: failed to put archive to object storage: [HTTP/%d] %s", res.StatusCode, res.Status)
+	}
+	return nil
+}
+
+// DownloadArchive opens a reader for an archive stored in object storage using
+// the presigned download URL provided by the source node. The caller is
+// responsible for closing the returned reader. ErrInternalHost is returned if
+// the URL is on an internal network that has not been allowed.
+func DownloadArchive(ctx context.Context, url string) (*ArchiveDownload, error) {
+	ctx = checkHosts(ctx)
+	res, err := getWithGrace(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to download archive: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("transfer: unexpected status code from object storage: %d", res.StatusCode)
+	}
+	// A chunked response does not have a length, which is reported by Go as
+	// -1. The checksum sent by the source node is still verified once the
+	// archive has been downloaded.
+	d := &ArchiveDownload{ReadCloser: newResumingReader(ctx, url, res), Size: res.ContentLength}
+	// An archive generated as it is downloaded may only have an estimated
+	// size, in which case any Content-Length is not trusted either.
+	if v, err := strconv.ParseInt(res.Header.Get(EstimatedSizeHeader), 10, 64); err == nil && v > 0 {
+		d.Size = v
+		d.Estimated = true
+	}
+	return d, nil
+}
+
+// ArchiveDownload is an archive being downloaded from object storage.
+type ArchiveDownload struct {
+	io.ReadCloser
+	// Size is the size of the archive, or -1 if it is not known.
+	Size int64
+	// Estimated is set if Size is only an approximation.
+	Estimated bool
+}
@@ -0,0 +1,135 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/system"
+)
+
+// ErrArchiveQuotaExceeded is returned when staging an archive would cause the
+// archive directory to grow larger than its configured quota.
+var ErrArchiveQuotaExceeded = errors.New("transfer: archive directory quota exceeded")
+
+// reservation is the space reserved in the archive directory by a transfer of
+// a server.
+type reservation struct {
+	server string
+	size   int64
+}
+
+// reservations tracks the space reserved in the archive directory by each
+// transfer that is currently staging an archive, keyed by the transfer ID.
+var reservations = struct {
+	mu    sync.Mutex
+	bytes map[string]reservation
+}{bytes: make(map[string]reservation)}
+
+// archiveDirectoryQuota returns the maximum number of bytes the archive
+// directory may hold, or zero if there is no limit.
+func archiveDirectoryQuota() int64 {
+	return int64(config.Get().System.Transfers.ArchiveDirectoryQuota) * 1024 * 1024
+}
+
+// archiveDirectoryUsage returns the size of the files in the archive directory.
+// Archives that are still being written are not included as the space they
+// will use has already been reserved by their transfer. Neither are the
+// partial archives left by checkpointed staging for the given servers, as
+// they are resumed or replaced within the space reserved for the server.
+func archiveDirectoryUsage(servers map[string]bool) (int64, error) {
+	temporaryFiles.mu.Lock()
+	defer temporaryFiles.mu.Unlock()
+
+	checkpoints := checkpointDirectory()
+	var size int64
+	err := filepath.WalkDir(config.Get().System.ArchiveDirectory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if _, ok := temporaryFiles.paths[p]; ok {
+			return nil
+		}
+		if filepath.Dir(p) == checkpoints && servers[archiveServer(d.Name())] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// checkArchiveQuota returns ErrArchiveQuotaExceeded if size bytes cannot be
+// added to the archive directory for the server without exceeding its quota.
+// The caller must hold the reservations lock.
+func checkArchiveQuota(server string, size int64) error {
+	quota := archiveDirectoryQuota()
+	if quota < 1 {
+		return nil
+	}
+	servers := map[string]bool{server: true}
+	for _, v := range reservations.bytes {
+		servers[v.server] = true
+	}
+	used, err := archiveDirectoryUsage(servers)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to calculate archive directory usage: %w", err)
+	}
+	for _, v := range reservations.bytes {
+		used += v.size
+	}
+	if used+size > quota {
+		return fmt.Errorf("%w: %s is in use, %s is required and the quota is %s", ErrArchiveQuotaExceeded, system.FormatBytes(used), system.FormatBytes(size), system.FormatBytes(quota))
+	}
+	return nil
+}
+
+// HasArchiveSpace checks if an archive of the given size could currently be
+// staged in the archive directory for the server without exceeding its quota.
+func HasArchiveSpace(server string, size int64) error {
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+	return checkArchiveQuota(server, size)
+}
+
+// reserveArchiveSpace reserves space in the archive directory for the archive
+// staged by this transfer. The size of the server's files is used as the size
+// of the archive since it is not known until it has been written. Nothing is
+// reserved if the transfer stages its archive somewhere other than the
+// archive directory.
+func (t *Transfer) reserveArchiveSpace(size int64) error {
+	if _, ok := t.ArchiveStore().(*LocalArchiveStore); !ok {
+		return nil
+	}
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+	if err := checkArchiveQuota(t.Server.ID(), size); err != nil {
+		return err
+	}
+	reservations.bytes[t.id] = reservation{server: t.Server.ID(), size: size}
+	return nil
+}
+
+// releaseArchiveSpace releases the space reserved by this transfer.
+func (t *Transfer) releaseArchiveSpace() {
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+	delete(reservations.bytes, t.id)
+}
@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestArchiveQuota(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("archive directory quota", func() {
+		const srv = "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f"
+		const other = "9c7d2e10-1f2a-4b3c-8d4e-5f6a7b8c9d0e"
+		const mib = 1024 * 1024
+		var dir string
+
+		g.BeforeEach(func() {
+			dir = t.TempDir()
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: dir,
+				Transfers:        config.Transfers{ArchiveDirectoryQuota: 2},
+			})
+		})
+
+		g.AfterEach(func() {
+			reservations.mu.Lock()
+			reservations.bytes = make(map[string]reservation)
+			reservations.mu.Unlock()
+		})
+
+		write := func(p string, size int) {
+			g.Assert(os.MkdirAll(filepath.Dir(p), 0o700)).IsNil()
+			g.Assert(os.WriteFile(p, make([]byte, size), 0o600)).IsNil()
+		}
+
+		g.It("rejects an archive that does not fit in the quota", func() {
+			g.Assert(HasArchiveSpace(srv, mib)).IsNil()
+			write(filepath.Join(dir, other+".tar.gz"), mib)
+			g.Assert(HasArchiveSpace(srv, mib)).IsNil()
+			g.Assert(errors.Is(HasArchiveSpace(srv, mib+1), ErrArchiveQuotaExceeded)).IsTrue()
+		})
+
+		g.It("never rejects an archive without a quota", func() {
+			config.Update(func(c *config.Configuration) {
+				c.System.Transfers.ArchiveDirectoryQuota = 0
+			})
+			g.Assert(HasArchiveSpace(srv, 10*mib)).IsNil()
+		})
+
+		g.It("counts the space reserved by other transfers", func() {
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.reserveArchiveSpace(mib)).IsNil()
+			g.Assert(errors.Is(HasArchiveSpace(srv, mib+1), ErrArchiveQuotaExceeded)).IsTrue()
+
+			trnsfr.releaseArchiveSpace()
+			g.Assert(HasArchiveSpace(srv, mib+1)).IsNil()
+		})
+
+		g.It("does not count the partial archive left for the server by a checkpoint", func() {
+			write(filepath.Join(checkpointDirectory(), srv+".tar.gz"), mib)
+			g.Assert(HasArchiveSpace(srv, 2*mib)).IsNil()
+			g.Assert(errors.Is(HasArchiveSpace(other, 2*mib), ErrArchiveQuotaExceeded)).IsTrue()
+		})
+	})
+}
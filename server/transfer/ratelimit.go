@@ -0,0 +1,121 @@
+package transfer
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// fairChunkSize is the largest number of bytes read from a transfer with a
+// normal priority before tokens are taken from the shared bucket. Keeping this
+// small means every active transfer takes turns drawing from the bucket, so no
+// single transfer is able to starve the others. The chunk size is scaled by
+// the weight of the priority of a transfer, giving higher priority transfers a
+// larger share of the bucket on every turn.
+const fairChunkSize = 32 * 1024
+
+// global is the token bucket shared by every transfer on this node.
+var global struct {
+	mu     sync.Mutex
+	rate   int64
+	bucket *ratelimit.Bucket
+}
+
+// globalBucket returns the bucket shared between all transfers, or nil if no
+// global download limit has been configured. The bucket is replaced if the
+// configured limit changes.
+func globalBucket() *ratelimit.Bucket {
+	rate := int64(config.Get().System.Transfers.GlobalDownloadLimit) * 1024 * 1024
+	if rate <= 0 {
+		return nil
+	}
+
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if global.bucket == nil || global.rate != rate {
+		global.rate = rate
+		global.bucket = ratelimit.NewBucketWithRate(float64(rate), rate)
+	}
+	return global.bucket
+}
+
+// scheduleInterval is how often the download schedule is checked while a
+// transfer is running.
+const scheduleInterval = time.Minute
+
+type limitedReader struct {
+	r       io.Reader
+	bucket  *ratelimit.Bucket
+	rate    int64
+	chunk   int
+	checked time.Time
+}
+
+// LimitReader limits the rate data can be read from r while receiving a
+// transfer. Every transfer draws from a single bucket shared across the node
+// when a global download limit is configured, while the per-transfer download
+// limit acts as an additional ceiling for each individual transfer.
+func LimitReader(r io.Reader) io.Reader {
+	return limitReader(r, PriorityNormal)
+}
+
+// LimitReader limits the rate data can be read from r in the same way as the
+// package level LimitReader, with the share of the global download limit given
+// to the transfer depending on its priority.
+func (t *Transfer) LimitReader(r io.Reader) io.Reader {
+	return limitReader(r, t.Priority())
+}
+
+func limitReader(r io.Reader, p Priority) io.Reader {
+	lr := &limitedReader{r: r, chunk: fairChunkSize * p.weight() / PriorityNormal.weight()}
+	lr.update(time.Now())
+	return lr
+}
+
+// update replaces the per-transfer bucket if the download limit has changed,
+// such as when a new schedule window has started.
+func (l *limitedReader) update(now time.Time) {
+	l.checked = now
+	rate := int64(downloadLimit(now)) * 1024 * 1024
+	if rate < 0 {
+		rate = 0
+	}
+	if rate == l.rate {
+		return
+	}
+	l.rate = rate
+	if rate == 0 {
+		l.bucket = nil
+		return
+	}
+	l.bucket = ratelimit.NewBucketWithRate(float64(rate), rate)
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if now := time.Now(); now.Sub(l.checked) >= scheduleInterval {
+		l.update(now)
+	}
+
+	g := globalBucket()
+	if l.bucket == nil && g == nil {
+		return l.r.Read(p)
+	}
+
+	if len(p) > l.chunk {
+		p = p[:l.chunk]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if l.bucket != nil {
+			l.bucket.Wait(int64(n))
+		}
+		if g != nil {
+			g.Wait(int64(n))
+		}
+	}
+	return n, err
+}
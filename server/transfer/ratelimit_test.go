@@ -0,0 +1,37 @@
+package transfer
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestLimitReader(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("LimitReader", func() {
+		g.Before(func() {
+			setTransfers(config.Transfers{GlobalDownloadLimit: 1024})
+		})
+		g.After(func() {
+			resetConfig()
+		})
+
+		g.It("draws larger chunks from the shared bucket for higher priorities", func() {
+			buf := make([]byte, 1024*1024)
+			for p, want := range map[Priority]int{
+				PriorityLow:    fairChunkSize / 2,
+				PriorityNormal: fairChunkSize,
+				PriorityHigh:   fairChunkSize * 2,
+			} {
+				r := limitReader(bytes.NewReader(make([]byte, len(buf))), p)
+				n, err := r.Read(buf)
+				g.Assert(err).IsNil()
+				g.Assert(n).Equal(want)
+			}
+		})
+	})
+}
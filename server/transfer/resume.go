@@ -0,0 +1,122 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrArchiveChanged is returned when a lost download cannot be resumed because
+// the archive at the source is no longer the one that was partially received.
+// Continuing would join the start of one archive to the end of another, so the
+// transfer must be started again from the beginning.
+var ErrArchiveChanged = errors.New("transfer: archive changed at source since the download started")
+
+// resumingReader reads the body of an archive download, resuming it from the
+// number of bytes already received when the connection is lost. Every resumed
+// request includes the validator of the original response so the source only
+// sends the rest of the archive if it is identical to the one already partly
+// received.
+type resumingReader struct {
+	ctx       context.Context
+	url       string
+	validator string
+	body      io.ReadCloser
+	// offset is the number of bytes of the archive received so far.
+	offset  int64
+	resumes int
+}
+
+// newResumingReader returns a reader for the body of res. The download can
+// only be resumed if the source accepts range requests and sent a validator
+// for the archive, otherwise a lost connection is returned as
+// ErrSourceDisconnected like any other download.
+func newResumingReader(ctx context.Context, url string, res *http.Response) io.ReadCloser {
+	r := &resumingReader{ctx: ctx, url: url, body: res.Body}
+	if res.Header.Get("Accept-Ranges") == "bytes" {
+		r.validator = validator(res.Header)
+	}
+	return r
+}
+
+// validator returns the value that identifies the exact version of a download
+// for an If-Range header. Weak entity tags cannot be used to resume a range,
+// so the modification time is used for them instead.
+func validator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF || !isDisconnect(err) {
+			return n, err
+		}
+		if r.validator == "" || r.resumes >= config.Get().System.Transfers.DownloadResumes {
+			return n, fmt.Errorf("%w: %v", ErrSourceDisconnected, err)
+		}
+		r.resumes++
+		log.WithField("subsystem", "transfer").WithField("offset", r.offset).WithField("attempt", r.resumes).WithError(err).Warn("connection lost while downloading archive, resuming download")
+		if rerr := r.resume(); rerr != nil {
+			return n, rerr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the rest of the archive from the current offset. The
+// source responds with the full archive instead of the requested range if it
+// has changed, in which case ErrArchiveChanged is returned.
+func (r *resumingReader) resume() error {
+	_ = r.body.Close()
+	r.body = http.NoBody
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+	req.Header.Set("If-Range", r.validator)
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSourceDisconnected, err)
+	}
+	switch {
+	case res.StatusCode == http.StatusOK:
+		_ = res.Body.Close()
+		return ErrArchiveChanged
+	case res.StatusCode != http.StatusPartialContent:
+		_ = res.Body.Close()
+		return fmt.Errorf("%w: unexpected status code when resuming download: %d", ErrSourceDisconnected, res.StatusCode)
+	case !strings.HasPrefix(res.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(r.offset, 10)+"-"):
+		_ = res.Body.Close()
+		return fmt.Errorf("transfer: source resumed download at the wrong offset: %s", res.Header.Get("Content-Range"))
+	case validator(res.Header) != r.validator:
+		_ = res.Body.Close()
+		return ErrArchiveChanged
+	}
+	r.body = res.Body
+	return nil
+}
+
+func (r *resumingReader) Close() error {
+	return r.body.Close()
+}
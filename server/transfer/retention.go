@@ -0,0 +1,168 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// RetainedArchive is written to the disk for every archive kept after its
+// server was transferred successfully, recording when it is due to be removed.
+type RetainedArchive struct {
+	Archive    string    `json:"archive"`
+	Server     string    `json:"server"`
+	TransferID string    `json:"transfer_id"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	DeleteAt   time.Time `json:"delete_at"`
+}
+
+func retentionDirectory() string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, "retained")
+}
+
+func retentionPath(archive string) string {
+	return filepath.Join(retentionDirectory(), filepath.Base(archive)+".json")
+}
+
+func archiveRetention() time.Duration {
+	return time.Duration(config.Get().System.Transfers.ArchiveRetention) * time.Second
+}
+
+// loadRetention returns the retention record of the archive, if it has one.
+func loadRetention(archive string) (*RetainedArchive, bool) {
+	b, err := os.ReadFile(retentionPath(archive))
+	if err != nil {
+		return nil, false
+	}
+	var rec RetainedArchive
+	if err := json.Unmarshal(b, &rec); err != nil || rec.Archive != archive {
+		return nil, false
+	}
+	return &rec, true
+}
+
+func removeRetention(archive string) error {
+	if err := os.Remove(retentionPath(archive)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// retainArchive is called once the target node has accepted the staged
+// archive. The final location of the archive is logged along with when it is
+// going to be removed, and if a retention period is configured the archive is
+// kept until it has passed rather than being removed with the transfer. Only
+// archives staged on the local disk can be retained.
+func (t *Transfer) retainArchive(store ArchiveStore, name, checksum string) {
+	l := t.Log().WithField("archive", name).WithField("checksum", checksum)
+	var size int64
+	if st, err := store.Stat(name); err == nil {
+		size = st.Size()
+		l = l.WithField("size", size)
+	}
+	local, ok := store.(*LocalArchiveStore)
+	if ok {
+		l = l.WithField("path", local.path(name))
+	}
+	retention := archiveRetention()
+	if !ok || retention <= 0 {
+		l.WithField("delete_at", time.Now().UTC()).Info("transfer archive accepted by destination, removing it")
+		return
+	}
+
+	rec := RetainedArchive{
+		Archive:    name,
+		Server:     t.Server.ID(),
+		TransferID: t.id,
+		Size:       size,
+		Checksum:   checksum,
+		DeleteAt:   time.Now().Add(retention).UTC(),
+	}
+	b, err := json.Marshal(rec)
+	if err == nil {
+		if err = os.MkdirAll(retentionDirectory(), 0o700); err == nil {
+			err = os.WriteFile(retentionPath(name), b, 0o600)
+		}
+	}
+	if err != nil {
+		l.WithError(err).Warn("failed to record retention of transfer archive, removing it")
+		return
+	}
+	t.retained = name
+	l.WithField("delete_at", rec.DeleteAt).Info("transfer archive accepted by destination, retaining it")
+}
+
+// RemoveExpiredArchives removes every retained archive whose retention period
+// has passed, along with any retention record that cannot be read. Archives
+// of a server that is currently being transferred are left until the next
+// sweep, as the transfer may be staging a new archive under the same name.
+func RemoveExpiredArchives() error {
+	entries, err := os.ReadDir(retentionDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	store := NewLocalArchiveStore()
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		l := log.WithField("subsystem", "transfer").WithField("archive", name).WithField("path", store.path(name))
+		rec, ok := loadRetention(name)
+		if !ok {
+			l.Warn("removing unreadable transfer archive retention record")
+			if err := removeRetention(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if time.Now().Before(rec.DeleteAt) || isTransferring(rec.Server) {
+			continue
+		}
+		if err := store.Remove(name); err != nil {
+			return err
+		}
+		if err := removeRetention(name); err != nil {
+			return err
+		}
+		l.WithField("server", rec.Server).
+			WithField("size", rec.Size).
+			WithField("checksum", rec.Checksum).
+			WithField("delete_at", rec.DeleteAt).
+			Info("removed transfer archive after its retention period")
+	}
+	return nil
+}
+
+// SweepRetainedArchives removes expired retained archives and persisted
+// transfer logs every minute until the context is canceled, along with the
+// backup exclusions of staged files that have been removed some other way.
+func SweepRetainedArchives(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if err := RemoveExpiredArchives(); err != nil {
+			log.WithField("subsystem", "transfer").WithError(err).Warn("failed to remove expired transfer archives")
+		}
+		if err := RemoveExpiredLogs(); err != nil {
+			log.WithField("subsystem", "transfer").WithError(err).Warn("failed to remove expired transfer logs")
+		}
+		pruneBackupExclusions()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
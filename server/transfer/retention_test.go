@@ -0,0 +1,78 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestArchiveRetention(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("archive retention", func() {
+		name := "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f.tar.gz"
+		var store *LocalArchiveStore
+
+		setRetention := func(seconds int) {
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: t.TempDir(),
+				Transfers:        config.Transfers{ArchiveRetention: seconds},
+			})
+			store = NewLocalArchiveStore()
+			w, err := store.Create(name)
+			g.Assert(err).IsNil()
+			_, err = w.Write([]byte("archive"))
+			g.Assert(err).IsNil()
+			g.Assert(w.Commit()).IsNil()
+		}
+
+		exists := func() bool {
+			_, err := store.Stat(name)
+			return err == nil
+		}
+
+		g.It("removes the archive with the transfer without a retention period", func() {
+			setRetention(0)
+			trnsfr := New(context.Background(), &server.Server{})
+			trnsfr.retainArchive(store, name, "checksum")
+			trnsfr.removeArchive(store, name)
+			g.Assert(exists()).IsFalse()
+		})
+
+		g.It("keeps the archive until its retention period has passed", func() {
+			setRetention(60)
+			trnsfr := New(context.Background(), &server.Server{})
+			trnsfr.retainArchive(store, name, "checksum")
+			trnsfr.removeArchive(store, name)
+			g.Assert(exists()).IsTrue()
+
+			archives, err := StagedArchives()
+			g.Assert(err).IsNil()
+			g.Assert(len(archives)).Equal(1)
+			g.Assert(archives[0].RetainedUntil == nil).IsFalse()
+
+			g.Assert(RemoveExpiredArchives()).IsNil()
+			g.Assert(exists()).IsTrue()
+
+			rec, ok := loadRetention(name)
+			g.Assert(ok).IsTrue()
+			g.Assert(rec.Size).Equal(int64(len("archive")))
+			rec.DeleteAt = time.Now().Add(-time.Second)
+			b, err := json.Marshal(rec)
+			g.Assert(err).IsNil()
+			g.Assert(os.WriteFile(retentionPath(name), b, 0o600)).IsNil()
+
+			g.Assert(RemoveExpiredArchives()).IsNil()
+			g.Assert(exists()).IsFalse()
+			_, ok = loadRetention(name)
+			g.Assert(ok).IsFalse()
+		})
+	})
+}
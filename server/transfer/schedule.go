@@ -0,0 +1,75 @@
+package transfer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// parseWindow parses a window in the format "HH:MM-HH:MM" returning the start
+// and end of the window as minutes since midnight.
+func parseWindow(v string) (int, int, error) {
+	parts := strings.SplitN(strings.ReplaceAll(v, " ", ""), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("transfer: invalid schedule window \"%s\"", v)
+	}
+	var minutes [2]int
+	for i, p := range parts {
+		t, err := time.Parse("15:04", p)
+		if err != nil {
+			return 0, 0, fmt.Errorf("transfer: invalid schedule window \"%s\": %w", v, err)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// inWindow returns true if the minute of the day falls within the window. A
+// window that ends before it starts wraps around midnight.
+func inWindow(minute, start, end int) bool {
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// scheduleLocation returns the timezone used to evaluate the download schedule.
+func scheduleLocation() *time.Location {
+	tz := config.Get().System.Transfers.ScheduleTimezone
+	if tz == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.WithField("timezone", tz).WithError(err).Warn("transfer: invalid schedule timezone, using local time")
+		return time.Local
+	}
+	return loc
+}
+
+// downloadLimit returns the per-transfer download limit in MiB/s that applies
+// at the given time, taking the configured schedule into account.
+func downloadLimit(now time.Time) int {
+	cfg := config.Get().System.Transfers
+	if len(cfg.DownloadSchedule) == 0 {
+		return cfg.DownloadLimit
+	}
+
+	now = now.In(scheduleLocation())
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range cfg.DownloadSchedule {
+		start, end, err := parseWindow(w.Window)
+		if err != nil {
+			log.WithError(err).Warn("transfer: ignoring invalid download schedule window")
+			continue
+		}
+		if inWindow(minute, start, end) {
+			return w.Limit
+		}
+	}
+	return cfg.DownloadLimit
+}
@@ -0,0 +1,43 @@
+package transfer
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestSchedule(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("parseWindow", func() {
+		g.It("parses a window into minutes since midnight", func() {
+			start, end, err := parseWindow("08:00-18:30")
+			g.Assert(err).IsNil()
+			g.Assert(start).Equal(8 * 60)
+			g.Assert(end).Equal(18*60 + 30)
+		})
+
+		g.It("returns an error for an invalid window", func() {
+			_, _, err := parseWindow("08:00")
+			g.Assert(err == nil).IsFalse()
+
+			_, _, err = parseWindow("8am-6pm")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+
+	g.Describe("inWindow", func() {
+		g.It("matches times within a window", func() {
+			g.Assert(inWindow(9*60, 8*60, 18*60)).IsTrue()
+			g.Assert(inWindow(8*60, 8*60, 18*60)).IsTrue()
+			g.Assert(inWindow(18*60, 8*60, 18*60)).IsFalse()
+			g.Assert(inWindow(7*60, 8*60, 18*60)).IsFalse()
+		})
+
+		g.It("handles windows that wrap around midnight", func() {
+			g.Assert(inWindow(23*60, 22*60, 6*60)).IsTrue()
+			g.Assert(inWindow(5*60, 22*60, 6*60)).IsTrue()
+			g.Assert(inWindow(12*60, 22*60, 6*60)).IsFalse()
+		})
+	})
+}
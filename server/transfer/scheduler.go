@@ -0,0 +1,172 @@
+package transfer
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// Priority controls the order outgoing transfers are started in when every
+// transfer slot on the node is in use.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// ParsePriority returns the priority with the given name, defaulting to
+// PriorityNormal if it is not recognised.
+func ParsePriority(v string) Priority {
+	switch Priority(v) {
+	case PriorityLow, PriorityHigh:
+		return Priority(v)
+	default:
+		return PriorityNormal
+	}
+}
+
+// weight returns the share of the bandwidth shared between transfers that is
+// given to a transfer with this priority, relative to the other priorities.
+func (p Priority) weight() int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityHigh:
+		return 4
+	default:
+		return 2
+	}
+}
+
+func (p Priority) rank() int {
+	switch p {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+type queuedTransfer struct {
+	t     *Transfer
+	seq   uint64
+	ready chan struct{}
+}
+
+// scheduler hands out the transfer slots available to outgoing transfers.
+// Transfers that cannot start immediately wait in a queue ordered by their
+// priority, and then by the order they were queued in.
+var scheduler = struct {
+	mu      sync.Mutex
+	seq     uint64
+	running map[*Transfer]struct{}
+	queue   []*queuedTransfer
+}{running: make(map[*Transfer]struct{})}
+
+// hasFreeSlot returns true if there is a transfer slot available. The caller
+// must hold the scheduler lock.
+func hasFreeSlot() bool {
+	limit := config.Get().System.Transfers.MaxConcurrent
+	if limit < 1 {
+		return true
+	}
+	return len(scheduler.running) < limit
+}
+
+// Acquire waits until a transfer slot is available for this transfer, or the
+// context is cancelled. Transfers with a higher priority are given a slot
+// before any that have a lower priority, regardless of when they were queued.
+func (t *Transfer) Acquire(ctx context.Context) error {
+	scheduler.mu.Lock()
+	if len(scheduler.queue) == 0 && hasFreeSlot() {
+		scheduler.running[t] = struct{}{}
+		scheduler.mu.Unlock()
+		return nil
+	}
+
+	scheduler.seq++
+	q := &queuedTransfer{t: t, seq: scheduler.seq, ready: make(chan struct{})}
+	scheduler.queue = append(scheduler.queue, q)
+	sort.SliceStable(scheduler.queue, func(i, j int) bool {
+		a, b := scheduler.queue[i], scheduler.queue[j]
+		if a.t.Priority().rank() != b.t.Priority().rank() {
+			return a.t.Priority().rank() > b.t.Priority().rank()
+		}
+		return a.seq < b.seq
+	})
+	scheduler.mu.Unlock()
+
+	t.SetStatus(StatusQueued)
+	t.SendMessage("Waiting for a free transfer slot on this node...")
+
+	select {
+	case <-q.ready:
+		return nil
+	case <-ctx.Done():
+		scheduler.mu.Lock()
+		defer scheduler.mu.Unlock()
+		for i, v := range scheduler.queue {
+			if v == q {
+				scheduler.queue = append(scheduler.queue[:i], scheduler.queue[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// The slot was handed out at the same time as the context was
+		// cancelled, give it to the next transfer.
+		delete(scheduler.running, t)
+		dispatch()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a transfer slot for this transfer if one is available,
+// returning false without waiting if there is not. This is used by incoming
+// transfers, which the source node retries if they are refused.
+func (t *Transfer) TryAcquire() bool {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if !hasFreeSlot() {
+		return false
+	}
+	scheduler.running[t] = struct{}{}
+	return true
+}
+
+// Release returns the slot held by this transfer, starting the next queued
+// transfer if there is one.
+func (t *Transfer) Release() {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	delete(scheduler.running, t)
+	dispatch()
+}
+
+// dispatch starts as many queued transfers as there are free slots. The
+// caller must hold the scheduler lock.
+func dispatch() {
+	for len(scheduler.queue) > 0 && hasFreeSlot() {
+		q := scheduler.queue[0]
+		scheduler.queue = scheduler.queue[1:]
+		scheduler.running[q.t] = struct{}{}
+		close(q.ready)
+	}
+}
+
+// Priority returns the priority of the transfer.
+func (t *Transfer) Priority() Priority {
+	if t.priority == "" {
+		return PriorityNormal
+	}
+	return t.priority
+}
+
+// SetPriority sets the priority of the transfer.
+func (t *Transfer) SetPriority(p Priority) {
+	t.priority = p
+}
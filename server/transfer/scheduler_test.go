@@ -0,0 +1,94 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestScheduler(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("Acquire", func() {
+		g.BeforeEach(func() {
+			setTransfers(config.Transfers{MaxConcurrent: 1})
+		})
+
+		// queue creates a transfer with the given priority waiting for a slot,
+		// the transfer is sent to started once it has one.
+		queue := func(ctx context.Context, p Priority, started chan<- *Transfer) *Transfer {
+			trnsfr := New(context.Background(), &server.Server{})
+			trnsfr.SetPriority(p)
+			go func() {
+				if err := trnsfr.Acquire(ctx); err == nil {
+					started <- trnsfr
+				}
+			}()
+			// Wait for the transfer to be queued so the order is known.
+			for {
+				scheduler.mu.Lock()
+				var queued bool
+				for _, q := range scheduler.queue {
+					queued = queued || q.t == trnsfr
+				}
+				scheduler.mu.Unlock()
+				if queued {
+					return trnsfr
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		g.It("starts queued transfers with a higher priority first", func() {
+			running := New(context.Background(), &server.Server{})
+			g.Assert(running.Acquire(context.Background())).IsNil()
+
+			started := make(chan *Transfer, 3)
+			low := queue(context.Background(), PriorityLow, started)
+			normal := queue(context.Background(), PriorityNormal, started)
+			high := queue(context.Background(), PriorityHigh, started)
+
+			running.Release()
+			g.Assert(<-started).Equal(high)
+			high.Release()
+			g.Assert(<-started).Equal(normal)
+			normal.Release()
+			g.Assert(<-started).Equal(low)
+			low.Release()
+		})
+
+		g.It("removes a transfer from the queue when it is cancelled", func() {
+			running := New(context.Background(), &server.Server{})
+			g.Assert(running.Acquire(context.Background())).IsNil()
+
+			started := make(chan *Transfer, 2)
+			ctx, cancel := context.WithCancel(context.Background())
+			queue(ctx, PriorityHigh, started)
+			next := queue(context.Background(), PriorityNormal, started)
+			cancel()
+			for {
+				scheduler.mu.Lock()
+				n := len(scheduler.queue)
+				scheduler.mu.Unlock()
+				if n == 1 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			running.Release()
+			g.Assert(<-started).Equal(next)
+			next.Release()
+
+			scheduler.mu.Lock()
+			defer scheduler.mu.Unlock()
+			g.Assert(len(scheduler.queue)).Equal(0)
+			g.Assert(len(scheduler.running)).Equal(0)
+		})
+	})
+}
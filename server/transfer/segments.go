@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrSegmentMismatch is returned when a segment of an archive does not match
+// the checksum sent with it by the source node.
+var ErrSegmentMismatch = errors.New("transfer: archive segment checksum mismatch")
+
+// SegmentsSHA256 is sent by the source node in the "segments" field when the
+// archive is split into segments that are each followed by their SHA-256
+// checksum.
+const SegmentsSHA256 = "sha256"
+
+// maxSegmentSize is the largest segment the target node will accept, each
+// segment is held in memory until it has been verified.
+const maxSegmentSize = 64 * 1024 * 1024
+
+// segmentWriter splits an archive into segments of a fixed size. Each segment
+// is written as its length, the data and then the SHA-256 checksum of the data,
+// allowing the target node to verify every segment before it is extracted
+// rather than only finding a corrupted archive once all of it has been
+// received. A segment with a length of zero marks the end of the archive.
+type segmentWriter struct {
+	w    io.Writer
+	size int
+	buf  []byte
+}
+
+func newSegmentWriter(w io.Writer, size int) *segmentWriter {
+	if size > maxSegmentSize {
+		size = maxSegmentSize
+	}
+	return &segmentWriter{w: w, size: size, buf: make([]byte, 0, size)}
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		l := min(s.size-len(s.buf), len(p))
+		s.buf = append(s.buf, p[:l]...)
+		p = p[l:]
+		if len(s.buf) == s.size {
+			if err := s.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (s *segmentWriter) flush() error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint64(hdr[:], uint64(len(s.buf)))
+	if _, err := s.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if len(s.buf) == 0 {
+		return nil
+	}
+	if _, err := s.w.Write(s.buf); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(s.buf)
+	if _, err := s.w.Write(sum[:]); err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Close writes the last segment followed by the end of the archive.
+func (s *segmentWriter) Close() error {
+	if len(s.buf) > 0 {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+type segmentReader struct {
+	r     io.Reader
+	buf   bytes.Reader
+	data  []byte
+	index int
+	done  bool
+}
+
+// SegmentReader returns a reader for an archive that was split into segments
+// by the source node. A segment is only returned once its checksum has been
+// verified, if it does not match ErrSegmentMismatch is returned from Read
+// straight away.
+func SegmentReader(r io.Reader) io.Reader {
+	return &segmentReader{r: r}
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	return s.buf.Read(p)
+}
+
+func (s *segmentReader) next() error {
+	var hdr [8]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		return unexpected(err)
+	}
+	n := binary.BigEndian.Uint64(hdr[:])
+	if n == 0 {
+		s.done = true
+		return nil
+	}
+	if n > maxSegmentSize {
+		return fmt.Errorf("transfer: archive segment %d is %d bytes, larger than the maximum of %d", s.index, n, maxSegmentSize)
+	}
+	if cap(s.data) < int(n) {
+		s.data = make([]byte, n)
+	}
+	s.data = s.data[:n]
+	if _, err := io.ReadFull(s.r, s.data); err != nil {
+		return unexpected(err)
+	}
+	var sum [sha256.Size]byte
+	if _, err := io.ReadFull(s.r, sum[:]); err != nil {
+		return unexpected(err)
+	}
+	if sha256.Sum256(s.data) != sum {
+		return fmt.Errorf("%w: segment %d", ErrSegmentMismatch, s.index)
+	}
+	s.index++
+	s.buf.Reset(s.data)
+	return nil
+}
+
+// unexpected converts an EOF part of the way through a segment into an
+// unexpected EOF, the archive always ends with an empty segment.
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestSegmentReader(t *testing.T) {
+	g := Goblin(t)
+
+	segment := func(data string, size int) []byte {
+		var buf bytes.Buffer
+		w := newSegmentWriter(&buf, size)
+		_, _ = w.Write([]byte(data))
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	g.Describe("SegmentReader", func() {
+		g.It("returns the original archive", func() {
+			data := strings.Repeat("archive", 100)
+			b, err := io.ReadAll(SegmentReader(bytes.NewReader(segment(data, 64))))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal(data)
+		})
+
+		g.It("fails on the first segment that does not match its checksum", func() {
+			b := segment(strings.Repeat("a", 256), 64)
+			// Corrupt the data of the second segment.
+			b[8+64+32+8] ^= 0xff
+
+			r := SegmentReader(bytes.NewReader(b))
+			buf := make([]byte, 64)
+			_, err := io.ReadFull(r, buf)
+			g.Assert(err).IsNil()
+			_, err = r.Read(buf)
+			g.Assert(errors.Is(err, ErrSegmentMismatch)).IsTrue()
+		})
+
+		g.It("fails if the archive ends before the final segment", func() {
+			b := segment(strings.Repeat("a", 256), 64)
+			_, err := io.ReadAll(SegmentReader(bytes.NewReader(b[:len(b)-8])))
+			g.Assert(errors.Is(err, io.ErrUnexpectedEOF)).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// selfTestFileSize is the size of the file archived by the self-test.
+const selfTestFileSize = 256 * 1024
+
+// SelfTestStep is the result of a single step of the transfer self-test.
+type SelfTestStep struct {
+	Name       string `json:"name"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// SelfTestResult is the result of running the transfer self-test.
+type SelfTestResult struct {
+	Success bool           `json:"success"`
+	Steps   []SelfTestStep `json:"steps"`
+}
+
+// SelfTest performs a complete transfer locally using a small throwaway
+// server. An archive is staged in the archive directory, downloaded over HTTP
+// using the same client and limits as a real transfer, and extracted into a
+// temporary directory before its checksum and contents are verified. The test
+// stops at the first step that fails.
+func SelfTest(ctx context.Context) SelfTestResult {
+	var res SelfTestResult
+	step := func(name string, fn func() error) bool {
+		started := time.Now()
+		err := fn()
+		s := SelfTestStep{Name: name, Success: err == nil, DurationMs: time.Since(started).Milliseconds()}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		res.Steps = append(res.Steps, s)
+		return err == nil
+	}
+
+	var root string
+	if !step("archive_directory", func() error {
+		if err := EnsureArchiveDirectory(); err != nil {
+			return err
+		}
+		var err error
+		root, err = os.MkdirTemp(config.Get().System.ArchiveDirectory, ".selftest-")
+		return err
+	}) {
+		return res
+	}
+	defer os.RemoveAll(root)
+
+	content := make([]byte, selfTestFileSize)
+	var src *filesystem.Filesystem
+	if !step("create_server", func() error {
+		if _, err := rand.Read(content); err != nil {
+			return err
+		}
+		var err error
+		if src, err = filesystem.New(filepath.Join(root, "source"), 0, nil); err != nil {
+			return err
+		}
+		return src.Write("selftest/data.bin", bytes.NewReader(content), int64(len(content)), 0o644)
+	}) {
+		return res
+	}
+
+	t := New(ctx, nil)
+	a := &Archive{archive: &filesystem.Archive{
+		Filesystem:  src,
+		Compression: filesystem.ParseCompressionFormat(config.Get().System.Transfers.CompressionFormat),
+		Threads:     compressionThreads(),
+	}}
+	store := NewLocalArchiveStore()
+	name := "selftest-" + uuid.NewString() + a.Format().Extension()
+	var checksum string
+	if !step("create_archive", func() error {
+		var err error
+		checksum, err = t.writeArchive(ctx, a, store, name)
+		return err
+	}) {
+		return res
+	}
+	defer t.removeArchive(store, name)
+
+	var (
+		url string
+		srv *http.Server
+	)
+	if !step("serve_archive", func() error {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		srv = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f, err := store.Open(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			_, _ = io.Copy(w, f)
+		})}
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+		url = "http://" + ln.Addr().String() + "/" + name
+		return nil
+	}) {
+		return res
+	}
+	defer srv.Close()
+
+	var dst *filesystem.Filesystem
+	h := sha256.New()
+	if !step("extract_archive", func() error {
+		var err error
+		if dst, err = filesystem.New(filepath.Join(root, "target"), 0, nil); err != nil {
+			return err
+		}
+		// The archive is served by this node, which is always refused for
+		// downloads requested by other nodes.
+		rc, err := DownloadArchive(allowInternalHosts(ctx), url)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		r, err := RequireMinimumSize(LimitReader(rc))
+		if err != nil {
+			return err
+		}
+		return dst.ExtractStreamUnsafe(ctx, "/", "archive"+a.Format().Extension(), io.TeeReader(r, h))
+	}) {
+		return res
+	}
+
+	if !step("verify_checksum", func() error {
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != checksum {
+			return fmt.Errorf("checksums don't match: expected %s, got %s", checksum, actual)
+		}
+		return nil
+	}) {
+		return res
+	}
+
+	res.Success = step("verify_contents", func() error {
+		b, err := os.ReadFile(filepath.Join(dst.Path(), "selftest", "data.bin"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(b, content) {
+			return errors.New("extracted file does not match the original")
+		}
+		return nil
+	})
+	return res
+}
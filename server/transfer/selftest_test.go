@@ -0,0 +1,29 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestSelfTest(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("SelfTest", func() {
+		g.It("completes with archive checkpoints enabled", func() {
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: t.TempDir(),
+				Transfers:        config.Transfers{ArchiveCheckpointInterval: 1},
+			})
+
+			res := SelfTest(context.Background())
+			for _, s := range res.Steps {
+				g.Assert(s.Name + ": " + s.Error).Equal(s.Name + ": ")
+			}
+			g.Assert(res.Success).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package transfer
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// Settings contains the transfer settings being applied by this node. Values
+// are the ones actually used, after defaults have been applied, rather than
+// what is written in the configuration file.
+type Settings struct {
+	CompressionFormat   filesystem.CompressionFormat    `json:"compression_format"`
+	CompressionSample   int                             `json:"compression_sample_size,omitempty"`
+	CompressionLevel    string                          `json:"compression_level"`
+	CompressionThreads  int                             `json:"compression_threads"`
+	CompressionDict     string                          `json:"compression_dictionary"`
+	ChunkVerifyWorkers  int                             `json:"chunk_verify_workers"`
+	ChunkVerifyMemory   int                             `json:"chunk_verify_memory"`
+	ChunkStoreSize      int                             `json:"chunk_store_size"`
+	DeltaTransfers      bool                            `json:"delta_transfers"`
+	BlobCache           bool                            `json:"blob_cache"`
+	BlobCacheSize       int                             `json:"blob_cache_size"`
+	DownloadLimit       int                             `json:"download_limit"`
+	GlobalDownloadLimit int                             `json:"global_download_limit"`
+	DownloadSchedule    []config.TransferScheduleWindow `json:"download_schedule"`
+	DownloadRetries     int                             `json:"download_retries"`
+	DownloadResumes     int                             `json:"download_resumes"`
+	UploadChunkSize     int                             `json:"upload_chunk_size"`
+	UploadRetries       int                             `json:"upload_retries"`
+	UploadLimit         int                             `json:"upload_limit"`
+	ScheduleTimezone    string                          `json:"schedule_timezone"`
+	MaxConcurrent       int                             `json:"max_concurrent"`
+	MountPolicy         string                          `json:"mount_policy"`
+	CleanupFailure      string                          `json:"cleanup_failure"`
+	PostTransferCommand string                          `json:"post_transfer_command"`
+	FinalizeCommand     string                          `json:"finalize_command"`
+	FinalizeCommands    map[string]string               `json:"finalize_commands"`
+	IntegrityScan       string                          `json:"integrity_scan"`
+	ExcludeFromBackups  bool                            `json:"exclude_from_backups"`
+	ChecksumAlgorithms  []string                        `json:"checksum_algorithms"`
+	IntegrityScanSample int                             `json:"integrity_scan_sample"`
+	StopTimeout         int                             `json:"stop_timeout"`
+	ForceStop           bool                            `json:"force_stop"`
+	MinimumArchiveSize  int                             `json:"minimum_archive_size"`
+	SizeMismatch        string                          `json:"size_mismatch"`
+	SizeAllowance       int                             `json:"size_mismatch_allowance"`
+	TransportCompress   bool                            `json:"transport_compression"`
+	PreserveXattrs      bool                            `json:"preserve_xattrs"`
+	RestoreSELinux      bool                            `json:"restore_selinux_labels"`
+	LogDirectory        string                          `json:"log_directory"`
+	LogRetention        int                             `json:"log_retention"`
+	LogsPerServer       int                             `json:"logs_per_server"`
+	MinFreeSpaceAfter   string                          `json:"min_free_space_after"`
+	ExtractMemoryBudget int                             `json:"extract_memory_budget"`
+	ImagePreflight      bool                            `json:"image_preflight"`
+	PrePullImage        bool                            `json:"pre_pull_image"`
+	ArchiveDirectory    string                          `json:"archive_directory"`
+	ArchiveQuota        int                             `json:"archive_directory_quota"`
+	StagingFileName     string                          `json:"staging_file_name"`
+	ArchiveNameTemplate string                          `json:"archive_name_template"`
+	CheckpointInterval  int                             `json:"archive_checkpoint_interval"`
+	CheckpointMaxAge    int                             `json:"archive_checkpoint_max_age"`
+	ArchiveRetention    int                             `json:"archive_retention"`
+	SignsArchives       bool                            `json:"signs_archives"`
+	RequireSignature    bool                            `json:"require_signature"`
+	Snapshots           bool                            `json:"snapshots"`
+	KeepSnapshots       bool                            `json:"keep_snapshots"`
+	PlainLogs           bool                            `json:"plain_logs"`
+	LogRateLimit        int                             `json:"log_rate_limit"`
+	Proxy               string                          `json:"proxy"`
+	MaxIdleConns        int                             `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int                             `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int                             `json:"max_conns_per_host"`
+	IdleConnTimeout     int                             `json:"idle_conn_timeout"`
+	SocketBufferSize    int                             `json:"socket_buffer_size"`
+	HasClientCert       bool                            `json:"has_client_cert"`
+	RequireClientCert   bool                            `json:"require_client_cert"`
+	MinTLSVersion       string                          `json:"min_tls_version"`
+	VerifyManifest      bool                            `json:"verify_manifest"`
+	AcceptBackups       bool                            `json:"accept_backups"`
+	SourceSnapshot      string                          `json:"source_snapshot"`
+}
+
+// EffectiveSettings returns the transfer settings being applied by this node.
+// The path to the signing key is not included, and any credentials in the
+// proxy URL are redacted.
+func EffectiveSettings() Settings {
+	cfg := config.Get()
+	t := cfg.System.Transfers
+	return Settings{
+		CompressionFormat:   settingsCompressionFormat(t.CompressionFormat),
+		CompressionSample:   settingsCompressionSample(t),
+		CompressionLevel:    cfg.System.Backups.CompressionLevel,
+		CompressionThreads:  compressionThreads(),
+		CompressionDict:     t.CompressionDictionary,
+		ChunkVerifyWorkers:  chunkVerifyWorkers(),
+		ChunkVerifyMemory:   t.ChunkVerifyMemory,
+		ChunkStoreSize:      t.ChunkStoreSize,
+		DeltaTransfers:      t.DeltaTransfers,
+		BlobCache:           t.BlobCache,
+		BlobCacheSize:       t.BlobCacheSize,
+		DownloadLimit:       t.DownloadLimit,
+		GlobalDownloadLimit: t.GlobalDownloadLimit,
+		DownloadSchedule:    t.DownloadSchedule,
+		DownloadRetries:     t.DownloadRetries,
+		DownloadResumes:     t.DownloadResumes,
+		UploadChunkSize:     t.UploadChunkSize,
+		UploadRetries:       t.UploadRetries,
+		UploadLimit:         t.UploadLimit,
+		ScheduleTimezone:    t.ScheduleTimezone,
+		MaxConcurrent:       t.MaxConcurrent,
+		MountPolicy:         t.MountPolicy,
+		CleanupFailure:      t.CleanupFailure,
+		PostTransferCommand: t.PostTransferCommand,
+		FinalizeCommand:     t.FinalizeCommand,
+		FinalizeCommands:    t.FinalizeCommands,
+		IntegrityScan:       t.IntegrityScan,
+		ExcludeFromBackups:  t.ExcludeFromBackups,
+		ChecksumAlgorithms:  ChecksumAlgorithms(),
+		IntegrityScanSample: t.IntegrityScanSample,
+		StopTimeout:         t.StopTimeout,
+		ForceStop:           t.ForceStop,
+		MinimumArchiveSize:  t.MinimumArchiveSize,
+		SizeMismatch:        t.SizeMismatch,
+		SizeAllowance:       t.SizeMismatchAllowance,
+		TransportCompress:   t.TransportCompression,
+		PreserveXattrs:      t.PreserveXattrs,
+		RestoreSELinux:      t.RestoreSELinuxLabels,
+		LogDirectory:        t.LogDirectory,
+		LogRetention:        t.LogRetention,
+		LogsPerServer:       t.LogsPerServer,
+		MinFreeSpaceAfter:   t.MinFreeSpaceAfter,
+		ExtractMemoryBudget: t.ExtractMemoryBudget,
+		ImagePreflight:      t.ImagePreflight,
+		PrePullImage:        t.PrePullImage,
+		ArchiveDirectory:    cfg.System.ArchiveDirectory,
+		ArchiveQuota:        t.ArchiveDirectoryQuota,
+		StagingFileName:     t.StagingFileName,
+		ArchiveNameTemplate: t.ArchiveNameTemplate,
+		CheckpointInterval:  t.ArchiveCheckpointInterval,
+		CheckpointMaxAge:    t.ArchiveCheckpointMaxAge,
+		ArchiveRetention:    t.ArchiveRetention,
+		SignsArchives:       t.SigningKey != "",
+		RequireSignature:    t.RequireSignature,
+		Snapshots:           t.Snapshots,
+		KeepSnapshots:       t.KeepSnapshots,
+		PlainLogs:           t.PlainLogs,
+		LogRateLimit:        t.LogRateLimit,
+		Proxy:               redactURL(t.Proxy),
+		MaxIdleConns:        t.MaxIdleConns,
+		MaxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     t.MaxConnsPerHost,
+		IdleConnTimeout:     t.IdleConnTimeout,
+		SocketBufferSize:    t.SocketBufferSize,
+		HasClientCert:       t.ClientCert != "",
+		RequireClientCert:   t.RequireClientCert,
+		MinTLSVersion:       t.MinTLSVersion,
+		VerifyManifest:      t.VerifyManifest,
+		AcceptBackups:       t.AcceptBackups,
+		SourceSnapshot:      t.SourceSnapshot,
+	}
+}
+
+func redactURL(v string) string {
+	if v == "" {
+		return ""
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return "<invalid>"
+	}
+	return u.Redacted()
+}
+
+// settingsCompressionFormat returns the configured compression format, which
+// is either "auto" or one of the formats archives are created with.
+func settingsCompressionFormat(v string) filesystem.CompressionFormat {
+	if strings.EqualFold(v, CompressionAuto) {
+		return CompressionAuto
+	}
+	return filesystem.ParseCompressionFormat(v)
+}
+
+// settingsCompressionSample returns the sample size used to choose the
+// compression format, which is only relevant when it is chosen automatically.
+func settingsCompressionSample(t config.Transfers) int {
+	if !strings.EqualFold(t.CompressionFormat, CompressionAuto) {
+		return 0
+	}
+	return t.CompressionSampleSize
+}
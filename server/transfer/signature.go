@@ -0,0 +1,107 @@
+package transfer
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrInvalidSignature is returned when the signature of an archive checksum
+// cannot be verified using the public key of the source node.
+var ErrInvalidSignature = errors.New("transfer: archive checksum signature is invalid")
+
+// SignedHeader is the header sent by a source node that signs the checksums of
+// its archives, telling the target node to keep the archive away from the
+// files of the server until the signature has been verified.
+const SignedHeader = "X-Transfer-Signed"
+
+// signingKey returns the private key used to sign archive checksums, or nil if
+// signing has not been configured for this node. The key file must contain a
+// base64 encoded Ed25519 private key or seed.
+func signingKey() (ed25519.PrivateKey, error) {
+	p := config.Get().System.Transfers.SigningKey
+	if p == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to read signing key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("transfer: failed to decode signing key: %w", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("transfer: signing key has an invalid length of %d bytes", len(key))
+	}
+}
+
+// signedMessage returns the message that is signed for the checksum of an
+// archive. It includes the server and transfer the archive was sent for, so a
+// signature cannot be replayed to have the same archive accepted for another
+// server or by a later transfer.
+func signedMessage(server, id, checksum string) []byte {
+	return []byte(server + "|" + id + "|" + checksum)
+}
+
+// SignChecksum returns the base64 encoded signature of the checksum of an
+// archive sent for the given server and transfer, using the private key of
+// this node. An empty string is returned if signing is not configured.
+func SignChecksum(server, id, checksum string) (string, error) {
+	key, err := signingKey()
+	if err != nil || key == nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(server, id, checksum))), nil
+}
+
+// VerifyChecksum verifies the base64 encoded signature of the checksum of an
+// archive received for the given server and transfer, using the base64
+// encoded public key of the source node.
+func VerifyChecksum(publicKey, server, id, checksum, signature string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return fmt.Errorf("transfer: invalid public key for source node: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("transfer: invalid public key for source node: key is %d bytes, expected %d", len(key), ed25519.PublicKeySize)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(key, signedMessage(server, id, checksum), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignsArchives returns true if this node has been configured to sign the
+// checksums of the archives it sends.
+func SignsArchives() bool {
+	return config.Get().System.Transfers.SigningKey != ""
+}
+
+// writeChecksum writes the checksum of the archive, followed by its signature
+// if this node has been configured to sign archives.
+func (t *Transfer) writeChecksum(mp *multipart.Writer, checksum string) error {
+	if err := mp.WriteField("checksum", checksum); err != nil {
+		return err
+	}
+	sig, err := SignChecksum(t.Server.ID(), t.id, checksum)
+	if err != nil || sig == "" {
+		return err
+	}
+	return mp.WriteField("checksum_signature", sig)
+}
@@ -0,0 +1,52 @@
+package transfer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	g := Goblin(t)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(pub)
+	const (
+		srv      = "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f"
+		id       = "11111111-1111-4111-8111-111111111111"
+		checksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, signedMessage(srv, id, checksum)))
+
+	g.Describe("VerifyChecksum", func() {
+		g.It("accepts a valid signature", func() {
+			g.Assert(VerifyChecksum(key, srv, id, checksum, sig)).IsNil()
+		})
+
+		g.It("rejects a signature for a different checksum", func() {
+			err := VerifyChecksum(key, srv, id, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", sig)
+			g.Assert(err).Equal(ErrInvalidSignature)
+		})
+
+		g.It("rejects a signature replayed for another server or transfer", func() {
+			g.Assert(VerifyChecksum(key, "8c2d7d2a-3f1e-4b59-9a4c-6e5f4d3c2b1a", id, checksum, sig)).Equal(ErrInvalidSignature)
+			g.Assert(VerifyChecksum(key, srv, "22222222-2222-4222-8222-222222222222", checksum, sig)).Equal(ErrInvalidSignature)
+		})
+
+		g.It("rejects a signature from a different key", func() {
+			other, _, _ := ed25519.GenerateKey(rand.Reader)
+			err := VerifyChecksum(base64.StdEncoding.EncodeToString(other), srv, id, checksum, sig)
+			g.Assert(err).Equal(ErrInvalidSignature)
+		})
+
+		g.It("returns an error for an invalid public key", func() {
+			g.Assert(VerifyChecksum("not-a-key", srv, id, checksum, sig) == nil).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package transfer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strconv"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// TotalSizeHeader is the header used by the source node to send the total
+// size of the files being archived, before they are compressed.
+const TotalSizeHeader = "X-Total-Size"
+
+const (
+	// SizeMismatchRefuse refuses a transfer whose archive is larger than the
+	// files it contains.
+	SizeMismatchRefuse = "refuse"
+	// SizeMismatchWarn logs an archive that is larger than the files it
+	// contains and continues with the transfer, this is the default.
+	SizeMismatchWarn = "warn"
+	// SizeMismatchIgnore does not compare the size of archives with the size
+	// of the files they contain.
+	SizeMismatchIgnore = "ignore"
+)
+
+// ErrSizeMismatch is returned when an archive is larger than the files it
+// contains could account for.
+var ErrSizeMismatch = errors.New("transfer: archive is larger than the uncompressed size of its files")
+
+// ParseTotalSize returns the total size of the files in the archive sent by
+// the source node, or 0 if it was not sent.
+func ParseTotalSize(v string) int64 {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// CheckArchiveSize compares the compressed size of an archive, as reported by
+// the given source such as a header, with the total size of the files in the
+// archive sent by the source node. Nothing is compared if either size is not
+// known. The offending values are logged whenever the archive is larger than
+// allowed, but ErrSizeMismatch is only returned if mismatches are refused.
+func (t *Transfer) CheckArchiveSize(source string, size, total int64) error {
+	cfg := config.Get().System.Transfers
+	if size <= 0 || total <= 0 || cfg.SizeMismatch == SizeMismatchIgnore {
+		return nil
+	}
+	allowed := total + total/10 + int64(cfg.SizeMismatchAllowance)*1024*1024
+	if size <= allowed {
+		return nil
+	}
+	l := t.Log().WithFields(log.Fields{"source": source, "size": size, "total_size": total, "allowed_size": allowed})
+	if cfg.SizeMismatch != SizeMismatchRefuse {
+		l.Warn("archive is larger than the uncompressed size of its files")
+		return nil
+	}
+	l.Error("refusing transfer as the archive is larger than the uncompressed size of its files")
+	return fmt.Errorf("%w: %s is %d bytes but %s is %d bytes", ErrSizeMismatch, source, size, TotalSizeHeader, total)
+}
+
+// ErrArchiveTooSmall is returned when the archive received from the source node
+// is smaller than the configured minimum archive size.
+var ErrArchiveTooSmall = errors.New("transfer: archive received from source node is empty or too small")
+
+// RequireMinimumSize ensures that at least the configured minimum number of
+// bytes can be read from r before anything is passed along to be extracted.
+// The returned reader contains the entire contents of r.
+func RequireMinimumSize(r io.Reader) (io.Reader, error) {
+	size := config.Get().System.Transfers.MinimumArchiveSize
+	if size < 1 {
+		return r, nil
+	}
+
+	br := bufio.NewReaderSize(r, size)
+	b, err := br.Peek(size)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: received %d bytes, expected at least %d", ErrArchiveTooSmall, len(b), size)
+		}
+		return nil, err
+	}
+	return br, nil
+}
+
+// ExtractLimit returns the limit archives received from other nodes are
+// extracted with.
+func ExtractLimit() filesystem.ExtractLimit {
+	cfg := config.Get().System.Transfers
+	return filesystem.ExtractLimit{
+		MaxSize:  int64(cfg.MaxExtractedSize) * 1024 * 1024,
+		MaxRatio: int64(cfg.MaxCompressionRatio),
+	}
+}
+
+// extractedSizeTolerance is the fraction the size of the extracted server is
+// allowed to differ from the size reported by the source node. Some variance
+// is expected as files may be ignored by the target node.
+const extractedSizeTolerance = 0.05
+
+// ExpectedSize returns the total size of the files the target node should have
+// once the archive has been extracted. This is only accurate once the archive
+// has been completely written.
+func (a *Archive) ExpectedSize() int64 {
+	return int64(a.Progress().Written()) + a.existing
+}
+
+// writeSize sends the expected size of the server once extracted, allowing the
+// target node to detect an archive that was not completely extracted.
+func (a *Archive) writeSize(mp *multipart.Writer) error {
+	return mp.WriteField("size", strconv.FormatInt(a.ExpectedSize(), 10))
+}
+
+// SizeMatches reports whether the size of the extracted server is close enough
+// to the size expected by the source node.
+func SizeMatches(expected, actual int64) bool {
+	diff := expected - actual
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) <= float64(expected)*extractedSizeTolerance
+}
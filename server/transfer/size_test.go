@@ -0,0 +1,45 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestCheckArchiveSize(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("CheckArchiveSize", func() {
+		const mib = 1024 * 1024
+
+		set := func(mode string) {
+			setTransfers(config.Transfers{SizeMismatch: mode, SizeMismatchAllowance: 1})
+		}
+
+		g.It("accepts an archive within the allowance", func() {
+			set(SizeMismatchRefuse)
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.CheckArchiveSize("Content-Length", 100*mib, 100*mib)).IsNil()
+			g.Assert(trnsfr.CheckArchiveSize("Content-Length", 111*mib, 100*mib)).IsNil()
+			g.Assert(trnsfr.CheckArchiveSize("Content-Length", 500*mib, 0)).IsNil()
+		})
+
+		g.It("refuses an archive larger than its files", func() {
+			set(SizeMismatchRefuse)
+			trnsfr := New(context.Background(), &server.Server{})
+			err := trnsfr.CheckArchiveSize("Content-Length", 200*mib, 100*mib)
+			g.Assert(errors.Is(err, ErrSizeMismatch)).IsTrue()
+		})
+
+		g.It("only warns about a mismatch when configured to", func() {
+			set(SizeMismatchWarn)
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.CheckArchiveSize("Content-Length", 200*mib, 100*mib)).IsNil()
+		})
+	})
+}
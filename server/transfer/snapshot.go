@@ -0,0 +1,148 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+const (
+	btrfsSuperMagic = 0x9123683e
+	zfsSuperMagic   = 0x2fc12fc2
+
+	// btrfsSubvolumeIno is the inode number of the root of every btrfs
+	// subvolume.
+	btrfsSubvolumeIno = 256
+)
+
+// Snapshot is a copy-on-write snapshot of a server's data directory taken
+// before an incoming transfer modifies it, allowing the directory to be rolled
+// back to exactly the state it was in before the transfer.
+type Snapshot struct {
+	// kind is either "btrfs" or "zfs".
+	kind string
+	// dir is the data directory of the server.
+	dir string
+	// name is the path of the btrfs snapshot, or the name of the zfs snapshot.
+	name string
+	// dataset is the zfs dataset mounted at dir.
+	dataset string
+}
+
+// CreateSnapshot takes a snapshot of the directory if snapshots are enabled
+// and the directory is on a filesystem that supports them. The directory must
+// be the root of a btrfs subvolume or the mountpoint of a zfs dataset, so the
+// snapshot only ever contains the files of this server. If a snapshot cannot
+// be taken, nil is returned without an error.
+func CreateSnapshot(ctx context.Context, dir, id string) (*Snapshot, error) {
+	if !config.Get().System.Transfers.Snapshots {
+		return nil, nil
+	}
+	return takeSnapshot(ctx, dir, "pre-transfer-"+id)
+}
+
+// takeSnapshot takes a read-only snapshot of the directory with the given
+// suffix, returning nil if the directory is not on a filesystem that supports
+// snapshots.
+func takeSnapshot(ctx context.Context, dir, suffix string) (*Snapshot, error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(dir, &fs); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch int64(fs.Type) {
+	case btrfsSuperMagic:
+		var st unix.Stat_t
+		if err := unix.Stat(dir, &st); err != nil || st.Ino != btrfsSubvolumeIno {
+			return nil, nil
+		}
+		s := &Snapshot{kind: "btrfs", dir: dir, name: filepath.Clean(dir) + "." + suffix}
+		if _, err := run(ctx, "btrfs", "subvolume", "snapshot", "-r", dir, s.name); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case zfsSuperMagic:
+		out, err := run(ctx, "zfs", "list", "-H", "-o", "name,mountpoint", dir)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Split(strings.TrimSpace(out), "\t")
+		if len(fields) != 2 || filepath.Clean(fields[1]) != filepath.Clean(dir) {
+			return nil, nil
+		}
+		s := &Snapshot{kind: "zfs", dir: dir, dataset: fields[0], name: fields[0] + "@" + suffix}
+		if _, err := run(ctx, "zfs", "snapshot", s.name); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Name returns the path or name of the snapshot.
+func (s *Snapshot) Name() string {
+	return s.name
+}
+
+// Path returns the directory the files of the snapshot can be read from.
+func (s *Snapshot) Path() string {
+	if s.kind == "zfs" {
+		return filepath.Join(s.dir, ".zfs", "snapshot", strings.TrimPrefix(s.name, s.dataset+"@"))
+	}
+	return s.name
+}
+
+// Rollback restores the data directory to the state it was in when the
+// snapshot was taken, and then removes the snapshot.
+func (s *Snapshot) Rollback(ctx context.Context) error {
+	switch s.kind {
+	case "btrfs":
+		if _, err := run(ctx, "btrfs", "subvolume", "delete", s.dir); err != nil {
+			return err
+		}
+		if _, err := run(ctx, "btrfs", "subvolume", "snapshot", s.name, s.dir); err != nil {
+			return err
+		}
+	case "zfs":
+		if _, err := run(ctx, "zfs", "rollback", s.name); err != nil {
+			return err
+		}
+	}
+	return s.Discard(ctx)
+}
+
+// Discard removes the snapshot, leaving the data directory as it is.
+func (s *Snapshot) Discard(ctx context.Context) error {
+	switch s.kind {
+	case "btrfs":
+		_, err := run(ctx, "btrfs", "subvolume", "delete", s.name)
+		return err
+	case "zfs":
+		_, err := run(ctx, "zfs", "destroy", s.name)
+		return err
+	}
+	return nil
+}
+
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("transfer: %s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,77 @@
+package transfer
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	// minSocketBufferSize is the smallest socket buffer that will be set.
+	minSocketBufferSize = 4 * 1024
+	// maxSocketBufferSize is the largest socket buffer that will be set when
+	// the limit of the kernel cannot be read.
+	maxSocketBufferSize = 64 * 1024 * 1024
+)
+
+// kernelBufferLimit returns the maximum socket buffer size allowed by the
+// kernel from the given procfs file, or maxSocketBufferSize if it cannot be
+// read.
+func kernelBufferLimit(p string) int {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return maxSocketBufferSize
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || n < minSocketBufferSize {
+		return maxSocketBufferSize
+	}
+	return n
+}
+
+// clampSocketBuffer limits the configured buffer size to a sane range and to
+// the limit of the kernel, which would otherwise silently cap it.
+func clampSocketBuffer(size, limit int) int {
+	if size < minSocketBufferSize {
+		return minSocketBufferSize
+	}
+	if size > limit {
+		return limit
+	}
+	return size
+}
+
+// socketDialer returns a dial function that sets the read and write buffers of
+// every connection to size bytes, allowing a single connection to make use of
+// links with a large bandwidth-delay product.
+func socketDialer(size int) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	read := clampSocketBuffer(size, kernelBufferLimit("/proc/sys/net/core/rmem_max"))
+	write := clampSocketBuffer(size, kernelBufferLimit("/proc/sys/net/core/wmem_max"))
+	if read != size || write != size {
+		log.WithField("subsystem", "transfer").
+			WithFields(log.Fields{"configured": size, "read": read, "write": write}).
+			Warn("transfer socket buffer size is outside of the limits allowed by the system, it has been adjusted")
+	}
+
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if tc, ok := conn.(*net.TCPConn); ok {
+			if err := tc.SetReadBuffer(read); err != nil {
+				log.WithField("subsystem", "transfer").WithError(err).Debug("failed to set socket read buffer")
+			}
+			if err := tc.SetWriteBuffer(write); err != nil {
+				log.WithField("subsystem", "transfer").WithError(err).Debug("failed to set socket write buffer")
+			}
+		}
+		return conn, nil
+	}
+}
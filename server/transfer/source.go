@@ -2,18 +2,28 @@ package transfer
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/pterodactyl/wings/internal/progress"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
 )
 
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
 // PushArchiveToTarget POSTs the archive to the target node and returns the
 // response body.
 func (t *Transfer) PushArchiveToTarget(url, token string) ([]byte, error) {
@@ -29,23 +39,24 @@ func (t *Transfer) PushArchiveToTarget(url, token string) ([]byte, error) {
 		return nil, errors.New("failed to get archive for transfer")
 	}
 
+	client, err := httpClient()
+	if err != nil {
+		t.Error(err, "Failed to configure the connection to the destination.")
+		return nil, err
+	}
+
+	// Build the manifest before the request is made so the destination is
+	// not left waiting for the body while every file is hashed.
+	if _, err := t.FileManifest(ctx); err != nil {
+		t.Error(err, "Failed to build manifest of server files.")
+		return nil, err
+	}
+
 	t.SendMessage("Streaming archive to destination...")
 
 	// Send the upload progress to the websocket every 5 seconds.
-	ctx2, cancel2 := context.WithCancel(ctx)
-	defer cancel2()
-	go func(ctx context.Context, p *progress.Progress, tc *time.Ticker) {
-		defer tc.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-tc.C:
-				t.SendMessage("Uploading " + p.Progress(25))
-			}
-		}
-	}(ctx2, a.Progress(), time.NewTicker(5*time.Second))
+	stopProgress := t.sendProgress("Uploading ", a.Progress(), 5*time.Second)
+	defer stopProgress()
 
 	// Create a new request using the pipe as the body.
 	body, writer := io.Pipe()
@@ -55,12 +66,19 @@ func (t *Transfer) PushArchiveToTarget(url, token string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", token)
+	t.setHeaders(ctx, req, token)
 
-	// Create a new multipart writer that writes the archive to the pipe.
-	mp := multipart.NewWriter(writer)
+	// Create a new multipart writer that writes the archive to the pipe,
+	// compressing it in transit if the archive itself is not compressed.
+	tw := newTransportWriter(req, writer, t.compressTransport(a))
+	mp := multipart.NewWriter(tw)
 	defer mp.Close()
 	req.Header.Set("Content-Type", mp.FormDataContentType())
+	req.Header.Set(ChecksumsHeader, strings.Join(ChecksumAlgorithms(), ","))
+	a.setFormatHeaders(req)
+	if v := a.EstimatedSize(); v > 0 {
+		req.Header.Set(EstimatedSizeHeader, strconv.FormatInt(v, 10))
+	}
 
 	// Create a new goroutine to write the archive to the pipe used by the
 	// multipart writer.
@@ -68,72 +86,129 @@ func (t *Transfer) PushArchiveToTarget(url, token string) ([]byte, error) {
 	go func() {
 		defer close(errChan)
 		defer writer.Close()
+		defer tw.Close()
 		defer mp.Close()
 
-		src, pw := io.Pipe()
-		defer src.Close()
-		defer pw.Close()
-
-		h := sha256.New()
-		tee := io.TeeReader(src, h)
-
-		dest, err := mp.CreateFormFile("archive", "archive.tar.gz")
-		if err != nil {
-			errChan <- errors.New("failed to create form file")
+		if err := t.writeState(mp); err != nil {
+			errChan <- errors.New("failed to write server state")
+			return
+		}
+		if err := t.writeFileManifest(ctx, mp); err != nil {
+			errChan <- errors.New("failed to write file manifest")
 			return
 		}
 
-		ch := make(chan error)
-		go func() {
-			defer close(ch)
+		// Let the destination know how the archive is compressed so that it
+		// is able to pick the correct format when extracting it.
+		if err := a.writeFormat(mp); err != nil {
+			errChan <- errors.New("failed to write archive format")
+			return
+		}
 
-			if _, err := io.Copy(dest, tee); err != nil {
-				ch <- fmt.Errorf("failed to stream archive to destination: %w", err)
+		// When sending a delta, the destination must remove any files that no
+		// longer exist on this node before the archive is applied.
+		if deleted := a.Deleted(); len(deleted) > 0 {
+			v, err := json.Marshal(deleted)
+			if err == nil {
+				err = mp.WriteField("delete", string(v))
+			}
+			if err != nil {
+				errChan <- errors.New("failed to write deleted files")
 				return
 			}
+		}
 
-			t.Log().Debug("finished copying dest to tee")
-		}()
+		// Split the archive into segments that are verified by the destination
+		// as they arrive, so a corrupted archive is rejected straight away.
+		// Older target nodes would extract the segments as if they were
+		// part of the archive, so they are only sent what they understand.
+		size := config.Get().System.Transfers.SegmentSize * 1024 * 1024
+		if !t.Supports(VersionArchiveFormats) {
+			size = 0
+		}
+		if size > 0 {
+			if err := mp.WriteField("segments", SegmentsSHA256); err != nil {
+				errChan <- errors.New("failed to write archive segments")
+				return
+			}
+		}
 
-		if err := a.Stream(ctx, pw); err != nil {
-			errChan <- errors.New("failed to stream archive to pipe")
+		part, err := mp.CreateFormFile("archive", t.ArchiveName(a.Format()))
+		if err != nil {
+			errChan <- errors.New("failed to create form file")
 			return
 		}
-		t.Log().Debug("finished streaming archive to pipe")
+		dest := io.WriteCloser(nopWriteCloser{part})
+		if size > 0 {
+			dest = newSegmentWriter(part, size)
+		}
 
-		// Close the pipe writer early to release resources and ensure that the data gets flushed.
-		_ = pw.Close()
+		stream := a.Open(ctx)
+		defer stream.Close()
+		n, err := io.Copy(dest, stream)
+		if err != nil {
+			errChan <- fmt.Errorf("failed to stream archive to destination: %w", err)
+			return
+		}
+		if err := dest.Close(); err != nil {
+			errChan <- fmt.Errorf("failed to stream archive to destination: %w", err)
+			return
+		}
+		t.Log().Debug("finished streaming archive to destination")
 
-		// Wait for the copy to finish before we continue.
-		t.Log().Debug("waiting on copy to finish")
-		if err := <-ch; err != nil {
-			errChan <- err
+		if err := a.writeSize(mp); err != nil {
+			errChan <- errors.New("failed to write archive size")
 			return
 		}
 
-		if err := mp.WriteField("checksum", hex.EncodeToString(h.Sum(nil))); err != nil {
+		// Checksums using other algorithms are sent first, so the target node
+		// can verify the strongest one it supports once the SHA-256 checksum
+		// is received.
+		for algorithm, sum := range stream.Checksums() {
+			if algorithm == ChecksumSHA256 {
+				continue
+			}
+			if err := mp.WriteField("checksum_"+algorithm, sum); err != nil {
+				errChan <- errors.New("failed to stream checksum")
+				return
+			}
+		}
+		if err := t.writeTimings(mp); err != nil {
+			errChan <- errors.New("failed to write phase timings")
+			return
+		}
+		if err := t.writeChecksum(mp, stream.Checksum()); err != nil {
 			errChan <- errors.New("failed to stream checksum")
 			return
 		}
 
-		cancel2()
+		stopProgress()
 		t.SendMessage("Finished streaming archive to destination.")
 
 		if err := mp.Close(); err != nil {
 			t.Log().WithError(err).Error("error while closing multipart writer")
+		} else if err := tw.Close(); err != nil {
+			t.Log().WithError(err).Error("error while closing compressed request body")
+		} else {
+			t.markSent()
+			if tw.gz != nil {
+				logTransport(t.Log(), tw.wire.n, n)
+			}
 		}
 		t.Log().Debug("closed multipart writer")
 	}()
 
 	t.Log().Debug("sending archive to destination")
-	client := http.Client{Timeout: 0}
+	// The archive is created while it is being streamed to the destination,
+	// so the two are tracked as a single phase.
+	defer t.timings.Start(PhaseUpload)()
 	res, err := client.Do(req)
 	if err != nil {
 		t.Log().Debug("error while sending archive to destination")
 		return nil, err
 	}
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code from destination: %d", res.StatusCode)
+		return nil, unexpectedStatus(res)
 	}
 	t.Log().Debug("waiting for stream to complete")
 	select {
@@ -0,0 +1,160 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+const (
+	// SourceSnapshotOff archives the live files of the server, this is the
+	// default.
+	SourceSnapshotOff = "off"
+	// SourceSnapshotSnapshot archives a btrfs or zfs snapshot of the server,
+	// falling back to the live files if a snapshot cannot be taken.
+	SourceSnapshotSnapshot = "snapshot"
+	// SourceSnapshotCopy archives a btrfs or zfs snapshot of the server, or a
+	// copy of its files if a snapshot cannot be taken. The copy uses reflinks
+	// where the filesystem supports them.
+	SourceSnapshotCopy = "copy"
+)
+
+// sourceSnapshot is the point-in-time view of a server that an outgoing
+// transfer is archived from.
+type sourceSnapshot struct {
+	fs       *filesystem.Filesystem
+	snapshot *Snapshot
+	// copy is the directory the files were copied to if a snapshot could not
+	// be taken.
+	copy string
+}
+
+// SnapshotSource takes a snapshot of the server's files before they are
+// archived, so the archive reflects a single point in time even if something
+// writes to the files while the transfer is running. If neither a snapshot
+// nor a copy can be made, a warning is logged and the live files are used.
+func (t *Transfer) SnapshotSource(ctx context.Context) {
+	mode := config.Get().System.Transfers.SourceSnapshot
+	if mode != SourceSnapshotSnapshot && mode != SourceSnapshotCopy {
+		return
+	}
+	dir := t.Server.Filesystem().Path()
+	l := t.Log().WithField("mode", mode)
+
+	s, err := takeSnapshot(ctx, dir, "transfer-source-"+t.id)
+	if err != nil {
+		l.WithError(err).Warn("failed to take snapshot of server files")
+	}
+	if s != nil {
+		fs, err := filesystem.New(s.Path(), 0, nil)
+		if err != nil {
+			l.WithField("snapshot", s.Name()).WithError(err).Warn("failed to open snapshot of server files")
+			_ = s.Discard(context.Background())
+		} else {
+			t.source = &sourceSnapshot{fs: fs, snapshot: s}
+			l.WithField("snapshot", s.Name()).Info("archiving snapshot of server files")
+			t.SendMessage("Archiving a snapshot of the server files.")
+			return
+		}
+	}
+
+	if mode == SourceSnapshotCopy {
+		if err := t.copySource(ctx, dir); err != nil {
+			l.WithError(err).Warn("failed to copy server files")
+		} else {
+			l.WithField("path", t.source.copy).Info("archiving copy of server files")
+			t.SendMessage("Archiving a copy of the server files.")
+			return
+		}
+	}
+	l.Warn("unable to snapshot server files, archiving the live files instead")
+	t.SendMessage("Warning: unable to snapshot the server files, archiving them as they are.")
+}
+
+// copySource copies the files of the server next to its data directory, so
+// they are on the same filesystem and can share blocks with the originals if
+// reflinks are supported.
+func (t *Transfer) copySource(ctx context.Context, dir string) error {
+	usage, err := t.Server.Filesystem().DiskUsage(true)
+	if err != nil {
+		return err
+	}
+	if err := CheckSpace(filepath.Dir(dir), usage); err != nil {
+		return err
+	}
+	dst := filepath.Clean(dir) + ".transfer-source-" + t.id
+	if err := os.Mkdir(dst, 0o700); err != nil {
+		return err
+	}
+	t.SendMessage("Copying server files before archiving them...")
+	if _, err := run(ctx, "cp", "-a", "--reflink=auto", filepath.Clean(dir)+"/.", dst+"/"); err != nil {
+		_ = os.RemoveAll(dst)
+		return err
+	}
+	fs, err := filesystem.New(dst, 0, nil)
+	if err != nil {
+		_ = os.RemoveAll(dst)
+		return err
+	}
+	t.source = &sourceSnapshot{fs: fs, copy: dst}
+	return nil
+}
+
+// sourceFilesystem returns the filesystem the server is archived from.
+func (t *Transfer) sourceFilesystem() *filesystem.Filesystem {
+	if t.source != nil {
+		return t.source.fs
+	}
+	return t.Server.Filesystem()
+}
+
+// ReleaseSource removes the snapshot or copy the server was archived from.
+func (t *Transfer) ReleaseSource() {
+	if t.source == nil {
+		return
+	}
+	s := t.source
+	t.source = nil
+	_ = s.fs.UnixFS().Close()
+	if s.snapshot != nil {
+		if err := s.snapshot.Discard(context.Background()); err != nil {
+			t.Log().WithField("snapshot", s.snapshot.Name()).WithError(err).Warn("failed to remove snapshot of server files")
+		}
+	}
+	if s.copy != "" {
+		if err := os.RemoveAll(s.copy); err != nil {
+			t.Log().WithField("path", s.copy).WithError(err).Warn("failed to remove copy of server files")
+		}
+	}
+}
+
+// RemoveStaleSourceSnapshots removes the btrfs snapshots and copies of server
+// files left next to the data directories by outgoing transfers that were
+// interrupted by Wings stopping.
+func RemoveStaleSourceSnapshots(ctx context.Context) {
+	matches, _ := filepath.Glob(filepath.Join(config.Get().System.Data, "*.transfer-source-*"))
+	for _, p := range matches {
+		l := log.WithField("subsystem", "transfer").WithField("path", p)
+		var err error
+		if st, serr := os.Lstat(p); serr != nil || !st.IsDir() {
+			continue
+		}
+		var sys unix.Stat_t
+		if unix.Stat(p, &sys) == nil && sys.Ino == btrfsSubvolumeIno {
+			_, err = run(ctx, "btrfs", "subvolume", "delete", p)
+		} else {
+			err = os.RemoveAll(p)
+		}
+		if err != nil {
+			l.WithError(err).Warn("failed to remove stale snapshot of server files")
+			continue
+		}
+		l.Info("removed stale snapshot of server files")
+	}
+}
@@ -0,0 +1,50 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestSourceSnapshot(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("source snapshots", func() {
+		g.After(func() {
+			resetConfig()
+		})
+
+		g.It("returns the directory the files of a snapshot are read from", func() {
+			s := &Snapshot{kind: "zfs", dir: "/var/lib/pterodactyl/volumes/abc", dataset: "tank/abc", name: "tank/abc@transfer-source-1"}
+			g.Assert(s.Path()).Equal("/var/lib/pterodactyl/volumes/abc/.zfs/snapshot/transfer-source-1")
+
+			s = &Snapshot{kind: "btrfs", dir: "/srv/abc", name: "/srv/abc.transfer-source-1"}
+			g.Assert(s.Path()).Equal("/srv/abc.transfer-source-1")
+		})
+
+		g.It("does not snapshot a directory on an unsupported filesystem", func() {
+			s, err := takeSnapshot(context.Background(), t.TempDir(), "transfer-source-1")
+			g.Assert(err).IsNil()
+			g.Assert(s == nil).IsTrue()
+		})
+
+		g.It("removes copies left by interrupted transfers", func() {
+			data := t.TempDir()
+			setConfig(config.SystemConfiguration{Data: data})
+			stale := filepath.Join(data, "abc.transfer-source-1")
+			g.Assert(os.MkdirAll(filepath.Join(stale, "world"), 0o700)).IsNil()
+			g.Assert(os.Mkdir(filepath.Join(data, "abc"), 0o700)).IsNil()
+
+			RemoveStaleSourceSnapshots(context.Background())
+			_, err := os.Stat(stale)
+			g.Assert(os.IsNotExist(err)).IsTrue()
+			_, err = os.Stat(filepath.Join(data, "abc"))
+			g.Assert(err).IsNil()
+		})
+	})
+}
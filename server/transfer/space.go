@@ -0,0 +1,60 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/system"
+)
+
+// ErrInsufficientSpace is returned when extracting a transfer would leave less
+// free space on the disk than the configured margin.
+var ErrInsufficientSpace = errors.New("transfer: insufficient disk space")
+
+// parseFreeSpaceMargin parses the configured margin, which is either a number
+// of bytes or a percentage of total, into a number of bytes.
+func parseFreeSpaceMargin(v string, total uint64) (uint64, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	if p, ok := strings.CutSuffix(v, "%"); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || f < 0 || f > 100 {
+			return 0, fmt.Errorf("transfer: invalid free space percentage %q", v)
+		}
+		return uint64(float64(total) * f / 100), nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("transfer: invalid free space margin %q", v)
+	}
+	return n, nil
+}
+
+// CheckSpace returns ErrInsufficientSpace if writing required bytes to the
+// filesystem containing dir would leave less free space than the configured
+// margin.
+func CheckSpace(dir string, required int64) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return err
+	}
+	free := st.Bavail * uint64(st.Bsize)
+	margin, err := parseFreeSpaceMargin(config.Get().System.Transfers.MinFreeSpaceAfter, st.Blocks*uint64(st.Bsize))
+	if err != nil {
+		return err
+	}
+	if required < 0 {
+		required = 0
+	}
+	if uint64(required)+margin > free {
+		return fmt.Errorf("%w: the transfer requires %s and %s must remain free, but only %s is free on this node", ErrInsufficientSpace, system.FormatBytes(required), system.FormatBytes(int64(margin)), system.FormatBytes(int64(free)))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package transfer
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestParseFreeSpaceMargin(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("parseFreeSpaceMargin", func() {
+		g.It("returns no margin when unset", func() {
+			v, err := parseFreeSpaceMargin("", 1000)
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(uint64(0))
+		})
+
+		g.It("parses a number of bytes", func() {
+			v, err := parseFreeSpaceMargin("1048576", 1000)
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(uint64(1048576))
+		})
+
+		g.It("parses a percentage of the disk", func() {
+			v, err := parseFreeSpaceMargin("5%", 1000)
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(uint64(50))
+		})
+
+		g.It("rejects invalid values", func() {
+			_, err := parseFreeSpaceMargin("five", 1000)
+			g.Assert(err == nil).IsFalse()
+			_, err = parseFreeSpaceMargin("150%", 1000)
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
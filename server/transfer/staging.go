@@ -0,0 +1,90 @@
+package transfer
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// StagingName returns the name of the archive staged for this transfer. The
+// name is generated the first time it is requested and then remains the same
+// for the rest of the transfer, so cleanup always removes the file that was
+// actually created. If an archive name template has been configured it is
+// used instead of the staging file name.
+func (t *Transfer) StagingName(format filesystem.CompressionFormat) string {
+	if t.stagingName == "" {
+		if name, ok := t.templateName(format); ok {
+			t.stagingName = name
+			return name
+		}
+		pattern := config.Get().System.Transfers.StagingFileName
+		if pattern == "" {
+			pattern = "{server}-{transfer}"
+		}
+		name := t.replacer("").Replace(pattern)
+		// The name must never be able to escape the archive directory.
+		t.stagingName = filepath.Base(filepath.Clean("/"+name)) + format.Extension()
+	}
+	return t.stagingName
+}
+
+// ArchiveName returns the file name the archive is sent to the target node
+// with. This is "archive" followed by the extension of the format unless an
+// archive name template has been configured.
+func (t *Transfer) ArchiveName(format filesystem.CompressionFormat) string {
+	if name, ok := t.templateName(format); ok {
+		return name
+	}
+	return "archive" + format.Extension()
+}
+
+// templateName renders the configured archive name template. False is
+// returned if no template is configured, or if it does not produce a safe
+// file name, in which case the default name should be used.
+func (t *Transfer) templateName(format filesystem.CompressionFormat) (string, bool) {
+	tmpl := config.Get().System.Transfers.ArchiveNameTemplate
+	if tmpl == "" {
+		return "", false
+	}
+	name := t.replacer(format.Extension()).Replace(tmpl)
+	if !strings.Contains(tmpl, "{ext}") {
+		name += format.Extension()
+	}
+	if !isSafeFileName(name) {
+		t.Log().WithField("name", name).Warn("archive name template does not produce a safe file name, using the default name")
+		return "", false
+	}
+	return name, true
+}
+
+func (t *Transfer) replacer(ext string) *strings.Replacer {
+	node := t.SourceNode()
+	if node == "" {
+		node = config.Get().Uuid
+	}
+	return strings.NewReplacer(
+		"{server}", t.Server.ID(),
+		"{transfer}", t.id,
+		"{timestamp}", strconv.FormatInt(t.started.Unix(), 10),
+		"{node}", node,
+		"{ext}", ext,
+	)
+}
+
+// isSafeFileName returns true if the name can be used as the name of a file
+// in a directory without referring to anything outside of it.
+func isSafeFileName(name string) bool {
+	if name == "" || len(name) > 255 || strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, r := range name {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
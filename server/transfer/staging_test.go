@@ -0,0 +1,29 @@
+package transfer
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestIsSafeFileName(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("isSafeFileName", func() {
+		g.It("allows names produced by a template", func() {
+			g.Assert(isSafeFileName("1234-abcd-1700000000.tar.gz")).IsTrue()
+		})
+
+		g.It("rejects names that refer to other directories", func() {
+			g.Assert(isSafeFileName("../archive.tar.gz")).IsFalse()
+			g.Assert(isSafeFileName("backups/archive.tar.gz")).IsFalse()
+			g.Assert(isSafeFileName("backups\\archive.tar.gz")).IsFalse()
+		})
+
+		g.It("rejects empty, hidden and unprintable names", func() {
+			g.Assert(isSafeFileName("")).IsFalse()
+			g.Assert(isSafeFileName(".tar.gz")).IsFalse()
+			g.Assert(isSafeFileName("archive\n.tar.gz")).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"strconv"
+
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/server"
+)
+
+// ServerState contains the administrative state of a server that is not part
+// of its files and must be carried over to the target node so that the server
+// ends up in the same state it left the source node in.
+type ServerState struct {
+	Suspended bool `json:"suspended"`
+}
+
+// State returns the current administrative state of the server being
+// transferred.
+func (t *Transfer) State() ServerState {
+	return ServerState{Suspended: t.Server.IsSuspended()}
+}
+
+// writeState sends the identifier of the transfer, the options for the target
+// node and the state of the server to the target node. The number and total
+// size of the files being transferred are also sent so the target is able to
+// check it has enough inodes and disk space before anything is extracted. If
+// they cannot be counted the transfer continues without them, and the target
+// skips those checks.
+func (t *Transfer) writeState(mp *multipart.Writer) error {
+	if err := mp.WriteField("transfer_id", t.id); err != nil {
+		return err
+	}
+	if err := t.writeUsage(mp); err != nil {
+		return err
+	}
+	if t.autoStart {
+		if err := mp.WriteField("auto_start", "true"); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(t.State())
+	if err != nil {
+		return err
+	}
+	return mp.WriteField("state", string(b))
+}
+
+// writeUsage sends the number and total size of the files being transferred.
+func (t *Transfer) writeUsage(mp *multipart.Writer) error {
+	var include func(string) bool
+	if t.filter != nil {
+		include = t.filter.allows
+	}
+	files, size, skipped, err := countFiles(t.ctx, t.sourceFilesystem().Path(), include)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		t.Log().WithError(err).Warn("failed to count server files, the destination will not check it has space for them")
+		return nil
+	}
+	if skipped > 0 {
+		t.Log().WithField("skipped", skipped).Warn("skipped server files that could not be read while counting them")
+	}
+	if err := mp.WriteField("files", strconv.FormatUint(files, 10)); err != nil {
+		return err
+	}
+	return mp.WriteField("disk_usage", strconv.FormatInt(size, 10))
+}
+
+// ApplyState applies the state received from the source node to the server.
+func ApplyState(s *server.Server, state ServerState) {
+	if s.IsSuspended() != state.Suspended {
+		s.Config().SetSuspended(state.Suspended)
+	}
+	s.Log().WithField("subsystem", "transfer").
+		WithField("suspended", state.Suspended).
+		Info("preserved server state from source node")
+}
@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"time"
+
+	"github.com/pterodactyl/wings/remote"
+)
+
+// Direction is the direction of a transfer relative to this node.
+type Direction string
+
+const (
+	DirectionIncoming Direction = "incoming"
+	DirectionOutgoing Direction = "outgoing"
+)
+
+// APIProgress is the progress of a transfer in bytes. Total is zero if the
+// size of the transfer is not known by this node.
+type APIProgress struct {
+	Written uint64 `json:"written"`
+	Total   uint64 `json:"total"`
+}
+
+// APIResponse is the representation of an active transfer returned by the API.
+type APIResponse struct {
+	Server     string      `json:"server"`
+	Direction  Direction   `json:"direction"`
+	SourceNode string      `json:"source_node,omitempty"`
+	Status     Status      `json:"status"`
+	Priority   Priority    `json:"priority"`
+	Phase      Phase       `json:"phase"`
+	Progress   APIProgress `json:"progress"`
+	// Backups is the progress of the backups being sent by an outgoing
+	// transfer, it is only set if backups are being transferred.
+	Backups        *APIProgress `json:"backups,omitempty"`
+	StartedAt      time.Time    `json:"started_at"`
+	ElapsedSeconds int64        `json:"elapsed_seconds"`
+	// Timings is the time spent in each phase of the transfer on this node so
+	// far, in seconds.
+	Timings map[string]float64 `json:"timings"`
+}
+
+// ToAPIResponse returns the API representation of the transfer.
+func (t *Transfer) ToAPIResponse(direction Direction) APIResponse {
+	res := APIResponse{
+		Server:         t.Server.ID(),
+		Direction:      direction,
+		SourceNode:     t.sourceNode,
+		Status:         t.Status(),
+		Priority:       t.Priority(),
+		Phase:          t.timings.Current(),
+		StartedAt:      t.started,
+		ElapsedSeconds: int64(time.Since(t.started).Seconds()),
+		Timings:        t.timings.Seconds(),
+	}
+	p := t.received
+	if a := t.archive.Load(); a != nil {
+		p = a.Progress()
+	}
+	res.Progress = APIProgress{Written: p.Written(), Total: p.Total()}
+	if b := t.BackupsProgress(); b != nil {
+		res.Backups = &APIProgress{Written: b.Written(), Total: b.Total()}
+	}
+	return res
+}
+
+// Failure returns the details sent to the Panel when the transfer fails.
+func (t *Transfer) Failure(direction Direction) remote.TransferFailure {
+	res := t.ToAPIResponse(direction)
+	if t.Deleted() {
+		res.Phase = PhaseDeleted
+	}
+	return remote.TransferFailure{
+		Phase:            string(res.Phase),
+		BytesTransferred: res.Progress.Written,
+		BytesTotal:       res.Progress.Total,
+	}
+}
+
+// Active returns every incoming and outgoing transfer currently running on
+// this node.
+func Active() []APIResponse {
+	out := make([]APIResponse, 0)
+	for _, t := range Incoming().All() {
+		out = append(out, t.ToAPIResponse(DirectionIncoming))
+	}
+	for _, t := range Outgoing().All() {
+		out = append(out, t.ToAPIResponse(DirectionOutgoing))
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ArchiveStore is used by transfers to stage archives before they are sent to
+// the target node. Names are relative to the store, such as "<uuid>.tar.gz".
+type ArchiveStore interface {
+	// Open opens the archive with the given name for reading.
+	Open(name string) (io.ReadCloser, error)
+	// Create returns a writer for a new archive. The archive is only made
+	// available under the given name once the writer has been committed.
+	Create(name string) (ArchiveWriter, error)
+	// Stat returns information about the archive with the given name.
+	Stat(name string) (fs.FileInfo, error)
+	// Remove removes the archive with the given name, removing an archive that
+	// does not exist is not an error.
+	Remove(name string) error
+	// Checksum returns the hex encoded SHA-256 checksum of the archive.
+	Checksum(name string) (string, error)
+}
+
+// ArchiveWriter is returned when creating an archive in an ArchiveStore.
+type ArchiveWriter interface {
+	io.Writer
+	// Commit finishes writing the archive and makes it available.
+	Commit() error
+	// Abort discards everything that has been written.
+	Abort() error
+}
+
+// LocalArchiveStore stores archives in a directory on the local filesystem.
+type LocalArchiveStore struct {
+	dir string
+}
+
+var _ ArchiveStore = (*LocalArchiveStore)(nil)
+
+// NewLocalArchiveStore returns a store that keeps archives in the configured
+// archive directory.
+func NewLocalArchiveStore() *LocalArchiveStore {
+	return &LocalArchiveStore{dir: config.Get().System.ArchiveDirectory}
+}
+
+func (s *LocalArchiveStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
+
+// Open opens the archive with the given name for reading.
+func (s *LocalArchiveStore) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.path(name))
+}
+
+// Create writes the archive to a temporary file which is renamed to its final
+// name once committed.
+func (s *LocalArchiveStore) Create(name string) (ArchiveWriter, error) {
+	f, err := createTemporary(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return &localArchiveWriter{f: f, p: s.path(name), h: sha256.New()}, nil
+}
+
+// Stat returns information about the archive with the given name.
+func (s *LocalArchiveStore) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(s.path(name))
+}
+
+// Remove removes the archive with the given name.
+func (s *LocalArchiveStore) Remove(name string) error {
+	p := s.path(name)
+	Checksums().Forget(p)
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	includeInBackups(p)
+	return nil
+}
+
+// Checksum returns the checksum of the archive, archives created by this store
+// have their checksum calculated as they are written.
+func (s *LocalArchiveStore) Checksum(name string) (string, error) {
+	return Checksums().Sum(s.path(name))
+}
+
+type localArchiveWriter struct {
+	f *os.File
+	p string
+	h hash.Hash
+}
+
+func (w *localArchiveWriter) Write(b []byte) (int, error) {
+	n, err := w.f.Write(b)
+	w.h.Write(b[:n])
+	return n, err
+}
+
+func (w *localArchiveWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		removeTemporary(w.f.Name())
+		return err
+	}
+	// The committed archive is excluded from backups until it is removed.
+	excludeFromBackups(w.p)
+	if err := commitTemporary(w.f.Name(), w.p); err != nil {
+		includeInBackups(w.p)
+		return err
+	}
+	Checksums().Put(w.p, hex.EncodeToString(w.h.Sum(nil)))
+	return nil
+}
+
+func (w *localArchiveWriter) Abort() error {
+	_ = w.f.Close()
+	removeTemporary(w.f.Name())
+	return nil
+}
@@ -0,0 +1,69 @@
+package transfer
+
+import (
+	"context"
+	"io"
+)
+
+// ArchiveStream is a stream of the contents of an archive, the archive is
+// created as the stream is read. The checksum and size of the archive are
+// only known once the stream has been read to the end.
+//
+// No rate limiting is applied to the stream, callers that need it should wrap
+// the stream in their own limited reader.
+type ArchiveStream struct {
+	r      *io.PipeReader
+	h      *ArchiveHash
+	n      int64
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ io.ReadCloser = (*ArchiveStream)(nil)
+
+// Open returns a stream of the contents of the archive. The stream must be
+// closed once it is no longer needed, closing it before it has been read to
+// the end stops the archive from being created.
+func (a *Archive) Open(ctx context.Context) *ArchiveStream {
+	ctx, cancel := context.WithCancel(ctx)
+	r, w := io.Pipe()
+	s := &ArchiveStream{r: r, h: NewArchiveHash(ChecksumAlgorithms()), cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		_ = w.CloseWithError(a.Stream(ctx, w))
+	}()
+	return s
+}
+
+func (s *ArchiveStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.h.Write(p[:n])
+	s.n += int64(n)
+	return n, err
+}
+
+// Close stops creating the archive if it has not been read to the end, and
+// waits for everything used to create it to be released.
+func (s *ArchiveStream) Close() error {
+	s.cancel()
+	err := s.r.Close()
+	<-s.done
+	return err
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of the data read from the
+// stream.
+func (s *ArchiveStream) Checksum() string {
+	return s.h.Sum(ChecksumSHA256)
+}
+
+// Checksums returns the hex encoded checksum of the data read from the stream
+// for every configured algorithm, including SHA-256.
+func (s *ArchiveStream) Checksums() map[string]string {
+	return s.h.Sums()
+}
+
+// Size returns the number of bytes read from the stream.
+func (s *ArchiveStream) Size() int64 {
+	return s.n
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+var temporaryFiles = struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}{paths: make(map[string]struct{})}
+
+// temporaryPattern returns the pattern passed to os.CreateTemp when creating
+// the in-progress version of the given archive name.
+func temporaryPattern(name string) string {
+	pattern := config.Get().System.Transfers.TemporaryFilePattern
+	if !strings.Contains(pattern, "*") {
+		pattern += "*"
+	}
+	return name + pattern
+}
+
+// createTemporary creates a temporary file in the same directory as the final
+// archive path. It is removed automatically if Wings is stopped before it has
+// been renamed to its final name with commitTemporary.
+func createTemporary(p string) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(p), temporaryPattern(filepath.Base(p)))
+	if err != nil {
+		return nil, err
+	}
+	temporaryFiles.mu.Lock()
+	temporaryFiles.paths[f.Name()] = struct{}{}
+	temporaryFiles.mu.Unlock()
+	excludeFromBackups(f.Name())
+	return f, nil
+}
+
+// commitTemporary renames a completed temporary file to its final path.
+func commitTemporary(tmp, p string) error {
+	defer forgetTemporary(tmp)
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("transfer: failed to move completed archive into place: %w", err)
+	}
+	return nil
+}
+
+// removeTemporary removes a temporary file that will not be committed.
+func removeTemporary(tmp string) {
+	defer forgetTemporary(tmp)
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		log.WithField("path", tmp).WithError(err).Warn("transfer: failed to remove temporary file")
+	}
+}
+
+func forgetTemporary(tmp string) {
+	includeInBackups(tmp)
+	temporaryFiles.mu.Lock()
+	defer temporaryFiles.mu.Unlock()
+	delete(temporaryFiles.paths, tmp)
+}
+
+// RemoveTemporaryFiles removes every in-progress archive that has not yet been
+// completed. This is called when Wings is shutting down so that partial files
+// are never left behind and mistaken for a complete archive.
+func RemoveTemporaryFiles() {
+	temporaryFiles.mu.Lock()
+	defer temporaryFiles.mu.Unlock()
+	for p := range temporaryFiles.paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithField("path", p).WithError(err).Warn("transfer: failed to remove temporary file")
+		}
+		includeInBackups(p)
+		delete(temporaryFiles.paths, p)
+	}
+}
+
+// RemoveStaleTemporaryFiles removes any in-progress archives left in the
+// archive directory by a previous run of Wings that did not exit cleanly.
+func RemoveStaleTemporaryFiles() error {
+	dir := config.Get().System.ArchiveDirectory
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+temporaryPattern("")))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
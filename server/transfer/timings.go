@@ -0,0 +1,179 @@
+package transfer
+
+import (
+	"mime/multipart"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/remote"
+)
+
+// Phase is a named stage of a transfer that is individually timed.
+type Phase string
+
+const (
+	PhaseStop        Phase = "stop"
+	PhaseArchive     Phase = "archive"
+	PhaseUpload      Phase = "upload"
+	PhaseDownload    Phase = "download"
+	PhaseChecksum    Phase = "checksum"
+	PhaseEnvironment Phase = "environment"
+	PhaseExtract     Phase = "extract"
+	PhaseIntegrity   Phase = "integrity"
+	PhaseManifest    Phase = "manifest"
+	PhaseBackups     Phase = "backups"
+)
+
+// Timings tracks the amount of time spent in each phase of a transfer. Phases
+// are reported in the order that they were first started.
+type Timings struct {
+	mu      sync.Mutex
+	order   []Phase
+	phases  map[Phase]time.Duration
+	running map[Phase]time.Time
+	current Phase
+}
+
+// NewTimings returns a new, empty, timings tracker.
+func NewTimings() *Timings {
+	return &Timings{phases: make(map[Phase]time.Duration), running: make(map[Phase]time.Time)}
+}
+
+// Start begins timing the given phase and returns a function that should be
+// called once the phase has finished. Timing the same phase multiple times
+// will add the durations together. Calling the returned function more than
+// once, or after Stop, has no effect.
+func (t *Timings) Start(p Phase) func() {
+	started := time.Now()
+	t.mu.Lock()
+	t.current = p
+	t.running[p] = started
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if v, ok := t.running[p]; !ok || !v.Equal(started) {
+			return
+		}
+		delete(t.running, p)
+		t.add(p, time.Since(started))
+	}
+}
+
+// Stop finishes timing every phase that is still running, so a phase that was
+// left running by an error is not reported as taking longer and longer.
+func (t *Timings) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for p, started := range t.running {
+		delete(t.running, p)
+		t.add(p, time.Since(started))
+	}
+}
+
+// Add adds the given duration to the phase.
+func (t *Timings) Add(p Phase, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(p, d)
+}
+
+// add adds the given duration to the phase, the caller must hold the lock.
+func (t *Timings) add(p Phase, d time.Duration) {
+	if _, ok := t.phases[p]; !ok {
+		t.order = append(t.order, p)
+	}
+	t.phases[p] += d
+}
+
+// Current returns the phase that was most recently started.
+func (t *Timings) Current() Phase {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// Durations returns a copy of the recorded phase durations.
+func (t *Timings) Durations() map[Phase]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[Phase]time.Duration, len(t.phases))
+	for k, v := range t.phases {
+		out[k] = v
+	}
+	return out
+}
+
+// Seconds returns the time spent in each phase in seconds, including the time
+// spent so far in any phase that is still running.
+func (t *Timings) Seconds() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]float64, len(t.phases)+len(t.running))
+	for k, v := range t.phases {
+		out[string(k)] = v.Seconds()
+	}
+	for k, v := range t.running {
+		out[string(k)] += time.Since(v).Seconds()
+	}
+	return out
+}
+
+// Fields returns the recorded phase durations as structured log fields.
+func (t *Timings) Fields() log.Fields {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fields := make(log.Fields, len(t.phases))
+	for _, p := range t.order {
+		fields["phase_"+string(p)] = t.phases[p].String()
+	}
+	return fields
+}
+
+// String returns a human-readable summary of the phases, such as
+// "download 4m12s, checksum 38s, extract 2m5s".
+func (t *Timings) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, len(t.order))
+	for i, p := range t.order {
+		parts[i] = string(p) + " " + t.phases[p].Round(time.Second).String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TimingsField is the name of the form field used by the source node to send
+// the time it spent in each phase of the transfer to the target node.
+const TimingsField = "timings"
+
+// writeTimings sends the time spent in each phase of the transfer on this node
+// so the target node can include it when reporting the transfer. Phases that
+// are still running, such as the upload, are sent with the time spent in them
+// so far.
+func (t *Transfer) writeTimings(mp *multipart.Writer) error {
+	b, err := json.Marshal(t.timings.Seconds())
+	if err != nil {
+		return err
+	}
+	return mp.WriteField(TimingsField, string(b))
+}
+
+// SetSourceTimings sets the phase timings sent by the source node.
+func (t *Transfer) SetSourceTimings(v map[string]float64) {
+	t.sourceTimings = v
+}
+
+// Success returns the details sent to the Panel when the transfer completes,
+// including the time spent in each phase on both nodes.
+func (t *Transfer) Success() remote.TransferSuccess {
+	return remote.TransferSuccess{
+		DurationSeconds: time.Since(t.started).Seconds(),
+		Timings:         t.timings.Seconds(),
+		SourceTimings:   t.sourceTimings,
+		Backups:         ReceivedBackups(t.Server.ID()),
+	}
+}
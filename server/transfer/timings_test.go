@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestTimings(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("Timings", func() {
+		g.It("includes finished and running phases in seconds", func() {
+			timings := NewTimings()
+			timings.Add(PhaseStop, 1500*time.Millisecond)
+			done := timings.Start(PhaseUpload)
+
+			s := timings.Seconds()
+			g.Assert(s["stop"]).Equal(1.5)
+			_, ok := s["upload"]
+			g.Assert(ok).IsTrue()
+
+			done()
+			g.Assert(len(timings.Durations())).Equal(2)
+		})
+
+		g.It("stops the phases left running", func() {
+			timings := NewTimings()
+			done := timings.Start(PhaseDownload)
+			timings.Start(PhaseExtract)
+			timings.Stop()
+
+			d := timings.Durations()
+			g.Assert(len(d)).Equal(2)
+			// Finishing a phase once it has been stopped does not add to it.
+			time.Sleep(5 * time.Millisecond)
+			done()
+			g.Assert(timings.Durations()[PhaseDownload]).Equal(d[PhaseDownload])
+		})
+
+		g.It("is included in the status of the transfer", func() {
+			trnsfr := New(context.Background(), &server.Server{})
+			trnsfr.timings.Add(PhaseStop, time.Second)
+			g.Assert(trnsfr.ToAPIResponse(DirectionOutgoing).Timings["stop"]).Equal(1.0)
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrTLSVersion is returned for a transfer request made over a version of TLS
+// older than the minimum configured for this node.
+var ErrTLSVersion = errors.New("transfer: connection uses a TLS version below the configured minimum")
+
+// ParseTLSVersion returns the TLS version for a min_tls_version setting. Only
+// TLS 1.2 and 1.3 are accepted, older versions are never used for transfers.
+func ParseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("transfer: unsupported min_tls_version \"%s\", expected \"1.2\" or \"1.3\"", v)
+	}
+}
+
+// minTLSVersion returns the minimum TLS version configured for transfers.
+func minTLSVersion() (uint16, error) {
+	return ParseTLSVersion(config.Get().System.Transfers.MinTLSVersion)
+}
+
+// isVersionError reports whether the error is a TLS handshake failure caused
+// by the two ends of the connection not supporting a common version.
+func isVersionError(err error) bool {
+	s := err.Error()
+	return strings.Contains(s, "protocol version not supported") || strings.Contains(s, "unsupported protocol version")
+}
+
+// versionTransport explains TLS handshake failures caused by the destination
+// not supporting the minimum TLS version configured for this node.
+type versionTransport struct {
+	http.RoundTripper
+	min uint16
+}
+
+func (t versionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.RoundTripper.RoundTrip(req)
+	if err != nil && isVersionError(err) {
+		return nil, fmt.Errorf("transfer: the destination does not support %s or later, which is required by min_tls_version: %w", tls.VersionName(t.min), err)
+	}
+	return res, err
+}
+
+// RequireTLSVersion returns ErrTLSVersion if the request was received over a
+// TLS connection using a version older than the configured minimum. Requests
+// that did not reach the webserver over TLS, such as those behind a reverse
+// proxy that terminates it, are not checked.
+func RequireTLSVersion(r *http.Request) error {
+	if r.TLS == nil {
+		return nil
+	}
+	min, err := minTLSVersion()
+	if err != nil {
+		return err
+	}
+	if r.TLS.Version < min {
+		return fmt.Errorf("%w: %s is required, the connection uses %s", ErrTLSVersion, tls.VersionName(min), tls.VersionName(r.TLS.Version))
+	}
+	return nil
+}
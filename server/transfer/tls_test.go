@@ -0,0 +1,79 @@
+package transfer
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func setMinTLSVersion(v string) {
+	setTransfers(config.Transfers{MinTLSVersion: v})
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	g := Goblin(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	transport := http.DefaultTransport.(*http.Transport)
+	orig := transport.TLSClientConfig
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	defer func() {
+		transport.TLSClientConfig = orig
+	}()
+
+	g.Describe("min_tls_version", func() {
+		g.After(func() {
+			resetConfig()
+		})
+
+		g.It("connects to a destination supporting the minimum version", func() {
+			setMinTLSVersion("1.2")
+			client, err := httpClient()
+			g.Assert(err).IsNil()
+
+			res, err := client.Get(srv.URL)
+			g.Assert(err).IsNil()
+			_ = res.Body.Close()
+		})
+
+		g.It("explains a destination that does not support the minimum version", func() {
+			setMinTLSVersion("1.3")
+			client, err := httpClient()
+			g.Assert(err).IsNil()
+
+			_, err = client.Get(srv.URL)
+			g.Assert(err == nil).IsFalse()
+			g.Assert(strings.Contains(err.Error(), "does not support TLS 1.3")).IsTrue()
+		})
+
+		g.It("rejects an unsupported version", func() {
+			setMinTLSVersion("1.0")
+			_, err := httpClient()
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("rejects requests received over an older version", func() {
+			setMinTLSVersion("1.3")
+			r := httptest.NewRequest(http.MethodPost, "/api/transfers", nil)
+			r.TLS = &tls.ConnectionState{Version: tls.VersionTLS12}
+			g.Assert(errors.Is(RequireTLSVersion(r), ErrTLSVersion)).IsTrue()
+
+			r.TLS.Version = tls.VersionTLS13
+			g.Assert(RequireTLSVersion(r)).IsNil()
+
+			r.TLS = nil
+			g.Assert(RequireTLSVersion(r)).IsNil()
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package transfer
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// tokenRefreshWindow is how long before a transfer token expires that a new
+// token will be requested from the Panel.
+const tokenRefreshWindow = 5 * time.Minute
+
+// TokenRefreshFunc requests a new transfer token from the Panel.
+type TokenRefreshFunc func(ctx context.Context) (string, error)
+
+// transferToken holds the current token used to authenticate with the target
+// node, refreshing it when it is close to expiring.
+type transferToken struct {
+	mu      sync.Mutex
+	token   string
+	refresh TokenRefreshFunc
+}
+
+// SetTokenRefresh sets the function used to request a new transfer token from
+// the Panel when the current one is about to expire. This allows transfers
+// that make multiple requests to the target node over a long period of time to
+// continue without failing because the original token expired.
+func (t *Transfer) SetTokenRefresh(fn TokenRefreshFunc) {
+	t.token.mu.Lock()
+	defer t.token.mu.Unlock()
+	t.token.refresh = fn
+}
+
+// authorization returns the token that should be used for the next request to
+// the target node. The token originally provided for the transfer is used
+// until it is close to expiring, at which point a new one is requested. If a
+// new token cannot be retrieved the current token is returned and the target
+// node will reject the request if it has expired.
+func (t *Transfer) authorization(ctx context.Context, token string) string {
+	t.token.mu.Lock()
+	defer t.token.mu.Unlock()
+
+	if t.token.token == "" {
+		t.token.token = token
+	}
+	if t.token.refresh == nil {
+		return t.token.token
+	}
+
+	exp, ok := tokenExpiry(t.token.token)
+	if !ok || time.Until(exp) > tokenRefreshWindow {
+		return t.token.token
+	}
+
+	t.Log().WithField("expires_at", exp).Info("transfer token is about to expire, requesting a new token")
+	v, err := t.token.refresh(ctx)
+	if err != nil {
+		t.Log().WithError(err).Warn("failed to refresh transfer token")
+		return t.token.token
+	}
+	if !strings.HasPrefix(v, "Bearer ") {
+		v = "Bearer " + v
+	}
+	t.token.token = v
+	return v
+}
+
+// setHeaders sets the headers required by the target node on a request.
+func (t *Transfer) setHeaders(ctx context.Context, req *http.Request, token string) {
+	req.Header.Set("Authorization", t.authorization(ctx, token))
+	if id := t.SourceNode(); id != "" {
+		req.Header.Set(SourceNodeHeader, id)
+	}
+	req.Header.Set(IDHeader, t.id)
+	if SignsArchives() {
+		req.Header.Set(SignedHeader, "true")
+	}
+	req.Header.Set(VersionHeader, strconv.Itoa(Version))
+	req.Header.Set(PriorityHeader, string(t.Priority()))
+}
+
+// tokenExpiry returns the expiration time of the JWT without verifying its
+// signature, the target node is responsible for validating the token.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(strings.TrimPrefix(token, "Bearer "), ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		ExpirationTime int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil || claims.ExpirationTime == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.ExpirationTime, 0), true
+}
@@ -2,11 +2,16 @@ package transfer
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/google/uuid"
 	"github.com/mitchellh/colorstring"
 
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/internal/progress"
 	"github.com/pterodactyl/wings/server"
 	"github.com/pterodactyl/wings/system"
 )
@@ -22,6 +27,9 @@ func (s Status) String() string {
 const (
 	// StatusPending is the status of a transfer when it is first created.
 	StatusPending Status = "pending"
+	// StatusQueued is the status of a transfer that is waiting for a free
+	// transfer slot before it is started.
+	StatusQueued Status = "queued"
 	// StatusProcessing is the status of a transfer when it is currently in
 	// progress, such as when the archive is being streamed to the target node.
 	StatusProcessing Status = "processing"
@@ -46,15 +54,120 @@ type Transfer struct {
 	// cancel is used to cancel all ongoing transfer operations for the server.
 	cancel *context.CancelFunc
 
+	// id uniquely identifies this attempt at transferring the server.
+	id string
+
 	// Server associated with the transfer.
 	Server *server.Server
 	// status of the transfer.
 	status *system.Atomic[Status]
 
-	// archive is the archive that is being created for the transfer.
-	archive *Archive
+	// archive is the archive that is being created for the transfer, it is
+	// read by the API while the transfer is running.
+	archive atomic.Pointer[Archive]
+
+	// timings tracks the time spent in each phase of the transfer.
+	timings *Timings
+
+	// token is used to authenticate requests to the target node.
+	token transferToken
+
+	// started is the time the transfer was created.
+	started time.Time
+	// received tracks the bytes of the archive received by the target node.
+	received *progress.Progress
+
+	// store is used to stage archives before they are sent to the target.
+	store ArchiveStore
+
+	// sourceNode is the identifier of the node the server is being
+	// transferred from.
+	sourceNode string
+
+	// stagingName is the name of the archive staged for this transfer.
+	stagingName string
+
+	// autoStart is set if the server should be started on the target node
+	// once the transfer has completed.
+	autoStart bool
+
+	// priority controls when the transfer is started if every transfer slot
+	// is in use.
+	priority Priority
+
+	// logs throttles the progress messages sent to the server's console.
+	logs messageThrottle
+	// queue publishes messages to the server's console without blocking the
+	// transfer.
+	queue logQueue
+
+	// filter limits the files of the server that are transferred, if set.
+	filter *PathFilter
+
+	// sourceTimings is the time the source node spent in each phase of an
+	// incoming transfer, in seconds.
+	sourceTimings map[string]float64
+
+	// fileManifest is the manifest of the files sent by an outgoing transfer,
+	// it is only built if manifests are enabled.
+	fileManifest Manifest
+
+	// source is the snapshot an outgoing transfer is archived from, if one
+	// was taken.
+	source *sourceSnapshot
+
+	// sent is set once an outgoing transfer no longer needs the server's
+	// files, as everything has been sent to the target node.
+	sent atomic.Bool
+	// deleted is set if the transfer was aborted because its server was
+	// deleted.
+	deleted atomic.Bool
+	// backups tracks the progress of the backups sent by an outgoing
+	// transfer, if any are being sent.
+	backups atomic.Pointer[progress.Progress]
+	// version is the transfer version agreed with the target node of an
+	// outgoing transfer, or zero if none has been negotiated.
+	version int
+	// transport reads the body of an incoming transfer, recording how much of
+	// it was received over the wire.
+	transport *transportReader
+
+	// logFile is the persisted log of the transfer.
+	logFile logFile
+
+	// force is set when the archive must be created from the current files of
+	// the server, ignoring any cached blobs or partial archive.
+	force bool
+
+	// retained is the name of the staged archive kept after an outgoing
+	// transfer succeeded, which must not be removed along with the transfer.
+	retained string
+
+	// done is closed once the transfer has been removed from its manager.
+	done     chan struct{}
+	doneOnce sync.Once
 }
 
+// SourceNodeHeader is the header used by the source node to identify itself
+// to the target node. It is not authenticated, so target nodes take the
+// identity of the source node from the transfer token instead and the header
+// is only sent for older nodes.
+const SourceNodeHeader = "X-Transfer-Source-Node"
+
+// IDHeader is the header used by the source node to send the identifier of
+// the transfer, allowing the logs of both nodes to be correlated.
+const IDHeader = "X-Transfer-Id"
+
+// PriorityHeader is the header used by the source node to send the priority
+// of the transfer, which determines its share of the bandwidth available to
+// transfers on the target node.
+const PriorityHeader = "X-Transfer-Priority"
+
+// EstimatedSizeHeader is the header used to send the approximate size of an
+// archive whose exact size is not known until it has been created, such as an
+// archive that is compressed as it is being sent.
+const EstimatedSizeHeader = "X-Estimated-Size"
+
 // New returns a new transfer instance for the given server.
 func New(ctx context.Context, s *server.Server) *Transfer {
 	ctx, cancel := context.WithCancel(ctx)
@@ -63,9 +176,33 @@ func New(ctx context.Context, s *server.Server) *Transfer {
 		ctx:    ctx,
 		cancel: &cancel,
 
-		Server: s,
-		status: system.NewAtomic(StatusPending),
+		id:      uuid.NewString(),
+		Server:  s,
+		status:  system.NewAtomic(StatusPending),
+		timings: NewTimings(),
+
+		started:  time.Now(),
+		received: progress.NewProgress(0),
+		done:     make(chan struct{}),
+	}
+}
+
+// ID returns the unique identifier of this transfer. A new identifier is
+// generated for every attempt, including retries of the same server.
+func (t *Transfer) ID() string {
+	return t.id
+}
+
+// SetID sets the identifier of the transfer to the one generated by the source
+// node so that both nodes use the same identifier. Anything that is not a
+// valid UUID is ignored.
+func (t *Transfer) SetID(id string) {
+	if _, err := uuid.Parse(id); err != nil {
+		return
 	}
+	old := t.id
+	t.id = id
+	t.renameLog(old)
 }
 
 // Context returns the context for the transfer.
@@ -73,6 +210,85 @@ func (t *Transfer) Context() context.Context {
 	return t.ctx
 }
 
+// Timings returns the phase timings tracker for the transfer.
+func (t *Transfer) Timings() *Timings {
+	return t.timings
+}
+
+// ArchiveStore returns the store used to stage archives for the transfer,
+// defaulting to the local archive directory.
+func (t *Transfer) ArchiveStore() ArchiveStore {
+	if t.store == nil {
+		t.store = NewLocalArchiveStore()
+	}
+	return t.store
+}
+
+// SetArchiveStore sets the store used to stage archives for the transfer.
+func (t *Transfer) SetArchiveStore(s ArchiveStore) {
+	t.store = s
+}
+
+// Received returns the progress of the archive being received from the
+// source node.
+func (t *Transfer) Received() *progress.Progress {
+	return t.received
+}
+
+// ReportProgress sends the progress to the server's console every 5 seconds
+// until the returned function is called.
+func (t *Transfer) ReportProgress(prefix string, p *progress.Progress) func() {
+	return t.sendProgress(prefix, p, 5*time.Second)
+}
+
+// sendProgress sends the progress to the server's console every interval until
+// the returned function is called. A final update is sent once it has been
+// called, so a transfer that completes before the first tick still reports
+// its progress. The returned function blocks until the final update has been
+// sent and is safe to call more than once.
+func (t *Transfer) sendProgress(prefix string, p *progress.Progress, interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tc := time.NewTicker(interval)
+		defer tc.Stop()
+		for {
+			select {
+			case <-stop:
+				t.SendMessage(prefix + p.Progress(25))
+				return
+			case <-tc.C:
+				t.sendProgressMessage(prefix + p.Progress(25))
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+		})
+		<-done
+	}
+}
+
+// LogTimings logs the time spent in each phase of the transfer as structured
+// fields and sends a summary of them to the server's console.
+func (t *Transfer) LogTimings() {
+	summary := t.timings.String()
+	if summary == "" {
+		return
+	}
+	fields := t.timings.Fields()
+	for k, v := range t.sourceTimings {
+		fields["source_phase_"+k] = (time.Duration(v * float64(time.Second))).Round(time.Millisecond).String()
+	}
+	fields["duration"] = time.Since(t.started).Round(time.Millisecond).String()
+	t.Log().WithFields(fields).Info("transfer phase timings")
+	t.SendMessage("Phase timings: " + summary)
+}
+
 // Cancel cancels the transfer.
 func (t *Transfer) Cancel() {
 	status := t.Status()
@@ -102,15 +318,90 @@ func (t *Transfer) SetStatus(s Status) {
 	// If we are cancelling, then we can't go back to processing.
 	t.status.Store(s)
 
+	// Terminal statuses are always published directly, after giving any queued
+	// log messages a chance to be sent first.
+	if s == StatusCompleted || s == StatusFailed || s == StatusCancelled {
+		t.timings.Stop()
+		t.flushLogs(terminalFlushTimeout)
+		t.closeLog()
+	}
 	t.Server.Events().Publish(server.TransferStatusEvent, s)
 }
 
-// SendMessage sends a message to the server's console.
+// SourceNode returns the identifier of the node the server is being
+// transferred from, if it is known.
+func (t *Transfer) SourceNode() string {
+	return t.sourceNode
+}
+
+// SetSourceNode sets the identifier of the node the server is being
+// transferred from.
+func (t *Transfer) SetSourceNode(id string) {
+	t.sourceNode = id
+}
+
+// AutoStart returns true if the server should be started on the target node
+// once the transfer has completed.
+func (t *Transfer) AutoStart() bool {
+	return t.autoStart
+}
+
+// SetAutoStart sets if the server should be started on the target node once
+// the transfer has completed.
+func (t *Transfer) SetAutoStart(v bool) {
+	t.autoStart = v
+}
+
+// SetForce sets if the archive of the server should be rebuilt from its
+// current files, bypassing the blob cache and any archive checkpoint left by
+// a previous transfer.
+func (t *Transfer) SetForce(v bool) {
+	t.force = v
+}
+
+// Start starts the server once it has been transferred to this node. The
+// transfer has already completed, so a failure to start the server is only
+// reported as a warning and does not affect the result of the transfer.
+func (t *Transfer) Start() {
+	t.SendMessage("Starting server...")
+	if err := t.Server.HandlePowerAction(server.PowerActionStart); err != nil {
+		t.Log().WithError(err).Warn("failed to start server after transfer")
+		t.SendMessage("Warning: the transfer completed successfully but the server could not be started: " + err.Error())
+		return
+	}
+	t.SendMessage("Server started.")
+}
+
+// SendMessage sends a message to the server's console. Messages sent using
+// this are never throttled, only progress updates are.
 func (t *Transfer) SendMessage(v string) {
-	t.Server.Events().Publish(
-		server.TransferLogsEvent,
-		colorstring.Color("[yellow][bold]"+time.Now().Format(time.RFC1123)+" [Transfer System] [Source Node]:[default] "+v),
-	)
+	t.sendImportantMessage(v)
+}
+
+// publish queues the message to be sent to the console of the server, and
+// writes it to the persisted log of the transfer.
+func (t *Transfer) publish(v string) {
+	t.record(v)
+	t.enqueue(t.format(v))
+}
+
+// format adds the prefix identifying the transfer to a console message.
+func (t *Transfer) format(v string) string {
+	c := colorstring.Colorize{
+		Colors:  colorstring.DefaultColors,
+		Disable: config.Get().System.Transfers.PlainLogs,
+		Reset:   true,
+	}
+	return c.Color("[yellow][bold]" + time.Now().Format(time.RFC1123) + " [Transfer System] [" + t.nodeName() + "] [Transfer " + t.id + "]:[default] " + v)
+}
+
+// nodeName returns the name of the node messages of the transfer are sent by.
+func (t *Transfer) nodeName() string {
+	node := "Source Node"
+	if t.sourceNode != "" {
+		node += " " + t.sourceNode
+	}
+	return node
 }
 
 // Error logs an error that occurred on the source node.
@@ -121,8 +412,12 @@ func (t *Transfer) Error(err error, v string) {
 
 // Log returns a logger for the transfer.
 func (t *Transfer) Log() *log.Entry {
-	if t.Server == nil {
-		return log.WithField("subsystem", "transfer")
+	entry := log.WithField("subsystem", "transfer")
+	if t.Server != nil {
+		entry = t.Server.Log().WithField("subsystem", "transfer")
+	}
+	if t.sourceNode != "" {
+		entry = entry.WithField("source_node", t.sourceNode)
 	}
-	return t.Server.Log().WithField("subsystem", "transfer")
+	return entry.WithField("transfer_id", t.id)
 }
@@ -0,0 +1,162 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+// TransportEncoding is the Content-Encoding used when the request an archive
+// is sent with is compressed in transit.
+const TransportEncoding = "gzip"
+
+// ErrUnsupportedEncoding is returned when the request an archive is sent with
+// is compressed in a way this node is unable to decompress.
+var ErrUnsupportedEncoding = errors.New("transfer: unsupported content encoding")
+
+// CheckTransportEncoding returns ErrUnsupportedEncoding if the Content-Encoding
+// of an incoming transfer cannot be decompressed by this node.
+func CheckTransportEncoding(v string) error {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "identity", TransportEncoding:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedEncoding, v)
+}
+
+// Uncompressed returns true if the contents of the archive are stored without
+// being compressed, either because no compression format is used or because
+// the compression level is "none".
+func (a *Archive) Uncompressed() bool {
+	return a.Format() == filesystem.CompressionNone || config.Get().System.Backups.CompressionLevel == "none"
+}
+
+// compressTransport returns true if the request the archive is sent to the
+// target node with should be compressed in transit. This is only done for
+// archives that are not already compressed, and only if the target node is
+// able to decompress the request.
+func (t *Transfer) compressTransport(a *Archive) bool {
+	if !config.Get().System.Transfers.TransportCompression || !a.Uncompressed() {
+		return false
+	}
+	if !t.Supports(VersionTransportCompression) {
+		t.Log().WithField("version", t.Version()).Warn("destination does not support compressed transfers, sending the archive uncompressed")
+		return false
+	}
+	return true
+}
+
+// transportWriter wraps the writer used for the body of an outgoing transfer,
+// compressing everything written to it if the request is compressed in
+// transit. It must be closed before the underlying writer for the compressed
+// body to be complete.
+type transportWriter struct {
+	io.Writer
+	gz *gzip.Writer
+	// wire is the number of bytes written to the underlying writer.
+	wire countingWriter
+}
+
+// newTransportWriter returns a writer for the body of req. If compress is true
+// the Content-Encoding of the request is set and the body is compressed with
+// gzip at its fastest level, as the archive was left uncompressed to save CPU.
+func newTransportWriter(req *http.Request, w io.Writer, compress bool) *transportWriter {
+	tw := &transportWriter{}
+	out := io.MultiWriter(w, &tw.wire)
+	if !compress {
+		tw.Writer = out
+		return tw
+	}
+	req.Header.Set("Content-Encoding", TransportEncoding)
+	tw.gz, _ = gzip.NewWriterLevel(out, gzip.BestSpeed)
+	tw.Writer = tw.gz
+	return tw
+}
+
+// Close flushes the remaining compressed data to the underlying writer.
+func (w *transportWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// transportReader decompresses the body of an incoming transfer that was
+// compressed in transit, counting the bytes received over the wire.
+type transportReader struct {
+	r    io.Reader
+	gz   *gzip.Reader
+	wire int64
+	// compressed is true if the body is decompressed, the gzip reader is only
+	// created on the first read so creating it does not block on the body.
+	compressed bool
+}
+
+// DecodeTransport returns a reader for the body of an incoming transfer sent
+// with the given Content-Encoding, which must have been checked with
+// CheckTransportEncoding. The reader returns the body as it was before it was
+// compressed in transit, while the bytes read from r are recorded so they can
+// be compared with the size of the archive once it has been received.
+func (t *Transfer) DecodeTransport(r io.Reader, encoding string) io.Reader {
+	t.transport = &transportReader{r: r, compressed: strings.EqualFold(strings.TrimSpace(encoding), TransportEncoding)}
+	return t.transport
+}
+
+func (r *transportReader) Read(p []byte) (int, error) {
+	if !r.compressed {
+		return r.readWire(p)
+	}
+	if r.gz == nil {
+		gz, err := gzip.NewReader(wireReader{r})
+		if err != nil {
+			return 0, fmt.Errorf("transfer: failed to decompress transfer: %w", err)
+		}
+		r.gz = gz
+	}
+	return r.gz.Read(p)
+}
+
+func (r *transportReader) readWire(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.wire += int64(n)
+	return n, err
+}
+
+// wireReader reads the compressed body of a transportReader.
+type wireReader struct {
+	r *transportReader
+}
+
+func (w wireReader) Read(p []byte) (int, error) {
+	return w.r.readWire(p)
+}
+
+// logTransport logs the number of bytes sent over the wire compared to the
+// size of the archive, for transfers compressed in transit.
+func logTransport(l *log.Entry, wire, archive int64) {
+	if wire <= 0 || archive <= 0 {
+		return
+	}
+	l.WithFields(log.Fields{
+		"wire_bytes":    wire,
+		"archive_bytes": archive,
+		"ratio":         fmt.Sprintf("%.2f", float64(wire)/float64(archive)),
+	}).Info("archive was compressed in transit")
+}
+
+// LogTransport logs how much the archive received by this node was reduced in
+// size by being compressed in transit. Nothing is logged if it was not.
+func (t *Transfer) LogTransport() {
+	if t.transport == nil || !t.transport.compressed {
+		return
+	}
+	logTransport(t.Log(), t.transport.wire, int64(t.Received().Written()))
+}
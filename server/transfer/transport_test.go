@@ -0,0 +1,67 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestTransportCompression(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("transport compression", func() {
+		g.BeforeEach(func() {
+			resetConfig()
+		})
+
+		g.It("only accepts encodings this node can decompress", func() {
+			g.Assert(CheckTransportEncoding("")).IsNil()
+			g.Assert(CheckTransportEncoding("identity")).IsNil()
+			g.Assert(CheckTransportEncoding("GZIP")).IsNil()
+			g.Assert(errors.Is(CheckTransportEncoding("br"), ErrUnsupportedEncoding)).IsTrue()
+		})
+
+		g.It("decompresses a body compressed in transit", func() {
+			req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+			content := strings.Repeat("uncompressed archive contents ", 4096)
+
+			var buf bytes.Buffer
+			tw := newTransportWriter(req, &buf, true)
+			_, err := io.WriteString(tw, content)
+			g.Assert(err).IsNil()
+			g.Assert(tw.Close()).IsNil()
+			g.Assert(req.Header.Get("Content-Encoding")).Equal(TransportEncoding)
+			g.Assert(tw.wire.n).Equal(int64(buf.Len()))
+			g.Assert(tw.wire.n < int64(len(content))).IsTrue()
+
+			trnsfr := New(context.Background(), &server.Server{})
+			b, err := io.ReadAll(trnsfr.DecodeTransport(&buf, req.Header.Get("Content-Encoding")))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal(content)
+			g.Assert(trnsfr.transport.wire).Equal(tw.wire.n)
+		})
+
+		g.It("passes through a body that was not compressed", func() {
+			req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+
+			var buf bytes.Buffer
+			tw := newTransportWriter(req, &buf, false)
+			_, _ = io.WriteString(tw, "archive")
+			g.Assert(tw.Close()).IsNil()
+			g.Assert(req.Header.Get("Content-Encoding")).Equal("")
+
+			trnsfr := New(context.Background(), &server.Server{})
+			b, err := io.ReadAll(trnsfr.DecodeTransport(&buf, ""))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("archive")
+		})
+	})
+}
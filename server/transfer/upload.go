@@ -0,0 +1,330 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/uuid"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// UploadChecksumHeader is the header used by the source node to send the hex
+// encoded SHA-256 checksum of the archive being uploaded, which identifies the
+// upload on the target node.
+const UploadChecksumHeader = "X-Upload-Checksum"
+
+// UploadOffsetHeader is the header used by the source node to send the offset
+// within the archive of the chunk being uploaded.
+const UploadOffsetHeader = "X-Upload-Offset"
+
+// UploadLengthHeader is the header used by the source node to send the size of
+// the whole archive being uploaded.
+const UploadLengthHeader = "X-Upload-Length"
+
+var (
+	// ErrUploadsUnsupported is returned when the target node does not accept
+	// archives uploaded in chunks.
+	ErrUploadsUnsupported = errors.New("transfer: destination does not accept archive uploads")
+	// ErrUploadOffset is returned when a chunk does not start at the end of
+	// what the target node has received of the archive so far.
+	ErrUploadOffset = errors.New("transfer: chunk does not start at the end of the upload")
+	// ErrUploadChecksum is returned when an uploaded archive does not match its
+	// checksum once all of it has been received.
+	ErrUploadChecksum = errors.New("transfer: uploaded archive checksum does not match")
+	// ErrUploadIncomplete is returned when an archive is used before all of it
+	// has been uploaded.
+	ErrUploadIncomplete = errors.New("transfer: archive upload is not complete")
+	// ErrUploadLength is returned when a chunk declares a different length for
+	// the archive than the first chunk of the upload did.
+	ErrUploadLength = errors.New("transfer: chunk does not match the length of the upload")
+)
+
+// UploadStatus is how much of an archive the target node has received.
+type UploadStatus struct {
+	// Offset is the number of bytes of the archive that have been received,
+	// the next chunk must start at this offset.
+	Offset int64 `json:"offset"`
+	// Complete is true once all of the archive has been received and it has
+	// been verified against its checksum.
+	Complete bool `json:"complete"`
+}
+
+// uploadLock serializes the chunks received for a single upload, refs is the
+// number of callers holding or waiting for it.
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// uploadLocks are the locks of the uploads currently being used, a lock is
+// removed once nothing holds or waits for it.
+var uploadLocks = struct {
+	mu      sync.Mutex
+	uploads map[string]*uploadLock
+}{uploads: make(map[string]*uploadLock)}
+
+func uploadDirectory() string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, "uploads")
+}
+
+// uploadPaths returns the path of the partially received archive and the path
+// it is moved to once it is complete. The declared length of a partially
+// received archive is stored next to it, see lengthPath.
+func uploadPaths(server, checksum string) (string, string, error) {
+	if _, err := uuid.Parse(server); err != nil {
+		return "", "", fmt.Errorf("transfer: invalid server uuid \"%s\"", server)
+	}
+	if !chunkHashRegex.MatchString(checksum) {
+		return "", "", fmt.Errorf("transfer: invalid upload checksum \"%s\"", checksum)
+	}
+	p := filepath.Join(uploadDirectory(), server+"-"+checksum)
+	return p + ".part", p + ".upload", nil
+}
+
+// lengthPath returns the path the length of the archive declared by the first
+// chunk of an upload is stored at.
+func lengthPath(part string) string {
+	return strings.TrimSuffix(part, ".part") + ".length"
+}
+
+func lockUpload(p string) func() {
+	uploadLocks.mu.Lock()
+	l, ok := uploadLocks.uploads[p]
+	if !ok {
+		l = &uploadLock{}
+		uploadLocks.uploads[p] = l
+	}
+	l.refs++
+	uploadLocks.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		uploadLocks.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(uploadLocks.uploads, p)
+		}
+		uploadLocks.mu.Unlock()
+	}
+}
+
+// checkLength stores the length of the archive declared by the first chunk of
+// an upload, and returns ErrUploadLength if a later chunk declares another.
+func checkLength(part string, length int64) error {
+	b, err := os.ReadFile(lengthPath(part))
+	if os.IsNotExist(err) {
+		if err := os.WriteFile(lengthPath(part), []byte(strconv.FormatInt(length, 10)), 0o600); err != nil {
+			return fmt.Errorf("transfer: failed to store upload length: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("transfer: failed to read upload length: %w", err)
+	}
+	if v, err := strconv.ParseInt(string(b), 10, 64); err != nil || v != length {
+		return ErrUploadLength
+	}
+	return nil
+}
+
+// Upload returns how much of the archive with the given checksum has been
+// uploaded for the server. An empty checksum is accepted, allowing the source
+// node to check the target node supports uploads before creating its archive.
+func Upload(server, checksum string) (UploadStatus, error) {
+	if checksum == "" {
+		return UploadStatus{}, nil
+	}
+	part, complete, err := uploadPaths(server, checksum)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	defer lockUpload(part)()
+	return uploadStatus(part, complete)
+}
+
+func uploadStatus(part, complete string) (UploadStatus, error) {
+	if st, err := os.Stat(complete); err == nil {
+		return UploadStatus{Offset: st.Size(), Complete: true}, nil
+	}
+	st, err := os.Stat(part)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return UploadStatus{}, nil
+		}
+		return UploadStatus{}, err
+	}
+	return UploadStatus{Offset: st.Size()}, nil
+}
+
+// ReceiveUpload appends a chunk of the archive with the given checksum, which
+// is length bytes in total, to the upload for the server. The chunk must start
+// at offset, otherwise ErrUploadOffset is returned along with the offset the
+// next chunk must start at. Whatever is read from r is kept even if the chunk
+// is cut short, allowing the source node to continue from where it stopped.
+// Once the whole archive has been received it is verified against the
+// checksum, if it does not match it is removed and ErrUploadChecksum is
+// returned. ErrUploadLength is returned if length differs from the length
+// sent with the first chunk.
+func ReceiveUpload(ctx context.Context, server, checksum string, offset, length int64, r io.Reader) (UploadStatus, error) {
+	part, complete, err := uploadPaths(server, checksum)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	if offset < 0 || length < 1 || offset > length {
+		return UploadStatus{}, fmt.Errorf("transfer: invalid upload offset %d for an archive of %d bytes", offset, length)
+	}
+	defer lockUpload(part)()
+
+	status, err := uploadStatus(part, complete)
+	if err != nil {
+		return status, err
+	}
+	if status.Complete {
+		_, _ = io.Copy(io.Discard, r)
+		return status, nil
+	}
+	if status.Offset != offset {
+		return status, ErrUploadOffset
+	}
+	if offset == 0 {
+		if err := EnsureArchiveDirectory(); err != nil {
+			return status, err
+		}
+		if err := HasArchiveSpace(server, length); err != nil {
+			return status, err
+		}
+		if err := os.MkdirAll(uploadDirectory(), 0o700); err != nil {
+			return status, fmt.Errorf("transfer: failed to create upload directory: %w", err)
+		}
+	}
+	if err := checkLength(part, length); err != nil {
+		return status, err
+	}
+
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return status, fmt.Errorf("transfer: failed to open upload: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(LimitReader(r), length-offset))
+	status.Offset += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || status.Offset < length {
+		return status, err
+	}
+
+	sum, err := fileChecksum(ctx, part)
+	if err != nil {
+		return status, err
+	}
+	if sum != checksum {
+		_ = os.Remove(part)
+		_ = os.Remove(lengthPath(part))
+		return UploadStatus{}, ErrUploadChecksum
+	}
+	if err := os.Rename(part, complete); err != nil {
+		return status, fmt.Errorf("transfer: failed to move completed upload into place: %w", err)
+	}
+	_ = os.Remove(lengthPath(part))
+	log.WithField("subsystem", "transfer").WithField("server", server).WithField("size", length).Info("received archive uploaded by source node")
+	status.Complete = true
+	return status, nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of the file at p,
+// stopping early if ctx is canceled.
+func fileChecksum(ctx context.Context, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	buf := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// OpenUpload opens the archive with the given checksum uploaded for the server,
+// ErrUploadIncomplete is returned if it has not been completely received.
+func OpenUpload(server, checksum string) (*os.File, error) {
+	_, complete, err := uploadPaths(server, checksum)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(complete)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadIncomplete
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// RemoveUpload removes the archive with the given checksum uploaded for the
+// server, along with anything partially received.
+func RemoveUpload(server, checksum string) {
+	part, complete, err := uploadPaths(server, checksum)
+	if err != nil {
+		return
+	}
+	defer lockUpload(part)()
+	for _, p := range []string{part, lengthPath(part), complete} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithField("subsystem", "transfer").WithField("path", p).WithError(err).Warn("failed to remove uploaded archive")
+		}
+	}
+}
+
+// RemoveStaleUploads removes uploads that have not received anything for
+// longer than archive checkpoints are kept for, as the source node has most
+// likely given up on them.
+func RemoveStaleUploads() error {
+	entries, err := os.ReadDir(uploadDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".part") && !strings.HasSuffix(e.Name(), ".upload") && !strings.HasSuffix(e.Name(), ".length") {
+			continue
+		}
+		st, err := e.Info()
+		if err != nil || time.Since(st.ModTime()) <= checkpointMaxAge() {
+			continue
+		}
+		log.WithField("subsystem", "transfer").WithField("upload", e.Name()).Info("removing stale archive upload")
+		if err := os.Remove(filepath.Join(uploadDirectory(), e.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/juju/ratelimit"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/internal/progress"
+)
+
+// uploadRetryDelay is the delay before the first retry of a chunk that failed
+// to be uploaded, it is doubled after every attempt up to uploadMaxRetryDelay.
+var (
+	uploadRetryDelay    = time.Second
+	uploadMaxRetryDelay = 30 * time.Second
+)
+
+// UploadURL returns the URL used to upload an archive to the target node for
+// the given transfer URL.
+func UploadURL(url string) string {
+	return strings.TrimSuffix(url, "/") + "/upload"
+}
+
+// PushArchiveUploaded archives the server to the local archive directory and
+// then uploads it to the target node in chunks. Every chunk that fails to be
+// sent is continued from the last byte the target node received, so a lost
+// connection does not mean starting the transfer over. Once all of the archive
+// has been received and verified by the target node it is told to extract it.
+//
+// If the target node does not accept uploads the archive is streamed to it
+// instead, in the same way as PushArchiveToTarget.
+func (t *Transfer) PushArchiveUploaded(url, token string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	if _, err := t.uploadStatus(ctx, url, token, ""); err != nil {
+		if !errors.Is(err, ErrUploadsUnsupported) {
+			return nil, err
+		}
+		t.Log().WithError(err).Info("unable to upload archive, falling back to streaming it")
+		t.SendMessage("Destination does not accept uploads, streaming server data instead...")
+		return t.PushArchiveToTarget(url, token)
+	}
+
+	t.SendMessage("Preparing to upload server data to destination...")
+	t.SetStatus(StatusProcessing)
+
+	if err := EnsureArchiveDirectory(); err != nil {
+		t.Error(err, "Failed to prepare archive directory for transfer.")
+		return nil, err
+	}
+
+	a, err := t.Archive()
+	if err != nil {
+		t.Error(err, "Failed to get archive for transfer.")
+		return nil, errors.New("failed to get archive for transfer")
+	}
+
+	if err := t.reserveArchiveSpace(int64(a.Progress().Total())); err != nil {
+		t.Error(err, "Not enough space in the archive directory for transfer.")
+		return nil, err
+	}
+	defer t.releaseArchiveSpace()
+
+	store := t.ArchiveStore()
+	name := t.StagingName(a.Format())
+	defer t.removeArchive(store, name)
+
+	t.SendMessage("Creating archive of server data...")
+	done := t.timings.Start(PhaseArchive)
+	checksum, err := t.writeArchive(ctx, a, store, name)
+	done()
+	if err != nil {
+		t.Error(err, "Failed to create archive for transfer.")
+		return nil, err
+	}
+
+	done = t.timings.Start(PhaseUpload)
+	t.SendMessage("Uploading archive to destination...")
+	err = t.uploadToTarget(ctx, url, token, store, name, checksum)
+	done()
+	if err != nil {
+		t.Error(err, "Failed to upload archive to destination.")
+		return nil, err
+	}
+	t.SendMessage("Finished uploading archive to destination.")
+
+	// Build the request for the target node, the archive is referenced by its
+	// checksum rather than being included in the request body.
+	var buf bytes.Buffer
+	mp := multipart.NewWriter(&buf)
+	if err := t.writeState(mp); err != nil {
+		return nil, err
+	}
+	if err := t.writeFileManifest(ctx, mp); err != nil {
+		return nil, err
+	}
+	if err := a.writeFormat(mp); err != nil {
+		return nil, err
+	}
+	if err := mp.WriteField("archive_upload", checksum); err != nil {
+		return nil, err
+	}
+	if err := a.writeSize(mp); err != nil {
+		return nil, err
+	}
+	if err := t.writeTimings(mp); err != nil {
+		return nil, err
+	}
+	if err := t.writeChecksum(mp, checksum); err != nil {
+		return nil, err
+	}
+	if err := mp.Close(); err != nil {
+		return nil, err
+	}
+	t.markSent()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(ctx, req, token)
+	req.Header.Set("Content-Type", mp.FormDataContentType())
+	a.setFormatHeaders(req)
+
+	t.Log().Debug("notifying destination of uploaded archive")
+	t.SendMessage("Waiting for destination to extract archive...")
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, context.Canceled
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(res)
+	}
+	v, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	t.retainArchive(store, name, checksum)
+	return v, nil
+}
+
+// uploadToTarget sends the archive in the store to the target node in chunks,
+// starting from whatever the target node has already received of it.
+func (t *Transfer) uploadToTarget(ctx context.Context, url, token string, store ArchiveStore, name, checksum string) error {
+	f, err := store.Open(name)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to open local archive: %w", err)
+	}
+	defer f.Close()
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return errors.New("transfer: archive store does not support reading archives from an offset")
+	}
+
+	st, err := store.Stat(name)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to stat local archive: %w", err)
+	}
+	size := st.Size()
+
+	cfg := config.Get().System.Transfers
+	chunk := int64(cfg.UploadChunkSize) * 1024 * 1024
+	if chunk <= 0 {
+		chunk = 16 * 1024 * 1024
+	}
+	var bucket *ratelimit.Bucket
+	if limit := int64(cfg.UploadLimit) * 1024 * 1024; limit > 0 {
+		bucket = ratelimit.NewBucketWithRate(float64(limit), limit)
+	}
+
+	status, err := t.uploadStatus(ctx, url, token, checksum)
+	if err != nil {
+		return err
+	}
+	if status.Offset > 0 && !status.Complete {
+		t.Log().WithField("offset", status.Offset).Info("resuming upload of archive to destination")
+	}
+
+	// Track the upload itself rather than the archive creation.
+	up := progress.NewProgress(uint64(size))
+	up.SetWritten(uint64(status.Offset))
+	defer t.sendProgress("Uploading ", up, 5*time.Second)()
+
+	delay := uploadRetryDelay
+	for attempt := 0; !status.Complete; {
+		n := min(chunk, size-status.Offset)
+		var r io.Reader = io.NewSectionReader(ra, status.Offset, n)
+		if bucket != nil {
+			r = ratelimit.Reader(r, bucket)
+		}
+		next, err := t.uploadChunk(ctx, url, token, checksum, status.Offset, size, n, io.TeeReader(r, up))
+		if err == nil {
+			status, attempt, delay = next, 0, uploadRetryDelay
+			continue
+		}
+		if errors.Is(err, ErrUploadOffset) {
+			// The target node has received a different amount of the archive
+			// than expected, such as when the response to the last chunk was
+			// lost, so continue from wherever it is.
+			status = next
+			up.SetWritten(uint64(status.Offset))
+			continue
+		}
+		var perr *permanentUploadError
+		if errors.As(err, &perr) || ctx.Err() != nil || attempt >= cfg.UploadRetries {
+			return err
+		}
+
+		attempt++
+		t.Log().WithError(err).WithField("attempt", attempt).WithField("delay", delay).Warn("failed to upload chunk of archive to destination, retrying")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > uploadMaxRetryDelay {
+			delay = uploadMaxRetryDelay
+		}
+		// If the status cannot be retrieved either the next chunk is sent from
+		// the same offset, and the target node corrects it if it differs.
+		if next, err := t.uploadStatus(ctx, url, token, checksum); err == nil {
+			status = next
+		}
+		up.SetWritten(uint64(status.Offset))
+	}
+	up.SetWritten(uint64(size))
+	return nil
+}
+
+// permanentUploadError is an error returned by the target node for a chunk
+// that will not succeed if it is sent again.
+type permanentUploadError struct {
+	err error
+}
+
+func (e *permanentUploadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentUploadError) Unwrap() error {
+	return e.err
+}
+
+// uploadStatus returns how much of the archive with the given checksum the
+// target node has received.
+func (t *Transfer) uploadStatus(ctx context.Context, url, token, checksum string) (UploadStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, UploadURL(url), nil)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	t.setHeaders(ctx, req, token)
+	if checksum != "" {
+		req.Header.Set(UploadChecksumHeader, checksum)
+	}
+	client, err := httpClient()
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	defer res.Body.Close()
+	return decodeUploadStatus(res)
+}
+
+// uploadChunk sends n bytes read from r, starting at offset within an archive
+// of size bytes, to the target node.
+func (t *Transfer) uploadChunk(ctx context.Context, url, token, checksum string, offset, size, n int64, r io.Reader) (UploadStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, UploadURL(url), r)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	req.ContentLength = n
+	t.setHeaders(ctx, req, token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(UploadChecksumHeader, checksum)
+	req.Header.Set(UploadOffsetHeader, strconv.FormatInt(offset, 10))
+	req.Header.Set(UploadLengthHeader, strconv.FormatInt(size, 10))
+
+	client, err := httpClient()
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	defer res.Body.Close()
+	return decodeUploadStatus(res)
+}
+
+// decodeUploadStatus reads the status of an upload from a response sent by
+// the target node.
+func decodeUploadStatus(res *http.Response) (UploadStatus, error) {
+	var status UploadStatus
+	v, err := io.ReadAll(res.Body)
+	if err != nil {
+		return status, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusConflict:
+		if err := json.Unmarshal(v, &status); err != nil {
+			return status, fmt.Errorf("transfer: failed to decode upload status: %w", err)
+		}
+		if res.StatusCode == http.StatusConflict {
+			return status, ErrUploadOffset
+		}
+		return status, nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		// A 404 or 501 means the node cannot receive uploads, this is never
+		// retried and the archive is streamed to it instead.
+		return status, &permanentUploadError{ErrUploadsUnsupported}
+	case http.StatusUnprocessableEntity:
+		// The archive was corrupted on the way to the target node, which has
+		// discarded it, so it is sent again from the start.
+		return status, fmt.Errorf("%w: %s", ErrUploadChecksum, string(v))
+	default:
+		err := fmt.Errorf("%w: %s", unexpectedStatus(res), string(v))
+		if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+			return status, &permanentUploadError{err}
+		}
+		return status, err
+	}
+}
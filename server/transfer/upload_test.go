@@ -0,0 +1,145 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+)
+
+func TestUpload(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("archive uploads", func() {
+		id := "0b6f1e38-6d0e-4c4a-9d8f-3a1b2c3d4e5f"
+		archive := bytes.Repeat([]byte("archive"), 1024)
+		sum := sha256.Sum256(archive)
+		checksum := hex.EncodeToString(sum[:])
+		length := int64(len(archive))
+
+		g.BeforeEach(func() {
+			setConfig(config.SystemConfiguration{
+				ArchiveDirectory: t.TempDir(),
+				Transfers:        config.Transfers{UploadRetries: 2},
+			})
+		})
+
+		g.It("continues an upload from the bytes already received", func() {
+			status, err := ReceiveUpload(context.Background(), id, checksum, 0, length, io.LimitReader(bytes.NewReader(archive), 100))
+			g.Assert(err).IsNil()
+			g.Assert(status).Equal(UploadStatus{Offset: 100})
+
+			status, err = ReceiveUpload(context.Background(), id, checksum, 0, length, bytes.NewReader(archive))
+			g.Assert(errors.Is(err, ErrUploadOffset)).IsTrue()
+			g.Assert(status.Offset).Equal(int64(100))
+
+			status, err = ReceiveUpload(context.Background(), id, checksum, 100, length, bytes.NewReader(archive[100:]))
+			g.Assert(err).IsNil()
+			g.Assert(status).Equal(UploadStatus{Offset: length, Complete: true})
+
+			f, err := OpenUpload(id, checksum)
+			g.Assert(err).IsNil()
+			defer f.Close()
+			b, err := io.ReadAll(f)
+			g.Assert(err).IsNil()
+			g.Assert(bytes.Equal(b, archive)).IsTrue()
+		})
+
+		g.It("rejects a chunk that changes the length of the upload", func() {
+			_, err := ReceiveUpload(context.Background(), id, checksum, 0, length, io.LimitReader(bytes.NewReader(archive), 100))
+			g.Assert(err).IsNil()
+			status, err := ReceiveUpload(context.Background(), id, checksum, 100, length+1, bytes.NewReader(archive[100:]))
+			g.Assert(errors.Is(err, ErrUploadLength)).IsTrue()
+			g.Assert(status.Offset).Equal(int64(100))
+
+			RemoveUpload(id, checksum)
+			uploadLocks.mu.Lock()
+			g.Assert(len(uploadLocks.uploads)).Equal(0)
+			uploadLocks.mu.Unlock()
+			status, err = Upload(id, checksum)
+			g.Assert(err).IsNil()
+			g.Assert(status).Equal(UploadStatus{})
+		})
+
+		g.It("stops checksumming an upload once canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := ReceiveUpload(ctx, id, checksum, 0, length, bytes.NewReader(archive))
+			g.Assert(errors.Is(err, context.Canceled)).IsTrue()
+		})
+
+		g.It("discards an upload that does not match its checksum", func() {
+			corrupted := bytes.Repeat([]byte("corrupt"), 1024)
+			_, err := ReceiveUpload(context.Background(), id, checksum, 0, length, bytes.NewReader(corrupted))
+			g.Assert(errors.Is(err, ErrUploadChecksum)).IsTrue()
+
+			status, err := Upload(id, checksum)
+			g.Assert(err).IsNil()
+			g.Assert(status).Equal(UploadStatus{})
+			_, err = OpenUpload(id, checksum)
+			g.Assert(errors.Is(err, ErrUploadIncomplete)).IsTrue()
+		})
+
+		g.It("uploads an archive in chunks, retrying a chunk that was cut short", func() {
+			delay := uploadRetryDelay
+			uploadRetryDelay = time.Millisecond
+			defer func() {
+				uploadRetryDelay = delay
+			}()
+
+			var failed bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					status, _ := Upload(id, r.Header.Get(UploadChecksumHeader))
+					_ = json.NewEncoder(w).Encode(status)
+					return
+				}
+				offset, _ := strconv.ParseInt(r.Header.Get(UploadOffsetHeader), 10, 64)
+				length, _ := strconv.ParseInt(r.Header.Get(UploadLengthHeader), 10, 64)
+				body := io.Reader(r.Body)
+				if !failed {
+					failed = true
+					body = io.LimitReader(body, 10)
+				}
+				status, err := ReceiveUpload(context.Background(), id, r.Header.Get(UploadChecksumHeader), offset, length, body)
+				if err == nil && !status.Complete && status.Offset != offset+r.ContentLength {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				if errors.Is(err, ErrUploadOffset) {
+					w.WriteHeader(http.StatusConflict)
+				}
+				_ = json.NewEncoder(w).Encode(status)
+			}))
+			defer srv.Close()
+
+			store := NewLocalArchiveStore()
+			w, err := store.Create("archive.tar.gz")
+			g.Assert(err).IsNil()
+			_, err = w.Write(archive)
+			g.Assert(err).IsNil()
+			g.Assert(w.Commit()).IsNil()
+
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.uploadToTarget(context.Background(), srv.URL, "token", store, "archive.tar.gz", checksum)).IsNil()
+			g.Assert(failed).IsTrue()
+
+			status, err := Upload(id, checksum)
+			g.Assert(err).IsNil()
+			g.Assert(status.Complete).IsTrue()
+		})
+	})
+}
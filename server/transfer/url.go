@@ -0,0 +1,63 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidURL is returned when a URL sent for a transfer is not an absolute
+// HTTP or HTTPS URL with a host.
+var ErrInvalidURL = errors.New("transfer: invalid transfer URL")
+
+// ValidateURL returns ErrInvalidURL if v cannot be used to make a request to
+// another node or to object storage. The error includes the URL with any
+// credentials and query values redacted, as these are often tokens or the
+// signature of a presigned URL.
+func ValidateURL(v string) error {
+	u, err := url.Parse(v)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w \"%s\": %v", ErrInvalidURL, redactTransferURL(v), unwrapURLError(err))
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("%w \"%s\": the scheme must be http or https", ErrInvalidURL, redactTransferURL(v))
+	case u.Host == "" || u.Hostname() == "":
+		return fmt.Errorf("%w \"%s\": the URL must include a host", ErrInvalidURL, redactTransferURL(v))
+	}
+	return nil
+}
+
+// unwrapURLError returns the cause of an error from url.Parse, leaving out
+// the URL which it includes without redacting it.
+func unwrapURLError(err error) error {
+	var e *url.Error
+	if errors.As(err, &e) {
+		return e.Err
+	}
+	return err
+}
+
+// redactTransferURL returns v with the password and every query value
+// replaced. If v cannot be parsed everything from the start of the query, and
+// anything before an @, is removed instead.
+func redactTransferURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		if i := strings.LastIndex(v, "@"); i >= 0 {
+			v = "xxxxx@" + v[i+1:]
+		}
+		if i := strings.IndexByte(v, '?'); i >= 0 {
+			v = v[:i] + "?xxxxx"
+		}
+		return v
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{"xxxxx"}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,50 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestValidateURL(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ValidateURL", func() {
+		g.It("accepts absolute http and https URLs", func() {
+			g.Assert(ValidateURL("https://node.example.com:8080/api/transfers")).IsNil()
+			g.Assert(ValidateURL("http://10.0.0.2/api/transfers")).IsNil()
+		})
+
+		g.It("rejects URLs without a scheme or host", func() {
+			for _, v := range []string{"", "/api/transfers", "node.example.com/api/transfers", "https:///api/transfers", "ftp://node.example.com/archive"} {
+				err := ValidateURL(v)
+				g.Assert(errors.Is(err, ErrInvalidURL)).IsTrue()
+			}
+		})
+
+		g.It("includes the URL in the error without its credentials or query values", func() {
+			err := ValidateURL("node.example.com/archive?X-Amz-Signature=secret&token=abc")
+			g.Assert(errors.Is(err, ErrInvalidURL)).IsTrue()
+			g.Assert(strings.Contains(err.Error(), "node.example.com/archive")).IsTrue()
+			g.Assert(strings.Contains(err.Error(), "secret")).IsFalse()
+			g.Assert(strings.Contains(err.Error(), "abc")).IsFalse()
+
+			err = ValidateURL("https://user:password@/archive")
+			g.Assert(errors.Is(err, ErrInvalidURL)).IsTrue()
+			g.Assert(strings.Contains(err.Error(), "password")).IsFalse()
+
+			err = ValidateURL("https://node.example.com:port?token=abc")
+			g.Assert(errors.Is(err, ErrInvalidURL)).IsTrue()
+			g.Assert(strings.Contains(err.Error(), "abc")).IsFalse()
+		})
+
+		g.It("is checked before an archive is downloaded", func() {
+			resetConfig()
+			_, err := DownloadArchive(context.Background(), "/archive.tar.gz")
+			g.Assert(errors.Is(err, ErrInvalidURL)).IsTrue()
+		})
+	})
+}
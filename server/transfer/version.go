@@ -0,0 +1,159 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// VersionHeader is the header used by both nodes to advertise the highest
+// transfer version they support.
+const VersionHeader = "X-Transfer-Version"
+
+// Transfer versions, every version supports everything the versions before it
+// do. A version is only added for changes an older node would misinterpret
+// rather than reject, features an older node rejects are detected by the
+// source node falling back when the request fails.
+const (
+	// VersionBaseline is assumed for nodes that do not advertise a version,
+	// they only accept gzip archives that are not segmented.
+	VersionBaseline = 1
+	// VersionArchiveFormats adds uncompressed archives and archives
+	// compressed with zstd, with or without a dictionary, along with archives
+	// split into verified segments.
+	VersionArchiveFormats = 2
+	// VersionTransportCompression adds transfers sent with a gzip
+	// Content-Encoding, for archives that are not compressed themselves.
+	VersionTransportCompression = 3
+	// VersionChunkCompression adds deduplicated transfers that are chunked
+	// from the uncompressed archive, with every chunk compressed on its own.
+	VersionChunkCompression = 4
+
+	// Version is the highest version supported by this node.
+	Version = VersionChunkCompression
+	// MinVersion is the lowest version this node is still able to transfer
+	// servers with.
+	MinVersion = VersionBaseline
+)
+
+// ErrIncompatibleVersion is returned when the source and target nodes do not
+// support any transfer version in common.
+var ErrIncompatibleVersion = errors.New("transfer: incompatible transfer versions")
+
+// VersionInfo is the range of transfer versions supported by a node.
+type VersionInfo struct {
+	Version    int `json:"version"`
+	MinVersion int `json:"min_version"`
+}
+
+// Versions returns the range of transfer versions supported by this node.
+func Versions() VersionInfo {
+	return VersionInfo{Version: Version, MinVersion: MinVersion}
+}
+
+// VersionURL returns the URL used to get the transfer versions supported by
+// the target node for the given transfer URL.
+func VersionURL(url string) string {
+	return strings.TrimSuffix(url, "/") + "/version"
+}
+
+// ParseVersion returns the version in a VersionHeader, nodes that did not
+// send one are assumed to be on the baseline version.
+func ParseVersion(v string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < VersionBaseline {
+		return VersionBaseline
+	}
+	return n
+}
+
+// Negotiate returns the highest version supported by both this node and a
+// node supporting the given range of versions.
+func Negotiate(remote VersionInfo) (int, error) {
+	if remote.Version < VersionBaseline {
+		remote.Version = VersionBaseline
+	}
+	v := min(Version, remote.Version)
+	if v < MinVersion || v < remote.MinVersion {
+		return 0, fmt.Errorf("%w: this node supports versions %d to %d, the other node supports versions %d to %d", ErrIncompatibleVersion, MinVersion, Version, remote.MinVersion, remote.Version)
+	}
+	return v, nil
+}
+
+// Version returns the transfer version agreed with the target node, or the
+// version of this node if none has been negotiated.
+func (t *Transfer) Version() int {
+	if t.version == 0 {
+		return Version
+	}
+	return t.version
+}
+
+// Supports reports whether the features added in the given version can be
+// used for the transfer.
+func (t *Transfer) Supports(v int) bool {
+	return t.Version() >= v
+}
+
+// NegotiateVersion asks the target node which transfer versions it supports
+// and uses the highest version supported by both nodes for the rest of the
+// transfer. Target nodes without the version endpoint are assumed to be on the
+// baseline version, any other failure to reach the target is returned.
+// ErrIncompatibleVersion is returned if there is no version both nodes
+// support.
+func (t *Transfer) NegotiateVersion(url, token string) error {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, VersionURL(url), nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(ctx, req, token)
+
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("transfer: failed to get version of destination: %w", err)
+	}
+	defer res.Body.Close()
+	v, _ := io.ReadAll(res.Body)
+
+	remote := VersionInfo{Version: VersionBaseline, MinVersion: VersionBaseline}
+	switch res.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(v, &remote); err != nil {
+			return fmt.Errorf("transfer: failed to decode version of destination: %w", err)
+		}
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		// A 404 or 405 comes from a node that predates the version endpoint,
+		// it is assumed to only support the baseline version.
+	default:
+		return fmt.Errorf("%w: %s", unexpectedStatus(res), string(v))
+	}
+
+	version, err := Negotiate(remote)
+	if err != nil {
+		t.Log().WithError(err).Error("unable to transfer server to destination")
+		t.SendMessage(fmt.Sprintf("Error: incompatible transfer versions, the destination supports versions %d to %d and this node supports versions %d to %d.", remote.MinVersion, remote.Version, MinVersion, Version))
+		return err
+	}
+	t.version = version
+	l := t.Log().WithField("version", version).WithField("destination_version", remote.Version)
+	if version < Version {
+		l.Info("destination supports an older transfer version, falling back to its features")
+		t.SendMessage(fmt.Sprintf("Destination supports transfer version %d, using version %d features.", remote.Version, version))
+	} else {
+		l.Debug("negotiated transfer version with destination")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/franela/goblin"
+	"github.com/goccy/go-json"
+
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/server/filesystem"
+)
+
+func TestVersion(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("transfer versions", func() {
+		g.BeforeEach(func() {
+			resetConfig()
+		})
+
+		g.It("uses the highest version both nodes support", func() {
+			v, err := Negotiate(VersionInfo{Version: Version + 5, MinVersion: VersionBaseline})
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(Version)
+
+			v, err = Negotiate(VersionInfo{})
+			g.Assert(err).IsNil()
+			g.Assert(v).Equal(VersionBaseline)
+		})
+
+		g.It("refuses a node that requires a newer version", func() {
+			_, err := Negotiate(VersionInfo{Version: Version + 2, MinVersion: Version + 1})
+			g.Assert(errors.Is(err, ErrIncompatibleVersion)).IsTrue()
+		})
+
+		g.It("falls back to the baseline version for a target without the version endpoint", func() {
+			srv := httptest.NewServer(http.NotFoundHandler())
+			defer srv.Close()
+
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.Supports(VersionArchiveFormats)).IsTrue()
+			g.Assert(trnsfr.NegotiateVersion(srv.URL, "token")).IsNil()
+			g.Assert(trnsfr.Version()).Equal(VersionBaseline)
+			g.Assert(trnsfr.Supports(VersionArchiveFormats)).IsFalse()
+
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}))
+			defer srv.Close()
+			trnsfr = New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.NegotiateVersion(srv.URL, "token")).IsNil()
+			g.Assert(trnsfr.Version()).Equal(VersionBaseline)
+		})
+
+		g.It("fails when the target cannot be reached", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.NegotiateVersion(srv.URL, "token") != nil).IsTrue()
+
+			srv.Close()
+			g.Assert(trnsfr.NegotiateVersion(srv.URL, "token") != nil).IsTrue()
+			g.Assert(trnsfr.Version()).Equal(Version)
+		})
+
+		g.It("only sends gzip archives to a baseline target", func() {
+			fs, err := filesystem.New(t.TempDir(), 0, nil)
+			g.Assert(err).IsNil()
+			defer fs.UnixFS().Close()
+
+			for _, format := range []string{"tar", "zstd", "gzip"} {
+				setTransfers(config.Transfers{CompressionFormat: format})
+				trnsfr := New(context.Background(), &server.Server{})
+				trnsfr.source = &sourceSnapshot{fs: fs}
+				trnsfr.version = VersionBaseline
+				g.Assert(trnsfr.compressionFormat()).Equal(filesystem.CompressionGzip)
+
+				trnsfr.version = VersionArchiveFormats
+				g.Assert(trnsfr.compressionFormat()).Equal(filesystem.ParseCompressionFormat(format))
+			}
+		})
+
+		g.It("uses the version advertised by the target", func() {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				g.Assert(r.URL.Path).Equal("/version")
+				g.Assert(ParseVersion(r.Header.Get(VersionHeader))).Equal(Version)
+				_ = json.NewEncoder(w).Encode(Versions())
+			}))
+			defer srv.Close()
+
+			trnsfr := New(context.Background(), &server.Server{})
+			g.Assert(trnsfr.NegotiateVersion(srv.URL, "token")).IsNil()
+			g.Assert(trnsfr.Version()).Equal(Version)
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+// ErrNotWritable is returned when the directory a server will be extracted to
+// cannot be written to, for example because it is on a read-only mount.
+var ErrNotWritable = errors.New("transfer: target filesystem is not writable")
+
+// writeProbePattern returns the pattern passed to os.CreateTemp when creating
+// the file used to check a directory can be written to.
+func writeProbePattern() string {
+	pattern := filepath.Base(config.Get().System.Transfers.WriteProbePattern)
+	if pattern == "." || pattern == string(filepath.Separator) {
+		pattern = ".wings-write-probe-"
+	}
+	if !strings.Contains(pattern, "*") {
+		pattern += "*"
+	}
+	return pattern
+}
+
+// CheckWritable creates and removes a temporary file in dir, so that a
+// directory that cannot be written to is found before anything is received
+// rather than part way through extracting the archive.
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, writeProbePattern())
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrNotWritable, dir, err)
+	}
+	_ = f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrNotWritable, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+
+	"github.com/pterodactyl/wings/config"
+)
+
+func TestCheckWritable(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("CheckWritable", func() {
+		set := func(pattern string) {
+			setTransfers(config.Transfers{WriteProbePattern: pattern})
+		}
+
+		g.It("leaves nothing behind in a writable directory", func() {
+			set(".probe-*")
+			dir := t.TempDir()
+			g.Assert(CheckWritable(dir)).IsNil()
+			entries, err := os.ReadDir(dir)
+			g.Assert(err).IsNil()
+			g.Assert(len(entries)).Equal(0)
+		})
+
+		g.It("reports a directory that cannot be written to", func() {
+			set(".probe-*")
+			err := CheckWritable(filepath.Join(t.TempDir(), "missing"))
+			g.Assert(errors.Is(err, ErrNotWritable)).IsTrue()
+		})
+
+		g.It("only uses the configured pattern as a file name", func() {
+			set("../probe")
+			g.Assert(writeProbePattern()).Equal("probe*")
+			set("")
+			g.Assert(writeProbePattern()).Equal(".wings-write-probe-*")
+		})
+	})
+}